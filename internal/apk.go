@@ -2,14 +2,15 @@
 package internal
 
 import (
+    "context"
     "archive/tar"
+    "bufio"
     "bytes"
     "compress/gzip"
-    "encoding/json"
+    "errors"
     "fmt"
     "io"
     "os"
-    "os/exec"
     "path/filepath"
     "strings"
     "time"
@@ -21,7 +22,9 @@ type APK struct {
     Name       string
     Version    string
     BuildDate  time.Time
+    DataHash   string // SHA256 сегмента данных из .PKGINFO
     Info       *PackageInfo
+    pkginfo    []byte // .PKGINFO с изменениями EditMetadata
 }
 
 // APKMetadata структура метаданных .apk пакета
@@ -36,6 +39,36 @@ type APKMetadata struct {
     Depends     []string `json:"depends"`
     Provides    []string `json:"provides"`
     InstallIf   []string `json:"install_if"`
+    DataHash    string   `json:"datahash"`
+}
+
+// apkSegment сжатый gzip-поток внутри .apk. Пакет состоит из
+// последовательных потоков: подпись (необязательна), управляющая
+// часть с .PKGINFO и данные
+type apkSegment struct {
+    Offset int64 // Смещение потока в файле
+    Size   int64 // Размер сжатого потока
+}
+
+// countingReader считает прочитанные байты. Реализует io.ByteReader,
+// чтобы gzip не читал данные следующего потока наперед
+type countingReader struct {
+    r *bufio.Reader
+    n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+    n, err := c.r.Read(p)
+    c.n += int64(n)
+    return n, err
+}
+
+func (c *countingReader) ReadByte() (byte, error) {
+    b, err := c.r.ReadByte()
+    if err == nil {
+        c.n++
+    }
+    return b, err
 }
 
 // NewAPK создает новый экземпляр APK
@@ -59,10 +92,6 @@ func NewAPK(path string) (*APK, error) {
 
 // validate проверяет корректность .apk файла
 func (a *APK) validate() error {
-    if !strings.HasSuffix(a.Path, ".apk") {
-        return fmt.Errorf("invalid package format: must be .apk")
-    }
-
     fi, err := os.Stat(a.Path)
     if err != nil {
         return fmt.Errorf("failed to stat package file: %w", err)
@@ -76,33 +105,87 @@ func (a *APK) validate() error {
 }
 
 // Install устанавливает .apk пакет
-func (a *APK) Install(force bool) error {
-    if err := RequireRoot(); err != nil {
+func (a *APK) Install(ctx context.Context, opts InstallOptions) error {
+    root := opts.InstallRoot()
+    if err := RequireRoot(root); err != nil && !opts.DryRun {
+        return err
+    }
+    if err := requireBackend(TypeAPK); err != nil {
         return err
     }
 
     logger.Infof("Installing APK package: %s", a.Path)
 
+    dbPath := filepath.Join(root, "etc/apk/world")
+
     // Создаем резервную копию
-    backupPath, err := CreateBackup("/etc/apk/world")
-    if err != nil {
-        logger.Warnf("Failed to create backup: %v", err)
-    } else {
-        logger.Infof("Created backup: %s", backupPath)
+    if !opts.NoBackup && !opts.DryRun {
+        backupDatabase(dbPath, opts.Progress)
     }
 
     // Подготавливаем команду установки
     args := []string{"add"}
-    if force {
+    if opts.IsAltRoot() {
+        args = append(args, "--root", root)
+    }
+    if opts.Force {
         args = append(args, "--force-overwrite")
     }
+    if opts.NoDeps {
+        logger.Warn("apk does not support skipping dependencies, ignoring")
+    }
+    if opts.AssumeYes {
+        args = append(args, "--no-interactive")
+    }
+    if opts.AllowUntrusted {
+        args = append(args, "--allow-untrusted")
+    }
+    if opts.Offline {
+        // Зависимости ищутся только среди установленных пакетов и в
+        // кэше индексов
+        args = append(args, "--no-network")
+    }
     args = append(args, a.Path)
 
+    // apk add не переустанавливает ту же версию, это делает apk fix,
+    // но берет пакет из репозиториев, а не из файла
+    if opts.Reinstall {
+        if a.Name == "" {
+            info, err := a.GetInfo(ctx)
+            if err != nil {
+                return fmt.Errorf("failed to get package info: %w", err)
+            }
+            a.Name = info.Name
+        }
+        logger.Warnf("apk reinstalls %s from its repositories, not from %s", a.Name, a.Path)
+        args = []string{"fix", "--reinstall"}
+        if opts.IsAltRoot() {
+            args = append(args, "--root", root)
+        }
+        if opts.AssumeYes {
+            args = append(args, "--no-interactive")
+        }
+        if opts.Offline {
+            // Без сети пакет берется только из кэша apk
+            args = append(args, "--no-network")
+        }
+        args = append(args, a.Name)
+    }
+
     // Выполняем установку
-    cmd := exec.Command("apk", args...)
-    cmd.Env = append(os.Environ(), "LANG=C")
-    
-    output, err := cmd.CombinedOutput()
+    if opts.DryRun {
+        printDryRun("apk", args, dbPath, opts.NoBackup)
+        return nil
+    }
+
+    output, err := CommandRunner.Run(ctx, "apk", args...)
+    if err != nil && ctx.Err() != nil {
+        return fmt.Errorf("installation cancelled: %w", ctx.Err())
+    }
+    if err != nil && !opts.AllowUntrusted && strings.Contains(string(output), "UNTRUSTED") {
+        return fmt.Errorf("installation failed: package is not signed with a trusted key "+
+            "(add the key to /etc/apk/keys or use --allow-untrusted): %s: %w", string(output), err)
+    }
     if err != nil {
         return fmt.Errorf("installation failed: %s: %w", string(output), err)
     }
@@ -112,13 +195,17 @@ func (a *APK) Install(force bool) error {
 }
 
 // Remove удаляет установленный пакет
-func (a *APK) Remove(purge bool) error {
-    if err := RequireRoot(); err != nil {
+func (a *APK) Remove(ctx context.Context, opts RemoveOptions) error {
+    root := opts.InstallRoot()
+    if err := RequireRoot(root); err != nil && !opts.DryRun {
+        return err
+    }
+    if err := requireBackend(TypeAPK); err != nil {
         return err
     }
 
     if a.Name == "" {
-        info, err := a.GetInfo()
+        info, err := a.GetInfo(ctx)
         if err != nil {
             return fmt.Errorf("failed to get package info: %w", err)
         }
@@ -127,26 +214,42 @@ func (a *APK) Remove(purge bool) error {
 
     logger.Infof("Removing APK package: %s", a.Name)
 
+    dbPath := filepath.Join(root, "etc/apk/world")
+
     // Создаем резервную копию
-    backupPath, err := CreateBackup("/etc/apk/world")
-    if err != nil {
-        logger.Warnf("Failed to create backup: %v", err)
-    } else {
-        logger.Infof("Created backup: %s", backupPath)
+    if !opts.NoBackup && !opts.DryRun {
+        backupDatabase(dbPath, opts.Progress)
     }
 
     // Подготавливаем команду удаления
     args := []string{"del"}
-    if purge {
+    if opts.Purge {
         args = append(args, "--purge")
     }
+    if opts.IsAltRoot() {
+        args = append(args, "--root", root)
+    }
+    if opts.Force {
+        args = append(args, "--force-broken-world")
+    }
+    if opts.NoDeps {
+        logger.Warn("apk does not support skipping dependencies, ignoring")
+    }
+    if opts.AssumeYes {
+        args = append(args, "--no-interactive")
+    }
     args = append(args, a.Name)
 
     // Выполняем удаление
-    cmd := exec.Command("apk", args...)
-    cmd.Env = append(os.Environ(), "LANG=C")
-    
-    output, err := cmd.CombinedOutput()
+    if opts.DryRun {
+        printDryRun("apk", args, dbPath, opts.NoBackup)
+        return nil
+    }
+
+    output, err := CommandRunner.Run(ctx, "apk", args...)
+    if err != nil && ctx.Err() != nil {
+        return fmt.Errorf("removal cancelled: %w", ctx.Err())
+    }
     if err != nil {
         return fmt.Errorf("removal failed: %s: %w", string(output), err)
     }
@@ -156,48 +259,20 @@ func (a *APK) Remove(purge bool) error {
 }
 
 // GetInfo возвращает информацию о пакете
-func (a *APK) GetInfo() (*PackageInfo, error) {
+func (a *APK) GetInfo(ctx context.Context) (*PackageInfo, error) {
     if a.Info != nil {
         return a.Info, nil
     }
 
-    // Открываем .apk файл
-    f, err := os.Open(a.Path)
-    if err != nil {
-        return nil, fmt.Errorf("failed to open package: %w", err)
+    cached, hash := loadCachedInfo(a.Path, TypeAPK)
+    if cached != nil {
+        a.Info = cached
+        return cached, nil
     }
-    defer f.Close()
 
-    // Читаем архив
-    gzr, err := gzip.NewReader(f)
+    control, err := readAPKControl(a.Path)
     if err != nil {
-        return nil, fmt.Errorf("failed to create gzip reader: %w", err)
-    }
-    defer gzr.Close()
-
-    tr := tar.NewReader(gzr)
-
-    var metadata APKMetadata
-    var control []byte
-
-    // Ищем .PKGINFO файл
-    for {
-        header, err := tr.Next()
-        if err == io.EOF {
-            break
-        }
-        if err != nil {
-            return nil, fmt.Errorf("failed to read tar header: %w", err)
-        }
-
-        if header.Name == ".PKGINFO" {
-            buf := new(bytes.Buffer)
-            if _, err := io.Copy(buf, tr); err != nil {
-                return nil, fmt.Errorf("failed to read .PKGINFO: %w", err)
-            }
-            control = buf.Bytes()
-            break
-        }
+        return nil, err
     }
 
     if control == nil {
@@ -205,6 +280,7 @@ func (a *APK) GetInfo() (*PackageInfo, error) {
     }
 
     // Парсим метаданные
+    var metadata APKMetadata
     if err := parseAPKMetadata(control, &metadata); err != nil {
         return nil, fmt.Errorf("failed to parse metadata: %w", err)
     }
@@ -217,25 +293,181 @@ func (a *APK) GetInfo() (*PackageInfo, error) {
         Description:  metadata.Description,
         Maintainer:   metadata.Maintainer,
         Homepage:     metadata.URL,
-        Size:         metadata.Size,
+        Size:         fileSize(a.Path),
+        InstalledSize: metadata.Size,
         Dependencies: metadata.Depends,
         Provides:     metadata.Provides,
         InstallDate:  a.BuildDate,
     }
 
-    // Получаем размер файла
-    if fi, err := os.Stat(a.Path); err == nil {
-        info.Size = fi.Size()
-    }
-
+    a.DataHash = metadata.DataHash
+    storeCachedInfo(hash, TypeAPK, info)
     a.Info = info
     return info, nil
 }
 
+// apkSegments возвращает границы gzip-потоков пакета
+func apkSegments(path string) ([]apkSegment, error) {
+    f, err := os.Open(path)
+    if err != nil {
+        return nil, fmt.Errorf("failed to open package: %w", err)
+    }
+    defer f.Close()
+
+    cr := &countingReader{r: bufio.NewReader(f)}
+    var segments []apkSegment
+    var gzr *gzip.Reader
+    for {
+        if _, err := cr.r.Peek(1); err == io.EOF {
+            break
+        }
+
+        start := cr.n
+        if gzr == nil {
+            gzr, err = gzip.NewReader(cr)
+        } else {
+            err = gzr.Reset(cr)
+        }
+        if err != nil {
+            return nil, fmt.Errorf("%w: segment %d: %v", ErrCorruptedPackage, len(segments), err)
+        }
+        gzr.Multistream(false)
+
+        if _, err := io.Copy(io.Discard, gzr); err != nil {
+            return nil, fmt.Errorf("%w: segment %d: %v", ErrCorruptedPackage, len(segments), err)
+        }
+        segments = append(segments, apkSegment{Offset: start, Size: cr.n - start})
+    }
+
+    if len(segments) == 0 {
+        return nil, ErrEmptyPackage
+    }
+    return segments, nil
+}
+
+// walkAPKSegments вызывает fn для tar архива каждого gzip-потока пакета
+// по порядку. Сегменты разбираются по отдельности: tar подписи и
+// управляющей части может завершаться собственным маркером конца
+// архива. fn может не дочитывать сегмент; если fn вернет done, обход
+// прекращается
+func walkAPKSegments(path string, fn func(tr *tar.Reader) (done bool, err error)) error {
+    f, err := os.Open(path)
+    if err != nil {
+        return fmt.Errorf("failed to open package: %w", err)
+    }
+    defer f.Close()
+
+    cr := &countingReader{r: bufio.NewReader(f)}
+    var gzr *gzip.Reader
+    for {
+        if _, err := cr.r.Peek(1); err == io.EOF {
+            return nil
+        }
+
+        if gzr == nil {
+            gzr, err = gzip.NewReader(cr)
+        } else {
+            err = gzr.Reset(cr)
+        }
+        if err != nil {
+            return fmt.Errorf("failed to create gzip reader: %w", err)
+        }
+        gzr.Multistream(false)
+
+        done, err := fn(tar.NewReader(gzr))
+        if err != nil || done {
+            return err
+        }
+
+        // Дочитываем поток, чтобы перейти к следующему
+        if _, err := io.Copy(io.Discard, gzr); err != nil {
+            return fmt.Errorf("failed to read package: %w", err)
+        }
+    }
+}
+
+// readAPKControl читает .PKGINFO, возвращает nil, если файла нет
+func readAPKControl(path string) ([]byte, error) {
+    var control []byte
+    err := walkAPKSegments(path, func(tr *tar.Reader) (bool, error) {
+        for {
+            header, err := tr.Next()
+            if err == io.EOF {
+                return false, nil
+            }
+            if err != nil {
+                return false, fmt.Errorf("failed to read tar header: %w", err)
+            }
+            if header.Name == ".PKGINFO" {
+                buf := new(bytes.Buffer)
+                if _, err := io.Copy(buf, tr); err != nil {
+                    return false, fmt.Errorf("failed to read .PKGINFO: %w", err)
+                }
+                control = buf.Bytes()
+                return true, nil
+            }
+        }
+    })
+    return control, err
+}
+
+// segmentHasEntry проверяет, является ли первая запись сегмента name
+func segmentHasEntry(f *os.File, seg apkSegment, name string) bool {
+    return segmentFirstEntry(f, seg) == name
+}
+
+// segmentFirstEntry возвращает имя первой записи сегмента или пустую
+// строку, если сегмент не читается
+func segmentFirstEntry(f *os.File, seg apkSegment) string {
+    gzr, err := gzip.NewReader(io.NewSectionReader(f, seg.Offset, seg.Size))
+    if err != nil {
+        return ""
+    }
+    defer gzr.Close()
+
+    header, err := tar.NewReader(gzr).Next()
+    if err != nil {
+        return ""
+    }
+    return header.Name
+}
+
+// verifyDataHash сверяет SHA256 сегмента данных с datahash из .PKGINFO
+func (a *APK) verifyDataHash() error {
+    segments, err := apkSegments(a.Path)
+    if err != nil {
+        return err
+    }
+
+    f, err := os.Open(a.Path)
+    if err != nil {
+        return fmt.Errorf("failed to open package: %w", err)
+    }
+    defer f.Close()
+
+    // Данные следуют за управляющим сегментом
+    for i, seg := range segments[:len(segments)-1] {
+        if !segmentHasEntry(f, seg, ".PKGINFO") {
+            continue
+        }
+
+        data := segments[i+1]
+        sum, err := CalculateReaderHash(io.NewSectionReader(f, data.Offset, data.Size))
+        if err != nil {
+            return err
+        }
+        if !strings.EqualFold(sum, a.DataHash) {
+            return fmt.Errorf("%w: data segment checksum mismatch", ErrCorruptedPackage)
+        }
+        return nil
+    }
+
+    return fmt.Errorf("%w: data segment not found", ErrCorruptedPackage)
+}
+
 // parseAPKMetadata парсит метаданные .apk пакета
 func parseAPKMetadata(data []byte, metadata *APKMetadata) error {
     lines := strings.Split(string(data), "\n")
-    current := make(map[string]string)
 
     for _, line := range lines {
         line = strings.TrimSpace(line)
@@ -257,7 +489,7 @@ func parseAPKMetadata(data []byte, metadata *APKMetadata) error {
         case "pkgver":
             metadata.Version = value
         case "arch":
-            metadata.Architecture = value
+            metadata.Arch = value
         case "maintainer":
             metadata.Maintainer = value
         case "pkgdesc":
@@ -274,6 +506,8 @@ func parseAPKMetadata(data []byte, metadata *APKMetadata) error {
             metadata.Provides = append(metadata.Provides, value)
         case "install_if":
             metadata.InstallIf = append(metadata.InstallIf, value)
+        case "datahash":
+            metadata.DataHash = value
         }
     }
 
@@ -287,11 +521,69 @@ func parseInt64(s string) (int64, error) {
     return result, err
 }
 
+// ListFiles возвращает список файлов пакета без служебных файлов
+// (.PKGINFO, .SIGN.*, скрипты установки)
+func (a *APK) ListFiles() ([]FileInfo, error) {
+    var files []FileInfo
+    err := walkAPKSegments(a.Path, func(tr *tar.Reader) (bool, error) {
+        segment, err := listTarFiles(tr, isMetadataEntry)
+        files = append(files, segment...)
+        return false, err
+    })
+    if err != nil {
+        return nil, err
+    }
+    return files, nil
+}
+
+// Verify проверяет целостность пакета: все сегменты распаковываются,
+// .PKGINFO разбирается, SHA1 файлов совпадают с записанными apk-tools
+// в PAX заголовках, а SHA256 сегмента данных - с datahash
+func (a *APK) Verify() error {
+    err := walkAPKSegments(a.Path, func(tr *tar.Reader) (bool, error) {
+        return false, verifyTarEntries(tr, func(name string, header *tar.Header) (string, int64) {
+            return header.PAXRecords["APK-TOOLS.checksum.SHA1"], header.Size
+        })
+    })
+    if err != nil {
+        if errors.Is(err, ErrCorruptedPackage) {
+            return err
+        }
+        return fmt.Errorf("%w: %v", ErrCorruptedPackage, err)
+    }
+
+    if _, err := a.GetInfo(context.Background()); err != nil {
+        return fmt.Errorf("%w: %v", ErrCorruptedPackage, err)
+    }
+
+    if a.DataHash != "" {
+        return a.verifyDataHash()
+    }
+    return nil
+}
+
+// Extract распаковывает файлы пакета в dest без служебных файлов
+func (a *APK) Extract(dest string) error {
+    absDest, err := prepareExtractDir(dest)
+    if err != nil {
+        return err
+    }
+
+    return walkAPKSegments(a.Path, func(tr *tar.Reader) (bool, error) {
+        return false, extractTar(tr, absDest, isMetadataEntry)
+    })
+}
+
 // GetType возвращает тип пакета
 func (a *APK) GetType() PackageType {
     return TypeAPK
 }
 
+// Comparator возвращает компаратор версий
+func (a *APK) Comparator() VersionComparator {
+    return APKVersion{}
+}
+
 // String возвращает строковое представление пакета
 func (a *APK) String() string {
     if a.Info != nil {
@@ -0,0 +1,122 @@
+package internal
+
+import (
+    "context"
+    "crypto/sha256"
+    "encoding/hex"
+    "errors"
+    "reflect"
+    "strings"
+    "testing"
+)
+
+func TestAPKDataHash(t *testing.T) {
+    path := buildTestAPK(t, t.TempDir(), "")
+    pkg, err := NewAPK(path)
+    if err != nil {
+        t.Fatal(err)
+    }
+    if _, err := pkg.GetInfo(context.Background()); err != nil {
+        t.Fatalf("GetInfo: %v", err)
+    }
+    if len(pkg.DataHash) != hex.EncodedLen(sha256.Size) {
+        t.Errorf("DataHash = %q, want a SHA256", pkg.DataHash)
+    }
+    if err := pkg.Verify(); err != nil {
+        t.Errorf("Verify: %v", err)
+    }
+}
+
+func TestAPKVerifyDataHashMismatch(t *testing.T) {
+    path := buildTestAPK(t, t.TempDir(), strings.Repeat("0", 64))
+    pkg, err := NewAPK(path)
+    if err != nil {
+        t.Fatal(err)
+    }
+    err = pkg.Verify()
+    if !errors.Is(err, ErrCorruptedPackage) || !strings.Contains(err.Error(), "checksum mismatch") {
+        t.Errorf("Verify = %v, want a data checksum mismatch", err)
+    }
+}
+
+func TestAPKGetInfoThreeSegments(t *testing.T) {
+    path := buildTestAPK(t, t.TempDir(), "")
+
+    segments, err := apkSegments(path)
+    if err != nil {
+        t.Fatalf("apkSegments: %v", err)
+    }
+    if len(segments) != 3 {
+        t.Fatalf("got %d segments, want 3", len(segments))
+    }
+
+    pkg, err := NewAPK(path)
+    if err != nil {
+        t.Fatal(err)
+    }
+    info, err := pkg.GetInfo(context.Background())
+    if err != nil {
+        t.Fatalf("GetInfo: %v", err)
+    }
+    if info.Name != "hello" || info.Version != "1.0-r0" || info.Architecture != "x86_64" {
+        t.Errorf("info = %s %s %s, want hello 1.0-r0 x86_64", info.Name, info.Version, info.Architecture)
+    }
+    if want := []string{"so:libc.musl-x86_64.so.1"}; !reflect.DeepEqual(info.Dependencies, want) {
+        t.Errorf("dependencies = %q, want %q", info.Dependencies, want)
+    }
+
+    files, err := pkg.ListFiles()
+    if err != nil {
+        t.Fatalf("ListFiles: %v", err)
+    }
+    if len(files) != 1 || files[0].Path != "/usr/bin/hello" {
+        t.Errorf("files = %+v, want only /usr/bin/hello", files)
+    }
+}
+
+func TestAPKInstallArgs(t *testing.T) {
+    path := buildTestAPK(t, t.TempDir(), "")
+    tests := []struct {
+        name string
+        opts InstallOptions
+        want []string
+    }{
+        {"signed", InstallOptions{}, []string{"apk", "add", path}},
+        {"allow untrusted", InstallOptions{AllowUntrusted: true}, []string{"apk", "add", "--allow-untrusted", path}},
+        {"root", InstallOptions{Root: "/mnt", AllowUntrusted: true}, []string{"apk", "add", "--root", "/mnt", "--allow-untrusted", path}},
+        {"force", InstallOptions{Force: true}, []string{"apk", "add", "--force-overwrite", path}},
+        {"offline", InstallOptions{Offline: true, AssumeYes: true}, []string{"apk", "add", "--no-interactive", "--no-network", path}},
+    }
+
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            runner := useFakeRunner(t, "apk")
+            pkg, err := NewAPK(path)
+            if err != nil {
+                t.Fatal(err)
+            }
+            tt.opts.NoBackup = true
+            if err := pkg.Install(context.Background(), tt.opts); err != nil {
+                t.Fatalf("Install: %v", err)
+            }
+            assertCalls(t, runner, tt.want)
+        })
+    }
+}
+
+func TestAPKInstallUntrustedError(t *testing.T) {
+    path := buildTestAPK(t, t.TempDir(), "")
+    runner := useFakeRunner(t, "apk")
+    line := "apk add " + path
+    runner.outputs[line] = []byte("ERROR: hello-1.0-r0.apk: UNTRUSTED signature")
+    runner.fail[line] = true
+
+    pkg, err := NewAPK(path)
+    if err != nil {
+        t.Fatal(err)
+    }
+    err = pkg.Install(context.Background(), InstallOptions{NoBackup: true})
+    if err == nil || !strings.Contains(err.Error(), "--allow-untrusted") {
+        t.Errorf("Install = %v, want a hint about --allow-untrusted", err)
+    }
+}
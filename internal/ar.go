@@ -0,0 +1,124 @@
+// internal/ar.go
+package internal
+
+import (
+    "bufio"
+    "bytes"
+    "fmt"
+    "io"
+    "strconv"
+    "strings"
+    "time"
+)
+
+// Размер заголовка члена ar архива
+const arHeaderSize = 60
+
+// arHeader заголовок члена ar архива
+type arHeader struct {
+    Name string
+    Size int64
+    Mode int64
+}
+
+// arReader последовательно читает члены ar архива (формат .deb)
+type arReader struct {
+    r       *bufio.Reader
+    remain  int64
+    padding int64
+}
+
+// newArReader проверяет глобальный заголовок и возвращает arReader
+func newArReader(r io.Reader) (*arReader, error) {
+    br := bufio.NewReader(r)
+
+    magic := make([]byte, len(magicAr))
+    if _, err := io.ReadFull(br, magic); err != nil {
+        return nil, fmt.Errorf("failed to read ar header: %w", err)
+    }
+    if !bytes.Equal(magic, magicAr) {
+        return nil, ErrInvalidFormat
+    }
+
+    return &arReader{r: br}, nil
+}
+
+// Next переходит к следующему члену архива
+func (ar *arReader) Next() (*arHeader, error) {
+    // Пропускаем непрочитанные данные предыдущего члена и выравнивание
+    if skip := ar.remain + ar.padding; skip > 0 {
+        if _, err := io.CopyN(io.Discard, ar.r, skip); err != nil {
+            return nil, fmt.Errorf("failed to skip ar member: %w", err)
+        }
+    }
+    ar.remain, ar.padding = 0, 0
+
+    buf := make([]byte, arHeaderSize)
+    if _, err := io.ReadFull(ar.r, buf); err != nil {
+        if err == io.EOF {
+            return nil, io.EOF
+        }
+        return nil, fmt.Errorf("failed to read ar member header: %w", err)
+    }
+
+    if buf[58] != '`' || buf[59] != '\n' {
+        return nil, ErrCorruptedPackage
+    }
+
+    size, err := strconv.ParseInt(strings.TrimSpace(string(buf[48:58])), 10, 64)
+    if err != nil {
+        return nil, fmt.Errorf("invalid ar member size: %w", err)
+    }
+    mode, _ := strconv.ParseInt(strings.TrimSpace(string(buf[40:48])), 8, 64)
+
+    header := &arHeader{
+        // GNU ar завершает имена символом "/"
+        Name: strings.TrimSuffix(strings.TrimSpace(string(buf[0:16])), "/"),
+        Size: size,
+        Mode: mode,
+    }
+
+    ar.remain = size
+    ar.padding = size % 2
+    return header, nil
+}
+
+// Read читает данные текущего члена архива
+func (ar *arReader) Read(p []byte) (int, error) {
+    if ar.remain <= 0 {
+        return 0, io.EOF
+    }
+    if int64(len(p)) > ar.remain {
+        p = p[:ar.remain]
+    }
+    n, err := ar.r.Read(p)
+    ar.remain -= int64(n)
+    if err == io.EOF && ar.remain > 0 {
+        err = io.ErrUnexpectedEOF
+    }
+    return n, err
+}
+
+// writeArMember записывает член ar архива: заголовок, size байт из r
+// и выравнивание до четной границы
+func writeArMember(w io.Writer, name string, mode, size int64, r io.Reader) error {
+    if mode == 0 {
+        mode = 0100644
+    }
+    header := fmt.Sprintf("%-16s%-12d%-6d%-6d%-8o%-10d`\n", name, time.Now().Unix(), 0, 0, mode, size)
+    if len(header) != arHeaderSize {
+        return fmt.Errorf("ar member name too long: %s", name)
+    }
+    if _, err := io.WriteString(w, header); err != nil {
+        return fmt.Errorf("failed to write ar member header: %w", err)
+    }
+    if _, err := io.CopyN(w, r, size); err != nil {
+        return fmt.Errorf("failed to write ar member %s: %w", name, err)
+    }
+    if size%2 != 0 {
+        if _, err := w.Write([]byte{'\n'}); err != nil {
+            return fmt.Errorf("failed to write ar member %s: %w", name, err)
+        }
+    }
+    return nil
+}
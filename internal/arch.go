@@ -0,0 +1,56 @@
+// internal/arch.go
+package internal
+
+import (
+    "fmt"
+    "runtime"
+    "strings"
+)
+
+// ErrArchMismatch архитектура пакета не совпадает с архитектурой системы
+var ErrArchMismatch = &PackageError{Code: ErrSystemIncompatible, Message: "package architecture does not match host"}
+
+// hostArchNames имена архитектуры в форматах пакетов для каждого GOARCH
+var hostArchNames = map[string][]string{
+    "amd64":   {"amd64", "x86_64"},
+    "386":     {"i386", "i486", "i586", "i686", "x86"},
+    "arm64":   {"arm64", "aarch64"},
+    "arm":     {"arm", "armhf", "armel", "armv7", "armv7h", "armv7hl", "armv7l"},
+    "ppc64le": {"ppc64le", "ppc64el"},
+    "s390x":   {"s390x"},
+    "riscv64": {"riscv64"},
+}
+
+// archIndependent архитектуры, подходящие для любой системы
+var archIndependent = map[string]bool{
+    "":       true,
+    "all":    true,
+    "any":    true,
+    "noarch": true,
+}
+
+// CheckArchitecture проверяет, что пакет можно установить на текущую
+// систему. Архитектурно-независимые пакеты проходят всегда
+func CheckArchitecture(info *PackageInfo) error {
+    return checkArchitecture(info.Architecture, runtime.GOARCH)
+}
+
+// checkArchitecture сравнивает архитектуру пакета с GOARCH
+func checkArchitecture(arch, goarch string) error {
+    arch = strings.ToLower(strings.TrimSpace(arch))
+    if archIndependent[arch] {
+        return nil
+    }
+
+    for _, name := range hostArchNames[goarch] {
+        if arch == name {
+            return nil
+        }
+    }
+    // Неизвестный GOARCH сравнивается по имени
+    if arch == goarch {
+        return nil
+    }
+
+    return fmt.Errorf("%w: package is %s, host is %s", ErrArchMismatch, arch, goarch)
+}
@@ -0,0 +1,51 @@
+package internal
+
+import (
+    "errors"
+    "runtime"
+    "testing"
+)
+
+func TestCheckArchitecture(t *testing.T) {
+    tests := []struct {
+        arch    string
+        goarch  string
+        wantErr bool
+    }{
+        {"amd64", "amd64", false},
+        {"x86_64", "amd64", false},
+        {"X86_64", "amd64", false},
+        {"aarch64", "arm64", false},
+        {"arm64", "arm64", false},
+        {"armv7h", "arm", false},
+        {"i686", "386", false},
+        {"all", "arm64", false},
+        {"any", "amd64", false},
+        {"noarch", "riscv64", false},
+        {"", "amd64", false},
+        {"loong64", "loong64", false},
+        {"aarch64", "amd64", true},
+        {"x86_64", "arm64", true},
+        {"i686", "amd64", true},
+        {"armhf", "arm64", true},
+    }
+
+    for _, tt := range tests {
+        err := checkArchitecture(tt.arch, tt.goarch)
+        if (err != nil) != tt.wantErr {
+            t.Errorf("checkArchitecture(%q, %q) = %v, wantErr %v", tt.arch, tt.goarch, err, tt.wantErr)
+        }
+        if err != nil && !errors.Is(err, ErrArchMismatch) {
+            t.Errorf("checkArchitecture(%q, %q) = %v, want ErrArchMismatch", tt.arch, tt.goarch, err)
+        }
+    }
+}
+
+func TestCheckArchitectureHost(t *testing.T) {
+    if err := CheckArchitecture(&PackageInfo{Architecture: runtime.GOARCH}); err != nil {
+        t.Errorf("CheckArchitecture(%s) = %v", runtime.GOARCH, err)
+    }
+    if err := CheckArchitecture(&PackageInfo{Architecture: "noarch"}); err != nil {
+        t.Errorf("CheckArchitecture(noarch) = %v", err)
+    }
+}
@@ -0,0 +1,326 @@
+// internal/backup.go
+package internal
+
+import (
+    "archive/tar"
+    "compress/gzip"
+    "fmt"
+    "io"
+    "os"
+    "path/filepath"
+    "regexp"
+    "sort"
+    "strconv"
+    "time"
+)
+
+// backupNameRe имя архива CreateBackup: <имя>-<YYYYMMDD-HHMMSS>[-N].tar.gz
+var backupNameRe = regexp.MustCompile(`^(.+)-(\d{8}-\d{6})(?:-(\d+))?\.tar\.gz$`)
+
+// partialBackupMarker запись, отмечающая копию только ключевых файлов
+const partialBackupMarker = ".upkgt-partial"
+
+// backupEssentials ключевые файлы баз пакетных менеджеров, которые
+// сохраняются, когда база целиком превышает BackupMaxSize
+var backupEssentials = map[string][]string{
+    "dpkg":   {"status", "diversions", "statoverride"},
+    "rpm":    {"rpmdb.sqlite", "Packages"},
+    "pacman": {"local"},
+}
+
+// BackupInfo описание резервной копии
+type BackupInfo struct {
+    Path   string    // Путь к архиву
+    Name   string    // Имя скопированного файла или каталога
+    Source string    // Исходный путь, если сохранен в архиве
+    Time   time.Time // Время создания
+    Size   int64     // Размер архива
+
+    seq int // Суффикс копий, созданных в одну секунду
+}
+
+// ListBackups возвращает резервные копии из BackupDir, от новых к старым
+func ListBackups() ([]BackupInfo, error) {
+    entries, err := os.ReadDir(BackupDir)
+    if os.IsNotExist(err) {
+        return nil, nil
+    }
+    if err != nil {
+        return nil, fmt.Errorf("failed to read backup directory: %w", err)
+    }
+
+    var result []BackupInfo
+    for _, entry := range entries {
+        m := backupNameRe.FindStringSubmatch(entry.Name())
+        if m == nil || !entry.Type().IsRegular() {
+            continue
+        }
+
+        created, err := time.ParseInLocation("20060102-150405", m[2], time.Local)
+        if err != nil {
+            continue
+        }
+
+        info := BackupInfo{
+            Path: filepath.Join(BackupDir, entry.Name()),
+            Name: m[1],
+            Time: created,
+        }
+        if m[3] != "" {
+            info.seq, _ = strconv.Atoi(m[3])
+        }
+        if fi, err := entry.Info(); err == nil {
+            info.Size = fi.Size()
+        }
+        info.Source = backupSource(info.Path)
+        result = append(result, info)
+    }
+
+    sort.Slice(result, func(i, j int) bool {
+        if !result[i].Time.Equal(result[j].Time) {
+            return result[i].Time.After(result[j].Time)
+        }
+        return result[i].seq > result[j].seq
+    })
+    return result, nil
+}
+
+// backupSource возвращает исходный путь из заголовка gzip архива
+func backupSource(path string) string {
+    f, err := os.Open(path)
+    if err != nil {
+        return ""
+    }
+    defer f.Close()
+
+    gzr, err := gzip.NewReader(f)
+    if err != nil {
+        return ""
+    }
+    defer gzr.Close()
+    return gzr.Comment
+}
+
+// RestoreBackup восстанавливает резервную копию CreateBackup в dest.
+// Если dest пуст, используется исходный путь, сохраненный в архиве.
+// Перед заменой архив полностью проверяется, а текущее состояние
+// dest сохраняется в новую резервную копию. Копия только ключевых
+// файлов заменяет их, не затрагивая остальное содержимое dest.
+// progress, если задан, получает прогресс распаковки архива
+func RestoreBackup(backupPath, dest string, progress ProgressFunc) error {
+    partial, err := validateBackup(backupPath)
+    if err != nil {
+        return fmt.Errorf("backup %s is not usable: %w", backupPath, err)
+    }
+
+    if dest == "" {
+        dest = backupSource(backupPath)
+        if dest == "" {
+            return fmt.Errorf("backup %s does not record its source, destination required", backupPath)
+        }
+    }
+    dest, err = filepath.Abs(dest)
+    if err != nil {
+        return fmt.Errorf("failed to get absolute path: %w", err)
+    }
+    if dest == "/" {
+        return fmt.Errorf("refusing to restore over /")
+    }
+
+    // Страховочная копия текущего состояния
+    if _, err := os.Lstat(dest); err == nil {
+        safety, err := CreateBackup(dest, nil)
+        if err != nil {
+            return fmt.Errorf("failed to back up current state: %w", err)
+        }
+        if safety == "" {
+            return fmt.Errorf("failed to back up current state of %s", dest)
+        }
+        logger.Infof("Saved current state of %s to %s", dest, safety)
+    }
+
+    // Распаковываем рядом с dest, чтобы замена была атомарной заменой имени
+    staging := dest + ".upkgt-restore"
+    if err := os.RemoveAll(staging); err != nil {
+        return fmt.Errorf("failed to clean staging path: %w", err)
+    }
+    defer os.RemoveAll(staging)
+
+    if err := extractBackup(backupPath, staging, progress); err != nil {
+        return err
+    }
+
+    if partial {
+        entries, err := os.ReadDir(staging)
+        if err != nil {
+            return fmt.Errorf("failed to read staging path: %w", err)
+        }
+        for _, entry := range entries {
+            if err := replacePath(filepath.Join(staging, entry.Name()), filepath.Join(dest, entry.Name())); err != nil {
+                return err
+            }
+        }
+        logger.Infof("Restored %d entries of %s from %s", len(entries), dest, backupPath)
+        return nil
+    }
+
+    if err := replacePath(staging, dest); err != nil {
+        return err
+    }
+
+    logger.Infof("Restored %s from %s", dest, backupPath)
+    return nil
+}
+
+// replacePath заменяет dest на src, сохраняя dest до успешной замены
+func replacePath(src, dest string) error {
+    old := dest + ".upkgt-old"
+    if err := os.RemoveAll(old); err != nil {
+        return fmt.Errorf("failed to clean old path: %w", err)
+    }
+    if _, err := os.Lstat(dest); err == nil {
+        if err := os.Rename(dest, old); err != nil {
+            return fmt.Errorf("failed to move current state aside: %w", err)
+        }
+    }
+    if err := os.Rename(src, dest); err != nil {
+        os.Rename(old, dest)
+        return fmt.Errorf("failed to restore backup: %w", err)
+    }
+
+    if err := os.RemoveAll(old); err != nil {
+        logger.Warnf("Failed to remove previous state %s: %v", old, err)
+    }
+    return nil
+}
+
+// validateBackup читает архив целиком, проверяя gzip, tar и пути записей.
+// Сообщает, является ли копия частичной
+func validateBackup(path string) (bool, error) {
+    f, err := os.Open(path)
+    if err != nil {
+        return false, err
+    }
+    defer f.Close()
+
+    gzr, err := gzip.NewReader(f)
+    if err != nil {
+        return false, fmt.Errorf("%w: %v", ErrCorruptedPackage, err)
+    }
+    defer gzr.Close()
+
+    tr := tar.NewReader(gzr)
+    entries := 0
+    partial := false
+    for {
+        header, err := tr.Next()
+        if err == io.EOF {
+            break
+        }
+        if err != nil {
+            return false, fmt.Errorf("%w: %v", ErrCorruptedPackage, err)
+        }
+        if header.Name == partialBackupMarker {
+            partial = true
+            continue
+        }
+        if _, err := safeJoin("/", header.Name); err != nil {
+            return false, err
+        }
+        if _, err := io.Copy(io.Discard, tr); err != nil {
+            return false, fmt.Errorf("%w: %v", ErrCorruptedPackage, err)
+        }
+        entries++
+    }
+
+    if entries == 0 {
+        return false, ErrEmptyPackage
+    }
+    return partial, nil
+}
+
+// extractBackup распаковывает архив в dst. Копия одного файла
+// состоит из записи "." и распаковывается в файл dst
+func extractBackup(path, dst string, progress ProgressFunc) error {
+    f, err := os.Open(path)
+    if err != nil {
+        return fmt.Errorf("failed to open backup: %w", err)
+    }
+    defer f.Close()
+
+    tracker := newProgressTracker(fileSize(path), progress)
+    gzr, err := gzip.NewReader(tracker.wrap(f))
+    if err != nil {
+        return fmt.Errorf("failed to decompress backup: %w", err)
+    }
+    defer gzr.Close()
+
+    err = extractTar(tar.NewReader(gzr), dst, func(name string) bool {
+        return name == partialBackupMarker
+    })
+    if err != nil {
+        return err
+    }
+    tracker.finish()
+    return nil
+}
+
+// backupDatabase создает резервную копию базы пакетного менеджера и
+// удаляет устаревшие копии. Ошибки не прерывают установку или удаление
+func backupDatabase(path string, progress ProgressFunc) {
+    backupPath, err := CreateBackup(path, progress)
+    if err != nil {
+        logger.Warnf("Failed to create backup: %v", err)
+        return
+    }
+    if backupPath == "" {
+        return
+    }
+    logger.Infof("Created backup: %s", backupPath)
+
+    if err := PruneBackups(BackupKeep, BackupMaxAge); err != nil {
+        logger.Warnf("Failed to prune backups: %v", err)
+    }
+}
+
+// PruneBackups удаляет резервные копии сверх keep последних для каждого
+// источника, а также копии старше maxAge. Самая свежая копия источника
+// сохраняется всегда. Нулевые keep и maxAge отключают соответствующее
+// ограничение
+func PruneBackups(keep int, maxAge time.Duration) error {
+    backups, err := ListBackups()
+    if err != nil {
+        return err
+    }
+
+    var reclaimed int64
+    var removed int
+    seen := make(map[string]int)
+    for _, backup := range backups {
+        source := backup.Source
+        if source == "" {
+            source = backup.Name
+        }
+
+        // ListBackups возвращает копии от новых к старым
+        index := seen[source]
+        seen[source]++
+
+        expired := maxAge > 0 && time.Since(backup.Time) > maxAge
+        if index == 0 || ((keep <= 0 || index < keep) && !expired) {
+            continue
+        }
+
+        if err := os.Remove(backup.Path); err != nil {
+            return fmt.Errorf("failed to remove backup: %w", err)
+        }
+        logger.Debugf("Removed backup %s", backup.Path)
+        reclaimed += backup.Size
+        removed++
+    }
+
+    if removed > 0 {
+        logger.Infof("Removed %d old backups, reclaimed %s", removed, FormatSize(reclaimed))
+    }
+    return nil
+}
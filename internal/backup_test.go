@@ -0,0 +1,38 @@
+package internal
+
+import (
+    "os"
+    "path/filepath"
+    "testing"
+)
+
+func TestCreateBackupRoundTrip(t *testing.T) {
+    oldDir := BackupDir
+    BackupDir = t.TempDir()
+    t.Cleanup(func() { BackupDir = oldDir })
+
+    src := filepath.Join(t.TempDir(), "dpkg")
+    if err := os.MkdirAll(filepath.Join(src, "info"), 0755); err != nil {
+        t.Fatal(err)
+    }
+    if err := os.WriteFile(filepath.Join(src, "status"), []byte("Package: hello\n"), 0644); err != nil {
+        t.Fatal(err)
+    }
+
+    backup, err := CreateBackup(src, nil)
+    if err != nil {
+        t.Fatalf("CreateBackup: %v", err)
+    }
+    if _, err := validateBackup(backup); err != nil {
+        t.Fatalf("backup is not complete: %v", err)
+    }
+
+    dest := filepath.Join(t.TempDir(), "restored")
+    if err := RestoreBackup(backup, dest, nil); err != nil {
+        t.Fatalf("RestoreBackup: %v", err)
+    }
+    data, err := os.ReadFile(filepath.Join(dest, "status"))
+    if err != nil || string(data) != "Package: hello\n" {
+        t.Errorf("restored status = %q, %v", data, err)
+    }
+}
@@ -0,0 +1,230 @@
+// internal/build.go
+package internal
+
+import (
+    "archive/tar"
+    "bytes"
+    "compress/gzip"
+    "crypto/md5"
+    "encoding/hex"
+    "fmt"
+    "io"
+    "os"
+    "path/filepath"
+    "sort"
+    "strconv"
+    "strings"
+    "time"
+)
+
+// Сценарии сопровождающего, которые dpkg выполняет и которым нужны
+// права на исполнение
+var debMaintainerScripts = map[string]bool{
+    "preinst":  true,
+    "postinst": true,
+    "prerm":    true,
+    "postrm":   true,
+    "config":   true,
+}
+
+// BuildDeb собирает .deb из каталога rootDir и каталога controlDir с
+// файлом control и сценариями сопровождающего. Содержимое rootDir
+// упаковывается в data.tar.gz; md5sums и Installed-Size добавляются,
+// если не заданы
+func BuildDeb(rootDir, controlDir, outPath string) error {
+    data, err := os.ReadFile(filepath.Join(controlDir, "control"))
+    if err != nil {
+        return fmt.Errorf("failed to read control file: %w", err)
+    }
+
+    control, err := parseControl(string(data))
+    if err != nil {
+        return fmt.Errorf("invalid control file: %w", err)
+    }
+    for _, field := range []struct{ name, value string }{
+        {"Package", control.Package},
+        {"Version", control.Version},
+        {"Architecture", control.Architecture},
+    } {
+        if field.value == "" {
+            return fmt.Errorf("%w: control file has no %s field", ErrInvalidFormat, field.name)
+        }
+    }
+
+    fi, err := os.Stat(rootDir)
+    if err != nil {
+        return fmt.Errorf("failed to stat root directory: %w", err)
+    }
+    if !fi.IsDir() {
+        return fmt.Errorf("%s is not a directory", rootDir)
+    }
+
+    return WithTempDir(func(dir string) error {
+        dataPath := filepath.Join(dir, "data.tar.gz")
+        md5sums, installedSize, err := writeDebData(dataPath, rootDir)
+        if err != nil {
+            return err
+        }
+
+        controlText := string(data)
+        if control.InstalledSize == 0 {
+            // Installed-Size указывается в килобайтах с округлением вверх
+            kib := strconv.FormatInt((installedSize+1023)/1024, 10)
+            if controlText, err = editControl(controlText, map[string]string{"Installed-Size": kib}); err != nil {
+                return err
+            }
+        }
+
+        var controlTar bytes.Buffer
+        if err := writeDebControl(&controlTar, controlDir, controlText, md5sums); err != nil {
+            return err
+        }
+
+        dataFile, err := os.Open(dataPath)
+        if err != nil {
+            return fmt.Errorf("failed to open data archive: %w", err)
+        }
+        defer dataFile.Close()
+
+        err = writeFileAtomic(outPath, func(w io.Writer) error {
+            if _, err := w.Write(magicAr); err != nil {
+                return fmt.Errorf("failed to write ar header: %w", err)
+            }
+            if err := writeArMember(w, "debian-binary", 0, 4, strings.NewReader("2.0\n")); err != nil {
+                return err
+            }
+            if err := writeArMember(w, "control.tar.gz", 0, int64(controlTar.Len()), &controlTar); err != nil {
+                return err
+            }
+            return writeArMember(w, "data.tar.gz", 0, fileSize(dataPath), dataFile)
+        })
+        if err != nil {
+            return err
+        }
+
+        logger.Infof("Built %s_%s_%s as %s", control.Package, control.Version, control.Architecture, outPath)
+        return nil
+    })
+}
+
+// writeDebData упаковывает rootDir в data.tar.gz по пути path.
+// Возвращает содержимое md5sums и суммарный размер файлов
+func writeDebData(path, rootDir string) (string, int64, error) {
+    out, err := os.Create(path)
+    if err != nil {
+        return "", 0, fmt.Errorf("failed to create data archive: %w", err)
+    }
+    defer out.Close()
+
+    gzw := gzip.NewWriter(out)
+    tw := tar.NewWriter(gzw)
+
+    var md5sums strings.Builder
+    var total int64
+    err = writeTarFromDir(tw, rootDir, func(header *tar.Header, path string) error {
+        header.Name = "./" + header.Name
+        if header.Typeflag != tar.TypeReg {
+            return nil
+        }
+        total += header.Size
+
+        f, err := os.Open(path)
+        if err != nil {
+            return fmt.Errorf("failed to open file: %w", err)
+        }
+        defer f.Close()
+
+        h := md5.New()
+        if _, err := io.Copy(h, f); err != nil {
+            return fmt.Errorf("failed to hash file: %w", err)
+        }
+        fmt.Fprintf(&md5sums, "%s  %s\n", hex.EncodeToString(h.Sum(nil)), strings.TrimPrefix(header.Name, "./"))
+        return nil
+    })
+    if err != nil {
+        return "", 0, err
+    }
+
+    if err := tw.Close(); err != nil {
+        return "", 0, fmt.Errorf("failed to finalize data archive: %w", err)
+    }
+    if err := gzw.Close(); err != nil {
+        return "", 0, fmt.Errorf("failed to compress data archive: %w", err)
+    }
+    return md5sums.String(), total, out.Close()
+}
+
+// writeDebControl записывает control.tar.gz из файлов controlDir,
+// подставляя control и, если его нет в controlDir, md5sums
+func writeDebControl(w io.Writer, controlDir, control, md5sums string) error {
+    entries, err := os.ReadDir(controlDir)
+    if err != nil {
+        return fmt.Errorf("failed to read control directory: %w", err)
+    }
+
+    files := map[string][]byte{
+        "control": []byte(control),
+        "md5sums": []byte(md5sums),
+    }
+    modes := map[string]int64{}
+    for _, entry := range entries {
+        name := entry.Name()
+        if !entry.Type().IsRegular() {
+            logger.Warnf("Skipping %s in control directory: not a regular file", name)
+            continue
+        }
+        fi, err := entry.Info()
+        if err != nil {
+            return fmt.Errorf("failed to stat %s: %w", name, err)
+        }
+        modes[name] = int64(fi.Mode().Perm())
+        if name == "control" {
+            continue
+        }
+        if files[name], err = os.ReadFile(filepath.Join(controlDir, name)); err != nil {
+            return fmt.Errorf("failed to read %s: %w", name, err)
+        }
+    }
+
+    names := make([]string, 0, len(files))
+    for name := range files {
+        names = append(names, name)
+    }
+    sort.Strings(names)
+
+    gzw := gzip.NewWriter(w)
+    tw := tar.NewWriter(gzw)
+    now := time.Now()
+    for _, name := range names {
+        mode, ok := modes[name]
+        if !ok {
+            mode = 0644
+        }
+        if debMaintainerScripts[name] {
+            mode |= 0755
+        }
+
+        if err := tw.WriteHeader(&tar.Header{
+            Name:     "./" + name,
+            Mode:     mode,
+            Size:     int64(len(files[name])),
+            ModTime:  now,
+            Typeflag: tar.TypeReg,
+            Uname:    "root",
+            Gname:    "root",
+        }); err != nil {
+            return fmt.Errorf("failed to write tar header: %w", err)
+        }
+        if _, err := tw.Write(files[name]); err != nil {
+            return fmt.Errorf("failed to write %s: %w", name, err)
+        }
+    }
+
+    if err := tw.Close(); err != nil {
+        return fmt.Errorf("failed to finalize control archive: %w", err)
+    }
+    if err := gzw.Close(); err != nil {
+        return fmt.Errorf("failed to compress control archive: %w", err)
+    }
+    return nil
+}
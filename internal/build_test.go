@@ -0,0 +1,54 @@
+package internal
+
+import (
+    "context"
+    "errors"
+    "os"
+    "path/filepath"
+    "testing"
+)
+
+func TestBuildDebReadBack(t *testing.T) {
+    path := buildTestDeb(t, t.TempDir(), "hello.deb", testDebControl)
+    pkg, err := NewDeb(path)
+    if err != nil {
+        t.Fatalf("NewDeb: %v", err)
+    }
+
+    version, err := pkg.readArMember("debian-binary")
+    if err != nil || string(version) != "2.0\n" {
+        t.Errorf("debian-binary = %q, %v; want 2.0", version, err)
+    }
+
+    info, err := pkg.GetInfo(context.Background())
+    if err != nil {
+        t.Fatalf("GetInfo: %v", err)
+    }
+    if info.Name != "hello" || info.Version != "1.0-1" || info.Architecture != "amd64" {
+        t.Errorf("info = %s %s %s, want hello 1.0-1 amd64", info.Name, info.Version, info.Architecture)
+    }
+    // Installed-Size добавляется при сборке и округляется вверх до KiB
+    if info.InstalledSize != 1024 {
+        t.Errorf("installed size = %d, want 1024", info.InstalledSize)
+    }
+}
+
+func TestBuildDebRejectsIncompleteControl(t *testing.T) {
+    dir := t.TempDir()
+    controlDir := filepath.Join(dir, "DEBIAN")
+    if err := os.MkdirAll(controlDir, 0755); err != nil {
+        t.Fatal(err)
+    }
+    control := "Package: hello\nArchitecture: amd64\n"
+    if err := os.WriteFile(filepath.Join(controlDir, "control"), []byte(control), 0644); err != nil {
+        t.Fatal(err)
+    }
+
+    out := filepath.Join(dir, "hello.deb")
+    if err := BuildDeb(dir, controlDir, out); !errors.Is(err, ErrInvalidFormat) {
+        t.Errorf("BuildDeb = %v, want ErrInvalidFormat", err)
+    }
+    if _, err := os.Stat(out); err == nil {
+        t.Error("package was written despite the invalid control file")
+    }
+}
@@ -0,0 +1,227 @@
+// internal/changelog.go
+package internal
+
+import (
+    "archive/tar"
+    "bytes"
+    "compress/gzip"
+    "context"
+    "fmt"
+    "io"
+    "os"
+    "path"
+    "strings"
+    "time"
+)
+
+// ChangelogEntry запись журнала изменений пакета
+type ChangelogEntry struct {
+    Date    time.Time `json:"date"`
+    Author  string    `json:"author"`
+    Version string    `json:"version,omitempty"`
+    Text    string    `json:"text"`
+}
+
+// GetChangelog возвращает журнал изменений из тегов CHANGELOG*
+// заголовка RPM, от новых записей к старым
+func (r *RPM) GetChangelog() ([]ChangelogEntry, error) {
+    header, err := readRPMMainHeader(r.Path)
+    if err != nil {
+        return nil, err
+    }
+
+    times, _ := header.Int32Array(rpmTagChangelogTime)
+    names, _ := header.StringArray(rpmTagChangelogName)
+    texts, _ := header.StringArray(rpmTagChangelogText)
+    if len(names) != len(times) || len(texts) != len(times) {
+        return nil, fmt.Errorf("%w: changelog tags have different lengths", ErrCorruptedPackage)
+    }
+
+    entries := make([]ChangelogEntry, len(times))
+    for i := range times {
+        // Имя записывается как "Автор <email> - версия"
+        author, version := names[i], ""
+        if j := strings.LastIndex(author, " - "); j >= 0 {
+            author, version = author[:j], strings.TrimSpace(author[j+3:])
+        }
+        entries[i] = ChangelogEntry{
+            Date:    time.Unix(int64(uint32(times[i])), 0).UTC(),
+            Author:  strings.TrimSpace(author),
+            Version: version,
+            Text:    texts[i],
+        }
+    }
+    return entries, nil
+}
+
+// GetChangelog возвращает журнал изменений из
+// usr/share/doc/<пакет>/changelog.Debian.gz. Если пакет не содержит
+// журнала, возвращается пустой список
+func (d *Deb) GetChangelog() ([]ChangelogEntry, error) {
+    info, err := d.GetInfo(context.Background())
+    if err != nil {
+        return nil, err
+    }
+
+    docDir := path.Join("usr/share/doc", info.Name)
+    data, err := d.readDataFile(func(name string) bool {
+        // Нативные пакеты хранят журнал в changelog.gz
+        return name == path.Join(docDir, "changelog.Debian.gz") || name == path.Join(docDir, "changelog.gz")
+    })
+    if err != nil || data == nil {
+        return nil, err
+    }
+
+    gzr, err := gzip.NewReader(bytes.NewReader(data))
+    if err != nil {
+        return nil, fmt.Errorf("failed to decompress changelog: %w", err)
+    }
+    defer gzr.Close()
+
+    text, err := io.ReadAll(gzr)
+    if err != nil {
+        return nil, fmt.Errorf("failed to read changelog: %w", err)
+    }
+    return parseDebianChangelog(string(text)), nil
+}
+
+// readDataFile возвращает содержимое первого файла data.tar.*, имя
+// которого принимает match, или nil, если такого файла нет
+func (d *Deb) readDataFile(match func(name string) bool) ([]byte, error) {
+    f, err := os.Open(d.Path)
+    if err != nil {
+        return nil, fmt.Errorf("failed to open package: %w", err)
+    }
+    defer f.Close()
+
+    ar, err := newArReader(f)
+    if err != nil {
+        return nil, err
+    }
+
+    for {
+        header, err := ar.Next()
+        if err == io.EOF {
+            break
+        }
+        if err != nil {
+            return nil, err
+        }
+
+        if !strings.HasPrefix(header.Name, "data.tar") {
+            continue
+        }
+
+        r, closeReader, err := decompressStream(ar)
+        if err != nil {
+            return nil, err
+        }
+        defer closeReader()
+
+        tr := tar.NewReader(r)
+        for {
+            th, err := tr.Next()
+            if err == io.EOF {
+                return nil, nil
+            }
+            if err != nil {
+                return nil, fmt.Errorf("failed to read data archive: %w", err)
+            }
+
+            if th.Typeflag == tar.TypeReg && match(strings.TrimPrefix(th.Name, "./")) {
+                return io.ReadAll(tr)
+            }
+        }
+    }
+
+    return nil, fmt.Errorf("data archive not found")
+}
+
+// parseDebianChangelog разбирает debian/changelog:
+//
+//   pkg (версия) дистрибутив; urgency=low
+//
+//     * изменения
+//
+//    -- Автор <email>  Mon, 01 Jan 2024 00:00:00 +0000
+func parseDebianChangelog(data string) []ChangelogEntry {
+    var result []ChangelogEntry
+    var current *ChangelogEntry
+    var body []string
+
+    for _, line := range strings.Split(data, "\n") {
+        switch {
+        case strings.HasPrefix(line, " -- "):
+            if current == nil {
+                continue
+            }
+            author, date, _ := strings.Cut(strings.TrimPrefix(line, " -- "), "  ")
+            current.Author = strings.TrimSpace(author)
+            if t, err := time.Parse(time.RFC1123Z, strings.TrimSpace(date)); err == nil {
+                current.Date = t
+            }
+            current.Text = strings.TrimSpace(strings.Join(body, "\n"))
+            result = append(result, *current)
+            current = nil
+        case line != "" && line[0] != ' ' && line[0] != '\t':
+            // Заголовок записи; строки вне записей ("Local variables:",
+            // "Old Changelog:") не имеют подписи и отбрасываются
+            current = &ChangelogEntry{}
+            body = nil
+            if open := strings.Index(line, "("); open >= 0 {
+                if end := strings.Index(line[open:], ")"); end >= 0 {
+                    current.Version = line[open+1 : open+end]
+                }
+            }
+        case current != nil:
+            body = append(body, strings.TrimPrefix(line, "  "))
+        }
+    }
+
+    return result
+}
+
+// ChangelogSince возвращает записи entries (от новых к старым), версии
+// которых новее since. Журналы не всегда упорядочены строго, поэтому
+// записи не обрываются на первой старой версии, а отбираются по одной;
+// записи без версии сохраняются, пока не встретилась версия не новее
+// since. Если в since нет эпохи или ревизии, они не учитываются и у
+// версий записей, чтобы --since 1.2.0 исключал и 1.2.0-1
+func ChangelogSince(entries []ChangelogEntry, since string, cmp VersionComparator) []ChangelogEntry {
+    var result []ChangelogEntry
+    reached := false
+    for _, entry := range entries {
+        if entry.Version == "" {
+            if !reached {
+                result = append(result, entry)
+            }
+            continue
+        }
+
+        if cmp.Compare(comparableVersion(entry.Version, since), since) > 0 {
+            if reached {
+                logger.Debugf("Changelog entry %s is out of order", entry.Version)
+            }
+            result = append(result, entry)
+            continue
+        }
+        reached = true
+    }
+    return result
+}
+
+// comparableVersion отбрасывает у version эпоху и ревизию, которых нет
+// в образце ref
+func comparableVersion(version, ref string) string {
+    if !strings.Contains(ref, ":") {
+        if i := strings.Index(version, ":"); i >= 0 {
+            version = version[i+1:]
+        }
+    }
+    if !strings.Contains(ref, "-") {
+        if i := strings.LastIndex(version, "-"); i >= 0 {
+            version = version[:i]
+        }
+    }
+    return version
+}
@@ -0,0 +1,71 @@
+// internal/clean.go
+package internal
+
+import (
+    "fmt"
+    "os"
+    "path/filepath"
+    "time"
+)
+
+// Возраст, после которого файлы кэша и временного каталога считаются
+// устаревшими
+const CacheMaxAge = 7 * 24 * time.Hour
+
+// CleanDirectory удаляет из dir записи, не изменявшиеся дольше maxAge,
+// и возвращает освобожденный объем. Для каталогов учитывается самое
+// свежее время изменения внутри. Нулевой maxAge удаляет все записи.
+// Сам dir не удаляется; отсутствующий dir не считается ошибкой
+func CleanDirectory(dir string, maxAge time.Duration) (int64, error) {
+    dir = filepath.Clean(dir)
+    if !filepath.IsAbs(dir) || dir == "/" {
+        return 0, fmt.Errorf("refusing to clean %q", dir)
+    }
+
+    entries, err := os.ReadDir(dir)
+    if os.IsNotExist(err) {
+        return 0, nil
+    }
+    if err != nil {
+        return 0, fmt.Errorf("failed to read directory %s: %w", dir, err)
+    }
+
+    var reclaimed int64
+    for _, entry := range entries {
+        path := filepath.Join(dir, entry.Name())
+        size, modified, err := entryStats(path)
+        if err != nil {
+            return reclaimed, fmt.Errorf("failed to stat %s: %w", path, err)
+        }
+        if maxAge > 0 && time.Since(modified) < maxAge {
+            continue
+        }
+
+        if err := RemoveDirectory(path); err != nil {
+            return reclaimed, err
+        }
+        logger.Debugf("Removed %s", path)
+        reclaimed += size
+    }
+    return reclaimed, nil
+}
+
+// entryStats возвращает размер файлов и самое свежее время изменения
+// в дереве path, не следуя символическим ссылкам
+func entryStats(path string) (int64, time.Time, error) {
+    var size int64
+    var modified time.Time
+    err := filepath.Walk(path, func(_ string, fi os.FileInfo, err error) error {
+        if err != nil {
+            return err
+        }
+        if fi.Mode().IsRegular() {
+            size += fi.Size()
+        }
+        if fi.ModTime().After(modified) {
+            modified = fi.ModTime()
+        }
+        return nil
+    })
+    return size, modified, err
+}
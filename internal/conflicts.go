@@ -0,0 +1,59 @@
+// internal/conflicts.go
+package internal
+
+import (
+    "context"
+    "fmt"
+)
+
+// CheckConflicts возвращает имена установленных пакетов, конфликтующих
+// с устанавливаемым: по его Conflicts и по Conflicts установленных
+// пакетов, совпадающим с именем или Provides нового пакета
+func CheckConflicts(ctx context.Context, pkg Package, installed []PackageInfo) ([]string, error) {
+    info, err := pkg.GetInfo(ctx)
+    if err != nil {
+        return nil, fmt.Errorf("failed to read package info: %w", err)
+    }
+
+    var result []string
+    seen := make(map[string]bool)
+    add := func(name string) {
+        if !seen[name] {
+            seen[name] = true
+            result = append(result, name)
+        }
+    }
+
+    incoming := providedNames(info)
+    for _, other := range installed {
+        // Пакет с тем же именем будет обновлен, а не установлен рядом
+        if other.Name == info.Name {
+            continue
+        }
+
+        names := providedNames(&other)
+        for _, conflict := range info.Conflicts {
+            if names[dependencyName(conflict)] {
+                logger.Debugf("%s conflicts with installed %s (%s)", info.Name, other.Name, conflict)
+                add(other.Name)
+            }
+        }
+        for _, conflict := range other.Conflicts {
+            if incoming[dependencyName(conflict)] {
+                logger.Debugf("Installed %s conflicts with %s (%s)", other.Name, info.Name, conflict)
+                add(other.Name)
+            }
+        }
+    }
+
+    return result, nil
+}
+
+// providedNames возвращает имя пакета и все имена из Provides
+func providedNames(info *PackageInfo) map[string]bool {
+    names := map[string]bool{info.Name: true}
+    for _, provide := range info.Provides {
+        names[dependencyName(provide)] = true
+    }
+    return names
+}
@@ -0,0 +1,270 @@
+// internal/convert.go
+package internal
+
+import (
+    "context"
+    "archive/tar"
+    "bytes"
+    "compress/gzip"
+    "crypto/sha1"
+    "crypto/sha256"
+    "encoding/hex"
+    "fmt"
+    "io"
+    "os"
+    "path/filepath"
+    "strings"
+    "time"
+)
+
+// archMap соответствие архитектур Debian архитектурам Alpine
+var archMap = map[string]string{
+    "amd64": "x86_64",
+    "i386":  "x86",
+    "arm64": "aarch64",
+    "armhf": "armv7",
+    "armel": "armhf",
+    "all":   "noarch",
+}
+
+// debToAPKDeps соответствие имен зависимостей Debian именам в Alpine.
+// Отсутствующие в таблице имена переносятся как есть
+var debToAPKDeps = map[string]string{
+    "libc6":        "musl",
+    "libc6-dev":    "musl-dev",
+    "libgcc-s1":    "libgcc",
+    "libstdc++6":   "libstdc++",
+    "zlib1g":       "zlib",
+    "libssl3":      "libssl3",
+    "libcrypto3":   "libcrypto3",
+    "libbz2-1.0":   "libbz2",
+    "liblzma5":     "xz-libs",
+    "libzstd1":     "zstd-libs",
+    "libncursesw6": "ncurses-libs",
+    "libtinfo6":    "ncurses-libs",
+    "libreadline8": "readline",
+    "libffi8":      "libffi",
+    "libexpat1":    "libexpat",
+    "libcurl4":     "libcurl",
+    "python3":      "python3",
+    "perl":         "perl",
+    "bash":         "bash",
+}
+
+// ConvertTo конвертирует пакет в другой формат и сохраняет результат
+// в outDir. Возвращает путь к созданному пакету. Пока поддерживается
+// только конвертация в apk
+func ConvertTo(ctx context.Context, pkg Package, target PackageType, outDir string) (string, error) {
+    if pkg.GetType() == target {
+        return "", fmt.Errorf("package is already in %s format", target)
+    }
+
+    switch target {
+    case TypeAPK:
+        return convertToAPK(ctx, pkg, outDir)
+    default:
+        return "", ErrNotSupported
+    }
+}
+
+// convertToAPK собирает неподписанный .apk из содержимого пакета
+func convertToAPK(ctx context.Context, pkg Package, outDir string) (string, error) {
+    info, err := pkg.GetInfo(ctx)
+    if err != nil {
+        return "", fmt.Errorf("failed to read package info: %w", err)
+    }
+
+    warnUnmappedFields(info, TypeAPK)
+
+    // Сегмент данных: tar.gz с SHA1 файлов в PAX заголовках
+    var data bytes.Buffer
+    var installedSize int64
+    err = WithTempDir(func(dir string) error {
+        if err := pkg.Extract(dir); err != nil {
+            return fmt.Errorf("failed to extract package: %w", err)
+        }
+        var err error
+        installedSize, err = writeAPKData(&data, dir)
+        return err
+    })
+    if err != nil {
+        return "", err
+    }
+    dataHash := sha256.Sum256(data.Bytes())
+
+    version := convertVersionToAPK(info.Version)
+    arch := info.Architecture
+    if mapped, ok := archMap[arch]; ok {
+        arch = mapped
+    }
+
+    var pkginfo strings.Builder
+    fmt.Fprintf(&pkginfo, "# Generated by upkgt %s\n", BuildInfo.Version)
+    fmt.Fprintf(&pkginfo, "pkgname = %s\n", info.Name)
+    fmt.Fprintf(&pkginfo, "pkgver = %s\n", version)
+    fmt.Fprintf(&pkginfo, "pkgdesc = %s\n", strings.SplitN(info.Description, "\n", 2)[0])
+    if info.Homepage != "" {
+        fmt.Fprintf(&pkginfo, "url = %s\n", info.Homepage)
+    }
+    fmt.Fprintf(&pkginfo, "builddate = %d\n", time.Now().Unix())
+    if info.Maintainer != "" {
+        fmt.Fprintf(&pkginfo, "maintainer = %s\n", info.Maintainer)
+    }
+    fmt.Fprintf(&pkginfo, "size = %d\n", installedSize)
+    fmt.Fprintf(&pkginfo, "arch = %s\n", arch)
+    if info.License != "" {
+        fmt.Fprintf(&pkginfo, "license = %s\n", info.License)
+    }
+    for _, dep := range info.Dependencies {
+        fmt.Fprintf(&pkginfo, "depend = %s\n", translateDependency(dep, pkg.GetType(), TypeAPK))
+    }
+    for _, provide := range info.Provides {
+        fmt.Fprintf(&pkginfo, "provides = %s\n", provide)
+    }
+    fmt.Fprintf(&pkginfo, "datahash = %s\n", hex.EncodeToString(dataHash[:]))
+
+    // Управляющий сегмент: tar без завершающих блоков, как у apk-tools
+    var control bytes.Buffer
+    gzw := gzip.NewWriter(&control)
+    tw := tar.NewWriter(gzw)
+    content := []byte(pkginfo.String())
+    if err := tw.WriteHeader(&tar.Header{
+        Name:     ".PKGINFO",
+        Mode:     0644,
+        Size:     int64(len(content)),
+        ModTime:  time.Now(),
+        Typeflag: tar.TypeReg,
+        Format:   tar.FormatPAX,
+    }); err != nil {
+        return "", fmt.Errorf("failed to write tar header: %w", err)
+    }
+    if _, err := tw.Write(content); err != nil {
+        return "", fmt.Errorf("failed to write .PKGINFO: %w", err)
+    }
+    if err := tw.Flush(); err != nil {
+        return "", fmt.Errorf("failed to write control segment: %w", err)
+    }
+    if err := gzw.Close(); err != nil {
+        return "", fmt.Errorf("failed to compress control segment: %w", err)
+    }
+
+    if err := CreateDirectory(outDir, 0755); err != nil {
+        return "", err
+    }
+    outPath := filepath.Join(outDir, fmt.Sprintf("%s-%s.apk", info.Name, version))
+
+    out, err := os.Create(outPath)
+    if err != nil {
+        return "", fmt.Errorf("failed to create package file: %w", err)
+    }
+    defer out.Close()
+
+    if _, err := io.Copy(out, io.MultiReader(&control, &data)); err != nil {
+        return "", fmt.Errorf("failed to write package: %w", err)
+    }
+
+    logger.Infof("Converted %s to %s", pkg, outPath)
+    return outPath, out.Close()
+}
+
+// writeAPKData записывает содержимое каталога в gzip tar поток и
+// возвращает суммарный размер файлов
+func writeAPKData(w io.Writer, root string) (int64, error) {
+    gzw := gzip.NewWriter(w)
+    tw := tar.NewWriter(gzw)
+
+    var total int64
+    err := writeTarFromDir(tw, root, func(header *tar.Header, path string) error {
+        if header.Typeflag != tar.TypeReg {
+            return nil
+        }
+        total += header.Size
+
+        f, err := os.Open(path)
+        if err != nil {
+            return fmt.Errorf("failed to open file: %w", err)
+        }
+        defer f.Close()
+
+        h := sha1.New()
+        if _, err := io.Copy(h, f); err != nil {
+            return fmt.Errorf("failed to hash file: %w", err)
+        }
+        header.Format = tar.FormatPAX
+        header.PAXRecords = map[string]string{
+            "APK-TOOLS.checksum.SHA1": hex.EncodeToString(h.Sum(nil)),
+        }
+        return nil
+    })
+    if err != nil {
+        return 0, err
+    }
+
+    if err := tw.Close(); err != nil {
+        return 0, fmt.Errorf("failed to finalize data segment: %w", err)
+    }
+    if err := gzw.Close(); err != nil {
+        return 0, fmt.Errorf("failed to compress data segment: %w", err)
+    }
+    return total, nil
+}
+
+// convertVersionToAPK приводит версию к виду apk: без epoch,
+// ревизия Debian/RPM становится -rN
+func convertVersionToAPK(version string) string {
+    if i := strings.Index(version, ":"); i >= 0 {
+        version = version[i+1:]
+    }
+
+    revision := "0"
+    if i := strings.LastIndex(version, "-"); i >= 0 {
+        rev := version[i+1:]
+        version = version[:i]
+
+        digits := 0
+        for digits < len(rev) && isDigit(rev[digits]) {
+            digits++
+        }
+        if digits > 0 {
+            revision = rev[:digits]
+        }
+    }
+
+    // apk не допускает "~" и "+" в версии
+    version = strings.NewReplacer("~", "_", "+", ".").Replace(version)
+    return fmt.Sprintf("%s-r%s", version, revision)
+}
+
+// translateDependency переводит имя зависимости между форматами
+// по таблице соответствия
+func translateDependency(dep string, from, to PackageType) string {
+    // apk не поддерживает альтернативы, берем первую
+    if alternatives := splitAlternatives(dep); to == TypeAPK && len(alternatives) > 1 {
+        logger.Warnf("Alternatives are not supported by %s, using %s from %q", to, alternatives[0], dep)
+        dep = alternatives[0]
+    }
+
+    if from == TypeDeb && to == TypeAPK {
+        if mapped, ok := debToAPKDeps[dep]; ok {
+            return mapped
+        }
+    }
+    return dep
+}
+
+// warnUnmappedFields предупреждает о полях, которые не переносятся
+// в целевой формат
+func warnUnmappedFields(info *PackageInfo, target PackageType) {
+    if target != TypeAPK {
+        return
+    }
+    if len(info.Conflicts) > 0 {
+        logger.Warnf("Conflicts are not supported by %s and will be dropped: %s", target, strings.Join(info.Conflicts, ", "))
+    }
+    if len(info.Replaces) > 0 {
+        logger.Warnf("Replaces are not supported by %s and will be dropped: %s", target, strings.Join(info.Replaces, ", "))
+    }
+    if info.Section != "" || info.Priority != "" {
+        logger.Warnf("Section and priority have no %s equivalent and will be dropped", target)
+    }
+}
@@ -2,18 +2,19 @@
 package internal
 
 import (
+    "context"
     "archive/tar"
     "bytes"
-    "compress/gzip"
     "fmt"
     "io"
     "os"
-    "os/exec"
     "path/filepath"
     "regexp"
     "strconv"
     "strings"
     "time"
+
+    "golang.org/x/crypto/openpgp"
 )
 
 // Deb структура для Debian пакетов
@@ -23,6 +24,9 @@ type Deb struct {
     Version    string
     BuildDate  time.Time
     Info       *PackageInfo
+    control    []byte // control с изменениями EditMetadata
+    rawControl string // control из пакета, прочитанный при открытии
+    arch       string
 }
 
 // DebControl структура для control файла
@@ -35,14 +39,15 @@ type DebControl struct {
     Homepage     string
     Section      string
     Priority     string
-    Depends      []string
-    PreDepends   []string
-    Recommends   []string
-    Suggests     []string
-    Conflicts    []string
-    Provides     []string
-    Replaces     []string
-    Size         int64
+    Depends      []DependencyGroup
+    PreDepends   []DependencyGroup
+    Recommends   []DependencyGroup
+    Suggests     []DependencyGroup
+    Conflicts    []DependencyGroup
+    Breaks       []DependencyGroup
+    Provides     []DependencyGroup
+    Replaces     []DependencyGroup
+    InstalledSize int64
 }
 
 // NewDeb создает новый экземпляр Deb
@@ -66,10 +71,6 @@ func NewDeb(path string) (*Deb, error) {
 
 // validate проверяет корректность .deb файла
 func (d *Deb) validate() error {
-    if !strings.HasSuffix(d.Path, ".deb") {
-        return fmt.Errorf("invalid package format: must be .deb")
-    }
-
     fi, err := os.Stat(d.Path)
     if err != nil {
         return fmt.Errorf("failed to stat package file: %w", err)
@@ -95,63 +96,130 @@ func (d *Deb) validate() error {
         return fmt.Errorf("invalid package format: not a debian package")
     }
 
+    // Имя и версия нужны сразу для String и Remove, поэтому control
+    // читается здесь встроенным разбором и потом используется GetInfo.
+    // Ошибка не мешает открыть пакет: GetInfo еще попробует dpkg-deb
+    data, err := d.readControl()
+    if err != nil {
+        logger.Debugf("Failed to read control file of %s: %v", d.Path, err)
+        return nil
+    }
+    if control, err := parseControl(data); err == nil {
+        d.rawControl = data
+        d.Name, d.Version, d.arch = control.Package, control.Version, control.Architecture
+    }
+
     return nil
 }
 
 // Install устанавливает .deb пакет
-func (d *Deb) Install(force bool) error {
-    if err := RequireRoot(); err != nil {
+func (d *Deb) Install(ctx context.Context, opts InstallOptions) error {
+    root := opts.InstallRoot()
+    if err := RequireRoot(root); err != nil && !opts.DryRun {
+        return err
+    }
+    if err := requireBackend(TypeDeb); err != nil {
         return err
     }
 
     logger.Infof("Installing Debian package: %s", d.Path)
 
+    dbPath := filepath.Join(root, "var/lib/dpkg")
+
     // Создаем резервную копию
-    backupPath, err := CreateBackup("/var/lib/dpkg")
-    if err != nil {
-        logger.Warnf("Failed to create backup: %v", err)
-    } else {
-        logger.Infof("Created backup: %s", backupPath)
+    if !opts.NoBackup && !opts.DryRun {
+        backupDatabase(dbPath, opts.Progress)
     }
 
     // Подготавливаем команду установки
     args := []string{"-i"}
-    if force {
+    if opts.IsAltRoot() {
+        args = append(args, "--root="+root)
+    }
+    if opts.Force {
         args = append(args, "--force-all")
+    } else if opts.NoDeps {
+        args = append(args, "--force-depends")
+    }
+    if opts.AssumeYes && !opts.Force {
+        // dpkg спрашивает только об измененных конфигурационных файлах:
+        // оставляем их версию по умолчанию, иначе текущую
+        args = append(args, "--force-confdef", "--force-confold")
     }
     args = append(args, d.Path)
 
     // Выполняем установку
-    cmd := exec.Command("dpkg", args...)
-    cmd.Env = append(os.Environ(), "LANG=C")
-    
-    output, err := cmd.CombinedOutput()
+    if opts.DryRun {
+        printDryRun("dpkg", args, dbPath, opts.NoBackup)
+        simulateDpkg(ctx, args)
+        return nil
+    }
+
+    output, err := CommandRunner.Run(ctx, "dpkg", args...)
+    if err != nil && ctx.Err() != nil {
+        return fmt.Errorf("installation cancelled: %w", ctx.Err())
+    }
+    if err != nil && (opts.IsAltRoot() || opts.Offline || !hasApt()) {
+        return fmt.Errorf("installation failed: %s: %w", string(output), err)
+    }
     if err != nil {
         // Пытаемся исправить зависимости
-        fixCmd := exec.Command("apt-get", "install", "-f", "-y")
-        if fixOut, fixErr := fixCmd.CombinedOutput(); fixErr != nil {
+        if fixOut, fixErr := CommandRunner.Run(ctx, "apt-get", aptArgs(opts.AssumeYes, "install", "-f")...); fixErr != nil {
             return fmt.Errorf("installation failed: %s\nFix attempt failed: %s", string(output), string(fixOut))
         }
         return fmt.Errorf("installation completed with warnings: %s", string(output))
     }
 
-    // Обновляем кэш
-    if err := exec.Command("apt-get", "update").Run(); err != nil {
-        logger.Warn("Failed to update package cache")
+    // Обновляем кэш хоста только по запросу: установка из файла не должна
+    // требовать сети. Альтернативный корень не трогаем
+    if opts.Refresh && !opts.Offline && !opts.IsAltRoot() && hasApt() {
+        if _, err := CommandRunner.Run(ctx, "apt-get", "update"); err != nil {
+            logger.Warn("Failed to update package cache")
+        }
     }
 
     logger.Info("Package installed successfully")
     return nil
 }
 
+// hasApt сообщает, установлен ли apt-get. dpkg может работать без apt,
+// тогда шаги apt-get пропускаются
+func hasApt() bool {
+    _, err := CommandRunner.LookPath("apt-get")
+    return err == nil
+}
+
+// aptArgs возвращает аргументы apt-get, добавляя -y, если вопросы
+// не разрешены
+func aptArgs(assumeYes bool, args ...string) []string {
+    if assumeYes {
+        args = append(args, "-y")
+    }
+    return args
+}
+
+// simulateDpkg прогоняет команду dpkg с --dry-run, ничего не меняя в системе
+func simulateDpkg(ctx context.Context, args []string) {
+    output, err := CommandRunner.Run(ctx, "dpkg", append([]string{"--dry-run"}, args...)...)
+    if err != nil {
+        logger.Warnf("dpkg simulation failed: %s", strings.TrimSpace(string(output)))
+        return
+    }
+    logger.Info("dpkg simulation succeeded")
+}
+
 // Remove удаляет установленный пакет
-func (d *Deb) Remove(purge bool) error {
-    if err := RequireRoot(); err != nil {
+func (d *Deb) Remove(ctx context.Context, opts RemoveOptions) error {
+    root := opts.InstallRoot()
+    if err := RequireRoot(root); err != nil && !opts.DryRun {
+        return err
+    }
+    if err := requireBackend(TypeDeb); err != nil {
         return err
     }
 
     if d.Name == "" {
-        info, err := d.GetInfo()
+        info, err := d.GetInfo(ctx)
         if err != nil {
             return fmt.Errorf("failed to get package info: %w", err)
         }
@@ -160,38 +228,61 @@ func (d *Deb) Remove(purge bool) error {
 
     logger.Infof("Removing Debian package: %s", d.Name)
 
+    dbPath := filepath.Join(root, "var/lib/dpkg")
+
     // Создаем резервную копию
-    backupPath, err := CreateBackup("/var/lib/dpkg")
-    if err != nil {
-        logger.Warnf("Failed to create backup: %v", err)
-    } else {
-        logger.Infof("Created backup: %s", backupPath)
+    if !opts.NoBackup && !opts.DryRun {
+        backupDatabase(dbPath, opts.Progress)
     }
 
     // Подготавливаем команду удаления
-    args := []string{"remove"}
-    if purge {
-        args = []string{"purge"} // purge удаляет также конфигурационные файлы
+    args := []string{"--remove"}
+    if opts.Purge {
+        args = []string{"--purge"} // purge удаляет также конфигурационные файлы
+    }
+    if opts.IsAltRoot() {
+        args = append(args, "--root="+root)
+    }
+    if opts.Force {
+        args = append(args, "--force-all")
+    } else if opts.NoDeps {
+        args = append(args, "--force-depends")
     }
     args = append(args, d.Name)
 
     // Выполняем удаление
-    cmd := exec.Command("dpkg", args...)
-    cmd.Env = append(os.Environ(), "LANG=C")
-    
-    output, err := cmd.CombinedOutput()
+    if opts.DryRun {
+        printDryRun("dpkg", args, dbPath, opts.NoBackup)
+        simulateDpkg(ctx, args)
+        return nil
+    }
+
+    output, err := CommandRunner.Run(ctx, "dpkg", args...)
+    if err != nil && ctx.Err() != nil {
+        return fmt.Errorf("removal cancelled: %w", ctx.Err())
+    }
     if err != nil {
         return fmt.Errorf("removal failed: %s: %w", string(output), err)
     }
 
+    // Шаги apt-get выполняются только на хосте и только если apt есть:
+    // на минимальных системах dpkg работает без него
+    aptSteps := !opts.IsAltRoot() && (opts.Autoremove || opts.Purge)
+    if aptSteps && !hasApt() {
+        logger.Info("apt-get not found, skipping autoremove and cache cleanup")
+        aptSteps = false
+    }
+
     // Очищаем неиспользуемые зависимости
-    if err := exec.Command("apt-get", "autoremove", "-y").Run(); err != nil {
-        logger.Warn("Failed to remove unused dependencies")
+    if aptSteps && opts.Autoremove {
+        if _, err := CommandRunner.Run(ctx, "apt-get", aptArgs(opts.AssumeYes, "autoremove")...); err != nil {
+            logger.Warn("Failed to remove unused dependencies")
+        }
     }
 
     // Очищаем кэш если указан purge
-    if purge {
-        if err := exec.Command("apt-get", "clean").Run(); err != nil {
+    if aptSteps && opts.Purge {
+        if _, err := CommandRunner.Run(ctx, "apt-get", "clean"); err != nil {
             logger.Warn("Failed to clean package cache")
         }
     }
@@ -201,30 +292,46 @@ func (d *Deb) Remove(purge bool) error {
 }
 
 // GetInfo возвращает информацию о пакете
-func (d *Deb) GetInfo() (*PackageInfo, error) {
+func (d *Deb) GetInfo(ctx context.Context) (*PackageInfo, error) {
     if d.Info != nil {
         return d.Info, nil
     }
 
-    // Используем dpkg-deb для получения control файла
-    cmd := exec.Command("dpkg-deb", "-f", d.Path)
-    output, err := cmd.Output()
-    if err != nil {
-        return nil, fmt.Errorf("failed to read control file: %w", err)
+    cached, hash := loadCachedInfo(d.Path, TypeDeb)
+    if cached != nil {
+        d.Info = cached
+        return cached, nil
     }
 
-    control, err := parseControl(string(output))
-    if err != nil {
-        return nil, fmt.Errorf("failed to parse control file: %w", err)
-    }
+    // Читаем control файл напрямую из ar архива. dpkg-deb используется,
+    // если встроенный разбор не удался или отключен PreferNativeParsers,
+    // и только если он установлен
+    _, lookErr := CommandRunner.LookPath("dpkg-deb")
+    useDpkg := lookErr == nil && !PreferNativeParsers
 
-    // Получаем размер установленного пакета
-    cmd = exec.Command("dpkg-deb", "-I", d.Path)
-    if output, err = cmd.Output(); err == nil {
-        re := regexp.MustCompile(`installed size: (\d+)`)
-        if matches := re.FindStringSubmatch(strings.ToLower(string(output))); len(matches) > 1 {
-            control.Size, _ = strconv.ParseInt(matches[1], 10, 64)
+    data := d.rawControl
+    if !useDpkg && data == "" {
+        var err error
+        data, err = d.readControl()
+        if err != nil {
+            if lookErr != nil {
+                return nil, fmt.Errorf("failed to read control file: %w", err)
+            }
+            logger.Debugf("Native control parsing failed, falling back to dpkg-deb: %v", err)
+            useDpkg = true
+        }
+    }
+    if useDpkg {
+        output, err := CommandRunner.Output(ctx, "dpkg-deb", "-f", d.Path)
+        if err != nil {
+            return nil, fmt.Errorf("failed to read control file: %w", err)
         }
+        data = string(output)
+    }
+
+    control, err := parseControl(data)
+    if err != nil {
+        return nil, fmt.Errorf("failed to parse control file: %w", err)
     }
 
     // Создаем информацию о пакете
@@ -235,20 +342,79 @@ func (d *Deb) GetInfo() (*PackageInfo, error) {
         Description:  control.Description,
         Maintainer:   control.Maintainer,
         Homepage:     control.Homepage,
-        Size:         control.Size,
-        Dependencies: control.Depends,
-        Conflicts:    control.Conflicts,
-        Provides:     control.Provides,
-        Replaces:     control.Replaces,
+        Size:         fileSize(d.Path),
+        InstalledSize: control.InstalledSize,
+        Dependencies: dependencyNames(control.Depends),
+        Conflicts:    dependencyNames(append(control.Conflicts, control.Breaks...)),
+        Provides:     dependencyNames(control.Provides),
+        Replaces:     dependencyNames(control.Replaces),
         InstallDate:  d.BuildDate,
         Section:      control.Section,
         Priority:     control.Priority,
     }
 
+    storeCachedInfo(hash, TypeDeb, info)
     d.Info = info
     return info, nil
 }
 
+// readControl извлекает control файл из control.tar.* без внешних утилит
+func (d *Deb) readControl() (string, error) {
+    f, err := os.Open(d.Path)
+    if err != nil {
+        return "", fmt.Errorf("failed to open package: %w", err)
+    }
+    defer f.Close()
+
+    ar, err := newArReader(f)
+    if err != nil {
+        return "", err
+    }
+
+    for {
+        header, err := ar.Next()
+        if err == io.EOF {
+            break
+        }
+        if err != nil {
+            return "", err
+        }
+
+        if !strings.HasPrefix(header.Name, "control.tar") {
+            continue
+        }
+
+        r, closeReader, err := decompressStream(ar)
+        if err != nil {
+            return "", err
+        }
+        defer closeReader()
+
+        tr := tar.NewReader(r)
+        for {
+            th, err := tr.Next()
+            if err == io.EOF {
+                break
+            }
+            if err != nil {
+                return "", fmt.Errorf("failed to read control archive: %w", err)
+            }
+
+            if strings.TrimPrefix(th.Name, "./") == "control" {
+                buf := new(bytes.Buffer)
+                if _, err := io.Copy(buf, tr); err != nil {
+                    return "", fmt.Errorf("failed to read control file: %w", err)
+                }
+                return buf.String(), nil
+            }
+        }
+
+        return "", fmt.Errorf("control file not found in %s", header.Name)
+    }
+
+    return "", fmt.Errorf("control archive not found")
+}
+
 // parseControl парсит debian control файл
 func parseControl(data string) (*DebControl, error) {
     control := &DebControl{}
@@ -299,13 +465,15 @@ func parseControl(data string) (*DebControl, error) {
             control.Suggests = parseDepends(value)
         case "Conflicts":
             control.Conflicts = parseDepends(value)
+        case "Breaks":
+            control.Breaks = parseDepends(value)
         case "Provides":
             control.Provides = parseDepends(value)
         case "Replaces":
             control.Replaces = parseDepends(value)
         case "Installed-Size":
-            control.Size, _ = strconv.ParseInt(value, 10, 64)
-            control.Size *= 1024 // Convert to bytes
+            control.InstalledSize, _ = strconv.ParseInt(value, 10, 64)
+            control.InstalledSize *= 1024 // Convert to bytes
         }
     }
 
@@ -313,54 +481,385 @@ func parseControl(data string) (*DebControl, error) {
     return control, nil
 }
 
-// parseDepends парсит строку зависимостей debian пакета
-func parseDepends(deps string) []string {
+// debDependencyRe запись зависимости вида "name[:arch] (>= version)"
+var debDependencyRe = regexp.MustCompile(`^([^\s:(\[<]+)(?::\S+)?\s*(?:\(\s*(<<|<=|>=|>>|=|<|>)\s*([^\s)]+)\s*\))?`)
+
+// parseDepends парсит строку зависимостей debian пакета. Каждая
+// группа через запятую может содержать альтернативы через "|"
+func parseDepends(deps string) []DependencyGroup {
     if deps == "" {
         return nil
     }
 
-    var result []string
-    for _, dep := range strings.Split(deps, ",") {
-        dep = strings.TrimSpace(dep)
-        if dep != "" {
-            // Оставляем только имя пакета, убираем версионные ограничения
-            if i := strings.Index(dep, " "); i > 0 {
-                dep = dep[:i]
+    var result []DependencyGroup
+    for _, group := range strings.Split(deps, ",") {
+        var alternatives DependencyGroup
+        for _, dep := range strings.Split(group, "|") {
+            if d, ok := parseDependency(dep); ok {
+                alternatives = append(alternatives, d)
             }
-            result = append(result, dep)
+        }
+        if len(alternatives) > 0 {
+            result = append(result, alternatives)
         }
     }
     return result
 }
 
+// parseDependency парсит одну зависимость с необязательным
+// ограничением версии. Квалификатор архитектуры (":any") отбрасывается
+func parseDependency(dep string) (Dependency, bool) {
+    m := debDependencyRe.FindStringSubmatch(strings.TrimSpace(dep))
+    if m == nil {
+        return Dependency{}, false
+    }
+    return Dependency{Name: m[1], Relation: m[2], Version: m[3]}, true
+}
+
+// dependencyNames возвращает имена зависимостей без ограничений версий.
+// Альтернативы сохраняются в виде "a | b"
+func dependencyNames(groups []DependencyGroup) []string {
+    if len(groups) == 0 {
+        return nil
+    }
+
+    names := make([]string, len(groups))
+    for i, group := range groups {
+        alternatives := make([]string, len(group))
+        for j, dep := range group {
+            alternatives[j] = dep.Name
+        }
+        names[i] = strings.Join(alternatives, " | ")
+    }
+    return names
+}
+
+// debContentsRe строка вывода dpkg-deb -c
+var debContentsRe = regexp.MustCompile(`^(\S{10})\s+\S+\s+(\d+)\s+(\S+ \S+)\s+(.+)$`)
+
+// ListFiles возвращает список файлов пакета
+func (d *Deb) ListFiles() ([]FileInfo, error) {
+    output, err := CommandRunner.Output(context.Background(), "dpkg-deb", "-c", d.Path)
+    if err != nil {
+        return nil, fmt.Errorf("failed to list package contents: %w", err)
+    }
+
+    var files []FileInfo
+    for _, line := range strings.Split(string(output), "\n") {
+        m := debContentsRe.FindStringSubmatch(line)
+        if m == nil {
+            continue
+        }
+
+        name := m[4]
+        if i := strings.Index(name, " -> "); i >= 0 {
+            name = name[:i]
+        }
+        if i := strings.Index(name, " link to "); i >= 0 {
+            name = name[:i]
+        }
+        name = strings.TrimSuffix(strings.TrimPrefix(name, "."), "/")
+        if name == "" {
+            continue
+        }
+
+        mode := parseModeString(m[1])
+        size, _ := strconv.ParseInt(m[2], 10, 64)
+        modTime, _ := time.Parse("2006-01-02 15:04", m[3])
+
+        files = append(files, FileInfo{
+            Path:    name,
+            Size:    size,
+            Mode:    mode,
+            ModTime: modTime,
+            IsDir:   mode.IsDir(),
+        })
+    }
+
+    return files, nil
+}
+
+// Verify проверяет что все члены ar архива распаковываются без ошибок,
+// а control файл разбирается
+func (d *Deb) Verify() error {
+    f, err := os.Open(d.Path)
+    if err != nil {
+        return fmt.Errorf("failed to open package: %w", err)
+    }
+    defer f.Close()
+
+    ar, err := newArReader(f)
+    if err != nil {
+        return fmt.Errorf("%w: %v", ErrCorruptedPackage, err)
+    }
+
+    for {
+        header, err := ar.Next()
+        if err == io.EOF {
+            break
+        }
+        if err != nil {
+            return fmt.Errorf("%w: %v", ErrCorruptedPackage, err)
+        }
+
+        if !strings.HasPrefix(header.Name, "control.tar") && !strings.HasPrefix(header.Name, "data.tar") {
+            continue
+        }
+
+        r, closeReader, err := decompressStream(ar)
+        if err != nil {
+            return fmt.Errorf("%w: %s: %v", ErrCorruptedPackage, header.Name, err)
+        }
+
+        err = verifyTarEntries(tar.NewReader(r), func(name string, th *tar.Header) (string, int64) {
+            return "", th.Size
+        })
+        closeReader()
+        if err != nil {
+            return err
+        }
+    }
+
+    control, err := d.readControl()
+    if err != nil {
+        return fmt.Errorf("%w: %v", ErrCorruptedPackage, err)
+    }
+    if _, err := parseControl(control); err != nil {
+        return fmt.Errorf("%w: %v", ErrCorruptedPackage, err)
+    }
+    return nil
+}
+
+// Extract распаковывает data.tar.* в dest
+func (d *Deb) Extract(dest string) error {
+    absDest, err := prepareExtractDir(dest)
+    if err != nil {
+        return err
+    }
+
+    f, err := os.Open(d.Path)
+    if err != nil {
+        return fmt.Errorf("failed to open package: %w", err)
+    }
+    defer f.Close()
+
+    ar, err := newArReader(f)
+    if err != nil {
+        return err
+    }
+
+    for {
+        header, err := ar.Next()
+        if err == io.EOF {
+            break
+        }
+        if err != nil {
+            return err
+        }
+
+        if !strings.HasPrefix(header.Name, "data.tar") {
+            continue
+        }
+
+        r, closeReader, err := decompressStream(ar)
+        if err != nil {
+            return err
+        }
+        defer closeReader()
+
+        return extractTar(tar.NewReader(r), absDest, nil)
+    }
+
+    return fmt.Errorf("data archive not found")
+}
+
 // GetType возвращает тип пакета
 func (d *Deb) GetType() PackageType {
     return TypeDeb
 }
 
+// Comparator возвращает компаратор версий
+func (d *Deb) Comparator() VersionComparator {
+    return DebVersion{}
+}
+
 // String возвращает строковое представление пакета
 func (d *Deb) String() string {
     if d.Info != nil {
         return fmt.Sprintf("%s_%s_%s.deb", d.Info.Name, d.Info.Version, d.Info.Architecture)
     }
+    if d.Name != "" {
+        return fmt.Sprintf("%s_%s_%s.deb", d.Name, d.Version, d.arch)
+    }
     return filepath.Base(d.Path)
 }
 
 // VerifySignature проверяет подпись пакета
 func (d *Deb) VerifySignature() error {
-    cmd := exec.Command("dpkg-sig", "--verify", d.Path)
-    if output, err := cmd.CombinedOutput(); err != nil {
+    if output, err := CommandRunner.Run(context.Background(), "dpkg-sig", "--verify", d.Path); err != nil {
         return fmt.Errorf("signature verification failed: %s: %w", string(output), err)
     }
     return nil
 }
 
+// VerifySignatureWith проверяет подпись debsigs (член _gpgorigin) по
+// связке открытых ключей keyringPath без dpkg-sig и возвращает
+// идентификатор подписавшего. Для неподписанного пакета возвращает ErrUnsigned
+func (d *Deb) VerifySignatureWith(keyringPath string) (string, error) {
+    sig, err := d.readArMember("_gpgorigin")
+    if err != nil {
+        return "", err
+    }
+    if sig == nil {
+        return "", ErrUnsigned
+    }
+
+    keyring, err := readKeyring(keyringPath)
+    if err != nil {
+        return "", err
+    }
+
+    // Подписана конкатенация debian-binary, control.tar.* и data.tar.*
+    pr, pw := io.Pipe()
+    go func() {
+        pw.CloseWithError(d.writeSignedMembers(pw))
+    }()
+    defer pr.Close()
+
+    var signer *openpgp.Entity
+    if bytes.HasPrefix(bytes.TrimSpace(sig), []byte("-----BEGIN PGP SIGNATURE")) {
+        signer, err = openpgp.CheckArmoredDetachedSignature(keyring, pr, bytes.NewReader(sig))
+    } else {
+        signer, err = openpgp.CheckDetachedSignature(keyring, pr, bytes.NewReader(sig))
+    }
+    if err != nil {
+        return "", fmt.Errorf("signature verification failed: %w", err)
+    }
+
+    return signerIdentity(signer), nil
+}
+
+// readArMember возвращает содержимое члена ar архива или nil, если его нет
+func (d *Deb) readArMember(name string) ([]byte, error) {
+    f, err := os.Open(d.Path)
+    if err != nil {
+        return nil, fmt.Errorf("failed to open package: %w", err)
+    }
+    defer f.Close()
+
+    ar, err := newArReader(f)
+    if err != nil {
+        return nil, err
+    }
+
+    for {
+        header, err := ar.Next()
+        if err == io.EOF {
+            return nil, nil
+        }
+        if err != nil {
+            return nil, err
+        }
+        if header.Name == name {
+            return io.ReadAll(ar)
+        }
+    }
+}
+
+// writeSignedMembers записывает в w данные, подписываемые debsigs
+func (d *Deb) writeSignedMembers(w io.Writer) error {
+    f, err := os.Open(d.Path)
+    if err != nil {
+        return fmt.Errorf("failed to open package: %w", err)
+    }
+    defer f.Close()
+
+    ar, err := newArReader(f)
+    if err != nil {
+        return err
+    }
+
+    for {
+        header, err := ar.Next()
+        if err == io.EOF {
+            return nil
+        }
+        if err != nil {
+            return err
+        }
+
+        if header.Name == "debian-binary" ||
+            strings.HasPrefix(header.Name, "control.tar") ||
+            strings.HasPrefix(header.Name, "data.tar") {
+            if _, err := io.Copy(w, ar); err != nil {
+                return err
+            }
+        }
+    }
+}
+
 // ExtractControl извлекает control файл из пакета
 func (d *Deb) ExtractControl() (string, error) {
-    cmd := exec.Command("dpkg-deb", "-I", d.Path)
-    output, err := cmd.Output()
+    output, err := CommandRunner.Output(context.Background(), "dpkg-deb", "-I", d.Path)
     if err != nil {
         return "", fmt.Errorf("failed to extract control: %w", err)
     }
     return string(output), nil
-}
\ No newline at end of file
+}
+// DebManager реализация PackageManager поверх dpkg
+type DebManager struct{}
+
+// NewDebManager создает новый экземпляр DebManager
+func NewDebManager() *DebManager {
+    return &DebManager{}
+}
+
+// CreatePackage создает Deb пакет из файла
+func (m *DebManager) CreatePackage(path string) (Package, error) {
+    return NewDeb(path)
+}
+
+// ListInstalled возвращает список установленных пакетов из базы dpkg
+func (m *DebManager) ListInstalled() ([]PackageInfo, error) {
+    return ListInstalled(TypeDeb)
+}
+
+// IsInstalled проверяет установлен ли пакет
+func (m *DebManager) IsInstalled(name string) bool {
+    output, err := CommandRunner.Output(context.Background(), "dpkg", "-s", name)
+    if err != nil {
+        return false
+    }
+
+    // Пакет может остаться в базе в состоянии deinstall или config-files
+    for _, line := range strings.Split(string(output), "\n") {
+        if strings.HasPrefix(line, "Status:") {
+            return strings.HasSuffix(strings.TrimSpace(line), " installed")
+        }
+    }
+    return false
+}
+
+// GetDependencies возвращает список зависимостей пакета
+func (m *DebManager) GetDependencies(pkg Package) ([]string, error) {
+    info, err := pkg.GetInfo(context.Background())
+    if err != nil {
+        return nil, err
+    }
+    return info.Dependencies, nil
+}
+
+// ValidateSystem проверяет наличие dpkg в системе
+func (m *DebManager) ValidateSystem() error {
+    for _, bin := range []string{"dpkg", "dpkg-query"} {
+        if _, err := CommandRunner.LookPath(bin); err != nil {
+            return fmt.Errorf("%s not found: %w", bin, ErrNotSupported)
+        }
+    }
+    return nil
+}
+
+// GetType возвращает тип пакетного менеджера
+func (m *DebManager) GetType() PackageType {
+    return TypeDeb
+}
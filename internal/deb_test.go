@@ -0,0 +1,184 @@
+package internal
+
+import (
+    "bytes"
+    "context"
+    "errors"
+    "os"
+    "path/filepath"
+    "reflect"
+    "testing"
+
+    "golang.org/x/crypto/openpgp"
+    "golang.org/x/crypto/openpgp/armor"
+)
+
+func TestDebGetInfoWithoutDpkg(t *testing.T) {
+    deb := buildTestDeb(t, t.TempDir(), "hello.deb", testDebControl)
+    runner := useFakeRunner(t)
+
+    pkg, err := NewDeb(deb)
+    if err != nil {
+        t.Fatal(err)
+    }
+    info, err := pkg.GetInfo(context.Background())
+    if err != nil {
+        t.Fatalf("GetInfo: %v", err)
+    }
+
+    if info.Name != "hello" || info.Version != "1.0-1" || info.Architecture != "amd64" {
+        t.Errorf("info = %s %s %s, want hello 1.0-1 amd64", info.Name, info.Version, info.Architecture)
+    }
+    if info.Maintainer != "Test <test@example.com>" {
+        t.Errorf("maintainer = %q", info.Maintainer)
+    }
+    if want := []string{"libc6", "foo | bar"}; !reflect.DeepEqual(info.Dependencies, want) {
+        t.Errorf("dependencies = %q, want %q", info.Dependencies, want)
+    }
+    assertCalls(t, runner)
+}
+
+func TestParseDependsConstraints(t *testing.T) {
+    tests := []struct {
+        deps string
+        want []DependencyGroup
+    }{
+        {"", nil},
+        {"libc6", []DependencyGroup{{{Name: "libc6"}}}},
+        {"libc6 (>= 2.31)", []DependencyGroup{{{Name: "libc6", Relation: ">=", Version: "2.31"}}}},
+        {"libc6(>=2.31)", []DependencyGroup{{{Name: "libc6", Relation: ">=", Version: "2.31"}}}},
+        {"python3:any (<< 3.13), perl (= 5.36.0-7)", []DependencyGroup{
+            {{Name: "python3", Relation: "<<", Version: "3.13"}},
+            {{Name: "perl", Relation: "=", Version: "5.36.0-7"}},
+        }},
+        {"libfoo1 (>> 1:2.0~rc1)", []DependencyGroup{{{Name: "libfoo1", Relation: ">>", Version: "1:2.0~rc1"}}}},
+        {"foo | bar", []DependencyGroup{{{Name: "foo"}, {Name: "bar"}}}},
+    }
+
+    for _, tt := range tests {
+        if got := parseDepends(tt.deps); !reflect.DeepEqual(got, tt.want) {
+            t.Errorf("parseDepends(%q) = %v, want %v", tt.deps, got, tt.want)
+        }
+    }
+}
+
+func TestDependencyNames(t *testing.T) {
+    groups := parseDepends("libc6 (>= 2.31), foo (>= 1) | bar")
+    want := []string{"libc6", "foo | bar"}
+    if got := dependencyNames(groups); !reflect.DeepEqual(got, want) {
+        t.Errorf("dependencyNames = %q, want %q", got, want)
+    }
+}
+
+func TestParseDependsAlternatives(t *testing.T) {
+    groups := parseDepends("default-mta (>= 1.0) | mail-transport-agent, awk | mawk (<< 2:0), libc6")
+    want := []DependencyGroup{
+        {{Name: "default-mta", Relation: ">=", Version: "1.0"}, {Name: "mail-transport-agent"}},
+        {{Name: "awk"}, {Name: "mawk", Relation: "<<", Version: "2:0"}},
+        {{Name: "libc6"}},
+    }
+    if !reflect.DeepEqual(groups, want) {
+        t.Fatalf("parseDepends = %v, want %v", groups, want)
+    }
+
+    if got := groups[0].String(); got != "default-mta (>= 1.0) | mail-transport-agent" {
+        t.Errorf("String() = %q", got)
+    }
+
+    alternatives := DependencyAlternatives(dependencyNames(groups))
+    wantAlternatives := [][]string{{"default-mta", "mail-transport-agent"}, {"awk", "mawk"}, {"libc6"}}
+    if !reflect.DeepEqual(alternatives, wantAlternatives) {
+        t.Errorf("DependencyAlternatives = %q, want %q", alternatives, wantAlternatives)
+    }
+}
+
+// signTestDeb добавляет в пакет подпись debsigs (член _gpgorigin),
+// созданную ключом signer
+func signTestDeb(t *testing.T, path string, signer *openpgp.Entity) {
+    t.Helper()
+    pkg, err := NewDeb(path)
+    if err != nil {
+        t.Fatal(err)
+    }
+    var signed, sig bytes.Buffer
+    if err := pkg.writeSignedMembers(&signed); err != nil {
+        t.Fatal(err)
+    }
+    if err := openpgp.ArmoredDetachSign(&sig, signer, &signed, nil); err != nil {
+        t.Fatal(err)
+    }
+
+    f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0)
+    if err != nil {
+        t.Fatal(err)
+    }
+    defer f.Close()
+    if err := writeArMember(f, "_gpgorigin", 0, int64(sig.Len()), &sig); err != nil {
+        t.Fatal(err)
+    }
+}
+
+// writeTestKeyring сохраняет открытый ключ entity в armored виде
+func writeTestKeyring(t *testing.T, dir string, entity *openpgp.Entity) string {
+    t.Helper()
+    var buf bytes.Buffer
+    w, err := armor.Encode(&buf, openpgp.PublicKeyType, nil)
+    if err != nil {
+        t.Fatal(err)
+    }
+    if err := entity.Serialize(w); err != nil {
+        t.Fatal(err)
+    }
+    if err := w.Close(); err != nil {
+        t.Fatal(err)
+    }
+
+    path := filepath.Join(dir, entity.PrimaryKey.KeyIdShortString()+".asc")
+    if err := os.WriteFile(path, buf.Bytes(), 0644); err != nil {
+        t.Fatal(err)
+    }
+    return path
+}
+
+func TestDebVerifySignatureWith(t *testing.T) {
+    dir := t.TempDir()
+    signer, err := openpgp.NewEntity("Test Signer", "", "signer@example.com", nil)
+    if err != nil {
+        t.Fatal(err)
+    }
+    other, err := openpgp.NewEntity("Other", "", "other@example.com", nil)
+    if err != nil {
+        t.Fatal(err)
+    }
+    keyring := writeTestKeyring(t, dir, signer)
+    otherKeyring := writeTestKeyring(t, dir, other)
+
+    signed := buildTestDeb(t, filepath.Join(dir, "signed"), "hello.deb", testDebControl)
+    signTestDeb(t, signed, signer)
+    unsigned := buildTestDeb(t, filepath.Join(dir, "unsigned"), "hello.deb", testDebControl)
+
+    pkg, err := NewDeb(signed)
+    if err != nil {
+        t.Fatal(err)
+    }
+    identity, err := pkg.VerifySignatureWith(keyring)
+    if err != nil {
+        t.Fatalf("VerifySignatureWith: %v", err)
+    }
+    if identity != "Test Signer <signer@example.com>" {
+        t.Errorf("identity = %q, want Test Signer <signer@example.com>", identity)
+    }
+
+    _, err = pkg.VerifySignatureWith(otherKeyring)
+    if err == nil || errors.Is(err, ErrUnsigned) {
+        t.Errorf("wrong key: error = %v, want a verification failure", err)
+    }
+
+    pkg, err = NewDeb(unsigned)
+    if err != nil {
+        t.Fatal(err)
+    }
+    if _, err := pkg.VerifySignatureWith(keyring); !errors.Is(err, ErrUnsigned) {
+        t.Errorf("unsigned: error = %v, want ErrUnsigned", err)
+    }
+}
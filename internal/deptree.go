@@ -0,0 +1,337 @@
+// internal/deptree.go
+package internal
+
+import (
+    "context"
+    "fmt"
+    "strconv"
+    "strings"
+)
+
+// DepNode узел дерева зависимостей
+type DepNode struct {
+    Name     string     `json:"name"`
+    Version  string     `json:"version,omitempty"`
+    Children []*DepNode `json:"children,omitempty"`
+}
+
+// GetDependencyTree строит дерево зависимостей пакета глубиной depth
+// (0 - без ограничения). Зависимости раскрываются по базе установленных
+// пакетов; если бэкенд недоступен, возвращаются только прямые зависимости
+func GetDependencyTree(ctx context.Context, pkg Package, depth int) (*DepNode, error) {
+    info, err := pkg.GetInfo(ctx)
+    if err != nil {
+        return nil, fmt.Errorf("failed to read package info: %w", err)
+    }
+
+    installed, err := ListInstalled(pkg.GetType())
+    if err != nil {
+        logger.Debugf("Dependencies will not be resolved: %v", err)
+    }
+
+    // Индекс установленных пакетов по имени и Provides
+    index := make(map[string]*PackageInfo)
+    for i := range installed {
+        other := &installed[i]
+        for name := range providedNames(other) {
+            if _, ok := index[name]; !ok || name == other.Name {
+                index[name] = other
+            }
+        }
+    }
+
+    root := &DepNode{Name: info.Name, Version: info.Version}
+    buildDepTree(root, info.Dependencies, index, depth, map[string]bool{info.Name: true})
+    return root, nil
+}
+
+// buildDepTree добавляет к node дочерние узлы для deps. ancestors
+// защищает от бесконечной рекурсии на циклических зависимостях
+func buildDepTree(node *DepNode, deps []string, index map[string]*PackageInfo, depth int, ancestors map[string]bool) {
+    for _, dep := range deps {
+        resolved := resolveInstalled(dep, index)
+        if resolved == nil {
+            node.Children = append(node.Children, &DepNode{Name: dep})
+            continue
+        }
+
+        child := &DepNode{Name: resolved.Name, Version: resolved.Version}
+        node.Children = append(node.Children, child)
+
+        if depth == 1 || ancestors[resolved.Name] {
+            continue
+        }
+
+        ancestors[resolved.Name] = true
+        buildDepTree(child, resolved.Dependencies, index, depth-1, ancestors)
+        delete(ancestors, resolved.Name)
+    }
+}
+
+// resolveInstalled находит установленный пакет, удовлетворяющий
+// зависимости. Альтернативы вида "a | b" проверяются по порядку
+func resolveInstalled(dep string, index map[string]*PackageInfo) *PackageInfo {
+    for _, alt := range splitAlternatives(dep) {
+        if info, ok := index[dependencyName(alt)]; ok {
+            return info
+        }
+    }
+    return nil
+}
+
+// Утилиты, которыми ResolveDependencyTree разрешает зависимости
+// по репозиториям
+var resolverTools = map[PackageType]string{
+    TypeDeb:    "apt-cache",
+    TypeRPM:    "dnf",
+    TypePacman: "pactree",
+}
+
+// ResolveDependencyTree строит транзитивное дерево зависимостей пакета
+// глубиной depth (0 - без ограничения) по репозиториям нативного
+// менеджера: apt-cache для deb, dnf repoquery для rpm, pactree для
+// pacman. Если утилиты нет, возвращает ErrBackendUnavailable
+func ResolveDependencyTree(ctx context.Context, pkg Package, depth int) (*DepNode, error) {
+    tool, ok := resolverTools[pkg.GetType()]
+    if !ok {
+        return nil, ErrNotSupported
+    }
+    if _, err := CommandRunner.LookPath(tool); err != nil {
+        return nil, fmt.Errorf("%w: resolving %s dependencies requires %s", ErrBackendUnavailable, pkg.GetType(), tool)
+    }
+
+    info, err := pkg.GetInfo(ctx)
+    if err != nil {
+        return nil, fmt.Errorf("failed to read package info: %w", err)
+    }
+
+    // Из альтернатив разрешается первая
+    var deps []string
+    for _, dep := range info.Dependencies {
+        if alternatives := splitAlternatives(dep); len(alternatives) > 0 {
+            deps = append(deps, alternatives[0])
+        }
+    }
+
+    root := &DepNode{Name: info.Name, Version: info.Version}
+    switch pkg.GetType() {
+    case TypeDeb:
+        err = resolveAptTree(ctx, root, deps, depth)
+    case TypeRPM:
+        err = resolveDnfTree(ctx, root, deps, depth)
+    case TypePacman:
+        err = resolvePactree(ctx, root, deps, depth)
+    }
+    if err != nil {
+        return nil, err
+    }
+    return root, nil
+}
+
+// resolveAptTree строит дерево по графу зависимостей из apt-cache depends
+func resolveAptTree(ctx context.Context, root *DepNode, deps []string, depth int) error {
+    names := make([]string, len(deps))
+    for i, dep := range deps {
+        names[i] = dependencyName(dep)
+    }
+    if len(names) == 0 {
+        return nil
+    }
+
+    args := []string{"depends", "--recurse", "--no-recommends", "--no-suggests",
+        "--no-conflicts", "--no-breaks", "--no-replaces", "--no-enhances"}
+    output, err := CommandRunner.Output(ctx, "apt-cache", append(args, names...)...)
+    if err != nil {
+        return fmt.Errorf("apt-cache depends failed: %w", err)
+    }
+
+    graph := parseAptDepends(string(output))
+    treeFromGraph(root, names, graph, depth, map[string]bool{root.Name: true})
+    return nil
+}
+
+// parseAptDepends разбирает вывод apt-cache depends в граф зависимостей.
+// Из альтернатив ("|Depends:") берется первая; виртуальный пакет
+// "<name>" становится узлом, дочерние узлы которого - поставщики
+func parseAptDepends(output string) map[string][]string {
+    graph := make(map[string][]string)
+    current, virtual := "", ""
+    skipAlternative := false
+
+    for _, line := range strings.Split(output, "\n") {
+        switch {
+        case strings.TrimSpace(line) == "":
+            continue
+        case !strings.HasPrefix(line, " "):
+            current, virtual = strings.TrimSpace(line), ""
+            if _, ok := graph[current]; !ok {
+                graph[current] = nil
+            }
+        case strings.HasPrefix(line, "    "):
+            // Поставщик виртуального пакета из предыдущей строки
+            if virtual != "" {
+                graph[virtual] = append(graph[virtual], strings.TrimSpace(line))
+            }
+        default:
+            kind, dep, ok := strings.Cut(strings.TrimSpace(line), ": ")
+            if !ok || current == "" {
+                continue
+            }
+            alternative := strings.HasPrefix(kind, "|")
+            skip := skipAlternative
+            skipAlternative = alternative
+
+            virtual = ""
+            if strings.HasPrefix(dep, "<") {
+                virtual = dep
+            }
+            if !skip {
+                graph[current] = append(graph[current], dep)
+            }
+        }
+    }
+    return graph
+}
+
+// resolveDnfTree обходит зависимости в ширину запросами dnf repoquery.
+// Зависимости rpm - это возможности, поэтому для прямых зависимостей
+// сначала ищется предоставляющий их пакет
+func resolveDnfTree(ctx context.Context, root *DepNode, deps []string, depth int) error {
+    var names []string
+    for _, dep := range deps {
+        capability := strings.Fields(dep)[0]
+        providers, err := dnfQuery(ctx, "--whatprovides", capability)
+        if err != nil {
+            return err
+        }
+        if len(providers) == 0 {
+            names = append(names, capability)
+            continue
+        }
+        names = append(names, providers[0])
+    }
+
+    graph := make(map[string][]string)
+    level := names
+    for d := 1; len(level) > 0 && (depth == 0 || d < depth); d++ {
+        var next []string
+        for _, name := range level {
+            if _, ok := graph[name]; ok {
+                continue
+            }
+            requires, err := dnfQuery(ctx, "--requires", "--resolve", name)
+            if err != nil {
+                return err
+            }
+            graph[name] = requires
+            next = append(next, requires...)
+        }
+        level = next
+    }
+
+    treeFromGraph(root, names, graph, depth, map[string]bool{root.Name: true})
+    return nil
+}
+
+// dnfQuery возвращает имена пакетов из dnf repoquery с аргументами args
+func dnfQuery(ctx context.Context, args ...string) ([]string, error) {
+    args = append([]string{"repoquery", "--quiet", "--qf", "%{name}"}, args...)
+    output, err := CommandRunner.Output(ctx, "dnf", args...)
+    if err != nil {
+        return nil, fmt.Errorf("dnf repoquery failed: %w", err)
+    }
+
+    var names []string
+    seen := make(map[string]bool)
+    for _, name := range strings.Fields(string(output)) {
+        if !seen[name] {
+            seen[name] = true
+            names = append(names, name)
+        }
+    }
+    return names, nil
+}
+
+// resolvePactree строит поддерево каждой прямой зависимости по выводу
+// pactree. Зависимости, которых нет в синхронизированных базах,
+// остаются листьями
+func resolvePactree(ctx context.Context, root *DepNode, deps []string, depth int) error {
+    for _, dep := range deps {
+        name := dependencyName(dep)
+        if depth == 1 {
+            root.Children = append(root.Children, &DepNode{Name: name})
+            continue
+        }
+
+        args := []string{"-s", "-a"}
+        if depth > 1 {
+            args = append(args, "-d", strconv.Itoa(depth-1))
+        }
+        output, err := CommandRunner.Output(ctx, "pactree", append(args, name)...)
+        if err != nil {
+            if ctx.Err() != nil {
+                return ctx.Err()
+            }
+            logger.Debugf("pactree could not resolve %s: %v", name, err)
+            root.Children = append(root.Children, &DepNode{Name: name})
+            continue
+        }
+
+        if node := parsePactree(string(output)); node != nil {
+            root.Children = append(root.Children, node)
+        }
+    }
+    return nil
+}
+
+// parsePactree разбирает ASCII дерево pactree -a. Уровень вложенности
+// определяется отступом: по два символа на уровень
+func parsePactree(output string) *DepNode {
+    var stack []*DepNode
+    for _, line := range strings.Split(output, "\n") {
+        name := strings.TrimLeft(line, "|`- ")
+        if name == "" {
+            continue
+        }
+        level := (len(line) - len(name)) / 2
+        // "sh provides sh" - берется имя пакета
+        node := &DepNode{Name: strings.Fields(name)[0]}
+
+        if len(stack) == 0 {
+            stack = []*DepNode{node}
+            continue
+        }
+        if level == 0 {
+            continue
+        }
+        if level > len(stack) {
+            level = len(stack)
+        }
+        stack = stack[:level]
+        parent := stack[level-1]
+        parent.Children = append(parent.Children, node)
+        stack = append(stack, node)
+    }
+
+    if len(stack) == 0 {
+        return nil
+    }
+    return stack[0]
+}
+
+// treeFromGraph добавляет к node дочерние узлы names, раскрывая их по
+// графу graph. Каждый пакет раскрывается только при первом появлении,
+// иначе дерево растет экспоненциально; это же защищает от циклов
+func treeFromGraph(node *DepNode, names []string, graph map[string][]string, depth int, expanded map[string]bool) {
+    for _, name := range names {
+        child := &DepNode{Name: name}
+        node.Children = append(node.Children, child)
+
+        if depth == 1 || expanded[name] {
+            continue
+        }
+
+        expanded[name] = true
+        treeFromGraph(child, graph[name], graph, depth-1, expanded)
+    }
+}
@@ -0,0 +1,185 @@
+// internal/detect.go
+package internal
+
+import (
+    "archive/tar"
+    "bytes"
+    "compress/gzip"
+    "fmt"
+    "io"
+    "os"
+    "path"
+    "path/filepath"
+    "strings"
+)
+
+// Магические числа форматов
+var (
+    magicAr    = []byte("!<arch>\n")
+    magicRPM   = []byte{0xED, 0xAB, 0xEE, 0xDB}
+    magicGzip  = []byte{0x1F, 0x8B}
+    magicXz    = []byte{0xFD, '7', 'z', 'X', 'Z', 0x00}
+    magicZstd  = []byte{0x28, 0xB5, 0x2F, 0xFD}
+    magicBzip2 = []byte("BZh")
+    magicLz4   = []byte{0x04, 0x22, 0x4D, 0x18}
+    magicZip   = []byte("PK\x03\x04")
+    magicUstar = []byte("ustar")
+)
+
+// unsupportedMagic распознаваемые, но не поддерживаемые форматы сжатия
+var unsupportedMagic = []struct {
+    magic []byte
+    name  string
+}{
+    {[]byte{0x5D, 0x00, 0x00}, "lzma"},
+    {[]byte("LZIP"), "lzip"},
+    {[]byte{0x1F, 0x9D}, "compress"},
+    {[]byte{0x89, 'L', 'Z', 'O'}, "lzop"},
+    {magicZip, "zip"},
+}
+
+// describeMagic возвращает описание неподдерживаемого формата для
+// сообщений об ошибках
+func describeMagic(magic []byte) string {
+    for _, known := range unsupportedMagic {
+        if bytes.HasPrefix(magic, known.magic) {
+            return "detected " + known.name
+        }
+    }
+    if len(magic) == 0 {
+        return "empty stream"
+    }
+    return fmt.Sprintf("unknown magic % x; supported: gzip, xz, zstd, bzip2, lz4, tar", magic)
+}
+
+// Смещение сигнатуры ustar в заголовке tar
+const ustarOffset = 257
+
+// Максимальное количество записей tar, просматриваемых при определении формата
+const sniffTarEntries = 16
+
+// detectByExtension определяет тип пакета по расширению без учета регистра
+func detectByExtension(path string) PackageType {
+    base := strings.ToLower(filepath.Base(path))
+    switch filepath.Ext(base) {
+    case ".deb":
+        return TypeDeb
+    case ".rpm":
+        return TypeRPM
+    case ".eopkg":
+        return TypeEopkg
+    case ".apk":
+        return TypeAPK
+    }
+
+    // Пакеты pacman: name-ver-rel-arch.pkg.tar.*
+    if strings.Contains(base, ".pkg.tar") {
+        return TypePacman
+    }
+    return TypeUnknown
+}
+
+// DetectPackageType определяет тип пакета по расширению, а если оно не
+// подходит - по первым байтам файла
+func DetectPackageType(path string) PackageType {
+    if pt := detectByExtension(path); pt != TypeUnknown {
+        return pt
+    }
+
+    pt, err := DetectByMagic(path)
+    if err != nil {
+        logger.WithField("path", path).Debugf("Magic detection failed: %v", err)
+        return TypeUnknown
+    }
+    return pt
+}
+
+// DetectByMagic определяет тип пакета по первым байтам файла,
+// не полагаясь на расширение
+func DetectByMagic(path string) (PackageType, error) {
+    f, err := os.Open(path)
+    if err != nil {
+        return TypeUnknown, fmt.Errorf("failed to open package: %w", err)
+    }
+    defer f.Close()
+
+    header := make([]byte, ustarOffset+len(magicUstar))
+    n, err := io.ReadFull(f, header)
+    if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+        return TypeUnknown, fmt.Errorf("failed to read package header: %w", err)
+    }
+    header = header[:n]
+
+    if n == 0 {
+        return TypeUnknown, ErrEmptyPackage
+    }
+
+    switch {
+    case bytes.HasPrefix(header, magicAr):
+        return TypeDeb, nil
+    case bytes.HasPrefix(header, magicRPM):
+        return TypeRPM, nil
+    case bytes.HasPrefix(header, magicZip):
+        return TypeEopkg, nil
+    case bytes.HasPrefix(header, magicXz), bytes.HasPrefix(header, magicZstd):
+        // xz и zstd tar архивы используются только pacman
+        return TypePacman, nil
+    }
+
+    if _, err := f.Seek(0, io.SeekStart); err != nil {
+        return TypeUnknown, fmt.Errorf("failed to rewind package: %w", err)
+    }
+
+    switch {
+    case bytes.HasPrefix(header, magicGzip):
+        gzr, err := gzip.NewReader(f)
+        if err != nil {
+            return TypeUnknown, ErrCorruptedPackage
+        }
+        defer gzr.Close()
+        return sniffTarType(gzr), nil
+    case bytes.HasPrefix(header, magicBzip2), bytes.HasPrefix(header, magicLz4):
+        r, closeReader, err := decompressStream(f)
+        if err != nil {
+            return TypeUnknown, err
+        }
+        defer closeReader()
+        return sniffTarType(r), nil
+    case len(header) >= ustarOffset+len(magicUstar) &&
+        bytes.Equal(header[ustarOffset:ustarOffset+len(magicUstar)], magicUstar):
+        return sniffTarType(f), nil
+    }
+
+    return TypeUnknown, ErrInvalidFormat
+}
+
+// sniffTarType определяет формат tar пакета по служебным файлам
+func sniffTarType(r io.Reader) PackageType {
+    tr := tar.NewReader(r)
+    hasPKGINFO := false
+
+    for i := 0; i < sniffTarEntries; i++ {
+        header, err := tr.Next()
+        if err != nil {
+            break
+        }
+
+        name := path.Clean(strings.TrimPrefix(header.Name, "./"))
+        switch {
+        case name == "metadata.xml":
+            return TypeEopkg
+        case name == ".MTREE", name == ".BUILDINFO":
+            return TypePacman
+        case strings.HasPrefix(name, ".SIGN."):
+            return TypeAPK
+        case name == ".PKGINFO":
+            hasPKGINFO = true
+        }
+    }
+
+    // .PKGINFO без файлов pacman считаем пакетом Alpine
+    if hasPKGINFO {
+        return TypeAPK
+    }
+    return TypeUnknown
+}
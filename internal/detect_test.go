@@ -0,0 +1,113 @@
+package internal
+
+import (
+    "context"
+    "os"
+    "path/filepath"
+    "testing"
+)
+
+func TestCreatePackageFromPathDetectsContent(t *testing.T) {
+    dir := t.TempDir()
+    deb := buildTestDeb(t, dir, "hello.deb", testDebControl)
+
+    for _, name := range []string{"hello.deb", "HELLO.DEB", "download"} {
+        t.Run(name, func(t *testing.T) {
+            path := filepath.Join(dir, name)
+            if path != deb {
+                data, err := os.ReadFile(deb)
+                if err != nil {
+                    t.Fatal(err)
+                }
+                if err := os.WriteFile(path, data, 0644); err != nil {
+                    t.Fatal(err)
+                }
+            }
+
+            pkg, err := CreatePackageFromPath(path)
+            if err != nil {
+                t.Fatalf("CreatePackageFromPath: %v", err)
+            }
+            if pkg.GetType() != TypeDeb {
+                t.Fatalf("type = %s, want deb", pkg.GetType())
+            }
+            info, err := pkg.GetInfo(context.Background())
+            if err != nil {
+                t.Fatalf("GetInfo: %v", err)
+            }
+            if info.Name != "hello" || info.Version != "1.0-1" {
+                t.Errorf("info = %s %s, want hello 1.0-1", info.Name, info.Version)
+            }
+        })
+    }
+}
+
+func TestCreatePackageFromPathUnsupported(t *testing.T) {
+    path := filepath.Join(t.TempDir(), "notes.txt")
+    if err := os.WriteFile(path, []byte("not a package"), 0644); err != nil {
+        t.Fatal(err)
+    }
+    if _, err := CreatePackageFromPath(path); err != ErrNotSupported {
+        t.Errorf("error = %v, want ErrNotSupported", err)
+    }
+}
+
+func TestDetectByExtension(t *testing.T) {
+    tests := []struct {
+        path string
+        want PackageType
+    }{
+        {"hello_1.0-1_amd64.deb", TypeDeb},
+        {"/tmp/HELLO.DEB", TypeDeb},
+        {"hello-1.0-1.x86_64.rpm", TypeRPM},
+        {"hello-1.0-1-1-x86_64.eopkg", TypeEopkg},
+        {"hello-1.0-r0.apk", TypeAPK},
+        {"name-1-1-x86_64.pkg.tar.zst", TypePacman},
+        {"name-1-1-x86_64.pkg.tar.xz", TypePacman},
+        {"name-1-1-any.pkg.tar.gz", TypePacman},
+        {"name-1-1-any.pkg.tar", TypePacman},
+        {"source-1.0.tar.gz", TypeUnknown},
+        {"source-1.0.tar.zst", TypeUnknown},
+        {"download", TypeUnknown},
+    }
+
+    for _, tt := range tests {
+        if got := detectByExtension(tt.path); got != tt.want {
+            t.Errorf("detectByExtension(%q) = %s, want %s", tt.path, got, tt.want)
+        }
+    }
+}
+
+func TestDetectByMagicTruncated(t *testing.T) {
+    tests := []struct {
+        name    string
+        data    []byte
+        wantErr error
+    }{
+        {"empty", nil, ErrEmptyPackage},
+        {"ar", magicAr[:4], ErrInvalidFormat},
+        {"rpm", magicRPM[:3], ErrInvalidFormat},
+        {"xz", magicXz[:5], ErrInvalidFormat},
+        {"zstd", magicZstd[:2], ErrInvalidFormat},
+        {"zip", magicZip[:3], ErrInvalidFormat},
+        {"gzip", magicGzip, ErrCorruptedPackage},
+        {"ustar", make([]byte, ustarOffset+2), ErrInvalidFormat},
+    }
+
+    dir := t.TempDir()
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            path := filepath.Join(dir, tt.name)
+            if err := os.WriteFile(path, tt.data, 0644); err != nil {
+                t.Fatal(err)
+            }
+            pt, err := DetectByMagic(path)
+            if err != tt.wantErr {
+                t.Errorf("DetectByMagic error = %v, want %v", err, tt.wantErr)
+            }
+            if pt != TypeUnknown {
+                t.Errorf("DetectByMagic type = %s, want unknown", pt)
+            }
+        })
+    }
+}
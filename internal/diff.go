@@ -0,0 +1,137 @@
+// internal/diff.go
+package internal
+
+import (
+    "context"
+    "fmt"
+    "sort"
+)
+
+// PackageDiff различия между двумя пакетами одного типа
+type PackageDiff struct {
+    OldName       string       `json:"old_name"`
+    NewName       string       `json:"new_name"`
+    OldVersion    string       `json:"old_version"`
+    NewVersion    string       `json:"new_version"`
+    VersionOrder  int          `json:"version_order"` // Сравнение новой версии со старой: -1, 0, 1
+    AddedDeps     []string     `json:"added_dependencies"`
+    RemovedDeps   []string     `json:"removed_dependencies"`
+    AddedFiles    []string     `json:"added_files"`
+    RemovedFiles  []string     `json:"removed_files"`
+    ModifiedFiles []FileChange `json:"modified_files"`
+}
+
+// FileChange измененный файл
+type FileChange struct {
+    Path    string `json:"path"`
+    OldSize int64  `json:"old_size"`
+    NewSize int64  `json:"new_size"`
+    OldHash string `json:"old_hash,omitempty"`
+    NewHash string `json:"new_hash,omitempty"`
+}
+
+// IsEmpty сообщает, что пакеты не различаются
+func (d *PackageDiff) IsEmpty() bool {
+    return d.OldName == d.NewName && d.OldVersion == d.NewVersion &&
+        len(d.AddedDeps) == 0 && len(d.RemovedDeps) == 0 &&
+        len(d.AddedFiles) == 0 && len(d.RemovedFiles) == 0 && len(d.ModifiedFiles) == 0
+}
+
+// DiffPackages сравнивает пакет a (старый) с пакетом b (новый): версию,
+// зависимости и файлы. Файл считается измененным, если отличается
+// размер или, когда формат их содержит, контрольная сумма
+func DiffPackages(ctx context.Context, a, b Package) (*PackageDiff, error) {
+    if a.GetType() != b.GetType() {
+        return nil, fmt.Errorf("cannot compare %s package with %s package", a.GetType(), b.GetType())
+    }
+
+    oldInfo, err := a.GetInfo(ctx)
+    if err != nil {
+        return nil, fmt.Errorf("failed to read package info for %s: %w", a, err)
+    }
+    newInfo, err := b.GetInfo(ctx)
+    if err != nil {
+        return nil, fmt.Errorf("failed to read package info for %s: %w", b, err)
+    }
+
+    diff := &PackageDiff{
+        OldName:      oldInfo.Name,
+        NewName:      newInfo.Name,
+        OldVersion:   oldInfo.Version,
+        NewVersion:   newInfo.Version,
+        VersionOrder: a.Comparator().Compare(newInfo.Version, oldInfo.Version),
+    }
+    diff.AddedDeps, diff.RemovedDeps = diffStrings(oldInfo.Dependencies, newInfo.Dependencies)
+
+    oldFiles, err := a.ListFiles()
+    if err != nil {
+        return nil, fmt.Errorf("failed to list files of %s: %w", a, err)
+    }
+    newFiles, err := b.ListFiles()
+    if err != nil {
+        return nil, fmt.Errorf("failed to list files of %s: %w", b, err)
+    }
+
+    oldIndex := make(map[string]FileInfo)
+    for _, file := range oldFiles {
+        if !file.IsDir {
+            oldIndex[file.Path] = file
+        }
+    }
+
+    for _, file := range newFiles {
+        if file.IsDir {
+            continue
+        }
+        old, ok := oldIndex[file.Path]
+        if !ok {
+            diff.AddedFiles = append(diff.AddedFiles, file.Path)
+            continue
+        }
+        delete(oldIndex, file.Path)
+
+        hashChanged := old.Hash != "" && file.Hash != "" && old.Hash != file.Hash
+        if old.Size != file.Size || hashChanged {
+            diff.ModifiedFiles = append(diff.ModifiedFiles, FileChange{
+                Path:    file.Path,
+                OldSize: old.Size,
+                NewSize: file.Size,
+                OldHash: old.Hash,
+                NewHash: file.Hash,
+            })
+        }
+    }
+    for path := range oldIndex {
+        diff.RemovedFiles = append(diff.RemovedFiles, path)
+    }
+
+    sort.Strings(diff.AddedFiles)
+    sort.Strings(diff.RemovedFiles)
+    sort.Slice(diff.ModifiedFiles, func(i, j int) bool {
+        return diff.ModifiedFiles[i].Path < diff.ModifiedFiles[j].Path
+    })
+
+    return diff, nil
+}
+
+// diffStrings возвращает элементы, которые есть только в b, и
+// элементы, которые есть только в a, в исходном порядке
+func diffStrings(a, b []string) (added, removed []string) {
+    inA := make(map[string]bool, len(a))
+    for _, s := range a {
+        inA[s] = true
+    }
+    inB := make(map[string]bool, len(b))
+    for _, s := range b {
+        inB[s] = true
+        if !inA[s] {
+            added = append(added, s)
+        }
+    }
+    for _, s := range a {
+        if !inB[s] {
+            removed = append(removed, s)
+        }
+    }
+    return added, removed
+}
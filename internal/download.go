@@ -0,0 +1,175 @@
+// internal/download.go
+package internal
+
+import (
+    "context"
+    "crypto"
+    "encoding/hex"
+    "fmt"
+    "io"
+    "net/http"
+    "os"
+    "path"
+    "path/filepath"
+    "strings"
+)
+
+// ErrChecksumMismatch хеш загруженного файла не совпадает с ожидаемым
+var ErrChecksumMismatch = &PackageError{Code: ErrInvalidPackage, Message: "checksum mismatch"}
+
+// DownloadOptions параметры загрузки пакета
+type DownloadOptions struct {
+    Dir          string      // Каталог для файла, по умолчанию CacheDir
+    ExpectedHash string      // Ожидаемый хеш файла, пустой - не проверять
+    Algo         crypto.Hash // Алгоритм хеша, по умолчанию SHA256
+    Resume       bool        // Докачивать оставшийся после сбоя .part файл
+
+    Progress ProgressFunc // Прогресс загрузки, nil - без вывода
+}
+
+// DownloadPackage загружает пакет по url и возвращает путь к файлу.
+// Файл пишется в name.part и переименовывается после проверки хеша;
+// с Resume он не удаляется при сбое, и следующая загрузка продолжает
+// его запросом Range. При несовпадении хеша файл загружается заново
+// один раз
+func DownloadPackage(ctx context.Context, url string, opts DownloadOptions) (string, error) {
+    if opts.Algo == 0 {
+        opts.Algo = crypto.SHA256
+    }
+    if !opts.Algo.Available() {
+        return "", fmt.Errorf("hash algorithm %v is not available", opts.Algo)
+    }
+    if opts.Dir == "" {
+        opts.Dir = CacheDir
+    }
+
+    req, err := http.NewRequest(http.MethodGet, url, nil)
+    if err != nil {
+        return "", fmt.Errorf("invalid url: %w", err)
+    }
+    name := path.Base(req.URL.Path)
+    if name == "" || name == "." || name == "/" {
+        return "", fmt.Errorf("url %s does not name a file", url)
+    }
+
+    if err := CreateDirectory(opts.Dir, 0755); err != nil {
+        return "", err
+    }
+    dest := filepath.Join(opts.Dir, name)
+    part := dest + ".part"
+
+    var sum string
+    for attempt := 0; ; attempt++ {
+        sum, err = downloadFile(ctx, url, part, opts)
+        if err != nil {
+            if !opts.Resume {
+                os.Remove(part)
+            }
+            return "", err
+        }
+        if opts.ExpectedHash == "" || strings.EqualFold(sum, opts.ExpectedHash) {
+            break
+        }
+
+        // Испорченный файл докачивать бессмысленно
+        os.Remove(part)
+        if attempt > 0 {
+            return "", fmt.Errorf("%w: expected %s, got %s", ErrChecksumMismatch, opts.ExpectedHash, sum)
+        }
+        logger.Warnf("Checksum mismatch for %s (got %s), downloading again", name, sum)
+        opts.Resume = false
+    }
+
+    if err := os.Rename(part, dest); err != nil {
+        return "", fmt.Errorf("failed to save file: %w", err)
+    }
+
+    logger.Infof("Downloaded %s (%v %s)", dest, opts.Algo, sum)
+    return dest, nil
+}
+
+// downloadFile загружает url в part и возвращает хеш всего файла. С
+// Resume непустой part продолжается с его конца, если сервер
+// поддерживает Range; иначе файл загружается заново
+func downloadFile(ctx context.Context, url, part string, opts DownloadOptions) (string, error) {
+    var offset int64
+    if opts.Resume {
+        if fi, err := os.Stat(part); err == nil && fi.Mode().IsRegular() {
+            offset = fi.Size()
+        }
+    }
+
+    req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+    if err != nil {
+        return "", fmt.Errorf("invalid url: %w", err)
+    }
+    if offset > 0 {
+        req.Header.Set("Range", fmt.Sprintf("bytes=%d-", offset))
+    }
+
+    resp, err := http.DefaultClient.Do(req)
+    if err != nil {
+        return "", fmt.Errorf("failed to download %s: %w", url, err)
+    }
+    defer resp.Body.Close()
+
+    switch {
+    case resp.StatusCode == http.StatusOK:
+        if offset > 0 {
+            logger.Infof("Server does not support resuming %s, downloading from the start", url)
+        }
+        offset = 0
+    case resp.StatusCode == http.StatusPartialContent && offset > 0:
+        if !strings.HasPrefix(resp.Header.Get("Content-Range"), fmt.Sprintf("bytes %d-", offset)) {
+            return "", fmt.Errorf("failed to resume %s: unexpected range %q", url, resp.Header.Get("Content-Range"))
+        }
+        logger.Infof("Resuming %s at %s", url, FormatSize(offset))
+    case resp.StatusCode == http.StatusRequestedRangeNotSatisfiable && offset > 0:
+        // Частичный файл не короче полного: он устарел или испорчен
+        resp.Body.Close()
+        if err := os.Remove(part); err != nil {
+            return "", fmt.Errorf("failed to remove stale %s: %w", part, err)
+        }
+        opts.Resume = false
+        return downloadFile(ctx, url, part, opts)
+    default:
+        return "", fmt.Errorf("failed to download %s: %s", url, resp.Status)
+    }
+
+    flags := os.O_RDWR | os.O_CREATE
+    if offset == 0 {
+        flags |= os.O_TRUNC
+    }
+    f, err := os.OpenFile(part, flags, 0644)
+    if err != nil {
+        return "", fmt.Errorf("failed to create file: %w", err)
+    }
+    defer f.Close()
+
+    // Хеш считается в том же проходе, что и запись; уже загруженная
+    // часть читается заново
+    hash := opts.Algo.New()
+    if offset > 0 {
+        if _, err := io.CopyN(hash, f, offset); err != nil {
+            return "", fmt.Errorf("failed to read %s: %w", part, err)
+        }
+    }
+
+    var total int64
+    if resp.ContentLength >= 0 {
+        total = offset + resp.ContentLength
+    }
+    tracker := newProgressTracker(total, opts.Progress)
+    if tracker != nil {
+        tracker.done = offset
+    }
+
+    if _, err := io.Copy(f, io.TeeReader(tracker.wrap(resp.Body), hash)); err != nil {
+        return "", fmt.Errorf("failed to download %s: %w", url, err)
+    }
+    tracker.finish()
+    if err := f.Close(); err != nil {
+        return "", fmt.Errorf("failed to write file: %w", err)
+    }
+    return hex.EncodeToString(hash.Sum(nil)), nil
+}
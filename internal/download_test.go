@@ -0,0 +1,61 @@
+package internal
+
+import (
+    "crypto"
+    "encoding/hex"
+    "io"
+    "os"
+    "path/filepath"
+    "testing"
+)
+
+// benchmarkDownloadSize размер "загружаемого" файла в BenchmarkDownloadHash
+const benchmarkDownloadSize = 500 << 20
+
+// zeroReader бесконечный источник нулей, заменяющий тело ответа
+type zeroReader struct{}
+
+func (zeroReader) Read(p []byte) (int, error) {
+    clear(p)
+    return len(p), nil
+}
+
+// BenchmarkDownloadHash сравнивает подсчёт хеша в одном проходе с записью
+// (как в DownloadPackage) со вторым проходом по уже записанному файлу
+func BenchmarkDownloadHash(b *testing.B) {
+    dest := filepath.Join(b.TempDir(), "package")
+
+    write := func(b *testing.B, r io.Reader) {
+        f, err := os.Create(dest)
+        if err != nil {
+            b.Fatal(err)
+        }
+        defer f.Close()
+        if _, err := io.Copy(f, r); err != nil {
+            b.Fatal(err)
+        }
+        if err := f.Close(); err != nil {
+            b.Fatal(err)
+        }
+    }
+
+    b.Run("stream", func(b *testing.B) {
+        b.SetBytes(benchmarkDownloadSize)
+        for i := 0; i < b.N; i++ {
+            hash := crypto.SHA256.New()
+            body := io.LimitReader(zeroReader{}, benchmarkDownloadSize)
+            write(b, io.TeeReader(body, hash))
+            _ = hex.EncodeToString(hash.Sum(nil))
+        }
+    })
+
+    b.Run("two-pass", func(b *testing.B) {
+        b.SetBytes(benchmarkDownloadSize)
+        for i := 0; i < b.N; i++ {
+            write(b, io.LimitReader(zeroReader{}, benchmarkDownloadSize))
+            if _, err := CalculateFileHash(dest); err != nil {
+                b.Fatal(err)
+            }
+        }
+    })
+}
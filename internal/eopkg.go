@@ -2,17 +2,20 @@
 package internal
 
 import (
+    "context"
     "archive/tar"
     "bytes"
-    "compress/gzip"
+    "encoding/hex"
     "encoding/xml"
     "fmt"
     "io"
     "os"
-    "os/exec"
     "path/filepath"
+    "sort"
     "strings"
     "time"
+
+    "github.com/ulikunitz/xz"
 )
 
 // Eopkg структура для Solus пакетов
@@ -28,12 +31,13 @@ type Eopkg struct {
 type EopkgMetadata struct {
     XMLName      xml.Name `xml:"PISI"`
     Source       Source   `xml:"Source"`
-    Package      Package  `xml:"Package"`
+    Package      EopkgPackage `xml:"Package"`
     History      History  `xml:"History"`
 }
 
 type Source struct {
     Name        string   `xml:"Name"`
+    Version     string   `xml:"Version"`
     Homepage    string   `xml:"Homepage"`
     Packager    Packager `xml:"Packager"`
 }
@@ -43,13 +47,15 @@ type Packager struct {
     Email string `xml:"Email"`
 }
 
-type Package struct {
+type EopkgPackage struct {
     Name         string       `xml:"Name"`
+    Version      string       `xml:"Version"`
     Summary      string       `xml:"Summary"`
     Description  string       `xml:"Description"`
     RuntimeDeps  Dependencies `xml:"RuntimeDependencies"`
     Files        Files        `xml:"Files"`
     Architecture string       `xml:"Architecture"`
+    History      History      `xml:"History"`
 }
 
 type Dependencies struct {
@@ -72,13 +78,65 @@ type History struct {
 }
 
 type Update struct {
+    Release     string    `xml:"release,attr"`
     Version     string    `xml:"Version"`
-    Date        time.Time `xml:"Date"`
+    Date        EopkgDate `xml:"Date"`
     Name        string    `xml:"Name"`
     Email       string    `xml:"Email"`
     Comment     string    `xml:"Comment"`
 }
 
+// EopkgDate дата из metadata.xml. eopkg записывает даты как YYYY-MM-DD
+type EopkgDate struct {
+    time.Time
+}
+
+// UnmarshalText разбирает дату в формате YYYY-MM-DD или RFC 3339
+func (d *EopkgDate) UnmarshalText(text []byte) error {
+    value := strings.TrimSpace(string(text))
+    for _, layout := range []string{"2006-01-02", time.RFC3339} {
+        if t, err := time.Parse(layout, value); err == nil {
+            d.Time = t
+            return nil
+        }
+    }
+    return fmt.Errorf("invalid date %q", value)
+}
+
+// latestUpdate возвращает последнюю запись истории пакета. История
+// обычно вложена в Package, поэтому она проверяется первой
+func (m *EopkgMetadata) latestUpdate() (Update, bool) {
+    for _, history := range []History{m.Package.History, m.History} {
+        if len(history.Update) > 0 {
+            return history.Update[0], true
+        }
+    }
+    return Update{}, false
+}
+
+// version возвращает версию пакета в формате eopkg list-installed:
+// "версия-релиз". Версия берется из Package или Source, а History
+// используется, только если они ее не содержат
+func (m *EopkgMetadata) version() (string, bool) {
+    update, hasUpdate := m.latestUpdate()
+
+    version := m.Package.Version
+    if version == "" {
+        version = m.Source.Version
+    }
+    if version == "" {
+        version = update.Version
+    }
+    if version == "" {
+        return "", false
+    }
+
+    if hasUpdate && update.Release != "" {
+        version += "-" + update.Release
+    }
+    return version, true
+}
+
 // NewEopkg создает новый экземпляр Eopkg
 func NewEopkg(path string) (*Eopkg, error) {
     absPath, err := filepath.Abs(path)
@@ -100,10 +158,6 @@ func NewEopkg(path string) (*Eopkg, error) {
 
 // validate проверяет корректность .eopkg файла
 func (e *Eopkg) validate() error {
-    if !strings.HasSuffix(e.Path, ".eopkg") {
-        return fmt.Errorf("invalid package format: must be .eopkg")
-    }
-
     fi, err := os.Stat(e.Path)
     if err != nil {
         return fmt.Errorf("failed to stat package file: %w", err)
@@ -117,40 +171,61 @@ func (e *Eopkg) validate() error {
 }
 
 // Install устанавливает .eopkg пакет
-func (e *Eopkg) Install(force bool) error {
-    if err := RequireRoot(); err != nil {
+func (e *Eopkg) Install(ctx context.Context, opts InstallOptions) error {
+    root := opts.InstallRoot()
+    if err := RequireRoot(root); err != nil && !opts.DryRun {
+        return err
+    }
+    if err := requireBackend(TypeEopkg); err != nil {
         return err
     }
 
     logger.Infof("Installing Eopkg package: %s", e.Path)
 
+    dbPath := filepath.Join(root, "var/lib/eopkg")
+
     // Создаем резервную копию
-    backupPath, err := CreateBackup("/var/lib/eopkg")
-    if err != nil {
-        logger.Warnf("Failed to create backup: %v", err)
-    } else {
-        logger.Infof("Created backup: %s", backupPath)
+    if !opts.NoBackup && !opts.DryRun {
+        backupDatabase(dbPath, opts.Progress)
     }
 
     // Подготавливаем команду установки
     args := []string{"install"}
-    if force {
+    if opts.IsAltRoot() {
+        args = append(args, "--destdir", root)
+    }
+    if opts.Force {
         args = append(args, "--ignore-dependency", "--ignore-safety")
+    } else if opts.NoDeps {
+        args = append(args, "--ignore-dependency")
+    }
+    if opts.Reinstall {
+        args = append(args, "--reinstall")
+    }
+    if opts.AssumeYes {
+        args = append(args, "--yes-all")
     }
     args = append(args, e.Path)
 
     // Выполняем установку
-    cmd := exec.Command("eopkg", args...)
-    cmd.Env = append(os.Environ(), "LANG=C")
-    
-    output, err := cmd.CombinedOutput()
+    if opts.DryRun {
+        printDryRun("eopkg", args, dbPath, opts.NoBackup)
+        return nil
+    }
+
+    output, err := CommandRunner.Run(ctx, "eopkg", args...)
+    if err != nil && ctx.Err() != nil {
+        return fmt.Errorf("installation cancelled: %w", ctx.Err())
+    }
     if err != nil {
         return fmt.Errorf("installation failed: %s: %w", string(output), err)
     }
 
-    // Обновляем кэш
-    if err := exec.Command("eopkg", "index", "--rebuild-db").Run(); err != nil {
-        logger.Warn("Failed to rebuild package database")
+    // Обновляем кэш хоста, альтернативный корень не трогаем
+    if !opts.IsAltRoot() {
+        if _, err := CommandRunner.Run(ctx, "eopkg", "index", "--rebuild-db"); err != nil {
+            logger.Warn("Failed to rebuild package database")
+        }
     }
 
     logger.Info("Package installed successfully")
@@ -158,13 +233,17 @@ func (e *Eopkg) Install(force bool) error {
 }
 
 // Remove удаляет установленный пакет
-func (e *Eopkg) Remove(purge bool) error {
-    if err := RequireRoot(); err != nil {
+func (e *Eopkg) Remove(ctx context.Context, opts RemoveOptions) error {
+    root := opts.InstallRoot()
+    if err := RequireRoot(root); err != nil && !opts.DryRun {
+        return err
+    }
+    if err := requireBackend(TypeEopkg); err != nil {
         return err
     }
 
     if e.Name == "" {
-        info, err := e.GetInfo()
+        info, err := e.GetInfo(ctx)
         if err != nil {
             return fmt.Errorf("failed to get package info: %w", err)
         }
@@ -173,33 +252,48 @@ func (e *Eopkg) Remove(purge bool) error {
 
     logger.Infof("Removing Eopkg package: %s", e.Name)
 
+    dbPath := filepath.Join(root, "var/lib/eopkg")
+
     // Создаем резервную копию
-    backupPath, err := CreateBackup("/var/lib/eopkg")
-    if err != nil {
-        logger.Warnf("Failed to create backup: %v", err)
-    } else {
-        logger.Infof("Created backup: %s", backupPath)
+    if !opts.NoBackup && !opts.DryRun {
+        backupDatabase(dbPath, opts.Progress)
     }
 
     // Подготавливаем команду удаления
     args := []string{"remove"}
-    if purge {
+    if opts.Purge {
         args = append(args, "--purge")
     }
+    if opts.IsAltRoot() {
+        args = append(args, "--destdir", root)
+    }
+    if opts.Force {
+        args = append(args, "--ignore-dependency", "--ignore-safety")
+    } else if opts.NoDeps {
+        args = append(args, "--ignore-dependency")
+    }
+    if opts.AssumeYes {
+        args = append(args, "--yes-all")
+    }
     args = append(args, e.Name)
 
     // Выполняем удаление
-    cmd := exec.Command("eopkg", args...)
-    cmd.Env = append(os.Environ(), "LANG=C")
-    
-    output, err := cmd.CombinedOutput()
+    if opts.DryRun {
+        printDryRun("eopkg", args, dbPath, opts.NoBackup)
+        return nil
+    }
+
+    output, err := CommandRunner.Run(ctx, "eopkg", args...)
+    if err != nil && ctx.Err() != nil {
+        return fmt.Errorf("removal cancelled: %w", ctx.Err())
+    }
     if err != nil {
         return fmt.Errorf("removal failed: %s: %w", string(output), err)
     }
 
     // Очищаем кэш если указан purge
-    if purge {
-        if err := exec.Command("eopkg", "delete-cache").Run(); err != nil {
+    if opts.Purge && !opts.IsAltRoot() {
+        if _, err := CommandRunner.Run(ctx, "eopkg", "delete-cache"); err != nil {
             logger.Warn("Failed to clean package cache")
         }
     }
@@ -209,28 +303,111 @@ func (e *Eopkg) Remove(purge bool) error {
 }
 
 // GetInfo возвращает информацию о пакете
-func (e *Eopkg) GetInfo() (*PackageInfo, error) {
+func (e *Eopkg) GetInfo(ctx context.Context) (*PackageInfo, error) {
     if e.Info != nil {
         return e.Info, nil
     }
 
-    // Открываем .eopkg файл
-    f, err := os.Open(e.Path)
+    cached, hash := loadCachedInfo(e.Path, TypeEopkg)
+    if cached != nil {
+        e.Info = cached
+        return cached, nil
+    }
+
+    metadata, err := e.readMetadata()
     if err != nil {
-        return nil, fmt.Errorf("failed to open package: %w", err)
+        return nil, err
     }
-    defer f.Close()
 
-    // Читаем архив
-    gzr, err := gzip.NewReader(f)
+    // Размер после установки - сумма размеров файлов
+    var totalSize int64
+    for _, file := range metadata.Package.Files.File {
+        totalSize += file.Size
+    }
+
+    version, ok := metadata.version()
+    if !ok {
+        return nil, fmt.Errorf("%w: metadata.xml has no package version", ErrInvalidFormat)
+    }
+    update, _ := metadata.latestUpdate()
+
+    // Создаем информацию о пакете
+    info := &PackageInfo{
+        Name:         metadata.Package.Name,
+        Version:      version,
+        Architecture: metadata.Package.Architecture,
+        Description:  metadata.Package.Description,
+        Maintainer:   fmt.Sprintf("%s <%s>", metadata.Source.Packager.Name, metadata.Source.Packager.Email),
+        Homepage:     metadata.Source.Homepage,
+        Size:         fileSize(e.Path),
+        InstalledSize: totalSize,
+        InstallDate:  update.Date.Time,
+    }
+
+    // Добавляем зависимости
+    if metadata.Package.RuntimeDeps.Dependency != nil {
+        info.Dependencies = metadata.Package.RuntimeDeps.Dependency
+    }
+
+    storeCachedInfo(hash, TypeEopkg, info)
+    e.Info = info
+    return info, nil
+}
+
+// ListFiles возвращает список файлов пакета. Файлы берутся из
+// вложенного install.tar.xz, метаданные пропускаются
+func (e *Eopkg) ListFiles() ([]FileInfo, error) {
+    tr, closeFn, err := OpenCompressedTar(e.Path)
     if err != nil {
-        return nil, fmt.Errorf("failed to create gzip reader: %w", err)
+        return nil, err
     }
-    defer gzr.Close()
+    defer closeFn()
 
-    tr := tar.NewReader(gzr)
+    var files []FileInfo
+    for {
+        header, err := tr.Next()
+        if err == io.EOF {
+            break
+        }
+        if err != nil {
+            return nil, fmt.Errorf("failed to read tar header: %w", err)
+        }
 
-    var metadata *EopkgMetadata
+        switch header.Name {
+        case "metadata.xml", "files.xml":
+            continue
+        case "install.tar.xz":
+            xzr, err := xz.NewReader(tr)
+            if err != nil {
+                return nil, fmt.Errorf("failed to create xz reader: %w", err)
+            }
+            payload, err := listTarFiles(tar.NewReader(xzr), nil)
+            if err != nil {
+                return nil, err
+            }
+            files = append(files, payload...)
+        default:
+            files = append(files, FileInfo{
+                Path:    "/" + strings.TrimPrefix(header.Name, "./"),
+                Size:    header.Size,
+                Mode:    header.FileInfo().Mode(),
+                ModTime: header.ModTime,
+                IsDir:   header.Typeflag == tar.TypeDir,
+            })
+        }
+    }
+
+    return files, nil
+}
+
+// readMetadata извлекает и разбирает metadata.xml
+func (e *Eopkg) readMetadata() (*EopkgMetadata, error) {
+    // Открываем архив .eopkg (gzip, xz или zstd)
+    tr, closeFn, err := OpenCompressedTar(e.Path)
+    if err != nil {
+        return nil, err
+    }
+    defer closeFn()
 
     // Ищем metadata.xml
     for {
@@ -248,43 +425,181 @@ func (e *Eopkg) GetInfo() (*PackageInfo, error) {
                 return nil, fmt.Errorf("failed to read metadata.xml: %w", err)
             }
 
-            metadata = &EopkgMetadata{}
+            metadata := &EopkgMetadata{}
             if err := xml.Unmarshal(buf.Bytes(), metadata); err != nil {
                 return nil, fmt.Errorf("failed to parse metadata: %w", err)
             }
+            return metadata, nil
+        }
+    }
+
+    return nil, fmt.Errorf("package metadata not found")
+}
+
+// Verify проверяет целостность пакета: архив распаковывается без ошибок,
+// а размеры и хеши файлов совпадают с указанными в metadata.xml
+func (e *Eopkg) Verify() error {
+    metadata, err := e.readMetadata()
+    if err != nil {
+        return fmt.Errorf("%w: %v", ErrCorruptedPackage, err)
+    }
+
+    expected := make(map[string]File)
+    for _, file := range metadata.Package.Files.File {
+        expected[strings.Trim(file.Path, "/")] = file
+    }
+
+    tr, closeFn, err := OpenCompressedTar(e.Path)
+    if err != nil {
+        return fmt.Errorf("%w: %v", ErrCorruptedPackage, err)
+    }
+    defer closeFn()
+
+    for {
+        header, err := tr.Next()
+        if err == io.EOF {
             break
         }
+        if err != nil {
+            return fmt.Errorf("%w: %v", ErrCorruptedPackage, err)
+        }
+
+        if header.Name != "install.tar.xz" {
+            continue
+        }
+
+        xzr, err := xz.NewReader(tr)
+        if err != nil {
+            return fmt.Errorf("%w: %v", ErrCorruptedPackage, err)
+        }
+
+        return verifyTarEntries(tar.NewReader(xzr), func(name string, header *tar.Header) (string, int64) {
+            file, ok := expected[name]
+            if !ok {
+                return "", -1
+            }
+            return file.Hash, file.Size
+        })
     }
 
-    if metadata == nil {
-        return nil, fmt.Errorf("package metadata not found")
+    return nil
+}
+
+// VerifyFiles сверяет каждый файл install.tar.xz с размером и хешем из
+// metadata.xml и возвращает пути несовпадающих файлов, в том числе
+// указанных в метаданных, но отсутствующих в архиве. В отличие от
+// Verify, проверка не останавливается на первом расхождении
+func (e *Eopkg) VerifyFiles() ([]string, error) {
+    metadata, err := e.readMetadata()
+    if err != nil {
+        return nil, fmt.Errorf("%w: %v", ErrCorruptedPackage, err)
     }
 
-    // Получаем размер файла
-    var totalSize int64
+    expected := make(map[string]File)
     for _, file := range metadata.Package.Files.File {
-        totalSize += file.Size
+        name := strings.Trim(file.Path, "/")
+        if name != "" && file.Hash != "" {
+            expected[name] = file
+        }
     }
 
-    // Создаем информацию о пакете
-    info := &PackageInfo{
-        Name:         metadata.Package.Name,
-        Version:      metadata.History.Update[0].Version,
-        Architecture: metadata.Package.Architecture,
-        Description:  metadata.Package.Description,
-        Maintainer:   fmt.Sprintf("%s <%s>", metadata.Source.Packager.Name, metadata.Source.Packager.Email),
-        Homepage:     metadata.Source.Homepage,
-        Size:         totalSize,
-        InstallDate:  metadata.History.Update[0].Date,
+    tr, closeFn, err := OpenCompressedTar(e.Path)
+    if err != nil {
+        return nil, fmt.Errorf("%w: %v", ErrCorruptedPackage, err)
     }
+    defer closeFn()
 
-    // Добавляем зависимости
-    if metadata.Package.RuntimeDeps.Dependency != nil {
-        info.Dependencies = metadata.Package.RuntimeDeps.Dependency
+    var mismatched []string
+    for {
+        header, err := tr.Next()
+        if err == io.EOF {
+            return nil, fmt.Errorf("package payload not found")
+        }
+        if err != nil {
+            return nil, fmt.Errorf("%w: %v", ErrCorruptedPackage, err)
+        }
+        if header.Name == "install.tar.xz" {
+            break
+        }
     }
 
-    e.Info = info
-    return info, nil
+    xzr, err := xz.NewReader(tr)
+    if err != nil {
+        return nil, fmt.Errorf("%w: %v", ErrCorruptedPackage, err)
+    }
+
+    payload := tar.NewReader(xzr)
+    for {
+        header, err := payload.Next()
+        if err == io.EOF {
+            break
+        }
+        if err != nil {
+            return nil, fmt.Errorf("%w: %v", ErrCorruptedPackage, err)
+        }
+
+        name := strings.Trim(strings.TrimPrefix(header.Name, "./"), "/")
+        file, ok := expected[name]
+        delete(expected, name)
+        if !ok || header.Typeflag != tar.TypeReg {
+            continue
+        }
+
+        h, err := newDigestHash(file.Hash)
+        if err != nil {
+            mismatched = append(mismatched, "/"+name)
+            continue
+        }
+        n, err := io.Copy(h, payload)
+        if err != nil {
+            return nil, fmt.Errorf("%w: %s: %v", ErrCorruptedPackage, name, err)
+        }
+        if n != file.Size || !strings.EqualFold(hex.EncodeToString(h.Sum(nil)), file.Hash) {
+            mismatched = append(mismatched, "/"+name)
+        }
+    }
+
+    // Файлы из метаданных, которых нет в архиве
+    for name := range expected {
+        mismatched = append(mismatched, "/"+name)
+    }
+    sort.Strings(mismatched)
+
+    return mismatched, nil
+}
+
+// Extract распаковывает содержимое install.tar.xz в dest
+func (e *Eopkg) Extract(dest string) error {
+    absDest, err := prepareExtractDir(dest)
+    if err != nil {
+        return err
+    }
+
+    tr, closeFn, err := OpenCompressedTar(e.Path)
+    if err != nil {
+        return err
+    }
+    defer closeFn()
+
+    for {
+        header, err := tr.Next()
+        if err == io.EOF {
+            break
+        }
+        if err != nil {
+            return fmt.Errorf("failed to read tar header: %w", err)
+        }
+
+        if header.Name == "install.tar.xz" {
+            xzr, err := xz.NewReader(tr)
+            if err != nil {
+                return fmt.Errorf("failed to create xz reader: %w", err)
+            }
+            return extractTar(tar.NewReader(xzr), absDest, nil)
+        }
+    }
+
+    return fmt.Errorf("package payload not found")
 }
 
 // GetType возвращает тип пакета
@@ -292,6 +607,11 @@ func (e *Eopkg) GetType() PackageType {
     return TypeEopkg
 }
 
+// Comparator возвращает компаратор версий
+func (e *Eopkg) Comparator() VersionComparator {
+    return DebVersion{}
+}
+
 // String возвращает строковое представление пакета
 func (e *Eopkg) String() string {
     if e.Info != nil {
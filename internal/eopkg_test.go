@@ -0,0 +1,75 @@
+package internal
+
+import (
+    "context"
+    "reflect"
+    "testing"
+)
+
+func TestEopkgGetInfoWithoutHistory(t *testing.T) {
+    pkg, err := NewEopkg(buildTestEopkg(t, t.TempDir(), "no-history.xml"))
+    if err != nil {
+        t.Fatal(err)
+    }
+    info, err := pkg.GetInfo(context.Background())
+    if err != nil {
+        t.Fatalf("GetInfo: %v", err)
+    }
+    if info.Name != "hello" || info.Version != "1.2" {
+        t.Errorf("info = %s %s, want hello 1.2", info.Name, info.Version)
+    }
+    if !info.InstallDate.IsZero() {
+        t.Errorf("install date = %v, want zero", info.InstallDate)
+    }
+}
+
+func TestEopkgMetadataWithoutVersion(t *testing.T) {
+    var metadata EopkgMetadata
+    metadata.Package.Name = "hello"
+    if version, ok := metadata.version(); ok {
+        t.Errorf("version() = %q, want none", version)
+    }
+    if _, ok := metadata.latestUpdate(); ok {
+        t.Error("latestUpdate() found an update in empty History")
+    }
+}
+
+func TestEopkgGetInfoSolusMetadata(t *testing.T) {
+    // Метаданные пакета nano из репозитория Solus: версия указана только в History
+    pkg, err := NewEopkg(buildTestEopkg(t, t.TempDir(), "nano.xml"))
+    if err != nil {
+        t.Fatal(err)
+    }
+    info, err := pkg.GetInfo(context.Background())
+    if err != nil {
+        t.Fatalf("GetInfo: %v", err)
+    }
+
+    if info.Name != "nano" || info.Version != "7.2-152" || info.Architecture != "x86_64" {
+        t.Errorf("info = %s %s %s, want nano 7.2-152 x86_64", info.Name, info.Version, info.Architecture)
+    }
+    if info.Maintainer != "Solus Team <releng@getsol.us>" {
+        t.Errorf("maintainer = %q", info.Maintainer)
+    }
+    if want := []string{"file", "ncurses"}; !reflect.DeepEqual(info.Dependencies, want) {
+        t.Errorf("dependencies = %q, want %q", info.Dependencies, want)
+    }
+    if got := info.InstallDate.Format("2006-01-02"); got != "2024-01-19" {
+        t.Errorf("date = %s, want 2024-01-19", got)
+    }
+}
+
+func TestEopkgMetadataVersionPrefersPackage(t *testing.T) {
+    var metadata EopkgMetadata
+    metadata.Package.Version = "2.0"
+    metadata.Source.Version = "1.9"
+    metadata.Package.History.Update = []Update{{Release: "3", Version: "1.0"}}
+    if version, _ := metadata.version(); version != "2.0-3" {
+        t.Errorf("version() = %q, want 2.0-3", version)
+    }
+
+    metadata.Package.Version = ""
+    if version, _ := metadata.version(); version != "1.9-3" {
+        t.Errorf("version() = %q, want 1.9-3", version)
+    }
+}
@@ -0,0 +1,210 @@
+package internal
+
+import (
+    "archive/tar"
+    "compress/gzip"
+    "os"
+    "path/filepath"
+    "testing"
+    "time"
+)
+
+// writeTarGz записывает tar.gz архив из заголовков. Содержимым обычных
+// файлов служит их имя
+func writeTarGz(t *testing.T, headers []*tar.Header) string {
+    t.Helper()
+    path := filepath.Join(t.TempDir(), "test.tar.gz")
+    f, err := os.Create(path)
+    if err != nil {
+        t.Fatal(err)
+    }
+    defer f.Close()
+
+    gzw := gzip.NewWriter(f)
+    tw := tar.NewWriter(gzw)
+    for _, header := range headers {
+        if header.Mode == 0 {
+            header.Mode = 0644
+        }
+        var body []byte
+        if header.Typeflag == tar.TypeReg {
+            body = []byte(header.Name)
+            header.Size = int64(len(body))
+        }
+        if err := tw.WriteHeader(header); err != nil {
+            t.Fatal(err)
+        }
+        if _, err := tw.Write(body); err != nil {
+            t.Fatal(err)
+        }
+    }
+    if err := tw.Close(); err != nil {
+        t.Fatal(err)
+    }
+    if err := gzw.Close(); err != nil {
+        t.Fatal(err)
+    }
+    return path
+}
+
+func TestExtractTarLinks(t *testing.T) {
+    mtime := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+    archive := writeTarGz(t, []*tar.Header{
+        {Name: "usr/lib/libfoo.so.1", Typeflag: tar.TypeReg, ModTime: mtime},
+        {Name: "usr/lib/libfoo.so", Typeflag: tar.TypeSymlink, Linkname: "libfoo.so.1"},
+        {Name: "usr/bin/foo", Typeflag: tar.TypeSymlink, Linkname: "/usr/lib/libfoo.so.1"},
+        {Name: "usr/lib/libfoo.hard", Typeflag: tar.TypeLink, Linkname: "usr/lib/libfoo.so.1"},
+    })
+    dst := t.TempDir()
+
+    if err := ExtractTarGz(archive, dst, nil); err != nil {
+        t.Fatalf("ExtractTarGz: %v", err)
+    }
+
+    link, err := os.Readlink(filepath.Join(dst, "usr/lib/libfoo.so"))
+    if err != nil || link != "libfoo.so.1" {
+        t.Errorf("relative symlink = %q, %v; want libfoo.so.1", link, err)
+    }
+    link, err = os.Readlink(filepath.Join(dst, "usr/bin/foo"))
+    if err != nil || link != "../lib/libfoo.so.1" {
+        t.Errorf("absolute symlink = %q, %v; want ../lib/libfoo.so.1", link, err)
+    }
+
+    original, err := os.Stat(filepath.Join(dst, "usr/lib/libfoo.so.1"))
+    if err != nil {
+        t.Fatal(err)
+    }
+    if !original.ModTime().Equal(mtime) {
+        t.Errorf("modtime = %v, want %v", original.ModTime(), mtime)
+    }
+    hard, err := os.Stat(filepath.Join(dst, "usr/lib/libfoo.hard"))
+    if err != nil || !os.SameFile(original, hard) {
+        t.Errorf("hardlink does not point to libfoo.so.1: %v", err)
+    }
+}
+
+func TestExtractTarRejectsWritesThroughSymlinks(t *testing.T) {
+    outside := t.TempDir()
+    victim := filepath.Join(outside, "victim")
+    if err := os.WriteFile(victim, []byte("original"), 0644); err != nil {
+        t.Fatal(err)
+    }
+
+    tests := []struct {
+        name    string
+        headers []*tar.Header
+        wantErr bool
+    }{
+        {
+            name: "file replaces symlink",
+            headers: []*tar.Header{
+                {Name: "evil", Typeflag: tar.TypeSymlink, Linkname: victim},
+                {Name: "evil", Typeflag: tar.TypeReg},
+            },
+        },
+        {
+            name: "file under symlinked directory",
+            headers: []*tar.Header{
+                {Name: "d", Typeflag: tar.TypeSymlink, Linkname: outside},
+                {Name: "d/newfile", Typeflag: tar.TypeReg},
+            },
+            wantErr: true,
+        },
+        {
+            name: "directory under symlinked directory",
+            headers: []*tar.Header{
+                {Name: "d", Typeflag: tar.TypeSymlink, Linkname: outside},
+                {Name: "d/sub/", Typeflag: tar.TypeDir, Mode: 0755},
+            },
+            wantErr: true,
+        },
+        {
+            name: "relative symlink escaping dst",
+            headers: []*tar.Header{
+                {Name: "up", Typeflag: tar.TypeSymlink, Linkname: "../../outside"},
+            },
+            wantErr: true,
+        },
+    }
+
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            dst := t.TempDir()
+            err := ExtractTarGz(writeTarGz(t, tt.headers), dst, nil)
+            if (err != nil) != tt.wantErr {
+                t.Fatalf("ExtractTarGz error = %v, wantErr %v", err, tt.wantErr)
+            }
+
+            data, err := os.ReadFile(victim)
+            if err != nil || string(data) != "original" {
+                t.Errorf("victim was modified: %q, %v", data, err)
+            }
+            if _, err := os.Lstat(filepath.Join(outside, "newfile")); err == nil {
+                t.Error("file was written outside dst")
+            }
+            if _, err := os.Lstat(filepath.Join(outside, "sub")); err == nil {
+                t.Error("directory was created outside dst")
+            }
+        })
+    }
+}
+
+func TestExtractTarRejectsTraversal(t *testing.T) {
+    tests := []struct {
+        name    string
+        headers []*tar.Header
+    }{
+        {"dotdot file", []*tar.Header{
+            {Name: "../../etc/passwd", Typeflag: tar.TypeReg},
+        }},
+        {"dotdot inside path", []*tar.Header{
+            {Name: "usr/../../../etc/passwd", Typeflag: tar.TypeReg},
+        }},
+        {"hardlink escaping dst", []*tar.Header{
+            {Name: "passwd", Typeflag: tar.TypeLink, Linkname: "../../etc/passwd"},
+        }},
+        {"symlink escaping dst", []*tar.Header{
+            {Name: "passwd", Typeflag: tar.TypeSymlink, Linkname: "../../etc/passwd"},
+        }},
+    }
+
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            base := t.TempDir()
+            dst := filepath.Join(base, "a", "b")
+            if err := os.MkdirAll(dst, 0755); err != nil {
+                t.Fatal(err)
+            }
+
+            if err := ExtractTarGz(writeTarGz(t, tt.headers), dst, nil); err == nil {
+                t.Fatal("ExtractTarGz succeeded, want error")
+            }
+            if _, err := os.Lstat(filepath.Join(base, "etc", "passwd")); err == nil {
+                t.Error("file was written outside dst")
+            }
+        })
+    }
+}
+
+func TestSafeJoin(t *testing.T) {
+    dst := "/tmp/dst"
+    tests := []struct {
+        name    string
+        want    string
+        wantErr bool
+    }{
+        {"usr/bin/hello", "/tmp/dst/usr/bin/hello", false},
+        {"./usr/bin/hello", "/tmp/dst/usr/bin/hello", false},
+        {"/etc/passwd", "/tmp/dst/etc/passwd", false},
+        {"../../etc/passwd", "", true},
+        {"usr/../../etc/passwd", "", true},
+        {"..", "", true},
+    }
+
+    for _, tt := range tests {
+        got, err := safeJoin(dst, tt.name)
+        if (err != nil) != tt.wantErr || got != tt.want {
+            t.Errorf("safeJoin(%q) = %q, %v; want %q, error %v", tt.name, got, err, tt.want, tt.wantErr)
+        }
+    }
+}
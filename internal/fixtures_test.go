@@ -0,0 +1,234 @@
+package internal
+
+import (
+    "archive/tar"
+    "bytes"
+    "compress/gzip"
+    "crypto/sha1"
+    "crypto/sha256"
+    "encoding/binary"
+    "encoding/hex"
+    "fmt"
+    "os"
+    "path/filepath"
+    "strings"
+    "testing"
+)
+
+func TestMain(m *testing.M) {
+    // Тесты не должны читать или заполнять кэш в /var/cache/upkgt
+    UseInfoCache = false
+    os.Exit(m.Run())
+}
+
+// buildTestDeb собирает в dir пакет .deb с именем file из control и
+// одного файла usr/bin/name
+func buildTestDeb(t *testing.T, dir, file, control string) string {
+    t.Helper()
+    root := filepath.Join(dir, "root")
+    controlDir := filepath.Join(dir, "DEBIAN")
+    for _, d := range []string{filepath.Join(root, "usr", "bin"), controlDir} {
+        if err := os.MkdirAll(d, 0755); err != nil {
+            t.Fatal(err)
+        }
+    }
+    if err := os.WriteFile(filepath.Join(root, "usr", "bin", "hello"), []byte("#!/bin/sh\n"), 0755); err != nil {
+        t.Fatal(err)
+    }
+    if err := os.WriteFile(filepath.Join(controlDir, "control"), []byte(control), 0644); err != nil {
+        t.Fatal(err)
+    }
+
+    path := filepath.Join(dir, file)
+    if err := BuildDeb(root, controlDir, path); err != nil {
+        t.Fatalf("BuildDeb: %v", err)
+    }
+    return path
+}
+
+// testDebControl control файл пакета, собираемого buildTestDeb
+const testDebControl = `Package: hello
+Version: 1.0-1
+Architecture: amd64
+Maintainer: Test <test@example.com>
+Depends: libc6 (>= 2.31), foo | bar
+Description: test package
+`
+
+// rpmTestTag значение тега заголовка для buildTestRPM: string,
+// []string или []int32
+type rpmTestTag struct {
+    tag   int32
+    value interface{}
+}
+
+// buildTestRPM собирает в dir файл .rpm без сигнатур и содержимого,
+// основной заголовок которого состоит из tags
+func buildTestRPM(t *testing.T, dir, file string, tags []rpmTestTag) string {
+    t.Helper()
+    var index, store bytes.Buffer
+    for _, tag := range tags {
+        var typ, count uint32
+        var data []byte
+        switch v := tag.value.(type) {
+        case string:
+            typ, count, data = rpmTypeString, 1, []byte(v+"\x00")
+        case []string:
+            typ, count = rpmTypeStringArray, uint32(len(v))
+            for _, value := range v {
+                data = append(data, value+"\x00"...)
+            }
+        case []int32:
+            typ, count = rpmTypeInt32, uint32(len(v))
+            for store.Len()%4 != 0 {
+                store.WriteByte(0)
+            }
+            for _, value := range v {
+                data = binary.BigEndian.AppendUint32(data, uint32(value))
+            }
+        default:
+            t.Fatalf("unsupported rpm tag value %T", tag.value)
+        }
+
+        binary.Write(&index, binary.BigEndian, []uint32{uint32(tag.tag), typ, uint32(store.Len()), count})
+        store.Write(data)
+    }
+
+    var out bytes.Buffer
+    lead := make([]byte, rpmLeadSize)
+    copy(lead, magicRPM)
+    out.Write(lead)
+    // Пустой заголовок сигнатур занимает 16 байт и не требует выравнивания
+    writeRPMTestHeader(&out, 0, nil, nil)
+    writeRPMTestHeader(&out, len(tags), index.Bytes(), store.Bytes())
+
+    path := filepath.Join(dir, file)
+    if err := os.WriteFile(path, out.Bytes(), 0644); err != nil {
+        t.Fatal(err)
+    }
+    return path
+}
+
+func writeRPMTestHeader(out *bytes.Buffer, count int, index, store []byte) {
+    out.Write(magicRPMHeader)
+    binary.Write(out, binary.BigEndian, []uint32{0, uint32(count), uint32(len(store))})
+    out.Write(index)
+    out.Write(store)
+}
+
+// buildTestEopkg собирает в dir пакет .eopkg (tar.gz), единственным
+// членом которого служит metadata.xml из testdata/eopkg/metadata
+func buildTestEopkg(t *testing.T, dir, metadata string) string {
+    t.Helper()
+    data, err := os.ReadFile(filepath.Join("testdata", "eopkg", metadata))
+    if err != nil {
+        t.Fatal(err)
+    }
+
+    var out bytes.Buffer
+    gzw := gzip.NewWriter(&out)
+    tw := tar.NewWriter(gzw)
+    if err := tw.WriteHeader(&tar.Header{Name: "metadata.xml", Mode: 0644, Size: int64(len(data))}); err != nil {
+        t.Fatal(err)
+    }
+    if _, err := tw.Write(data); err != nil {
+        t.Fatal(err)
+    }
+    if err := tw.Close(); err != nil {
+        t.Fatal(err)
+    }
+    if err := gzw.Close(); err != nil {
+        t.Fatal(err)
+    }
+
+    path := filepath.Join(dir, strings.TrimSuffix(metadata, ".xml")+".eopkg")
+    if err := os.WriteFile(path, out.Bytes(), 0644); err != nil {
+        t.Fatal(err)
+    }
+    return path
+}
+
+// testAPKPkginfo .PKGINFO пакета, собираемого buildTestAPK; %s заменяется
+// на datahash
+const testAPKPkginfo = `# Generated by abuild 3.11.0-r0
+# using fakeroot version 1.32.1
+pkgname = hello
+pkgver = 1.0-r0
+pkgdesc = test package
+url = https://example.com/hello
+builddate = 1696939200
+packager = Buildozer <alpine-devel@lists.alpinelinux.org>
+size = 10
+arch = x86_64
+origin = hello
+maintainer = Test <test@example.com>
+license = MIT
+depend = so:libc.musl-x86_64.so.1
+provides = cmd:hello=1.0-r0
+datahash = %s
+`
+
+// apkTestEntry файл сегмента .apk
+type apkTestEntry struct {
+    name string
+    body string
+}
+
+// writeAPKTestSegment сжимает entries в отдельный gzip-поток. Как и
+// abuild, сегменты подписи и управляющей части пишутся без маркера
+// конца tar архива
+func writeAPKTestSegment(t *testing.T, entries []apkTestEntry, trailer bool) []byte {
+    t.Helper()
+    var out bytes.Buffer
+    gzw := gzip.NewWriter(&out)
+    tw := tar.NewWriter(gzw)
+    for _, entry := range entries {
+        sum := sha1.Sum([]byte(entry.body))
+        header := &tar.Header{
+            Name:       entry.name,
+            Mode:       0644,
+            Size:       int64(len(entry.body)),
+            PAXRecords: map[string]string{"APK-TOOLS.checksum.SHA1": hex.EncodeToString(sum[:])},
+        }
+        if err := tw.WriteHeader(header); err != nil {
+            t.Fatal(err)
+        }
+        if _, err := tw.Write([]byte(entry.body)); err != nil {
+            t.Fatal(err)
+        }
+    }
+
+    var err error
+    if trailer {
+        err = tw.Close()
+    } else {
+        err = tw.Flush()
+    }
+    if err != nil {
+        t.Fatal(err)
+    }
+    if err := gzw.Close(); err != nil {
+        t.Fatal(err)
+    }
+    return out.Bytes()
+}
+
+// buildTestAPK собирает в dir пакет hello-1.0-r0.apk из трех сегментов:
+// подписи, .PKGINFO и данных с файлом usr/bin/hello. Пустой dataHash
+// заменяется настоящим SHA256 сегмента данных
+func buildTestAPK(t *testing.T, dir, dataHash string) string {
+    t.Helper()
+    data := writeAPKTestSegment(t, []apkTestEntry{{"usr/bin/hello", "#!/bin/sh\n"}}, true)
+    if dataHash == "" {
+        sum := sha256.Sum256(data)
+        dataHash = hex.EncodeToString(sum[:])
+    }
+    control := writeAPKTestSegment(t, []apkTestEntry{{".PKGINFO", fmt.Sprintf(testAPKPkginfo, dataHash)}}, false)
+    signature := writeAPKTestSegment(t, []apkTestEntry{{".SIGN.RSA.test@example.com-5f3e1a2b.rsa.pub", "signature"}}, false)
+
+    path := filepath.Join(dir, "hello-1.0-r0.apk")
+    if err := os.WriteFile(path, append(append(signature, control...), data...), 0644); err != nil {
+        t.Fatal(err)
+    }
+    return path
+}
@@ -0,0 +1,45 @@
+// internal/gpg.go
+package internal
+
+import (
+    "bufio"
+    "fmt"
+    "os"
+
+    "golang.org/x/crypto/openpgp"
+)
+
+// readKeyring читает связку открытых ключей OpenPGP в armored
+// или бинарном виде
+func readKeyring(path string) (openpgp.EntityList, error) {
+    f, err := os.Open(path)
+    if err != nil {
+        return nil, fmt.Errorf("failed to open keyring: %w", err)
+    }
+    defer f.Close()
+
+    br := bufio.NewReader(f)
+    head, _ := br.Peek(5)
+
+    var keyring openpgp.EntityList
+    if string(head) == "-----" {
+        keyring, err = openpgp.ReadArmoredKeyRing(br)
+    } else {
+        keyring, err = openpgp.ReadKeyRing(br)
+    }
+    if err != nil {
+        return nil, fmt.Errorf("failed to read keyring: %w", err)
+    }
+    if len(keyring) == 0 {
+        return nil, fmt.Errorf("keyring %s contains no keys", path)
+    }
+    return keyring, nil
+}
+
+// signerIdentity возвращает идентификатор владельца ключа
+func signerIdentity(entity *openpgp.Entity) string {
+    for name := range entity.Identities {
+        return name
+    }
+    return fmt.Sprintf("%X", entity.PrimaryKey.Fingerprint)
+}
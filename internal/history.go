@@ -0,0 +1,104 @@
+// internal/history.go
+package internal
+
+import (
+    "bufio"
+    "encoding/json"
+    "fmt"
+    "os"
+    "path/filepath"
+    "time"
+)
+
+// Имя файла журнала операций в DBDir
+const historyFile = "history.jsonl"
+
+// Transaction запись журнала операций
+type Transaction struct {
+    Time    time.Time `json:"time"`
+    Action  string    `json:"action"`
+    Package string    `json:"package"`
+    Version string    `json:"version,omitempty"`
+    Backend string    `json:"backend"`
+    Result  string    `json:"result"`
+    Error   string    `json:"error,omitempty"`
+}
+
+// Результаты операций в журнале
+const (
+    ResultSuccess = "success"
+    ResultFailed  = "failed"
+)
+
+// historyPath возвращает путь к журналу операций для корня root
+func historyPath(root string) string {
+    return filepath.Join(resolveRoot(root), DBDir, historyFile)
+}
+
+// RecordTransaction дописывает запись в журнал операций. Журнал
+// хранится в формате JSON Lines и только дополняется
+func RecordTransaction(root string, tx Transaction) error {
+    path := historyPath(root)
+    if err := CreateDirectory(filepath.Dir(path), 0755); err != nil {
+        return err
+    }
+
+    if tx.Time.IsZero() {
+        tx.Time = time.Now()
+    }
+
+    data, err := json.Marshal(tx)
+    if err != nil {
+        return fmt.Errorf("failed to encode history entry: %w", err)
+    }
+
+    f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+    if err != nil {
+        return fmt.Errorf("failed to open history: %w", err)
+    }
+    defer f.Close()
+
+    if _, err := f.Write(append(data, '\n')); err != nil {
+        return fmt.Errorf("failed to write history: %w", err)
+    }
+    return f.Close()
+}
+
+// ReadHistory возвращает последние limit записей журнала операций
+// (все при limit <= 0) в хронологическом порядке
+func ReadHistory(root string, limit int) ([]Transaction, error) {
+    f, err := os.Open(historyPath(root))
+    if os.IsNotExist(err) {
+        return nil, nil
+    }
+    if err != nil {
+        return nil, fmt.Errorf("failed to open history: %w", err)
+    }
+    defer f.Close()
+
+    var result []Transaction
+    scanner := bufio.NewScanner(f)
+    scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+    for scanner.Scan() {
+        line := scanner.Bytes()
+        if len(line) == 0 {
+            continue
+        }
+
+        var tx Transaction
+        if err := json.Unmarshal(line, &tx); err != nil {
+            // Оборванная запись не должна скрывать остальной журнал
+            logger.Warnf("Skipping malformed history entry: %v", err)
+            continue
+        }
+        result = append(result, tx)
+    }
+    if err := scanner.Err(); err != nil {
+        return nil, fmt.Errorf("failed to read history: %w", err)
+    }
+
+    if limit > 0 && len(result) > limit {
+        result = result[len(result)-limit:]
+    }
+    return result, nil
+}
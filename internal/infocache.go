@@ -0,0 +1,82 @@
+// internal/infocache.go
+package internal
+
+import (
+    "encoding/json"
+    "io"
+    "os"
+    "path/filepath"
+)
+
+// Подкаталог CacheDir с разобранными метаданными пакетов
+const infoCacheDir = "info"
+
+// infoCacheEntry запись кэша метаданных. Хеш и тип сверяются при чтении,
+// чтобы не вернуть данные другого файла
+type infoCacheEntry struct {
+    SHA256 string       `json:"sha256"`
+    Type   string       `json:"type"`
+    Info   *PackageInfo `json:"info"`
+}
+
+// infoCachePath возвращает путь к записи кэша для хеша файла
+func infoCachePath(hash string) string {
+    return filepath.Join(CacheDir, infoCacheDir, hash+".json")
+}
+
+// loadCachedInfo ищет в кэше метаданные файла path. Возвращает их (nil
+// при промахе) и хеш файла для storeCachedInfo; пустой хеш означает,
+// что кэш не используется
+func loadCachedInfo(path string, pt PackageType) (*PackageInfo, string) {
+    if !UseInfoCache {
+        return nil, ""
+    }
+
+    hash, err := CalculateFileHash(path)
+    if err != nil {
+        logger.Debugf("Not caching info of %s: %v", path, err)
+        return nil, ""
+    }
+
+    data, err := os.ReadFile(infoCachePath(hash))
+    if err != nil {
+        return nil, hash
+    }
+    var entry infoCacheEntry
+    if err := json.Unmarshal(data, &entry); err != nil {
+        logger.Debugf("Ignoring corrupted info cache entry %s: %v", infoCachePath(hash), err)
+        return nil, hash
+    }
+    if entry.SHA256 != hash || entry.Type != pt.String() || entry.Info == nil {
+        return nil, hash
+    }
+    return entry.Info, hash
+}
+
+// storeCachedInfo сохраняет метаданные в кэш. Ошибки записи, например
+// при запуске без прав на CacheDir, не мешают работе и только
+// записываются в журнал
+func storeCachedInfo(hash string, pt PackageType, info *PackageInfo) {
+    if hash == "" {
+        return
+    }
+
+    data, err := json.Marshal(infoCacheEntry{SHA256: hash, Type: pt.String(), Info: info})
+    if err != nil {
+        logger.Debugf("Failed to encode info cache entry: %v", err)
+        return
+    }
+
+    path := infoCachePath(hash)
+    if err := CreateDirectory(filepath.Dir(path), 0755); err != nil {
+        logger.Debugf("Not caching package info: %v", err)
+        return
+    }
+    err = writeFileAtomic(path, func(w io.Writer) error {
+        _, err := w.Write(data)
+        return err
+    })
+    if err != nil {
+        logger.Debugf("Not caching package info: %v", err)
+    }
+}
@@ -0,0 +1,463 @@
+// internal/installed.go
+package internal
+
+import (
+    "context"
+    "fmt"
+    "regexp"
+    "sort"
+    "strings"
+    "sync"
+)
+
+// hostBackends бинарники пакетных менеджеров в порядке предпочтения
+var hostBackends = []struct {
+    Type   PackageType
+    Binary string
+}{
+    {TypeDeb, "dpkg"},
+    {TypeRPM, "rpm"},
+    {TypePacman, "pacman"},
+    {TypeAPK, "apk"},
+    {TypeEopkg, "eopkg"},
+}
+
+// ParsePackageType возвращает тип пакета по его названию
+func ParsePackageType(name string) (PackageType, error) {
+    switch strings.ToLower(strings.TrimSpace(name)) {
+    case "deb", "dpkg":
+        return TypeDeb, nil
+    case "rpm":
+        return TypeRPM, nil
+    case "eopkg":
+        return TypeEopkg, nil
+    case "pacman":
+        return TypePacman, nil
+    case "apk":
+        return TypeAPK, nil
+    }
+    return TypeUnknown, fmt.Errorf("unknown package type: %s", name)
+}
+
+// DetectHostPackageType определяет основной пакетный менеджер системы
+func DetectHostPackageType() PackageType {
+    if backends := DetectAvailableManagers(); len(backends) > 0 {
+        return backends[0]
+    }
+    return TypeUnknown
+}
+
+var (
+    availableOnce     sync.Once
+    availableBackends []PackageType
+)
+
+// DetectAvailableManagers возвращает пакетные менеджеры, найденные в системе,
+// в порядке предпочтения. Поиск бинарников выполняется один раз
+func DetectAvailableManagers() []PackageType {
+    availableOnce.Do(func() {
+        for _, backend := range hostBackends {
+            if _, err := CommandRunner.LookPath(backend.Binary); err == nil {
+                availableBackends = append(availableBackends, backend.Type)
+            }
+        }
+    })
+    return availableBackends
+}
+
+// BackendBinary возвращает бинарник пакетного менеджера pt
+func BackendBinary(pt PackageType) string {
+    for _, backend := range hostBackends {
+        if backend.Type == pt {
+            return backend.Binary
+        }
+    }
+    return ""
+}
+
+// ErrBackendUnavailable пакетный менеджер не установлен в системе
+var ErrBackendUnavailable = &PackageError{Code: ErrSystemIncompatible, Message: "package manager not available on this host"}
+
+// requireBackend возвращает ErrBackendUnavailable, если бинарник
+// пакетного менеджера pt не найден
+func requireBackend(pt PackageType) error {
+    binary := BackendBinary(pt)
+    if binary == "" {
+        return ErrNotSupported
+    }
+    if _, err := CommandRunner.LookPath(binary); err != nil {
+        return fmt.Errorf("%w: %s backend requires %s", ErrBackendUnavailable, pt, binary)
+    }
+    return nil
+}
+
+// IsPackageInstalled проверяет, установлен ли пакет name в базе
+// пакетного менеджера pt
+func IsPackageInstalled(ctx context.Context, pt PackageType, name string) bool {
+    var err error
+    switch pt {
+    case TypeDeb:
+        return NewDebManager().IsInstalled(name)
+    case TypePacman:
+        return NewPacmanManager().IsInstalled(name)
+    case TypeRPM:
+        _, err = CommandRunner.Output(ctx, "rpm", "-q", name)
+    case TypeAPK:
+        _, err = CommandRunner.Output(ctx, "apk", "info", "-e", name)
+    case TypeEopkg:
+        // eopkg info описывает и доступные в репозитории пакеты,
+        // установленные отмечены отдельным разделом
+        output, err := CommandRunner.Output(ctx, "eopkg", "info", name)
+        return err == nil && strings.Contains(string(output), "Installed package:")
+    default:
+        return false
+    }
+
+    return err == nil
+}
+
+// DetectInstalledPackageType возвращает первый из доступных пакетных
+// менеджеров, в базе которого установлен пакет name, или TypeUnknown
+func DetectInstalledPackageType(ctx context.Context, name string) PackageType {
+    for _, pt := range DetectAvailableManagers() {
+        if IsPackageInstalled(ctx, pt, name) {
+            logger.Debugf("Package %s is installed via %s", name, pt)
+            return pt
+        }
+    }
+    return TypeUnknown
+}
+
+// essentialPackages пакеты, без которых система не загрузится или
+// потеряет пакетный менеджер, для форматов без признака Essential
+var essentialPackages = map[PackageType][]string{
+    TypeRPM:    {"glibc", "bash", "coreutils", "filesystem", "setup", "systemd", "util-linux", "shadow-utils", "rpm", "dnf", "kernel-core"},
+    TypePacman: {"base", "glibc", "bash", "coreutils", "filesystem", "systemd", "util-linux", "shadow", "pacman", "linux"},
+    TypeAPK:    {"alpine-base", "alpine-baselayout", "musl", "busybox", "apk-tools", "openrc"},
+    TypeEopkg:  {"baselayout", "glibc", "bash", "coreutils", "systemd", "util-linux", "eopkg"},
+}
+
+// IsEssential проверяет, является ли пакет обязательным для системы.
+// Для deb используются поля Essential и Protected из базы dpkg; rpm не
+// хранит такого признака, поэтому для остальных форматов используется
+// встроенный список
+func IsEssential(name string, t PackageType) bool {
+    if t == TypeDeb {
+        output, err := CommandRunner.Output(context.Background(), "dpkg-query", "-W", "-f", "${Essential} ${Protected}", name)
+        if err != nil {
+            return false
+        }
+        for _, field := range strings.Fields(string(output)) {
+            if field == "yes" {
+                return true
+            }
+        }
+        return false
+    }
+
+    for _, essential := range essentialPackages[t] {
+        if essential == name {
+            return true
+        }
+    }
+    return false
+}
+
+// ReverseDependencies возвращает отсортированные имена установленных
+// пакетов, зависящих от name: apt-cache rdepends для deb, dnf repoquery
+// --whatrequires (или rpm -q --whatrequires) для rpm, pacman -Qi для
+// pacman и apk info -r для apk
+func ReverseDependencies(ctx context.Context, pt PackageType, name string) ([]string, error) {
+    var command []string
+    switch pt {
+    case TypeDeb:
+        command = []string{"apt-cache", "rdepends", "--installed",
+            "--no-recommends", "--no-suggests", "--no-conflicts", "--no-breaks",
+            "--no-replaces", "--no-enhances", name}
+    case TypeRPM:
+        if _, err := CommandRunner.LookPath("dnf"); err == nil {
+            command = []string{"dnf", "repoquery", "--installed", "--quiet", "--qf", "%{name}", "--whatrequires", name}
+        } else {
+            command = []string{"rpm", "-q", "--qf", "%{NAME}\n", "--whatrequires", name}
+        }
+    case TypePacman:
+        command = []string{"pacman", "-Qi", name}
+    case TypeAPK:
+        command = []string{"apk", "info", "-r", name}
+    default:
+        return nil, ErrNotSupported
+    }
+
+    output, err := CommandRunner.Output(ctx, command[0], command[1:]...)
+    if err != nil {
+        // rpm завершается с ошибкой, если зависимых пакетов нет
+        if pt == TypeRPM && strings.Contains(string(output), "no package requires") {
+            return nil, nil
+        }
+        return nil, fmt.Errorf("failed to query reverse dependencies of %s: %w", name, err)
+    }
+
+    var names []string
+    switch pt {
+    case TypeDeb:
+        names = parseAptRdepends(string(output))
+    case TypePacman:
+        names = parsePacmanRequiredBy(string(output))
+    case TypeAPK:
+        names = parseAPKRequiredBy(string(output))
+    default:
+        names = strings.Fields(string(output))
+    }
+
+    seen := map[string]bool{name: true}
+    var result []string
+    for _, dep := range names {
+        if !seen[dep] {
+            seen[dep] = true
+            result = append(result, dep)
+        }
+    }
+    sort.Strings(result)
+    return result, nil
+}
+
+// parseAptRdepends разбирает вывод apt-cache rdepends. Альтернативы
+// отмечены префиксом "|"
+func parseAptRdepends(output string) []string {
+    var names []string
+    for _, line := range strings.Split(output, "\n") {
+        if !strings.HasPrefix(line, " ") {
+            continue
+        }
+        if name := strings.TrimLeft(strings.TrimSpace(line), "|"); name != "" {
+            names = append(names, name)
+        }
+    }
+    return names
+}
+
+// parsePacmanRequiredBy извлекает поле "Required By" из вывода pacman -Qi.
+// Длинные значения переносятся на строки с отступом
+func parsePacmanRequiredBy(output string) []string {
+    var names []string
+    inField := false
+    for _, line := range strings.Split(output, "\n") {
+        if inField && strings.HasPrefix(line, " ") {
+            names = append(names, strings.Fields(line)...)
+            continue
+        }
+        inField = false
+
+        key, value, ok := strings.Cut(line, ":")
+        if !ok || strings.TrimSpace(key) != "Required By" {
+            continue
+        }
+        inField = true
+        if value = strings.TrimSpace(value); value != "None" {
+            names = append(names, strings.Fields(value)...)
+        }
+    }
+    return names
+}
+
+// parseAPKRequiredBy разбирает вывод apk info -r: заголовок
+// "name-version is required by:" и строки name-version
+func parseAPKRequiredBy(output string) []string {
+    var names []string
+    for _, line := range strings.Split(output, "\n") {
+        line = strings.TrimSpace(line)
+        if line == "" || strings.HasSuffix(line, ":") {
+            continue
+        }
+        name, _ := splitAPKNameVersion(line)
+        names = append(names, name)
+    }
+    return names
+}
+
+// dpkgInstalledFormat формат dpkg-query для ListInstalled, разбираемый
+// parseDpkgInstalled
+const dpkgInstalledFormat = "${db:Status-Abbrev}\t${Package}\t${Version}\t${Architecture}\t${Pre-Depends}\t${Depends}\t${Provides}\t${Conflicts}\t${Breaks}\t${binary:Summary}\n"
+
+// ListInstalled возвращает список установленных пакетов указанного типа
+func ListInstalled(pt PackageType) ([]PackageInfo, error) {
+    var name string
+    var args []string
+
+    switch pt {
+    case TypeDeb:
+        name = "dpkg-query"
+        args = []string{"-W", "-f", dpkgInstalledFormat}
+    case TypeRPM:
+        name = "rpm"
+        args = []string{"-qa", "--qf", "%{NAME}\t%{VERSION}-%{RELEASE}\t%{ARCH}\t%{SUMMARY}\n"}
+    case TypePacman:
+        // Локальная база читается напрямую, без блокировки pacman
+        return NewPacmanManager().ListInstalled()
+    case TypeAPK:
+        name = "apk"
+        args = []string{"list", "--installed"}
+    case TypeEopkg:
+        name = "eopkg"
+        args = []string{"list-installed", "-l"}
+    default:
+        return nil, ErrNotSupported
+    }
+
+    output, err := CommandRunner.Output(context.Background(), name, args...)
+    if err != nil {
+        return nil, fmt.Errorf("failed to list installed packages: %w", err)
+    }
+
+    switch pt {
+    case TypeDeb:
+        return parseDpkgInstalled(string(output)), nil
+    case TypeRPM:
+        return parseTabInstalled(string(output)), nil
+    case TypeAPK:
+        return parseAPKInstalled(string(output)), nil
+    default:
+        return parseEopkgInstalled(string(output)), nil
+    }
+}
+
+// InstalledVersion возвращает версию установленного пакета name и
+// признак того, что он найден в базе
+func InstalledVersion(pt PackageType, name string) (string, bool, error) {
+    packages, err := ListInstalled(pt)
+    if err != nil {
+        return "", false, err
+    }
+    for _, pkg := range packages {
+        if pkg.Name == name {
+            return pkg.Version, true, nil
+        }
+    }
+    return "", false, nil
+}
+
+// parseTabInstalled парсит вывод вида name\tversion\tarch\tsummary
+func parseTabInstalled(data string) []PackageInfo {
+    var result []PackageInfo
+    for _, line := range strings.Split(data, "\n") {
+        fields := strings.SplitN(line, "\t", 4)
+        if len(fields) < 3 || fields[0] == "" {
+            continue
+        }
+
+        info := PackageInfo{
+            Name:         fields[0],
+            Version:      fields[1],
+            Architecture: fields[2],
+        }
+        if len(fields) == 4 {
+            info.Description = fields[3]
+        }
+        result = append(result, info)
+    }
+    return result
+}
+
+// parseDpkgInstalled парсит вывод dpkg-query вида status\tname\tversion\t
+// arch\tpre-depends\tdepends\tprovides\tconflicts\tbreaks\tsummary.
+// Пакеты, оставшиеся в базе после удаления (например rc - только
+// конфигурационные файлы), пропускаются
+func parseDpkgInstalled(data string) []PackageInfo {
+    var result []PackageInfo
+    for _, line := range strings.Split(data, "\n") {
+        fields := strings.SplitN(line, "\t", 10)
+        if len(fields) < 10 || fields[1] == "" {
+            continue
+        }
+        if !dpkgStatusInstalled(fields[0]) {
+            continue
+        }
+
+        result = append(result, PackageInfo{
+            Name:         fields[1],
+            Version:      fields[2],
+            Architecture: fields[3],
+            Dependencies: dependencyNames(parseDepends(fields[4] + "," + fields[5])),
+            Provides:     dependencyNames(parseDepends(fields[6])),
+            Conflicts:    dependencyNames(parseDepends(fields[7] + "," + fields[8])),
+            Description:  fields[9],
+        })
+    }
+    return result
+}
+
+// dpkgStatusInstalled сообщает, установлен ли пакет по ${db:Status-Abbrev}:
+// желаемое состояние install или hold и фактическое installed
+func dpkgStatusInstalled(status string) bool {
+    status = strings.TrimSpace(status)
+    return strings.HasPrefix(status, "ii") || strings.HasPrefix(status, "hi")
+}
+
+// parseAPKInstalled парсит вывод apk list --installed:
+// name-1.2.3-r0 x86_64 {origin} (license) [installed]
+func parseAPKInstalled(data string) []PackageInfo {
+    var result []PackageInfo
+    for _, line := range strings.Split(data, "\n") {
+        fields := strings.Fields(line)
+        if len(fields) < 2 {
+            continue
+        }
+
+        name, version := splitAPKNameVersion(fields[0])
+        result = append(result, PackageInfo{
+            Name:         name,
+            Version:      version,
+            Architecture: fields[1],
+        })
+    }
+    return result
+}
+
+// splitAPKNameVersion разделяет строку name-version-rN на имя и версию
+func splitAPKNameVersion(s string) (string, string) {
+    rest := s
+    if i := strings.LastIndex(rest, "-r"); i > 0 {
+        rest = rest[:i]
+    }
+    if i := strings.LastIndex(rest, "-"); i > 0 {
+        return s[:i], s[i+1:]
+    }
+    return s, ""
+}
+
+// eopkgInstalledRe строка заголовка из eopkg list-installed -l
+var eopkgInstalledRe = regexp.MustCompile(`^Name\s*:\s*([^,]+),\s*version:\s*([^,]+),\s*release:\s*(\S+)`)
+
+// parseEopkgInstalled парсит вывод eopkg list-installed -l
+func parseEopkgInstalled(data string) []PackageInfo {
+    var result []PackageInfo
+    for _, line := range strings.Split(data, "\n") {
+        line = strings.TrimSpace(line)
+
+        if m := eopkgInstalledRe.FindStringSubmatch(line); m != nil {
+            result = append(result, PackageInfo{
+                Name:    strings.TrimSpace(m[1]),
+                Version: fmt.Sprintf("%s-%s", strings.TrimSpace(m[2]), m[3]),
+            })
+            continue
+        }
+
+        if len(result) == 0 {
+            continue
+        }
+
+        parts := strings.SplitN(line, ":", 2)
+        if len(parts) != 2 {
+            continue
+        }
+
+        current := &result[len(result)-1]
+        switch strings.TrimSpace(parts[0]) {
+        case "Summary":
+            current.Description = strings.TrimSpace(parts[1])
+        case "Architecture":
+            current.Architecture = strings.TrimSpace(parts[1])
+        }
+    }
+    return result
+}
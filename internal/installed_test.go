@@ -0,0 +1,95 @@
+package internal
+
+import (
+    "context"
+    "reflect"
+    "sync"
+    "testing"
+)
+
+// resetAvailableManagers сбрасывает найденные пакетные менеджеры до и
+// после теста
+func resetAvailableManagers(t *testing.T) {
+    availableOnce, availableBackends = sync.Once{}, nil
+    t.Cleanup(func() {
+        availableOnce, availableBackends = sync.Once{}, nil
+    })
+}
+
+func TestDetectInstalledPackageType(t *testing.T) {
+    resetAvailableManagers(t)
+    runner := useFakeRunner(t, "dpkg", "rpm", "apk")
+    // Удаленный пакет с оставшимися конфигами не считается установленным
+    runner.outputs["dpkg -s foo"] = []byte("Package: foo\nStatus: deinstall ok config-files\n")
+    runner.fail["rpm -q foo"] = true
+
+    if got := DetectInstalledPackageType(context.Background(), "foo"); got != TypeAPK {
+        t.Errorf("DetectInstalledPackageType = %s, want apk", got)
+    }
+    assertCalls(t, runner,
+        []string{"dpkg", "-s", "foo"},
+        []string{"rpm", "-q", "foo"},
+        []string{"apk", "info", "-e", "foo"},
+    )
+}
+
+func TestDetectInstalledPackageTypeFirstMatch(t *testing.T) {
+    resetAvailableManagers(t)
+    runner := useFakeRunner(t, "dpkg", "rpm")
+    runner.outputs["dpkg -s foo"] = []byte("Package: foo\nStatus: install ok installed\n")
+
+    if got := DetectInstalledPackageType(context.Background(), "foo"); got != TypeDeb {
+        t.Errorf("DetectInstalledPackageType = %s, want deb", got)
+    }
+    assertCalls(t, runner, []string{"dpkg", "-s", "foo"})
+}
+
+func TestDetectInstalledPackageTypeWithoutManagers(t *testing.T) {
+    resetAvailableManagers(t)
+    runner := useFakeRunner(t)
+
+    if got := DetectInstalledPackageType(context.Background(), "foo"); got != TypeUnknown {
+        t.Errorf("DetectInstalledPackageType = %s, want unknown", got)
+    }
+    assertCalls(t, runner)
+}
+
+func TestDetectAvailableManagersCachesLookup(t *testing.T) {
+    resetAvailableManagers(t)
+    runner := useFakeRunner(t, "rpm", "eopkg")
+
+    want := []PackageType{TypeRPM, TypeEopkg}
+    if got := DetectAvailableManagers(); !reflect.DeepEqual(got, want) {
+        t.Fatalf("DetectAvailableManagers = %v, want %v", got, want)
+    }
+
+    runner.binaries["dpkg"] = true
+    if got := DetectAvailableManagers(); !reflect.DeepEqual(got, want) {
+        t.Errorf("second DetectAvailableManagers = %v, want cached %v", got, want)
+    }
+}
+
+func TestListInstalledDebSkipsRemoved(t *testing.T) {
+    runner := useFakeRunner(t, "dpkg-query")
+    // rc - пакет удален, но его конфигурационные файлы остались в базе
+    runner.outputs["dpkg-query -W -f "+dpkgInstalledFormat] = []byte(
+        "ii \thello\t1.0-1\tamd64\t\tlibc6 (>= 2.34)\t\t\t\tgreeting program\n" +
+            "rc \told\t0.9-1\tamd64\t\t\t\t\t\tremoved program\n" +
+            "hi \theld\t2.0-1\tall\t\t\t\t\t\theld program\n")
+
+    packages, err := ListInstalled(TypeDeb)
+    if err != nil {
+        t.Fatalf("ListInstalled: %v", err)
+    }
+    var names []string
+    for _, pkg := range packages {
+        names = append(names, pkg.Name)
+    }
+    if want := []string{"hello", "held"}; !reflect.DeepEqual(names, want) {
+        t.Errorf("ListInstalled names = %v, want %v", names, want)
+    }
+
+    if _, found, err := InstalledVersion(TypeDeb, "old"); err != nil || found {
+        t.Errorf("InstalledVersion(old) = found %v, err %v, want not found", found, err)
+    }
+}
@@ -0,0 +1,87 @@
+// internal/lock.go
+package internal
+
+import (
+    "errors"
+    "fmt"
+    "os"
+    "path/filepath"
+    "strconv"
+    "strings"
+    "syscall"
+)
+
+// Имя файла блокировки в DBDir
+const lockFile = "lock"
+
+// ErrLocked блокировка удерживается другим процессом upkgt
+var ErrLocked = errors.New("another upkgt process is running")
+
+// Lock блокировка базы upkgt, исключающая одновременный запуск
+type Lock struct {
+    file *os.File
+}
+
+// lockPath возвращает путь к файлу блокировки для корня root
+func lockPath(root string) string {
+    return filepath.Join(resolveRoot(root), DBDir, lockFile)
+}
+
+// AcquireLock захватывает блокировку для корня root без ожидания.
+// Если она удерживается, возвращает ErrLocked с PID владельца.
+// Блокировка снимается ядром и при аварийном завершении процесса
+func AcquireLock(root string) (*Lock, error) {
+    path := lockPath(root)
+    if err := CreateDirectory(filepath.Dir(path), 0755); err != nil {
+        return nil, err
+    }
+
+    f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0644)
+    if err != nil {
+        return nil, fmt.Errorf("failed to open lock file: %w", err)
+    }
+
+    if err := syscall.Flock(int(f.Fd()), syscall.LOCK_EX|syscall.LOCK_NB); err != nil {
+        defer f.Close()
+        if errors.Is(err, syscall.EWOULDBLOCK) {
+            if pid := readLockPID(f); pid > 0 {
+                return nil, fmt.Errorf("%w: lock %s is held by pid %d", ErrLocked, path, pid)
+            }
+            return nil, fmt.Errorf("%w: lock %s is held", ErrLocked, path)
+        }
+        return nil, fmt.Errorf("failed to lock %s: %w", path, err)
+    }
+
+    // PID владельца нужен только для сообщения другим процессам
+    if err := f.Truncate(0); err == nil {
+        f.WriteAt([]byte(strconv.Itoa(os.Getpid())+"\n"), 0)
+    }
+
+    return &Lock{file: f}, nil
+}
+
+// Release снимает блокировку
+func (l *Lock) Release() error {
+    if l == nil || l.file == nil {
+        return nil
+    }
+    l.file.Truncate(0)
+    err := syscall.Flock(int(l.file.Fd()), syscall.LOCK_UN)
+    l.file.Close()
+    l.file = nil
+    if err != nil {
+        return fmt.Errorf("failed to release lock: %w", err)
+    }
+    return nil
+}
+
+// readLockPID читает PID владельца из файла блокировки
+func readLockPID(f *os.File) int {
+    buf := make([]byte, 32)
+    n, _ := f.ReadAt(buf, 0)
+    pid, err := strconv.Atoi(strings.TrimSpace(string(buf[:n])))
+    if err != nil {
+        return 0
+    }
+    return pid
+}
@@ -2,7 +2,11 @@
 package internal
 
 import (
+    "context"
     "fmt"
+    "os"
+    "path/filepath"
+    "strings"
     "time"
 )
 
@@ -41,42 +45,172 @@ func (pt PackageType) String() string {
     }[pt]
 }
 
+// InstallOptions параметры установки пакета
+type InstallOptions struct {
+    Root       string // Корневая директория установки
+    Force      bool   // Принудительная установка
+    NoDeps     bool   // Не проверять зависимости
+    DryRun     bool   // Только показать, что будет сделано
+    NoBackup   bool   // Не создавать резервную копию базы пакетов
+    IgnoreArch bool   // Не проверять архитектуру пакета
+    Upgrade    bool   // Заменить установленную версию пакета
+    Downgrade  bool   // Разрешить установку более старой версии
+    Reinstall  bool   // Переустановить ту же версию (dpkg и pacman делают это всегда)
+    Refresh    bool   // Обновить индексы репозиториев после установки (только apt)
+    AssumeYes  bool   // Не задавать вопросов: передать менеджеру флаг согласия
+    Offline    bool   // Не обращаться к сети: только локальный файл и кэш
+
+    // Устанавливать неподписанные пакеты и пакеты с неизвестными ключами
+    // (apk --allow-untrusted)
+    AllowUntrusted bool
+
+    Progress ProgressFunc // Прогресс резервного копирования, nil - без вывода
+}
+
+// InstallRoot возвращает корневую директорию установки
+func (o InstallOptions) InstallRoot() string {
+    return resolveRoot(o.Root)
+}
+
+// IsAltRoot сообщает, выполняется ли установка в альтернативный корень
+func (o InstallOptions) IsAltRoot() bool {
+    return isAltRoot(o.Root)
+}
+
+// RemoveOptions параметры удаления пакета
+type RemoveOptions struct {
+    Root      string // Корневая директория установки
+    Purge     bool   // Удалить также конфигурационные файлы
+    Force     bool   // Принудительное удаление
+    NoDeps    bool   // Не проверять зависимости
+    DryRun    bool   // Только показать, что будет сделано
+    NoBackup  bool   // Не создавать резервную копию базы пакетов
+    AssumeYes bool   // Не задавать вопросов: передать менеджеру флаг согласия
+
+    // Удалить ставшие ненужными зависимости (apt-get autoremove для
+    // deb, если apt установлен)
+    Autoremove bool
+
+    Progress ProgressFunc // Прогресс резервного копирования, nil - без вывода
+}
+
+// InstallRoot возвращает корневую директорию, из которой удаляется пакет
+func (o RemoveOptions) InstallRoot() string {
+    return resolveRoot(o.Root)
+}
+
+// IsAltRoot сообщает, выполняется ли удаление из альтернативного корня
+func (o RemoveOptions) IsAltRoot() bool {
+    return isAltRoot(o.Root)
+}
+
+// resolveRoot возвращает корень установки, по умолчанию DefaultInstallRoot
+func resolveRoot(root string) string {
+    if root == "" {
+        return DefaultInstallRoot
+    }
+    return root
+}
+
+// isAltRoot проверяет, отличается ли корень от DefaultInstallRoot
+func isAltRoot(root string) bool {
+    return filepath.Clean(resolveRoot(root)) != DefaultInstallRoot
+}
+
+// InstallPackage устанавливает пакет.
+//
+// Deprecated: используйте Package.Install с InstallOptions
+func InstallPackage(pkg Package, force bool) error {
+    return pkg.Install(context.Background(), InstallOptions{Force: force, AssumeYes: true})
+}
+
+// RemovePackage удаляет пакет.
+//
+// Deprecated: используйте Package.Remove с RemoveOptions
+func RemovePackage(pkg Package, purge bool) error {
+    return pkg.Remove(context.Background(), RemoveOptions{Purge: purge, Autoremove: true, AssumeYes: true})
+}
+
 // Package интерфейс для всех типов пакетов
 type Package interface {
-    // Install устанавливает пакет
-    Install(force bool) error
+    // Install устанавливает пакет. Отмена ctx прерывает внешние команды
+    Install(ctx context.Context, opts InstallOptions) error
     
-    // Remove удаляет пакет
-    Remove(purge bool) error
+    // Remove удаляет пакет. Отмена ctx прерывает внешние команды
+    Remove(ctx context.Context, opts RemoveOptions) error
     
     // GetInfo возвращает информацию о пакете
-    GetInfo() (*PackageInfo, error)
+    GetInfo(ctx context.Context) (*PackageInfo, error)
+    
+    // ListFiles возвращает список файлов, содержащихся в пакете
+    ListFiles() ([]FileInfo, error)
+    
+    // Validate быстро проверяет структуру файла пакета, не распаковывая
+    // содержимое и не проверяя подписи и контрольные суммы
+    Validate() error
+    
+    // Verify проверяет целостность архива и контрольные суммы
+    Verify() error
+    
+    // Extract распаковывает файлы пакета в указанный каталог
+    Extract(dest string) error
     
     // GetType возвращает тип пакета
     GetType() PackageType
     
+    // Comparator возвращает компаратор версий для формата пакета
+    Comparator() VersionComparator
+    
     // String возвращает строковое представление пакета
     String() string
 }
 
+// Dependency зависимость пакета с необязательным ограничением версии
+type Dependency struct {
+    Name     string // Имя пакета
+    Relation string // Отношение версий: <<, <=, =, >=, >>
+    Version  string // Версия
+}
+
+// String возвращает зависимость в формате Debian: "name (>= version)"
+func (d Dependency) String() string {
+    if d.Relation == "" {
+        return d.Name
+    }
+    return fmt.Sprintf("%s (%s %s)", d.Name, d.Relation, d.Version)
+}
+
+// DependencyGroup группа альтернативных зависимостей "a | b",
+// достаточно удовлетворить любую из них
+type DependencyGroup []Dependency
+
+// String возвращает группу в формате Debian
+func (g DependencyGroup) String() string {
+    alternatives := make([]string, len(g))
+    for i, dep := range g {
+        alternatives[i] = dep.String()
+    }
+    return strings.Join(alternatives, " | ")
+}
+
 // PackageInfo содержит метаданные пакета
 type PackageInfo struct {
-    Name            string    // Имя пакета
-    Version         string    // Версия
-    Architecture    string    // Архитектура
-    Description     string    // Описание
-    Maintainer      string    // Сопровождающий
-    Homepage        string    // Домашняя страница
-    Size            int64     // Размер в байтах
-    InstalledSize   int64     // Размер после установки
-    Dependencies    []string  // Зависимости
-    Conflicts      []string  // Конфликты
-    Provides       []string  // Предоставляет
-    Replaces       []string  // Заменяет
-    InstallDate    time.Time // Дата установки
-    License        string    // Лицензия
-    Section        string    // Секция/категория
-    Priority       string    // Приоритет
+    Name           string    `json:"name"`            // Имя пакета
+    Version        string    `json:"version"`         // Версия
+    Architecture   string    `json:"architecture"`    // Архитектура
+    Description    string    `json:"description"`     // Описание
+    Maintainer     string    `json:"maintainer"`      // Сопровождающий
+    Homepage       string    `json:"homepage"`        // Домашняя страница
+    Size           int64     `json:"size"`            // Размер в байтах
+    InstalledSize  int64     `json:"installed_size"`  // Размер после установки
+    Dependencies   []string  `json:"dependencies"`    // Зависимости
+    Conflicts      []string  `json:"conflicts"`       // Конфликты
+    Provides       []string  `json:"provides"`        // Предоставляет
+    Replaces       []string  `json:"replaces"`        // Заменяет
+    InstallDate    time.Time `json:"install_date"`    // Дата установки
+    License        string    `json:"license"`         // Лицензия
+    Section        string    `json:"section"`         // Секция/категория
+    Priority       string    `json:"priority"`        // Приоритет
 }
 
 // PackageError ошибка при работе с пакетом
@@ -89,10 +223,22 @@ type PackageError struct {
 }
 
 func (e *PackageError) Error() string {
+    msg := e.Message
+    switch {
+    case e.Package != "":
+        msg = fmt.Sprintf("[%s] %s", e.Package, e.Message)
+    case e.Type != TypeUnknown:
+        msg = fmt.Sprintf("[%s] %s", e.Type, e.Message)
+    }
     if e.Original != nil {
-        return fmt.Sprintf("[%s] %s: %v", e.Package, e.Message, e.Original)
+        return fmt.Sprintf("%s: %v", msg, e.Original)
     }
-    return fmt.Sprintf("[%s] %s", e.Package, e.Message)
+    return msg
+}
+
+// Unwrap возвращает оригинальную ошибку
+func (e *PackageError) Unwrap() error {
+    return e.Original
 }
 
 // PackageManager интерфейс для управления пакетами
@@ -116,24 +262,84 @@ type PackageManager interface {
     GetType() PackageType
 }
 
+// NewPackageManager возвращает PackageManager для указанного типа
+func NewPackageManager(pt PackageType) (PackageManager, error) {
+    switch pt {
+    case TypeDeb:
+        return NewDebManager(), nil
+    case TypePacman:
+        return NewPacmanManager(), nil
+    default:
+        return nil, ErrNotSupported
+    }
+}
+
 // Constants для путей и настроек
 const (
     // Корневая директория для установки
     DefaultInstallRoot = "/"
-    
-    // Директория для резервных копий
-    BackupDir = "/var/backups/upkgt"
-    
+
+    // Максимальный возраст резервной копии
+    BackupMaxAge = 30 * 24 * time.Hour
+
+    // Максимальный размер копируемого дерева. Для более крупных баз
+    // сохраняются только ключевые файлы (см. backupEssentials)
+    BackupMaxSize = 64 << 20
+)
+
+// Каталоги upkgt. Переопределяются переменными окружения UPKGT_*_DIR,
+// которые читаются один раз при запуске
+var (
     // Директория для базы данных
-    DBDir = "/var/lib/upkgt"
-    
+    DBDir = envDir("UPKGT_DB_DIR", "/var/lib/upkgt")
+
     // Директория для кэша
-    CacheDir = "/var/cache/upkgt"
-    
+    CacheDir = envDir("UPKGT_CACHE_DIR", "/var/cache/upkgt")
+
     // Временная директория
-    TempDir = "/tmp/upkgt"
+    TempDir = envDir("UPKGT_TEMP_DIR", "/tmp/upkgt")
+)
+
+// Настройки, которые могут быть переопределены файлом конфигурации
+var (
+    // Директория для резервных копий
+    BackupDir = envDir("UPKGT_BACKUP_DIR", "/var/backups/upkgt")
+
+    // Количество резервных копий каждого источника, сохраняемых при очистке
+    BackupKeep = 10
+
+    // Разбирать метаданные пакетов встроенными средствами, а не внешними
+    // утилитами (dpkg-deb), если они установлены
+    PreferNativeParsers = true
+
+    // Сохранять при распаковке владельца и права из архива. Действует
+    // только при запуске от root, иначе файлы принадлежат текущему
+    // пользователю
+    PreserveOwnership = true
+
+    // Не выставлять C locale для команд установки и удаления, чтобы
+    // их вывод был на языке пользователя. Вывод, который разбирается,
+    // всегда запрашивается в C locale
+    PreserveLocale = false
+
+    // Показывать служебные зависимости RPM (rpmlib(...), config(...)),
+    // которые rpm удовлетворяет сам
+    ShowRPMInternalDeps = false
+
+    // Кэшировать разобранные метаданные пакетов в CacheDir по SHA256
+    // файла, чтобы повторный GetInfo не разбирал пакет заново
+    UseInfoCache = true
 )
 
+// envDir возвращает значение переменной окружения name или def, если
+// она не задана
+func envDir(name, def string) string {
+    if dir := os.Getenv(name); dir != "" {
+        return filepath.Clean(dir)
+    }
+    return def
+}
+
 // Error codes
 const (
     ErrUnknown = iota + 1
@@ -155,26 +361,82 @@ var (
     ErrInvalidFormat    = &PackageError{Code: ErrInvalidPackage, Message: "invalid package format"}
     ErrCorruptedPackage = &PackageError{Code: ErrInvalidPackage, Message: "package is corrupted"}
     ErrNotSupported     = &PackageError{Code: ErrSystemIncompatible, Message: "package type not supported"}
+    ErrUnsigned         = &PackageError{Code: ErrInvalidPackage, Message: "package is not signed"}
+    ErrReadOnly         = &PackageError{Code: ErrPermissionDenied, Message: "package is opened read-only"}
 )
 
-// CreatePackageFromPath создает пакет нужного типа на основе расширения файла
+// CreatePackageFromPath создает пакет нужного типа. Тип определяется по
+// расширению файла, а если оно не подходит - по содержимому
 func CreatePackageFromPath(path string) (Package, error) {
-    switch {
-    case strings.HasSuffix(path, ".deb"):
+    switch DetectPackageType(path) {
+    case TypeDeb:
         return NewDeb(path)
-    case strings.HasSuffix(path, ".rpm"):
+    case TypeRPM:
         return NewRPM(path)
-    case strings.HasSuffix(path, ".eopkg"):
+    case TypeEopkg:
         return NewEopkg(path)
-    case strings.HasSuffix(path, ".apk"):
+    case TypeAPK:
         return NewAPK(path)
-    case strings.Contains(path, ".pkg.tar"):
+    case TypePacman:
         return NewPacman(path)
     default:
         return nil, ErrNotSupported
     }
 }
 
+// OpenPackage открывает файл пакета только для чтения: проверяет его
+// структуру и возвращает пакет, у которого Install и Remove отключены и
+// возвращают ErrReadOnly. Не требует прав root и не запускает внешних
+// команд; подписи проверяются отдельно через Verify и VerifySignature
+func OpenPackage(path string) (Package, error) {
+    pkg, err := CreatePackageFromPath(path)
+    if err != nil {
+        return nil, err
+    }
+    if err := pkg.Validate(); err != nil {
+        return nil, err
+    }
+    return readOnlyPackage{pkg}, nil
+}
+
+// readOnlyPackage пакет, открытый через OpenPackage
+type readOnlyPackage struct {
+    Package
+}
+
+// Install всегда возвращает ErrReadOnly
+func (readOnlyPackage) Install(ctx context.Context, opts InstallOptions) error {
+    return ErrReadOnly
+}
+
+// Remove всегда возвращает ErrReadOnly
+func (readOnlyPackage) Remove(ctx context.Context, opts RemoveOptions) error {
+    return ErrReadOnly
+}
+
+// NewInstalledPackage возвращает пакет типа pt для операций над уже
+// установленным пакетом name (например, Remove), без файла пакета
+func NewInstalledPackage(pt PackageType, name string) (Package, error) {
+    if err := ValidatePackageName(name); err != nil {
+        return nil, err
+    }
+
+    switch pt {
+    case TypeDeb:
+        return &Deb{Name: name}, nil
+    case TypeRPM:
+        return &RPM{Name: name}, nil
+    case TypeEopkg:
+        return &Eopkg{Name: name}, nil
+    case TypePacman:
+        return &Pacman{Name: name}, nil
+    case TypeAPK:
+        return &APK{Name: name}, nil
+    default:
+        return nil, ErrNotSupported
+    }
+}
+
 // ValidatePackageName проверяет корректность имени пакета
 func ValidatePackageName(name string) error {
     if name == "" {
@@ -202,12 +464,17 @@ func FormatSize(size int64) string {
     return fmt.Sprintf("%.1f %ciB", float64(size)/float64(div), "KMGTPE"[exp])
 }
 
-// CompareVersions сравнивает версии пакетов
+// CompareVersions сравнивает версии пакетов по правилам dpkg
+// (epoch, upstream, revision; "~" сортируется раньше всего)
 // Возвращает:
 //   -1 если v1 < v2
 //    0 если v1 = v2
 //    1 если v1 > v2
 func CompareVersions(v1, v2 string) int {
-    // TODO: Implement proper version comparison
-    return strings.Compare(v1, v2)
+    return DebVersion{}.Compare(v1, v2)
+}
+
+// CompareVersionsFor сравнивает версии по правилам указанного типа пакета
+func CompareVersionsFor(pt PackageType, v1, v2 string) int {
+    return ComparatorFor(pt).Compare(v1, v2)
 }
\ No newline at end of file
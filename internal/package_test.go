@@ -0,0 +1,61 @@
+package internal
+
+import (
+    "context"
+    "reflect"
+    "testing"
+)
+
+func TestOpenPackageIsReadOnly(t *testing.T) {
+    deb := buildTestDeb(t, t.TempDir(), "hello.deb", testDebControl)
+    runner := useFakeRunner(t, "dpkg")
+
+    pkg, err := OpenPackage(deb)
+    if err != nil {
+        t.Fatalf("OpenPackage: %v", err)
+    }
+    if err := pkg.Install(context.Background(), InstallOptions{NoBackup: true}); err != ErrReadOnly {
+        t.Errorf("Install = %v, want ErrReadOnly", err)
+    }
+    if err := pkg.Remove(context.Background(), RemoveOptions{NoBackup: true}); err != ErrReadOnly {
+        t.Errorf("Remove = %v, want ErrReadOnly", err)
+    }
+    assertCalls(t, runner)
+}
+
+func TestOpenPackageRPMWithoutRPM(t *testing.T) {
+    path := buildTestRPM(t, t.TempDir(), "hello.rpm", []rpmTestTag{
+        {rpmTagName, "hello"},
+        {rpmTagVersion, "2.10"},
+        {rpmTagRelease, "3.fc39"},
+        {rpmTagSummary, "greeting"},
+        {rpmTagBuildTime, []int32{1700000000}},
+        {rpmTagSize, []int32{4096}},
+        {rpmTagArch, "x86_64"},
+        {rpmTagRequireFlags, []int32{0, rpmSenseGreater | rpmSenseEqual, rpmSenseLess | rpmSenseEqual}},
+        {rpmTagRequireName, []string{"bash", "glibc", "rpmlib(CompressedFileNames)"}},
+        {rpmTagRequireVer, []string{"", "2.34", "3.0.4-1"}},
+    })
+    // Без rpm в PATH: открытие и чтение метаданных не запускают команд
+    runner := useFakeRunner(t)
+
+    pkg, err := OpenPackage(path)
+    if err != nil {
+        t.Fatalf("OpenPackage: %v", err)
+    }
+    info, err := pkg.GetInfo(context.Background())
+    if err != nil {
+        t.Fatalf("GetInfo: %v", err)
+    }
+
+    if info.Name != "hello" || info.Version != "2.10-3.fc39" || info.Architecture != "x86_64" {
+        t.Errorf("info = %s %s %s, want hello 2.10-3.fc39 x86_64", info.Name, info.Version, info.Architecture)
+    }
+    if info.InstalledSize != 4096 || info.Description != "greeting" {
+        t.Errorf("size, description = %d, %q; want 4096, greeting", info.InstalledSize, info.Description)
+    }
+    if want := []string{"bash", "glibc >= 2.34"}; !reflect.DeepEqual(info.Dependencies, want) {
+        t.Errorf("dependencies = %q, want %q", info.Dependencies, want)
+    }
+    assertCalls(t, runner)
+}
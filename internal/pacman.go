@@ -2,14 +2,15 @@
 package internal
 
 import (
+    "context"
     "archive/tar"
     "bytes"
-    "encoding/json"
     "fmt"
     "io"
     "os"
-    "os/exec"
     "path/filepath"
+    "regexp"
+    "strconv"
     "strings"
     "time"
 )
@@ -21,6 +22,7 @@ type Pacman struct {
     Version    string
     BuildDate  time.Time
     Info       *PackageInfo
+    pkginfo    []byte // .PKGINFO с изменениями EditMetadata
 }
 
 // PacmanMetadata структура метаданных .pkg.tar.* пакета 
@@ -64,10 +66,6 @@ func NewPacman(path string) (*Pacman, error) {
 
 // validate проверяет корректность .pkg.tar.* файла
 func (p *Pacman) validate() error {
-    if !strings.Contains(p.Path, ".pkg.tar") {
-        return fmt.Errorf("invalid package format: must be .pkg.tar.*")
-    }
-
     fi, err := os.Stat(p.Path)
     if err != nil {
         return fmt.Errorf("failed to stat package file: %w", err)
@@ -81,54 +79,115 @@ func (p *Pacman) validate() error {
 }
 
 // Install устанавливает .pkg.tar.* пакет
-func (p *Pacman) Install(force bool) error {
-    if err := RequireRoot(); err != nil {
+func (p *Pacman) Install(ctx context.Context, opts InstallOptions) error {
+    root := opts.InstallRoot()
+    if err := RequireRoot(root); err != nil && !opts.DryRun {
+        return err
+    }
+    if err := requireBackend(TypePacman); err != nil {
         return err
     }
 
     logger.Infof("Installing Pacman package: %s", p.Path)
 
+    dbPath := filepath.Join(root, "var/lib/pacman")
+
     // Создаем резервную копию
-    backupPath, err := CreateBackup("/var/lib/pacman")
-    if err != nil {
-        logger.Warnf("Failed to create backup: %v", err)
-    } else {
-        logger.Infof("Created backup: %s", backupPath)
+    if !opts.NoBackup && !opts.DryRun {
+        backupDatabase(dbPath, opts.Progress)
     }
 
     // Подготавливаем команду установки
     args := []string{"-U"}
-    if force {
-        args = append(args, "--force", "--nodeps")
+    if opts.IsAltRoot() {
+        args = append(args, "--root", root)
+    }
+    if opts.Force {
+        args = append(args, pacmanOverwriteArgs(ctx)...)
+    }
+    if opts.NoDeps {
+        args = append(args, "--nodeps")
+    }
+    if opts.AssumeYes {
+        args = append(args, "--noconfirm")
     }
     args = append(args, p.Path)
 
     // Выполняем установку
-    cmd := exec.Command("pacman", args...)
-    cmd.Env = append(os.Environ(), "LANG=C")
-    
-    output, err := cmd.CombinedOutput()
+    if opts.DryRun {
+        printDryRun("pacman", args, dbPath, opts.NoBackup)
+        return nil
+    }
+
+    output, err := CommandRunner.Run(ctx, "pacman", args...)
+    if err != nil && ctx.Err() != nil {
+        return fmt.Errorf("installation cancelled: %w", ctx.Err())
+    }
     if err != nil {
         return fmt.Errorf("installation failed: %s: %w", string(output), err)
     }
 
-    // Обновляем базу данных
-    if err := exec.Command("pacman", "-Sy").Run(); err != nil {
-        logger.Warn("Failed to update package database")
+    // Базы синхронизации не обновляются: pacman -Sy без обновления
+    // системы приводит к частичному обновлению
+    if opts.Refresh {
+        logger.Warn("pacman does not refresh its sync databases after a local install, ignoring --refresh")
     }
 
     logger.Info("Package installed successfully")
     return nil
 }
 
+// pacmanVersionRe находит версию в выводе pacman --version
+var pacmanVersionRe = regexp.MustCompile(`Pacman v(\d+)\.(\d+)`)
+
+// pacmanToolVersion возвращает основную и дополнительную версии
+// установленного pacman
+func pacmanToolVersion(ctx context.Context) (int, int, error) {
+    output, err := CommandRunner.Output(ctx, "pacman", "--version")
+    if err != nil {
+        return 0, 0, fmt.Errorf("failed to get pacman version: %w", err)
+    }
+    return parsePacmanToolVersion(output)
+}
+
+// parsePacmanToolVersion разбирает вывод pacman --version
+func parsePacmanToolVersion(output []byte) (int, int, error) {
+    m := pacmanVersionRe.FindSubmatch(output)
+    if m == nil {
+        return 0, 0, fmt.Errorf("unrecognized pacman --version output")
+    }
+    major, _ := strconv.Atoi(string(m[1]))
+    minor, _ := strconv.Atoi(string(m[2]))
+    return major, minor, nil
+}
+
+// pacmanOverwriteArgs возвращает флаги, разрешающие замену чужих файлов.
+// --force удален в pacman 5.1 и заменен на --overwrite; если версию
+// определить не удалось, считается, что pacman современный
+func pacmanOverwriteArgs(ctx context.Context) []string {
+    major, minor, err := pacmanToolVersion(ctx)
+    if err != nil {
+        logger.Debugf("Assuming pacman 5.1 or newer: %v", err)
+        return []string{"--overwrite", "*"}
+    }
+    if major < 5 || major == 5 && minor < 1 {
+        return []string{"--force"}
+    }
+    return []string{"--overwrite", "*"}
+}
+
 // Remove удаляет установленный пакет
-func (p *Pacman) Remove(purge bool) error {
-    if err := RequireRoot(); err != nil {
+func (p *Pacman) Remove(ctx context.Context, opts RemoveOptions) error {
+    root := opts.InstallRoot()
+    if err := RequireRoot(root); err != nil && !opts.DryRun {
+        return err
+    }
+    if err := requireBackend(TypePacman); err != nil {
         return err
     }
 
     if p.Name == "" {
-        info, err := p.GetInfo()
+        info, err := p.GetInfo(ctx)
         if err != nil {
             return fmt.Errorf("failed to get package info: %w", err)
         }
@@ -137,33 +196,50 @@ func (p *Pacman) Remove(purge bool) error {
 
     logger.Infof("Removing Pacman package: %s", p.Name)
 
+    dbPath := filepath.Join(root, "var/lib/pacman")
+
     // Создаем резервную копию
-    backupPath, err := CreateBackup("/var/lib/pacman")
-    if err != nil {
-        logger.Warnf("Failed to create backup: %v", err)
-    } else {
-        logger.Infof("Created backup: %s", backupPath)
+    if !opts.NoBackup && !opts.DryRun {
+        backupDatabase(dbPath, opts.Progress)
     }
 
     // Подготавливаем команду удаления
     args := []string{"-R"}
-    if purge {
+    if opts.Purge {
         args = append(args, "-n", "-s") // -n: удалить конфиги, -s: удалить зависимости
     }
+    if opts.IsAltRoot() {
+        args = append(args, "--root", root)
+    }
+    if opts.Force || opts.NoDeps {
+        args = append(args, "--nodeps", "--nodeps") // двойной флаг пропускает все проверки
+    }
+    if opts.AssumeYes {
+        args = append(args, "--noconfirm")
+    }
     args = append(args, p.Name)
 
     // Выполняем удаление
-    cmd := exec.Command("pacman", args...)
-    cmd.Env = append(os.Environ(), "LANG=C")
-    
-    output, err := cmd.CombinedOutput()
+    if opts.DryRun {
+        printDryRun("pacman", args, dbPath, opts.NoBackup)
+        return nil
+    }
+
+    output, err := CommandRunner.Run(ctx, "pacman", args...)
+    if err != nil && ctx.Err() != nil {
+        return fmt.Errorf("removal cancelled: %w", ctx.Err())
+    }
     if err != nil {
         return fmt.Errorf("removal failed: %s: %w", string(output), err)
     }
 
     // Очищаем кэш если указан purge
-    if purge {
-        if err := exec.Command("pacman", "-Scc", "--noconfirm").Run(); err != nil {
+    if opts.Purge && !opts.IsAltRoot() {
+        cleanArgs := []string{"-Scc"}
+        if opts.AssumeYes {
+            cleanArgs = append(cleanArgs, "--noconfirm")
+        }
+        if _, err := CommandRunner.Run(ctx, "pacman", cleanArgs...); err != nil {
             logger.Warn("Failed to clean package cache")
         }
     }
@@ -173,16 +249,21 @@ func (p *Pacman) Remove(purge bool) error {
 }
 
 // GetInfo возвращает информацию о пакете
-func (p *Pacman) GetInfo() (*PackageInfo, error) {
+func (p *Pacman) GetInfo(ctx context.Context) (*PackageInfo, error) {
     if p.Info != nil {
         return p.Info, nil
     }
 
-    // Читаем .PKGINFO
-    cmd := exec.Command("tar", "-xOf", p.Path, ".PKGINFO")
-    output, err := cmd.Output()
+    cached, hash := loadCachedInfo(p.Path, TypePacman)
+    if cached != nil {
+        p.Info = cached
+        return cached, nil
+    }
+
+    // Читаем .PKGINFO без внешнего tar
+    output, err := p.readPKGINFO()
     if err != nil {
-        return nil, fmt.Errorf("failed to read .PKGINFO: %w", err)
+        return nil, err
     }
 
     metadata := &PacmanMetadata{}
@@ -197,7 +278,8 @@ func (p *Pacman) GetInfo() (*PackageInfo, error) {
         Architecture: metadata.Architecture,
         Description:  metadata.Description,
         Homepage:     metadata.URL,
-        Size:         metadata.Size,
+        Size:         fileSize(p.Path),
+        InstalledSize: metadata.Size,
         Dependencies: metadata.Depends,
         Conflicts:    metadata.Conflicts,
         Provides:     metadata.Provides,
@@ -212,10 +294,40 @@ func (p *Pacman) GetInfo() (*PackageInfo, error) {
         info.Description += "\n\nOptional Dependencies:\n" + strings.Join(metadata.OptDepends, "\n")
     }
 
+    storeCachedInfo(hash, TypePacman, info)
     p.Info = info
     return info, nil
 }
 
+// readPKGINFO извлекает .PKGINFO из архива пакета
+func (p *Pacman) readPKGINFO() ([]byte, error) {
+    tr, closeFn, err := OpenCompressedTar(p.Path)
+    if err != nil {
+        return nil, err
+    }
+    defer closeFn()
+
+    for {
+        header, err := tr.Next()
+        if err == io.EOF {
+            break
+        }
+        if err != nil {
+            return nil, fmt.Errorf("failed to read tar header: %w", err)
+        }
+
+        if strings.TrimPrefix(header.Name, "./") == ".PKGINFO" {
+            buf := new(bytes.Buffer)
+            if _, err := io.Copy(buf, tr); err != nil {
+                return nil, fmt.Errorf("failed to read .PKGINFO: %w", err)
+            }
+            return buf.Bytes(), nil
+        }
+    }
+
+    return nil, fmt.Errorf("package metadata not found")
+}
+
 // parsePacmanMetadata парсит .PKGINFO файл
 func parsePacmanMetadata(data []byte, metadata *PacmanMetadata) error {
     lines := strings.Split(string(data), "\n")
@@ -271,11 +383,66 @@ func parsePacmanMetadata(data []byte, metadata *PacmanMetadata) error {
     return nil
 }
 
+// ListFiles возвращает список файлов пакета без служебных файлов
+// (.PKGINFO, .MTREE, .BUILDINFO, .INSTALL)
+func (p *Pacman) ListFiles() ([]FileInfo, error) {
+    tr, closeFn, err := OpenCompressedTar(p.Path)
+    if err != nil {
+        return nil, err
+    }
+    defer closeFn()
+
+    return listTarFiles(tr, isMetadataEntry)
+}
+
+// Verify проверяет что архив распаковывается без ошибок,
+// а .PKGINFO разбирается
+func (p *Pacman) Verify() error {
+    tr, closeFn, err := OpenCompressedTar(p.Path)
+    if err != nil {
+        return fmt.Errorf("%w: %v", ErrCorruptedPackage, err)
+    }
+    defer closeFn()
+
+    err = verifyTarEntries(tr, func(name string, header *tar.Header) (string, int64) {
+        return "", header.Size
+    })
+    if err != nil {
+        return err
+    }
+
+    if _, err := p.GetInfo(context.Background()); err != nil {
+        return fmt.Errorf("%w: %v", ErrCorruptedPackage, err)
+    }
+    return nil
+}
+
+// Extract распаковывает файлы пакета в dest без служебных файлов
+func (p *Pacman) Extract(dest string) error {
+    absDest, err := prepareExtractDir(dest)
+    if err != nil {
+        return err
+    }
+
+    tr, closeFn, err := OpenCompressedTar(p.Path)
+    if err != nil {
+        return err
+    }
+    defer closeFn()
+
+    return extractTar(tr, absDest, isMetadataEntry)
+}
+
 // GetType возвращает тип пакета
 func (p *Pacman) GetType() PackageType {
     return TypePacman
 }
 
+// Comparator возвращает компаратор версий
+func (p *Pacman) Comparator() VersionComparator {
+    return PacmanVersion{}
+}
+
 // String возвращает строковое представление пакета
 func (p *Pacman) String() string {
     if p.Info != nil {
@@ -286,8 +453,7 @@ func (p *Pacman) String() string {
 
 // VerifySignature проверяет подпись пакета
 func (p *Pacman) VerifySignature() error {
-    cmd := exec.Command("pacman-key", "--verify", p.Path)
-    if output, err := cmd.CombinedOutput(); err != nil {
+    if output, err := CommandRunner.Run(context.Background(), "pacman-key", "--verify", p.Path); err != nil {
         return fmt.Errorf("signature verification failed: %s: %w", string(output), err)
     }
     return nil
@@ -295,9 +461,170 @@ func (p *Pacman) VerifySignature() error {
 
 // ExtractFile извлекает файл из пакета
 func (p *Pacman) ExtractFile(filename string, dest string) error {
-    cmd := exec.Command("tar", "-xf", p.Path, "-C", dest, filename)
-    if output, err := cmd.CombinedOutput(); err != nil {
+    if output, err := CommandRunner.Run(context.Background(), "tar", "-xf", p.Path, "-C", dest, filename); err != nil {
         return fmt.Errorf("failed to extract file: %s: %w", string(output), err)
     }
     return nil
-}
\ No newline at end of file
+}
+// Каталог базы данных pacman по умолчанию
+const PacmanDBPath = "/var/lib/pacman"
+
+// PacmanManager реализация PackageManager, читающая локальную базу
+// pacman напрямую, без блокировки и запуска pacman
+type PacmanManager struct {
+    DBPath string
+}
+
+// NewPacmanManager создает новый экземпляр PacmanManager
+func NewPacmanManager() *PacmanManager {
+    return &PacmanManager{DBPath: PacmanDBPath}
+}
+
+// localDir возвращает каталог локальной базы установленных пакетов
+func (m *PacmanManager) localDir() string {
+    return filepath.Join(m.DBPath, "local")
+}
+
+// CreatePackage создает Pacman пакет из файла
+func (m *PacmanManager) CreatePackage(path string) (Package, error) {
+    return NewPacman(path)
+}
+
+// ListInstalled возвращает список установленных пакетов из local/*/desc
+func (m *PacmanManager) ListInstalled() ([]PackageInfo, error) {
+    entries, err := os.ReadDir(m.localDir())
+    if err != nil {
+        return nil, fmt.Errorf("failed to read pacman database: %w", err)
+    }
+
+    var result []PackageInfo
+    for _, entry := range entries {
+        if !entry.IsDir() {
+            continue
+        }
+
+        data, err := os.ReadFile(filepath.Join(m.localDir(), entry.Name(), "desc"))
+        if err != nil {
+            logger.Debugf("Skipping %s: %v", entry.Name(), err)
+            continue
+        }
+
+        info := parsePacmanDesc(data)
+        if info.Name == "" {
+            continue
+        }
+        result = append(result, *info)
+    }
+
+    return result, nil
+}
+
+// IsInstalled проверяет наличие каталога пакета в локальной базе
+func (m *PacmanManager) IsInstalled(name string) bool {
+    entries, err := os.ReadDir(m.localDir())
+    if err != nil {
+        return false
+    }
+
+    for _, entry := range entries {
+        if entry.IsDir() && pacmanEntryName(entry.Name()) == name {
+            return true
+        }
+    }
+    return false
+}
+
+// GetDependencies возвращает список зависимостей пакета
+func (m *PacmanManager) GetDependencies(pkg Package) ([]string, error) {
+    info, err := pkg.GetInfo(context.Background())
+    if err != nil {
+        return nil, err
+    }
+    return info.Dependencies, nil
+}
+
+// ValidateSystem проверяет наличие локальной базы pacman
+func (m *PacmanManager) ValidateSystem() error {
+    fi, err := os.Stat(m.localDir())
+    if err != nil {
+        return fmt.Errorf("pacman database not found: %w", err)
+    }
+    if !fi.IsDir() {
+        return fmt.Errorf("pacman database is not a directory: %s", m.localDir())
+    }
+    return nil
+}
+
+// GetType возвращает тип пакетного менеджера
+func (m *PacmanManager) GetType() PackageType {
+    return TypePacman
+}
+
+// pacmanEntryName возвращает имя пакета из имени каталога
+// локальной базы вида name-pkgver-pkgrel
+func pacmanEntryName(dir string) string {
+    for i := 0; i < 2; i++ {
+        idx := strings.LastIndex(dir, "-")
+        if idx <= 0 {
+            return ""
+        }
+        dir = dir[:idx]
+    }
+    return dir
+}
+
+// parsePacmanDesc парсит файл desc локальной базы pacman:
+// блоки %KEY% со значениями по одному на строку до пустой строки
+func parsePacmanDesc(data []byte) *PackageInfo {
+    info := &PackageInfo{}
+
+    var key string
+    for _, line := range strings.Split(string(data), "\n") {
+        line = strings.TrimRight(line, "\r")
+
+        if line == "" {
+            key = ""
+            continue
+        }
+        if key == "" && strings.HasPrefix(line, "%") && strings.HasSuffix(line, "%") {
+            key = strings.Trim(line, "%")
+            continue
+        }
+
+        switch key {
+        case "NAME":
+            info.Name = line
+        case "VERSION":
+            info.Version = line
+        case "DESC":
+            info.Description = line
+        case "ARCH":
+            info.Architecture = line
+        case "URL":
+            info.Homepage = line
+        case "PACKAGER":
+            info.Maintainer = line
+        case "LICENSE":
+            if info.License != "" {
+                info.License += ", "
+            }
+            info.License += line
+        case "SIZE":
+            info.InstalledSize, _ = strconv.ParseInt(line, 10, 64)
+        case "INSTALLDATE":
+            if ts, err := strconv.ParseInt(line, 10, 64); err == nil {
+                info.InstallDate = time.Unix(ts, 0)
+            }
+        case "DEPENDS":
+            info.Dependencies = append(info.Dependencies, line)
+        case "CONFLICTS":
+            info.Conflicts = append(info.Conflicts, line)
+        case "PROVIDES":
+            info.Provides = append(info.Provides, line)
+        case "REPLACES":
+            info.Replaces = append(info.Replaces, line)
+        }
+    }
+
+    return info
+}
@@ -0,0 +1,157 @@
+package internal
+
+import (
+    "context"
+    "fmt"
+    "os"
+    "path/filepath"
+    "reflect"
+    "strings"
+    "testing"
+)
+
+// Вывод pacman --version без логотипа
+const pacmanVersionOutput = `
+ .--.                  Pacman v%s - libalpm v13.0.1
+/ _.-' .-.  .-.  .-.   Copyright (C) 2006-2021 Pacman Development Team
+`
+
+func TestParsePacmanToolVersion(t *testing.T) {
+    tests := []struct {
+        output       string
+        major, minor int
+        wantErr      bool
+    }{
+        {output: " .--.   Pacman v6.0.2 - libalpm v13.0.2", major: 6, minor: 0},
+        {output: " .--.   Pacman v5.1.3 - libalpm v11.0.3", major: 5, minor: 1},
+        {output: " .--.   Pacman v5.0.2 - libalpm v10.0.2", major: 5, minor: 0},
+        {output: " .--.   Pacman v4.2.1 - libalpm v9.0.1", major: 4, minor: 2},
+        {output: "pacman: command not found", wantErr: true},
+    }
+
+    for _, tt := range tests {
+        major, minor, err := parsePacmanToolVersion([]byte(tt.output))
+        if (err != nil) != tt.wantErr {
+            t.Errorf("parsePacmanToolVersion(%q) error = %v, wantErr %v", tt.output, err, tt.wantErr)
+            continue
+        }
+        if major != tt.major || minor != tt.minor {
+            t.Errorf("parsePacmanToolVersion(%q) = %d.%d, want %d.%d", tt.output, major, minor, tt.major, tt.minor)
+        }
+    }
+}
+
+func TestPacmanOverwriteArgs(t *testing.T) {
+    tests := []struct {
+        version string
+        want    []string
+    }{
+        {"6.0.2", []string{"--overwrite", "*"}},
+        {"5.1.0", []string{"--overwrite", "*"}},
+        {"5.0.2", []string{"--force"}},
+        {"4.2.1", []string{"--force"}},
+        {"", []string{"--overwrite", "*"}},
+    }
+
+    for _, tt := range tests {
+        runner := useFakeRunner(t, "pacman")
+        if tt.version != "" {
+            runner.outputs["pacman --version"] = []byte(fmt.Sprintf(pacmanVersionOutput, tt.version))
+        }
+        if got := pacmanOverwriteArgs(context.Background()); !reflect.DeepEqual(got, tt.want) {
+            t.Errorf("pacman %q: args = %q, want %q", tt.version, got, tt.want)
+        }
+    }
+}
+
+// newTestPacman создает Pacman для файла-заглушки: команды установки
+// выполняет fakeRunner, содержимое пакета не читается
+func newTestPacman(t *testing.T) *Pacman {
+    t.Helper()
+    path := filepath.Join(t.TempDir(), "hello-1.0-1-x86_64.pkg.tar.zst")
+    if err := os.WriteFile(path, []byte("package"), 0644); err != nil {
+        t.Fatal(err)
+    }
+    pkg, err := NewPacman(path)
+    if err != nil {
+        t.Fatal(err)
+    }
+    pkg.Name = "hello"
+    return pkg
+}
+
+func TestPacmanLocalInstallDoesNotSync(t *testing.T) {
+    for _, refresh := range []bool{false, true} {
+        runner := useFakeRunner(t, "pacman")
+        pkg := newTestPacman(t)
+        if err := pkg.Install(context.Background(), InstallOptions{NoBackup: true, Refresh: refresh}); err != nil {
+            t.Fatalf("Install: %v", err)
+        }
+
+        assertCalls(t, runner, []string{"pacman", "-U", pkg.Path})
+        for _, call := range runner.calls {
+            for _, arg := range call[1:] {
+                if strings.HasPrefix(arg, "-S") {
+                    t.Errorf("refresh %v: %q syncs the package databases", refresh, call)
+                }
+            }
+        }
+    }
+}
+
+func TestPacmanCommandArgs(t *testing.T) {
+    installTests := []struct {
+        name    string
+        version string
+        opts    InstallOptions
+        want    []string
+    }{
+        {"default", "", InstallOptions{}, []string{"-U"}},
+        {"assume yes", "", InstallOptions{AssumeYes: true}, []string{"-U", "--noconfirm"}},
+        {"root", "", InstallOptions{Root: "/mnt"}, []string{"-U", "--root", "/mnt"}},
+        {"no deps", "", InstallOptions{NoDeps: true}, []string{"-U", "--nodeps"}},
+        {"force", "6.0.2", InstallOptions{Force: true, AssumeYes: true}, []string{"-U", "--overwrite", "*", "--noconfirm"}},
+        {"force on old pacman", "5.0.2", InstallOptions{Force: true}, []string{"-U", "--force"}},
+    }
+    for _, tt := range installTests {
+        t.Run("install "+tt.name, func(t *testing.T) {
+            runner := useFakeRunner(t, "pacman")
+            var want [][]string
+            if tt.version != "" {
+                runner.outputs["pacman --version"] = []byte(fmt.Sprintf(pacmanVersionOutput, tt.version))
+                want = append(want, []string{"pacman", "--version"})
+            }
+            pkg := newTestPacman(t)
+            tt.opts.NoBackup = true
+            if err := pkg.Install(context.Background(), tt.opts); err != nil {
+                t.Fatalf("Install: %v", err)
+            }
+            want = append(want, append(append([]string{"pacman"}, tt.want...), pkg.Path))
+            assertCalls(t, runner, want...)
+        })
+    }
+
+    removeTests := []struct {
+        name string
+        opts RemoveOptions
+        want [][]string
+    }{
+        {"default", RemoveOptions{}, [][]string{{"pacman", "-R", "hello"}}},
+        {"assume yes", RemoveOptions{AssumeYes: true}, [][]string{{"pacman", "-R", "--noconfirm", "hello"}}},
+        {"purge", RemoveOptions{Purge: true, AssumeYes: true}, [][]string{
+            {"pacman", "-R", "-n", "-s", "--noconfirm", "hello"},
+            {"pacman", "-Scc", "--noconfirm"},
+        }},
+        {"no deps", RemoveOptions{NoDeps: true}, [][]string{{"pacman", "-R", "--nodeps", "--nodeps", "hello"}}},
+    }
+    for _, tt := range removeTests {
+        t.Run("remove "+tt.name, func(t *testing.T) {
+            runner := useFakeRunner(t, "pacman")
+            tt.opts.NoBackup = true
+            if err := newTestPacman(t).Remove(context.Background(), tt.opts); err != nil {
+                t.Fatalf("Remove: %v", err)
+            }
+            assertCalls(t, runner, tt.want...)
+        })
+    }
+}
@@ -0,0 +1,58 @@
+// internal/progress.go
+package internal
+
+import (
+    "io"
+)
+
+// ProgressFunc получает количество обработанных байт и общий объем
+// работы. По завершении операции вызывается с done == total
+type ProgressFunc func(done, total int64)
+
+// progressTracker суммирует прогресс по нескольким потокам
+type progressTracker struct {
+    done     int64
+    total    int64
+    progress ProgressFunc
+}
+
+// newProgressTracker возвращает nil, если progress не задан
+func newProgressTracker(total int64, progress ProgressFunc) *progressTracker {
+    if progress == nil {
+        return nil
+    }
+    return &progressTracker{total: total, progress: progress}
+}
+
+// wrap возвращает r, чтение из которого учитывается в прогрессе
+func (t *progressTracker) wrap(r io.Reader) io.Reader {
+    if t == nil {
+        return r
+    }
+    return &trackedReader{r: r, tracker: t}
+}
+
+// finish сообщает о завершении операции
+func (t *progressTracker) finish() {
+    if t != nil {
+        t.progress(t.total, t.total)
+    }
+}
+
+// trackedReader передает прочитанный объем в progressTracker
+type trackedReader struct {
+    r       io.Reader
+    tracker *progressTracker
+}
+
+func (r *trackedReader) Read(p []byte) (int, error) {
+    n, err := r.r.Read(p)
+    if n > 0 {
+        r.tracker.done += int64(n)
+        // Сжатые потоки могут дочитываться после оценки total
+        if r.tracker.done < r.tracker.total {
+            r.tracker.progress(r.tracker.done, r.tracker.total)
+        }
+    }
+    return n, err
+}
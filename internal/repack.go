@@ -0,0 +1,654 @@
+// internal/repack.go
+package internal
+
+import (
+    "archive/tar"
+    "bufio"
+    "bytes"
+    "compress/gzip"
+    "crypto/md5"
+    "crypto/sha1"
+    "crypto/sha256"
+    "encoding/hex"
+    "fmt"
+    "io"
+    "os"
+    "path/filepath"
+    "sort"
+    "strings"
+
+    "github.com/klauspost/compress/zstd"
+    "github.com/pierrec/lz4/v4"
+    "github.com/ulikunitz/xz"
+)
+
+// Ключи изменений EditMetadata, общие для всех форматов. Остальные ключи
+// задают поле метаданных формата как есть (Maintainer для deb, pkgdesc
+// для pacman и apk); пустое значение удаляет поле
+const (
+    // MetaVersion новая версия пакета
+    MetaVersion = "version"
+    // MetaAddDepend зависимости через запятую, добавляемые к существующим,
+    // в синтаксисе формата пакета
+    MetaAddDepend = "add-depend"
+)
+
+// Ключ PAX заголовка с SHA1 файла в архивах apk-tools
+const apkChecksumKey = "APK-TOOLS.checksum.SHA1"
+
+// tarEdits функции замены содержимого записей tar архива по имени
+// записи без префикса "./"
+type tarEdits map[string]func(data []byte) ([]byte, error)
+
+// EditMetadata применяет изменения к control файлу пакета. Изменения
+// накапливаются и записываются в новый пакет вызовом Repack
+func (d *Deb) EditMetadata(changes map[string]string) error {
+    control := string(d.control)
+    if d.control == nil {
+        var err error
+        if control, err = d.readControl(); err != nil {
+            return err
+        }
+    }
+
+    edited, err := editControl(control, changes)
+    if err != nil {
+        return err
+    }
+    d.control = []byte(edited)
+    d.Info = nil
+    return nil
+}
+
+// Repack записывает пакет в out, заменяя control на измененный
+// EditMetadata. control.tar сжимается тем же алгоритмом, data.tar
+// копируется без изменений, поэтому md5sums и Installed-Size остаются
+// верными. Подписи debsigs отбрасываются
+func (d *Deb) Repack(out string) error {
+    f, err := os.Open(d.Path)
+    if err != nil {
+        return fmt.Errorf("failed to open package: %w", err)
+    }
+    defer f.Close()
+
+    ar, err := newArReader(f)
+    if err != nil {
+        return err
+    }
+
+    edits := tarEdits{}
+    found := false
+    if d.control != nil {
+        edits["control"] = func([]byte) ([]byte, error) {
+            found = true
+            return d.control, nil
+        }
+    }
+
+    err = writeFileAtomic(out, func(w io.Writer) error {
+        if _, err := w.Write(magicAr); err != nil {
+            return fmt.Errorf("failed to write ar header: %w", err)
+        }
+
+        for {
+            header, err := ar.Next()
+            if err == io.EOF {
+                return nil
+            }
+            if err != nil {
+                return err
+            }
+
+            switch {
+            case strings.HasPrefix(header.Name, "_gpg"):
+                logger.Warnf("Dropping signature %s: it does not cover the edited package", header.Name)
+            case strings.HasPrefix(header.Name, "control.tar"):
+                var buf bytes.Buffer
+                if err := recompressTar(ar, &buf, edits); err != nil {
+                    return fmt.Errorf("failed to rewrite %s: %w", header.Name, err)
+                }
+                if err := writeArMember(w, header.Name, header.Mode, int64(buf.Len()), &buf); err != nil {
+                    return err
+                }
+            default:
+                if err := writeArMember(w, header.Name, header.Mode, header.Size, ar); err != nil {
+                    return err
+                }
+            }
+        }
+    })
+    if err != nil {
+        return err
+    }
+    if d.control != nil && !found {
+        os.Remove(out)
+        return fmt.Errorf("%w: control file not found", ErrInvalidFormat)
+    }
+
+    logger.Infof("Repacked %s to %s", d, out)
+    return nil
+}
+
+// EditMetadata применяет изменения к .PKGINFO пакета. Изменения
+// накапливаются и записываются в новый пакет вызовом Repack
+func (p *Pacman) EditMetadata(changes map[string]string) error {
+    pkginfo := p.pkginfo
+    if pkginfo == nil {
+        var err error
+        if pkginfo, err = p.readPKGINFO(); err != nil {
+            return err
+        }
+    }
+
+    edited, err := editPKGINFO(pkginfo, changes)
+    if err != nil {
+        return err
+    }
+    p.pkginfo = edited
+    p.Info = nil
+    return nil
+}
+
+// Repack записывает пакет в out с .PKGINFO, измененным EditMetadata.
+// Архив сжимается тем же алгоритмом; размер и хеши .PKGINFO в .MTREE
+// пересчитываются. Отсоединенная подпись .sig к новому пакету не подходит
+func (p *Pacman) Repack(out string) error {
+    f, err := os.Open(p.Path)
+    if err != nil {
+        return fmt.Errorf("failed to open package: %w", err)
+    }
+    defer f.Close()
+
+    edits := tarEdits{}
+    found := false
+    if p.pkginfo != nil {
+        edits[".PKGINFO"] = func([]byte) ([]byte, error) {
+            found = true
+            return p.pkginfo, nil
+        }
+        edits[".MTREE"] = func(data []byte) ([]byte, error) {
+            return updateMTREEEntry(data, ".PKGINFO", p.pkginfo)
+        }
+    }
+
+    err = writeFileAtomic(out, func(w io.Writer) error {
+        return recompressTar(f, w, edits)
+    })
+    if err != nil {
+        return err
+    }
+    if p.pkginfo != nil && !found {
+        os.Remove(out)
+        return fmt.Errorf("%w: .PKGINFO not found", ErrInvalidFormat)
+    }
+
+    if _, err := os.Stat(p.Path + ".sig"); err == nil {
+        logger.Warnf("Signature %s.sig does not cover the repacked package", p.Path)
+    }
+    logger.Infof("Repacked %s to %s", p, out)
+    return nil
+}
+
+// EditMetadata применяет изменения к .PKGINFO пакета. Изменения
+// накапливаются и записываются в новый пакет вызовом Repack
+func (a *APK) EditMetadata(changes map[string]string) error {
+    pkginfo := a.pkginfo
+    if pkginfo == nil {
+        var err error
+        if pkginfo, err = readAPKControl(a.Path); err != nil {
+            return err
+        }
+        if pkginfo == nil {
+            return fmt.Errorf("%w: missing .PKGINFO", ErrInvalidFormat)
+        }
+    }
+
+    edited, err := editPKGINFO(pkginfo, changes)
+    if err != nil {
+        return err
+    }
+    a.pkginfo = edited
+    a.Info = nil
+    return nil
+}
+
+// Repack записывает пакет в out с .PKGINFO, измененным EditMetadata.
+// Сегмент данных копируется без изменений, поэтому datahash остается
+// верным. Сегмент подписи отбрасывается: она покрывает управляющую часть
+func (a *APK) Repack(out string) error {
+    segments, err := apkSegments(a.Path)
+    if err != nil {
+        return err
+    }
+
+    f, err := os.Open(a.Path)
+    if err != nil {
+        return fmt.Errorf("failed to open package: %w", err)
+    }
+    defer f.Close()
+
+    edits := tarEdits{}
+    if a.pkginfo != nil {
+        edits[".PKGINFO"] = func([]byte) ([]byte, error) {
+            return a.pkginfo, nil
+        }
+    }
+
+    found := false
+    err = writeFileAtomic(out, func(w io.Writer) error {
+        for _, seg := range segments {
+            section := io.NewSectionReader(f, seg.Offset, seg.Size)
+            name := segmentFirstEntry(f, seg)
+
+            switch {
+            case strings.HasPrefix(name, ".SIGN."):
+                logger.Warnf("Dropping signature %s: it does not cover the edited package", name)
+            case name == ".PKGINFO" && !found:
+                found = true
+                if err := rewriteAPKControl(section, w, edits); err != nil {
+                    return err
+                }
+            default:
+                if _, err := io.Copy(w, section); err != nil {
+                    return fmt.Errorf("failed to write package: %w", err)
+                }
+            }
+        }
+        return nil
+    })
+    if err != nil {
+        return err
+    }
+    if !found {
+        os.Remove(out)
+        return fmt.Errorf("%w: missing .PKGINFO", ErrInvalidFormat)
+    }
+
+    logger.Infof("Repacked %s to %s", a, out)
+    return nil
+}
+
+// rewriteAPKControl перепаковывает управляющий сегмент .apk. Как и
+// у apk-tools, tar записывается без завершающих блоков
+func rewriteAPKControl(r io.Reader, w io.Writer, edits tarEdits) error {
+    gzr, err := gzip.NewReader(r)
+    if err != nil {
+        return fmt.Errorf("failed to create gzip reader: %w", err)
+    }
+    defer gzr.Close()
+
+    gzw := gzip.NewWriter(w)
+    tw := tar.NewWriter(gzw)
+    if err := rewriteTar(tar.NewReader(gzr), tw, edits); err != nil {
+        return err
+    }
+    if err := tw.Flush(); err != nil {
+        return fmt.Errorf("failed to write control segment: %w", err)
+    }
+    if err := gzw.Close(); err != nil {
+        return fmt.Errorf("failed to compress control segment: %w", err)
+    }
+    return nil
+}
+
+// recompressTar копирует сжатый tar архив из r в w, применяя edits, и
+// сжимает результат тем же алгоритмом, что и исходный архив
+func recompressTar(r io.Reader, w io.Writer, edits tarEdits) error {
+    br := bufio.NewReader(r)
+    magic, _ := br.Peek(len(magicXz))
+
+    cw, err := newCompressWriter(w, magic)
+    if err != nil {
+        return err
+    }
+
+    dr, closeReader, err := decompressStream(br)
+    if err != nil {
+        return err
+    }
+    defer closeReader()
+
+    tw := tar.NewWriter(cw)
+    if err := rewriteTar(tar.NewReader(dr), tw, edits); err != nil {
+        return err
+    }
+    if err := tw.Close(); err != nil {
+        return fmt.Errorf("failed to finalize archive: %w", err)
+    }
+    if err := cw.Close(); err != nil {
+        return fmt.Errorf("failed to compress archive: %w", err)
+    }
+    return nil
+}
+
+// rewriteTar копирует записи tar архива, заменяя содержимое записей из
+// edits. Размер и SHA1 apk-tools в PAX заголовке пересчитываются
+func rewriteTar(tr *tar.Reader, tw *tar.Writer, edits tarEdits) error {
+    for {
+        header, err := tr.Next()
+        if err == io.EOF {
+            return nil
+        }
+        if err != nil {
+            return fmt.Errorf("failed to read tar header: %w", err)
+        }
+
+        edit, ok := edits[strings.TrimPrefix(header.Name, "./")]
+        if !ok || header.Typeflag != tar.TypeReg {
+            if err := tw.WriteHeader(header); err != nil {
+                return fmt.Errorf("failed to write tar header: %w", err)
+            }
+            if _, err := io.Copy(tw, tr); err != nil {
+                return fmt.Errorf("failed to copy %s: %w", header.Name, err)
+            }
+            continue
+        }
+
+        data, err := io.ReadAll(tr)
+        if err != nil {
+            return fmt.Errorf("failed to read %s: %w", header.Name, err)
+        }
+        if data, err = edit(data); err != nil {
+            return fmt.Errorf("failed to edit %s: %w", header.Name, err)
+        }
+
+        header.Size = int64(len(data))
+        if _, ok := header.PAXRecords[apkChecksumKey]; ok {
+            sum := sha1.Sum(data)
+            header.PAXRecords[apkChecksumKey] = hex.EncodeToString(sum[:])
+        }
+        if err := tw.WriteHeader(header); err != nil {
+            return fmt.Errorf("failed to write tar header: %w", err)
+        }
+        if _, err := tw.Write(data); err != nil {
+            return fmt.Errorf("failed to write %s: %w", header.Name, err)
+        }
+    }
+}
+
+// nopWriteCloser io.WriteCloser для архивов без сжатия
+type nopWriteCloser struct {
+    io.Writer
+}
+
+func (nopWriteCloser) Close() error { return nil }
+
+// newCompressWriter возвращает writer, сжимающий данные тем же
+// алгоритмом, что и поток с магическими байтами magic
+func newCompressWriter(w io.Writer, magic []byte) (io.WriteCloser, error) {
+    switch {
+    case bytes.HasPrefix(magic, magicGzip):
+        return gzip.NewWriter(w), nil
+    case bytes.HasPrefix(magic, magicXz):
+        xzw, err := xz.NewWriter(w)
+        if err != nil {
+            return nil, fmt.Errorf("failed to create xz writer: %w", err)
+        }
+        return xzw, nil
+    case bytes.HasPrefix(magic, magicZstd):
+        zw, err := zstd.NewWriter(w)
+        if err != nil {
+            return nil, fmt.Errorf("failed to create zstd writer: %w", err)
+        }
+        return zw, nil
+    case bytes.HasPrefix(magic, magicLz4):
+        return lz4.NewWriter(w), nil
+    case bytes.HasPrefix(magic, magicBzip2):
+        return nil, fmt.Errorf("%w: writing bzip2 archives", ErrNotSupported)
+    }
+    return nopWriteCloser{w}, nil
+}
+
+// writeFileAtomic записывает файл path через временный файл в том же
+// каталоге, чтобы при ошибке не оставить частично записанный пакет.
+// path может совпадать с исходным пакетом
+func writeFileAtomic(path string, fn func(w io.Writer) error) error {
+    tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".part-*")
+    if err != nil {
+        return fmt.Errorf("failed to create file: %w", err)
+    }
+    defer os.Remove(tmp.Name())
+
+    bw := bufio.NewWriter(tmp)
+    if err := fn(bw); err != nil {
+        tmp.Close()
+        return err
+    }
+    if err := bw.Flush(); err != nil {
+        tmp.Close()
+        return fmt.Errorf("failed to write file: %w", err)
+    }
+    if err := tmp.Chmod(0644); err != nil {
+        tmp.Close()
+        return fmt.Errorf("failed to write file: %w", err)
+    }
+    if err := tmp.Close(); err != nil {
+        return fmt.Errorf("failed to write file: %w", err)
+    }
+
+    if err := os.Rename(tmp.Name(), path); err != nil {
+        return fmt.Errorf("failed to save file: %w", err)
+    }
+    return nil
+}
+
+// sortedChanges возвращает ключи изменений по порядку и проверяет, что
+// значения однострочные
+func sortedChanges(changes map[string]string) ([]string, error) {
+    keys := make([]string, 0, len(changes))
+    for key, value := range changes {
+        if key == "" || strings.ContainsAny(key, ":= \n") {
+            return nil, fmt.Errorf("invalid metadata field %q", key)
+        }
+        if strings.Contains(value, "\n") {
+            return nil, fmt.Errorf("value of %s must be a single line", key)
+        }
+        keys = append(keys, key)
+    }
+    sort.Strings(keys)
+    return keys, nil
+}
+
+// splitDepends разбирает список зависимостей через запятую
+func splitDepends(value string) []string {
+    var deps []string
+    for _, dep := range strings.Split(value, ",") {
+        if dep = strings.TrimSpace(dep); dep != "" {
+            deps = append(deps, dep)
+        }
+    }
+    return deps
+}
+
+// controlField поле debian control файла. Value хранит строки
+// продолжения как есть
+type controlField struct {
+    Name  string
+    Value string
+}
+
+// editControl применяет изменения к debian control файлу, сохраняя
+// порядок и форматирование остальных полей
+func editControl(control string, changes map[string]string) (string, error) {
+    keys, err := sortedChanges(changes)
+    if err != nil {
+        return "", err
+    }
+
+    var fields []controlField
+    for _, line := range strings.Split(strings.TrimRight(control, "\n"), "\n") {
+        if strings.HasPrefix(line, " ") || strings.HasPrefix(line, "\t") {
+            if len(fields) == 0 {
+                return "", fmt.Errorf("%w: unexpected continuation line in control", ErrInvalidFormat)
+            }
+            fields[len(fields)-1].Value += "\n" + line
+            continue
+        }
+        name, value, ok := strings.Cut(line, ":")
+        if !ok {
+            return "", fmt.Errorf("%w: invalid control line %q", ErrInvalidFormat, line)
+        }
+        fields = append(fields, controlField{Name: name, Value: strings.TrimSpace(value)})
+    }
+
+    find := func(name string) int {
+        for i, field := range fields {
+            if strings.EqualFold(field.Name, name) {
+                return i
+            }
+        }
+        return -1
+    }
+    set := func(name, value string) {
+        i := find(name)
+        switch {
+        case i >= 0 && value == "":
+            fields = append(fields[:i], fields[i+1:]...)
+        case i >= 0:
+            fields[i].Value = value
+        case value != "":
+            // Новые поля вставляются перед многострочным Description
+            at := find("Description")
+            if at < 0 {
+                at = len(fields)
+            }
+            fields = append(fields[:at], append([]controlField{{Name: name, Value: value}}, fields[at:]...)...)
+        }
+    }
+
+    for _, key := range keys {
+        value := strings.TrimSpace(changes[key])
+        switch key {
+        case MetaVersion:
+            if value == "" {
+                return "", fmt.Errorf("version must not be empty")
+            }
+            set("Version", value)
+        case MetaAddDepend:
+            deps := splitDepends(value)
+            if i := find("Depends"); i >= 0 {
+                deps = append(splitDepends(fields[i].Value), deps...)
+            }
+            set("Depends", strings.Join(deps, ", "))
+        default:
+            set(key, value)
+        }
+    }
+
+    var b strings.Builder
+    for _, field := range fields {
+        fmt.Fprintf(&b, "%s: %s\n", field.Name, field.Value)
+    }
+    return b.String(), nil
+}
+
+// editPKGINFO применяет изменения к .PKGINFO pacman или apk. Поле,
+// заданное явно, заменяет все строки с этим ключом
+func editPKGINFO(data []byte, changes map[string]string) ([]byte, error) {
+    keys, err := sortedChanges(changes)
+    if err != nil {
+        return nil, err
+    }
+
+    lines := strings.Split(strings.TrimRight(string(data), "\n"), "\n")
+    keyOf := func(line string) string {
+        if strings.HasPrefix(line, "#") {
+            return ""
+        }
+        key, _, _ := strings.Cut(line, "=")
+        return strings.TrimSpace(key)
+    }
+    set := func(name, value string) {
+        var kept []string
+        at := -1
+        for _, line := range lines {
+            if keyOf(line) == name {
+                if at < 0 {
+                    at = len(kept)
+                }
+                continue
+            }
+            kept = append(kept, line)
+        }
+        if at < 0 {
+            at = len(kept)
+        }
+        if value != "" {
+            kept = append(kept[:at], append([]string{name + " = " + value}, kept[at:]...)...)
+        }
+        lines = kept
+    }
+
+    for _, key := range keys {
+        value := strings.TrimSpace(changes[key])
+        switch key {
+        case MetaVersion:
+            if value == "" {
+                return nil, fmt.Errorf("version must not be empty")
+            }
+            set("pkgver", value)
+        case MetaAddDepend:
+            // Новые зависимости добавляются после существующих
+            at := len(lines)
+            for i, line := range lines {
+                if keyOf(line) == "depend" {
+                    at = i + 1
+                }
+            }
+            var added []string
+            for _, dep := range splitDepends(value) {
+                added = append(added, "depend = "+dep)
+            }
+            lines = append(lines[:at], append(added, lines[at:]...)...)
+        default:
+            set(key, value)
+        }
+    }
+
+    return []byte(strings.Join(lines, "\n") + "\n"), nil
+}
+
+// updateMTREEEntry пересчитывает size, md5digest и sha256digest записи
+// name в сжатом gzip .MTREE пакета pacman
+func updateMTREEEntry(mtree []byte, name string, content []byte) ([]byte, error) {
+    gzr, err := gzip.NewReader(bytes.NewReader(mtree))
+    if err != nil {
+        return nil, fmt.Errorf("failed to create gzip reader: %w", err)
+    }
+    text, err := io.ReadAll(gzr)
+    if err != nil {
+        return nil, fmt.Errorf("failed to read .MTREE: %w", err)
+    }
+
+    md5sum := md5.Sum(content)
+    sha256sum := sha256.Sum256(content)
+    lines := strings.Split(string(text), "\n")
+    for i, line := range lines {
+        tokens := strings.Fields(line)
+        if len(tokens) == 0 || tokens[0] != "./"+name {
+            continue
+        }
+        for j, token := range tokens[1:] {
+            key, _, _ := strings.Cut(token, "=")
+            switch key {
+            case "size":
+                tokens[j+1] = fmt.Sprintf("size=%d", len(content))
+            case "md5digest":
+                tokens[j+1] = "md5digest=" + hex.EncodeToString(md5sum[:])
+            case "sha256digest":
+                tokens[j+1] = "sha256digest=" + hex.EncodeToString(sha256sum[:])
+            }
+        }
+        lines[i] = strings.Join(tokens, " ")
+    }
+
+    var buf bytes.Buffer
+    gzw := gzip.NewWriter(&buf)
+    if _, err := io.WriteString(gzw, strings.Join(lines, "\n")); err != nil {
+        return nil, fmt.Errorf("failed to write .MTREE: %w", err)
+    }
+    if err := gzw.Close(); err != nil {
+        return nil, fmt.Errorf("failed to compress .MTREE: %w", err)
+    }
+    return buf.Bytes(), nil
+}
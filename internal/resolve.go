@@ -0,0 +1,175 @@
+// internal/resolve.go
+package internal
+
+import (
+    "context"
+    "errors"
+    "fmt"
+    "strings"
+)
+
+// ErrDependencyCycle циклическая зависимость между пакетами
+var ErrDependencyCycle = errors.New("dependency cycle detected")
+
+// ResolveInstallOrder упорядочивает пакеты так, чтобы зависимости
+// устанавливались раньше зависящих от них пакетов. Учитываются только
+// связи внутри переданного набора; при отсутствии ограничений
+// сохраняется исходный порядок
+func ResolveInstallOrder(ctx context.Context, pkgs []Package) ([]Package, error) {
+    infos := make([]*PackageInfo, len(pkgs))
+    for i, pkg := range pkgs {
+        info, err := pkg.GetInfo(ctx)
+        if err != nil {
+            return nil, fmt.Errorf("failed to read package info for %s: %w", pkg, err)
+        }
+        infos[i] = info
+    }
+
+    // Кто предоставляет каждое имя: сам пакет и его Provides
+    providers := make(map[string][]int)
+    for i, info := range infos {
+        providers[info.Name] = append(providers[info.Name], i)
+        for _, provide := range info.Provides {
+            name := dependencyName(provide)
+            providers[name] = append(providers[name], i)
+        }
+    }
+
+    // edges[j] содержит пакеты, которые должны идти после j
+    edges := make([][]int, len(pkgs))
+    indegree := make([]int, len(pkgs))
+    for i, info := range infos {
+        seen := make(map[int]bool)
+        for _, dep := range info.Dependencies {
+            j, ok := findProvider(dep, providers, i)
+            if !ok || seen[j] {
+                continue
+            }
+            seen[j] = true
+            edges[j] = append(edges[j], i)
+            indegree[i]++
+        }
+    }
+
+    // Алгоритм Кана, на каждом шаге берем готовый пакет с наименьшим индексом
+    result := make([]Package, 0, len(pkgs))
+    done := make([]bool, len(pkgs))
+    for len(result) < len(pkgs) {
+        next := -1
+        for i := range pkgs {
+            if !done[i] && indegree[i] == 0 {
+                next = i
+                break
+            }
+        }
+        if next < 0 {
+            return nil, fmt.Errorf("%w: %s", ErrDependencyCycle, describeCycle(infos, edges, done))
+        }
+
+        done[next] = true
+        result = append(result, pkgs[next])
+        for _, i := range edges[next] {
+            indegree[i]--
+        }
+    }
+
+    return result, nil
+}
+
+// findProvider ищет в наборе пакет, удовлетворяющий зависимости.
+// Альтернативы вида "a | b" проверяются по порядку
+func findProvider(dep string, providers map[string][]int, self int) (int, bool) {
+    for _, alt := range splitAlternatives(dep) {
+        for _, j := range providers[dependencyName(alt)] {
+            if j != self {
+                return j, true
+            }
+        }
+    }
+    return 0, false
+}
+
+// DependencyAlternatives разбивает записи зависимостей на группы
+// альтернатив: "a | b" становится ["a", "b"]
+func DependencyAlternatives(deps []string) [][]string {
+    groups := make([][]string, 0, len(deps))
+    for _, dep := range deps {
+        if alternatives := splitAlternatives(dep); len(alternatives) > 0 {
+            groups = append(groups, alternatives)
+        }
+    }
+    return groups
+}
+
+// splitAlternatives разбивает запись зависимости вида "a | b" на альтернативы
+func splitAlternatives(dep string) []string {
+    var result []string
+    for _, alt := range strings.Split(dep, "|") {
+        if alt = strings.TrimSpace(alt); alt != "" {
+            result = append(result, alt)
+        }
+    }
+    return result
+}
+
+// dependencyName возвращает имя из записи зависимости, отбрасывая
+// ограничение версии ("foo (>= 1.0)", "foo>=1.0", "foo = 1.0")
+func dependencyName(dep string) string {
+    dep = strings.TrimSpace(dep)
+    if i := strings.IndexAny(dep, " <>=("); i >= 0 {
+        dep = dep[:i]
+    }
+    return dep
+}
+
+// describeCycle находит цикл среди неупорядоченных пакетов и
+// возвращает его в виде "a -> b -> a", где a зависит от b
+func describeCycle(infos []*PackageInfo, edges [][]int, done []bool) string {
+    const (
+        unvisited = iota
+        visiting
+        visited
+    )
+    state := make([]int, len(infos))
+    var stack []int
+    var cycle []int
+
+    var visit func(i int) bool
+    visit = func(i int) bool {
+        state[i] = visiting
+        stack = append(stack, i)
+        for _, j := range edges[i] {
+            if done[j] {
+                continue
+            }
+            if state[j] == visiting {
+                for k := len(stack) - 1; k >= 0; k-- {
+                    if stack[k] == j {
+                        cycle = append(append([]int{}, stack[k:]...), j)
+                        break
+                    }
+                }
+                return true
+            }
+            if state[j] == unvisited && visit(j) {
+                return true
+            }
+        }
+        stack = stack[:len(stack)-1]
+        state[i] = visited
+        return false
+    }
+
+    for i := range infos {
+        if !done[i] && state[i] == unvisited && visit(i) {
+            break
+        }
+    }
+
+    // Ребра направлены от зависимости к пакету, выводим в обратном порядке
+    names := make([]string, len(cycle))
+    for k, i := range cycle {
+        names[len(cycle)-1-k] = infos[i].Name
+    }
+    return strings.Join(names, " -> ")
+}
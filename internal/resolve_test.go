@@ -0,0 +1,91 @@
+package internal
+
+import (
+    "context"
+    "errors"
+    "reflect"
+    "strings"
+    "testing"
+)
+
+// infoPackage пакет, у которого реализованы только GetInfo и String
+type infoPackage struct {
+    Package
+    info PackageInfo
+}
+
+func (p *infoPackage) GetInfo(ctx context.Context) (*PackageInfo, error) {
+    return &p.info, nil
+}
+
+func (p *infoPackage) String() string {
+    return p.info.Name
+}
+
+// newInfoPackage создает пакет name с зависимостями deps
+func newInfoPackage(name string, deps ...string) *infoPackage {
+    return &infoPackage{info: PackageInfo{Name: name, Dependencies: deps}}
+}
+
+// packageNames возвращает имена пакетов по порядку
+func packageNames(pkgs []Package) []string {
+    names := make([]string, len(pkgs))
+    for i, pkg := range pkgs {
+        names[i] = pkg.String()
+    }
+    return names
+}
+
+func TestResolveInstallOrderDiamond(t *testing.T) {
+    // app зависит от left и right, обе зависят от base
+    pkgs := []Package{
+        newInfoPackage("app", "left (>= 1.0)", "right"),
+        newInfoPackage("left", "base"),
+        newInfoPackage("right", "base", "libc6"),
+        newInfoPackage("base"),
+    }
+
+    ordered, err := ResolveInstallOrder(context.Background(), pkgs)
+    if err != nil {
+        t.Fatalf("ResolveInstallOrder: %v", err)
+    }
+    want := []string{"base", "left", "right", "app"}
+    if got := packageNames(ordered); !reflect.DeepEqual(got, want) {
+        t.Errorf("order = %q, want %q", got, want)
+    }
+}
+
+func TestResolveInstallOrderProvides(t *testing.T) {
+    mta := newInfoPackage("postfix")
+    mta.info.Provides = []string{"mail-transport-agent"}
+    pkgs := []Package{
+        newInfoPackage("mailutils", "exim4 | mail-transport-agent"),
+        mta,
+    }
+
+    ordered, err := ResolveInstallOrder(context.Background(), pkgs)
+    if err != nil {
+        t.Fatalf("ResolveInstallOrder: %v", err)
+    }
+    want := []string{"postfix", "mailutils"}
+    if got := packageNames(ordered); !reflect.DeepEqual(got, want) {
+        t.Errorf("order = %q, want %q", got, want)
+    }
+}
+
+func TestResolveInstallOrderCycle(t *testing.T) {
+    pkgs := []Package{
+        newInfoPackage("standalone"),
+        newInfoPackage("a", "b"),
+        newInfoPackage("b", "c"),
+        newInfoPackage("c", "a"),
+    }
+
+    _, err := ResolveInstallOrder(context.Background(), pkgs)
+    if !errors.Is(err, ErrDependencyCycle) {
+        t.Fatalf("error = %v, want ErrDependencyCycle", err)
+    }
+    if !strings.Contains(err.Error(), "a -> b -> c -> a") {
+        t.Errorf("error = %q, want the cycle a -> b -> c -> a", err)
+    }
+}
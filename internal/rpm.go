@@ -2,7 +2,10 @@
 package internal
 
 import (
+    "context"
     "bytes"
+    "crypto/sha256"
+    "encoding/hex"
     "fmt"
     "io"
     "os"
@@ -11,6 +14,8 @@ import (
     "strconv"
     "strings"
     "time"
+
+    "golang.org/x/crypto/openpgp"
 )
 
 // RPM структура для Red Hat Package Manager пакетов
@@ -62,10 +67,6 @@ func NewRPM(path string) (*RPM, error) {
 
 // validate проверяет корректность .rpm файла
 func (r *RPM) validate() error {
-    if !strings.HasSuffix(r.Path, ".rpm") {
-        return fmt.Errorf("invalid package format: must be .rpm")
-    }
-
     fi, err := os.Stat(r.Path)
     if err != nil {
         return fmt.Errorf("failed to stat package file: %w", err)
@@ -75,51 +76,59 @@ func (r *RPM) validate() error {
         return fmt.Errorf("invalid package: file is empty")
     }
 
-    // Проверка сигнатуры RPM
-    cmd := exec.Command("rpm", "-K", r.Path)
-    if err := cmd.Run(); err != nil {
-        return fmt.Errorf("invalid RPM signature: %w", err)
+    // Проверяется только lead: подпись и дайджесты проверяют Verify и
+    // VerifySignature, чтобы пакет открывался без установленного rpm
+    f, err := os.Open(r.Path)
+    if err != nil {
+        return fmt.Errorf("failed to open package file: %w", err)
+    }
+    defer f.Close()
+
+    magic := make([]byte, len(magicRPM))
+    if _, err := io.ReadFull(f, magic); err != nil || !bytes.Equal(magic, magicRPM) {
+        return fmt.Errorf("invalid package format: not an rpm package")
     }
 
     return nil
 }
 
 // Install устанавливает .rpm пакет
-func (r *RPM) Install(force bool) error {
-    if err := RequireRoot(); err != nil {
+func (r *RPM) Install(ctx context.Context, opts InstallOptions) error {
+    root := opts.InstallRoot()
+    if err := RequireRoot(root); err != nil && !opts.DryRun {
+        return err
+    }
+    if err := requireBackend(TypeRPM); err != nil {
         return err
     }
 
     logger.Infof("Installing RPM package: %s", r.Path)
 
+    dbPath := filepath.Join(root, "var/lib/rpm")
+
     // Создаем резервную копию RPM базы
-    backupPath, err := CreateBackup("/var/lib/rpm")
-    if err != nil {
-        logger.Warnf("Failed to create backup: %v", err)
-    } else {
-        logger.Infof("Created backup: %s", backupPath)
+    if !opts.NoBackup && !opts.DryRun {
+        backupDatabase(dbPath, opts.Progress)
     }
 
-    // Подготавливаем команду установки
-    args := []string{"-i"}
-    if force {
-        args = append(args, "--force", "--nodeps")
+    // Выполняем установку
+    args := rpmInstallArgs(opts, r.Path)
+    if opts.DryRun {
+        printDryRun("rpm", args, dbPath, opts.NoBackup)
+        return nil
     }
-    args = append(args, r.Path)
 
-    // Выполняем установку
-    cmd := exec.Command("rpm", args...)
-    cmd.Env = append(os.Environ(), "LANG=C")
-    
-    output, err := cmd.CombinedOutput()
+    output, err := CommandRunner.Run(ctx, "rpm", args...)
+    if err != nil && ctx.Err() != nil {
+        return fmt.Errorf("installation cancelled: %w", ctx.Err())
+    }
     if err != nil {
         return fmt.Errorf("installation failed: %s: %w", string(output), err)
     }
 
     // Проверяем успешность установки
-    if info, err := r.GetInfo(); err == nil {
-        cmd = exec.Command("rpm", "-q", info.Name)
-        if err := cmd.Run(); err != nil {
+    if info, err := r.GetInfo(ctx); err == nil {
+        if _, err := CommandRunner.Run(ctx, "rpm", "--root", root, "-q", info.Name); err != nil {
             return fmt.Errorf("package verification failed after installation")
         }
     }
@@ -129,13 +138,17 @@ func (r *RPM) Install(force bool) error {
 }
 
 // Remove удаляет установленный пакет
-func (r *RPM) Remove(purge bool) error {
-    if err := RequireRoot(); err != nil {
+func (r *RPM) Remove(ctx context.Context, opts RemoveOptions) error {
+    root := opts.InstallRoot()
+    if err := RequireRoot(root); err != nil && !opts.DryRun {
+        return err
+    }
+    if err := requireBackend(TypeRPM); err != nil {
         return err
     }
 
     if r.Name == "" {
-        info, err := r.GetInfo()
+        info, err := r.GetInfo(ctx)
         if err != nil {
             return fmt.Errorf("failed to get package info: %w", err)
         }
@@ -144,33 +157,30 @@ func (r *RPM) Remove(purge bool) error {
 
     logger.Infof("Removing RPM package: %s", r.Name)
 
+    dbPath := filepath.Join(root, "var/lib/rpm")
+
     // Создаем резервную копию RPM базы
-    backupPath, err := CreateBackup("/var/lib/rpm")
-    if err != nil {
-        logger.Warnf("Failed to create backup: %v", err)
-    } else {
-        logger.Infof("Created backup: %s", backupPath)
+    if !opts.NoBackup && !opts.DryRun {
+        backupDatabase(dbPath, opts.Progress)
     }
 
-    // Подготавливаем команду удаления
-    args := []string{"-e"}
-    if !purge {
-        args = append(args, "--nodeps")
+    // Выполняем удаление
+    args := rpmRemoveArgs(opts, r.Name)
+    if opts.DryRun {
+        printDryRun("rpm", args, dbPath, opts.NoBackup)
+        return nil
     }
-    args = append(args, r.Name)
 
-    // Выполняем удаление
-    cmd := exec.Command("rpm", args...)
-    cmd.Env = append(os.Environ(), "LANG=C")
-    
-    output, err := cmd.CombinedOutput()
+    output, err := CommandRunner.Run(ctx, "rpm", args...)
+    if err != nil && ctx.Err() != nil {
+        return fmt.Errorf("removal cancelled: %w", ctx.Err())
+    }
     if err != nil {
         return fmt.Errorf("removal failed: %s: %w", string(output), err)
     }
 
     // Проверяем успешность удаления
-    cmd = exec.Command("rpm", "-q", r.Name)
-    if err := cmd.Run(); err == nil {
+    if _, err := CommandRunner.Run(ctx, "rpm", "--root", root, "-q", r.Name); err == nil {
         return fmt.Errorf("package still installed after removal")
     }
 
@@ -178,35 +188,98 @@ func (r *RPM) Remove(purge bool) error {
     return nil
 }
 
+// rpmInstallArgs возвращает аргументы rpm для установки. Force
+// разрешает переустановку и замену файлов, но не отключает проверку
+// зависимостей - для этого служит NoDeps. Upgrade заменяет rpm -i на
+// rpm -U
+func rpmInstallArgs(opts InstallOptions, path string) []string {
+    args := []string{"-i"}
+    if opts.Upgrade {
+        // rpm -i отказывается ставить пакет поверх другой версии
+        args[0] = "-U"
+    }
+    if opts.IsAltRoot() {
+        args = append(args, "--root", opts.InstallRoot())
+    }
+    if opts.Force {
+        args = append(args, "--force")
+    } else {
+        if opts.Downgrade {
+            args = append(args, "--oldpackage")
+        }
+        if opts.Reinstall {
+            args = append(args, "--replacepkgs")
+        }
+    }
+    if opts.NoDeps {
+        args = append(args, "--nodeps")
+    }
+    return append(args, path)
+}
+
+// rpmRemoveArgs возвращает аргументы rpm для удаления. Зависимости
+// не проверяются только с NoDeps
+func rpmRemoveArgs(opts RemoveOptions, name string) []string {
+    args := []string{"-e"}
+    if opts.IsAltRoot() {
+        args = append(args, "--root", opts.InstallRoot())
+    }
+    if opts.NoDeps {
+        args = append(args, "--nodeps")
+    }
+    return append(args, name)
+}
+
 // GetInfo возвращает информацию о пакете
-func (r *RPM) GetInfo() (*PackageInfo, error) {
+func (r *RPM) GetInfo(ctx context.Context) (*PackageInfo, error) {
     if r.Info != nil {
         return r.Info, nil
     }
 
-    // Получаем метаданные через rpm команду
-    cmd := exec.Command("rpm", "-qip", r.Path)
-    cmd.Env = append(os.Environ(), "LANG=C")
-    
-    output, err := cmd.Output()
-    if err != nil {
-        return nil, fmt.Errorf("failed to get package info: %w", err)
+    cached, hash := loadCachedInfo(r.Path, TypeRPM)
+    if cached != nil {
+        r.Info = cached
+        return cached, nil
     }
 
-    metadata, err := parseRPMMetadata(output)
+    header, err := readRPMMainHeader(r.Path)
     if err != nil {
-        return nil, fmt.Errorf("failed to parse package metadata: %w", err)
+        logger.Debugf("Failed to read RPM header of %s: %v", r.Path, err)
     }
 
-    // Получаем зависимости
-    cmd = exec.Command("rpm", "-qpR", r.Path)
-    cmd.Env = append(os.Environ(), "LANG=C")
-    
-    deps, err := cmd.Output()
-    if err == nil {
-        metadata.Dependencies = strings.Split(string(deps), "\n")
+    // Метаданные читаются из заголовка напрямую. rpm используется, если
+    // заголовок не прочитан или отключен PreferNativeParsers, и только
+    // если он установлен
+    _, lookErr := CommandRunner.LookPath("rpm")
+    useRPM := lookErr == nil && (header == nil || !PreferNativeParsers)
+
+    var metadata *RPMMetadata
+    if useRPM {
+        output, err := CommandRunner.Output(ctx, "rpm", "-qip", r.Path)
+        if err != nil {
+            return nil, fmt.Errorf("failed to get package info: %w", err)
+        }
+        if metadata, err = parseRPMMetadata(output); err != nil {
+            return nil, fmt.Errorf("failed to parse package metadata: %w", err)
+        }
+    } else {
+        if header == nil {
+            return nil, fmt.Errorf("failed to read package header: %w", ErrCorruptedPackage)
+        }
+        metadata = rpmHeaderMetadata(header)
+    }
+
+    // Дата в выводе rpm -qi зависит от локали, числовое время сборки
+    // надежнее; разобранный текст остается запасным вариантом
+    if buildTime, ok := r.buildTime(ctx, header); ok {
+        metadata.BuildDate = buildTime
     }
 
+    // rpm -qi не выводит связи пакета, их берем из заголовка
+    metadata.Provides = r.relations(ctx, header, "--provides", rpmTagProvideName, rpmTagProvideFlags, rpmTagProvideVer)
+    metadata.Conflicts = r.relations(ctx, header, "--conflicts", rpmTagConflictName, rpmTagConflictFlags, rpmTagConflictVer)
+    metadata.Dependencies = filterRPMRequires(r.relations(ctx, header, "--requires", rpmTagRequireName, rpmTagRequireFlags, rpmTagRequireVer))
+
     // Создаем информацию о пакете
     info := &PackageInfo{
         Name:         metadata.Name,
@@ -214,17 +287,159 @@ func (r *RPM) GetInfo() (*PackageInfo, error) {
         Architecture: metadata.Architecture,
         Description:  metadata.Description,
         Homepage:     metadata.URL,
-        Size:         metadata.Size,
+        Size:         fileSize(r.Path),
+        InstalledSize: metadata.Size,
         Dependencies: metadata.Dependencies,
         Provides:     metadata.Provides,
         Conflicts:    metadata.Conflicts,
         InstallDate:  metadata.BuildDate,
     }
 
+    storeCachedInfo(hash, TypeRPM, info)
     r.Info = info
     return info, nil
 }
 
+// buildTime возвращает время сборки из тега BUILDTIME: из заголовка
+// пакета, а если он не прочитан - через rpm --qf
+func (r *RPM) buildTime(ctx context.Context, header *rpmHeader) (time.Time, bool) {
+    if header != nil {
+        if buildTime, ok := header.Int32Array(rpmTagBuildTime); ok && len(buildTime) > 0 {
+            return time.Unix(int64(uint32(buildTime[0])), 0).UTC(), true
+        }
+    }
+
+    output, err := CommandRunner.Output(ctx, "rpm", "-qp", "--qf", "%{BUILDTIME}", r.Path)
+    if err != nil {
+        return time.Time{}, false
+    }
+    seconds, err := strconv.ParseInt(strings.TrimSpace(string(output)), 10, 64)
+    if err != nil {
+        return time.Time{}, false
+    }
+    return time.Unix(seconds, 0).UTC(), true
+}
+
+// filterRPMRequires убирает требования rpmlib(...) и config(...): их
+// удовлетворяет сам rpm, они остаются только при ShowRPMInternalDeps
+func filterRPMRequires(requires []string) []string {
+    if ShowRPMInternalDeps {
+        return requires
+    }
+    var deps []string
+    for _, dep := range requires {
+        if strings.HasPrefix(dep, "rpmlib(") || strings.HasPrefix(dep, "config(") {
+            continue
+        }
+        deps = append(deps, dep)
+    }
+    return deps
+}
+
+// rpmHeaderMetadata читает метаданные из основного заголовка пакета
+// без rpm. Описание собирается из Summary и Description, как в rpm -qi
+func rpmHeaderMetadata(header *rpmHeader) *RPMMetadata {
+    metadata := &RPMMetadata{}
+    metadata.Name, _ = header.String(rpmTagName)
+    metadata.Version, _ = header.String(rpmTagVersion)
+    metadata.Release, _ = header.String(rpmTagRelease)
+    metadata.Architecture, _ = header.String(rpmTagArch)
+    metadata.Group, _ = header.String(rpmTagGroup)
+    metadata.License, _ = header.String(rpmTagLicense)
+    metadata.Vendor, _ = header.String(rpmTagVendor)
+    metadata.URL, _ = header.String(rpmTagURL)
+    if size, ok := header.Int32Array(rpmTagSize); ok && len(size) > 0 {
+        metadata.Size = int64(uint32(size[0]))
+    }
+
+    var description []string
+    for _, tag := range []int32{rpmTagSummary, rpmTagDescription} {
+        if text, ok := header.String(tag); ok && text != "" {
+            description = append(description, text)
+        }
+    }
+    metadata.Description = strings.Join(description, "\n")
+    return metadata
+}
+
+// relations возвращает связи пакета (Provides, Conflicts) в формате
+// rpm --provides: "имя [оператор версия]". Без заголовка используется
+// вывод rpm -qp с флагом flag
+func (r *RPM) relations(ctx context.Context, header *rpmHeader, flag string, nameTag, flagsTag, versionTag int32) []string {
+    if header == nil {
+        output, err := CommandRunner.Output(ctx, "rpm", "-qp", flag, r.Path)
+        if err != nil {
+            logger.Debugf("rpm -qp %s failed for %s: %v", flag, r.Path, err)
+            return nil
+        }
+        var result []string
+        for _, line := range strings.Split(string(output), "\n") {
+            if line = strings.TrimSpace(line); line != "" {
+                result = append(result, line)
+            }
+        }
+        return result
+    }
+
+    names, ok := header.StringArray(nameTag)
+    if !ok {
+        return nil
+    }
+    flags, _ := header.Int32Array(flagsTag)
+    versions, _ := header.StringArray(versionTag)
+
+    result := make([]string, 0, len(names))
+    for i, name := range names {
+        if i >= len(versions) || versions[i] == "" || i >= len(flags) {
+            result = append(result, name)
+            continue
+        }
+        result = append(result, fmt.Sprintf("%s %s %s", name, rpmSenseOperator(flags[i]), versions[i]))
+    }
+    return result
+}
+
+// rpmSenseOperator переводит флаги сравнения в оператор
+func rpmSenseOperator(flags int32) string {
+    op := ""
+    if flags&rpmSenseLess != 0 {
+        op += "<"
+    }
+    if flags&rpmSenseGreater != 0 {
+        op += ">"
+    }
+    if flags&rpmSenseEqual != 0 {
+        op += "="
+    }
+    if op == "" {
+        op = "="
+    }
+    return op
+}
+
+// rpmDateLayouts форматы даты сборки в выводе rpm -qi: strftime %c
+// в C locale и en_US, с часовым поясом и без
+var rpmDateLayouts = []string{
+    "Mon Jan 2 15:04:05 2006",
+    "Mon Jan 2 15:04:05 MST 2006",
+    "Mon 2 Jan 2006 03:04:05 PM MST",
+    "Mon 2 Jan 2006 15:04:05 MST",
+    "Mon 2 Jan 2006 03:04:05 PM -0700",
+    "Mon 2 Jan 2006 15:04:05 -0700",
+}
+
+// parseRPMDate разбирает текстовую дату rpm, допуская лишние пробелы
+// (день месяца выравнивается пробелом)
+func parseRPMDate(value string) (time.Time, bool) {
+    value = strings.Join(strings.Fields(value), " ")
+    for _, layout := range rpmDateLayouts {
+        if t, err := time.Parse(layout, value); err == nil {
+            return t, true
+        }
+    }
+    return time.Time{}, false
+}
+
 // parseRPMMetadata парсит вывод команды rpm -qip
 func parseRPMMetadata(data []byte) (*RPMMetadata, error) {
     metadata := &RPMMetadata{}
@@ -264,7 +479,7 @@ func parseRPMMetadata(data []byte) (*RPMMetadata, error) {
         case "Signature":
             metadata.Signature = value
         case "Build Date":
-            if t, err := time.Parse("Mon Jan 2 15:04:05 2006", value); err == nil {
+            if t, ok := parseRPMDate(value); ok {
                 metadata.BuildDate = t
             }
         case "Vendor":
@@ -283,11 +498,172 @@ func parseRPMMetadata(data []byte) (*RPMMetadata, error) {
     return metadata, nil
 }
 
+// ListFiles возвращает список файлов пакета
+func (r *RPM) ListFiles() ([]FileInfo, error) {
+    output, err := CommandRunner.Output(context.Background(), "rpm", "-qp", "--qf",
+        "[%{FILENAMES}\t%{FILESIZES}\t%{FILEMODES}\t%{FILEMTIMES}\t%{FILEDIGESTS}\n]", r.Path)
+    if err != nil {
+        return nil, fmt.Errorf("failed to list package contents: %w", err)
+    }
+
+    var files []FileInfo
+    for _, line := range strings.Split(string(output), "\n") {
+        fields := strings.Split(line, "\t")
+        if len(fields) != 5 || fields[0] == "" {
+            continue
+        }
+
+        size, _ := strconv.ParseInt(fields[1], 10, 64)
+        rawMode, _ := strconv.ParseUint(fields[2], 10, 32)
+        mtime, _ := strconv.ParseInt(fields[3], 10, 64)
+        mode := unixFileMode(uint32(rawMode))
+
+        files = append(files, FileInfo{
+            Path:    fields[0],
+            Size:    size,
+            Mode:    mode,
+            ModTime: time.Unix(mtime, 0),
+            Hash:    fields[4],
+            IsDir:   mode.IsDir(),
+        })
+    }
+
+    return files, nil
+}
+
+// Verify проверяет дайджесты заголовка и содержимого пакета
+// (без проверки подписи) и разбор метаданных
+func (r *RPM) Verify() error {
+    if output, err := CommandRunner.Run(context.Background(), "rpm", "-K", "--nosignature", r.Path); err != nil {
+        return fmt.Errorf("%w: %s", ErrCorruptedPackage, strings.TrimSpace(string(output)))
+    }
+
+    if _, err := r.GetInfo(context.Background()); err != nil {
+        return fmt.Errorf("%w: %v", ErrCorruptedPackage, err)
+    }
+    return nil
+}
+
+// VerifySignature проверяет подпись пакета по ключам базы rpm
+func (r *RPM) VerifySignature() error {
+    return r.VerifySignatureWith("")
+}
+
+// VerifySignatureWith проверяет подпись пакета по связке открытых ключей
+// keyringPath, не требуя импорта ключей в базу rpm. Без связки
+// используется rpm -K
+func (r *RPM) VerifySignatureWith(keyringPath string) error {
+    if keyringPath == "" {
+        if output, err := CommandRunner.Run(context.Background(), "rpm", "-K", r.Path); err != nil {
+            return fmt.Errorf("signature verification failed: %s: %w", strings.TrimSpace(string(output)), err)
+        }
+        return nil
+    }
+
+    keyring, err := readKeyring(keyringPath)
+    if err != nil {
+        return err
+    }
+
+    f, err := os.Open(r.Path)
+    if err != nil {
+        return fmt.Errorf("failed to open package: %w", err)
+    }
+    defer f.Close()
+
+    sigHeader, err := openRPM(f)
+    if err != nil {
+        return err
+    }
+    header, err := readRPMHeader(f, false)
+    if err != nil {
+        return err
+    }
+
+    // Дайджест основного заголовка
+    if want, ok := sigHeader.String(rpmSigTagSHA256); ok {
+        sum := sha256.Sum256(header.Raw)
+        if !strings.EqualFold(want, hex.EncodeToString(sum[:])) {
+            return fmt.Errorf("%w: header SHA256 digest mismatch", ErrCorruptedPackage)
+        }
+    }
+
+    // Подпись только заголовка предпочтительнее: она не требует чтения данных
+    var signed io.Reader
+    sig, ok := sigHeader.Binary(rpmSigTagRSA)
+    if !ok {
+        sig, ok = sigHeader.Binary(rpmSigTagDSA)
+    }
+    if ok {
+        signed = bytes.NewReader(header.Raw)
+    } else {
+        sig, ok = sigHeader.Binary(rpmSigTagPGP)
+        if !ok {
+            sig, ok = sigHeader.Binary(rpmSigTagGPG)
+        }
+        if !ok {
+            return ErrUnsigned
+        }
+        signed = io.MultiReader(bytes.NewReader(header.Raw), f)
+    }
+
+    signer, err := openpgp.CheckDetachedSignature(keyring, signed, bytes.NewReader(sig))
+    if err != nil {
+        return fmt.Errorf("signature verification failed: %w", err)
+    }
+
+    logger.Infof("Good signature from %s", signerIdentity(signer))
+    return nil
+}
+
+// Extract распаковывает cpio содержимое пакета в dest через rpm2cpio
+func (r *RPM) Extract(dest string) error {
+    absDest, err := prepareExtractDir(dest)
+    if err != nil {
+        return err
+    }
+
+    rpm2cpio := exec.Command("rpm2cpio", r.Path)
+    args := []string{"-idm", "--no-absolute-filenames", "--quiet"}
+    if !PreserveOwnership {
+        args = append(args, "--no-preserve-owner")
+    }
+    cpio := exec.Command("cpio", args...)
+    cpio.Dir = absDest
+
+    payload, err := rpm2cpio.StdoutPipe()
+    if err != nil {
+        return fmt.Errorf("failed to create pipe: %w", err)
+    }
+    cpio.Stdin = payload
+
+    var stderr bytes.Buffer
+    cpio.Stderr = &stderr
+
+    if err := cpio.Start(); err != nil {
+        return fmt.Errorf("failed to start cpio: %w", err)
+    }
+    if err := rpm2cpio.Run(); err != nil {
+        cpio.Wait()
+        return fmt.Errorf("rpm2cpio failed: %w", err)
+    }
+    if err := cpio.Wait(); err != nil {
+        return fmt.Errorf("cpio failed: %s: %w", stderr.String(), err)
+    }
+
+    return nil
+}
+
 // GetType возвращает тип пакета
 func (r *RPM) GetType() PackageType {
     return TypeRPM
 }
 
+// Comparator возвращает компаратор версий
+func (r *RPM) Comparator() VersionComparator {
+    return RPMVersion{}
+}
+
 // String возвращает строковое представление пакета
 func (r *RPM) String() string {
     if r.Info != nil {
@@ -298,27 +674,47 @@ func (r *RPM) String() string {
 
 // VerifyDependencies проверяет зависимости пакета
 func (r *RPM) VerifyDependencies() error {
-    cmd := exec.Command("rpm", "-qpR", r.Path)
-    output, err := cmd.CombinedOutput()
+    output, err := CommandRunner.Run(context.Background(), "rpm", "-qpR", r.Path)
     if err != nil {
         return fmt.Errorf("failed to verify dependencies: %s: %w", string(output), err)
     }
     return nil
 }
 
-// GetScripts возвращает установочные скрипты пакета
+// rpmScriptTags теги скриптов и их интерпретаторов
+var rpmScriptTags = []struct {
+    name        string
+    script      int32
+    interpreter int32
+}{
+    {"prein", rpmTagPreIn, rpmTagPreInProg},
+    {"postin", rpmTagPostIn, rpmTagPostInProg},
+    {"preun", rpmTagPreUn, rpmTagPreUnProg},
+    {"postun", rpmTagPostUn, rpmTagPostUnProg},
+}
+
+// GetScripts возвращает установочные скрипты пакета из заголовка RPM.
+// Скрипт хранится под ключом prein, postin, preun или postun, его
+// интерпретатор - под ключом с суффиксом prog (preinprog и т.д.).
+// Отсутствующие скрипты в результат не входят
 func (r *RPM) GetScripts() (map[string]string, error) {
-    scripts := make(map[string]string)
-    scriptTypes := []string{"prein", "postin", "preun", "postun"}
+    header, err := readRPMMainHeader(r.Path)
+    if err != nil {
+        return nil, err
+    }
 
-    for _, scriptType := range scriptTypes {
-        cmd := exec.Command("rpm", "-qp", "--scripts", r.Path)
-        output, err := cmd.Output()
-        if err != nil {
-            continue
+    scripts := make(map[string]string)
+    for _, tags := range rpmScriptTags {
+        if script, ok := header.String(tags.script); ok && script != "" {
+            scripts[tags.name] = script
         }
 
-        scripts[scriptType] = string(output)
+        // Интерпретатор с аргументами записывается массивом строк
+        if prog, ok := header.String(tags.interpreter); ok {
+            scripts[tags.name+"prog"] = prog
+        } else if args, ok := header.StringArray(tags.interpreter); ok {
+            scripts[tags.name+"prog"] = strings.Join(args, " ")
+        }
     }
 
     return scripts, nil
@@ -0,0 +1,142 @@
+package internal
+
+import (
+    "context"
+    "reflect"
+    "testing"
+)
+
+func TestRPMGetScripts(t *testing.T) {
+    path := buildTestRPM(t, t.TempDir(), "hello.rpm", []rpmTestTag{
+        {rpmTagName, "hello"},
+        {rpmTagPreIn, "getent group hello || groupadd -r hello"},
+        {rpmTagPostIn, "systemctl daemon-reload"},
+        {rpmTagPreUn, "systemctl stop hello.service"},
+        {rpmTagPostUn, "print(\"removed\")"},
+        {rpmTagPreInProg, "/bin/sh"},
+        {rpmTagPostUnProg, []string{"<lua>", "-e"}},
+    })
+    pkg, err := NewRPM(path)
+    if err != nil {
+        t.Fatal(err)
+    }
+
+    scripts, err := pkg.GetScripts()
+    if err != nil {
+        t.Fatalf("GetScripts: %v", err)
+    }
+    want := map[string]string{
+        "prein":      "getent group hello || groupadd -r hello",
+        "postin":     "systemctl daemon-reload",
+        "preun":      "systemctl stop hello.service",
+        "postun":     "print(\"removed\")",
+        "preinprog":  "/bin/sh",
+        "postunprog": "<lua> -e",
+    }
+    if !reflect.DeepEqual(scripts, want) {
+        t.Errorf("GetScripts = %q, want %q", scripts, want)
+    }
+
+    seen := make(map[string]string)
+    for _, key := range []string{"prein", "postin", "preun", "postun"} {
+        if other, ok := seen[scripts[key]]; ok {
+            t.Errorf("%s and %s hold the same script", other, key)
+        }
+        seen[scripts[key]] = key
+    }
+}
+
+func TestRPMInstallArgs(t *testing.T) {
+    const path = "/tmp/hello.rpm"
+    tests := []struct {
+        name string
+        opts InstallOptions
+        want []string
+    }{
+        {"default", InstallOptions{}, []string{"-i", path}},
+        {"force", InstallOptions{Force: true}, []string{"-i", "--force", path}},
+        {"no deps", InstallOptions{NoDeps: true}, []string{"-i", "--nodeps", path}},
+        {"force and no deps", InstallOptions{Force: true, NoDeps: true}, []string{"-i", "--force", "--nodeps", path}},
+        {"upgrade", InstallOptions{Upgrade: true}, []string{"-U", path}},
+        {"downgrade", InstallOptions{Upgrade: true, Downgrade: true}, []string{"-U", "--oldpackage", path}},
+        {"reinstall", InstallOptions{Reinstall: true}, []string{"-i", "--replacepkgs", path}},
+        {"force covers reinstall", InstallOptions{Force: true, Reinstall: true, Downgrade: true}, []string{"-i", "--force", path}},
+        {"root", InstallOptions{Root: "/mnt"}, []string{"-i", "--root", "/mnt", path}},
+    }
+
+    for _, tt := range tests {
+        if got := rpmInstallArgs(tt.opts, path); !reflect.DeepEqual(got, tt.want) {
+            t.Errorf("%s: rpmInstallArgs = %q, want %q", tt.name, got, tt.want)
+        }
+    }
+}
+
+// testRPMTags основной заголовок пакета hello-1.0-1.x86_64
+var testRPMTags = []rpmTestTag{
+    {rpmTagName, "hello"},
+    {rpmTagVersion, "1.0"},
+    {rpmTagRelease, "1"},
+    {rpmTagArch, "x86_64"},
+    {rpmTagBuildTime, []int32{1696939200}},
+}
+
+func TestRPMProvidesVirtualCapability(t *testing.T) {
+    tags := append(append([]rpmTestTag{}, testRPMTags...),
+        rpmTestTag{rpmTagProvideName, []string{"hello", "hello(x86-64)", "mail-transport-agent"}},
+        rpmTestTag{rpmTagProvideFlags, []int32{rpmSenseEqual, rpmSenseEqual, 0}},
+        rpmTestTag{rpmTagProvideVer, []string{"1.0-1", "1.0-1", ""}},
+        rpmTestTag{rpmTagConflictName, []string{"sendmail"}},
+        rpmTestTag{rpmTagConflictFlags, []int32{rpmSenseLess}},
+        rpmTestTag{rpmTagConflictVer, []string{"8.0"}},
+    )
+    path := buildTestRPM(t, t.TempDir(), "hello.rpm", tags)
+    runner := useFakeRunner(t)
+
+    pkg, err := NewRPM(path)
+    if err != nil {
+        t.Fatal(err)
+    }
+    info, err := pkg.GetInfo(context.Background())
+    if err != nil {
+        t.Fatalf("GetInfo: %v", err)
+    }
+
+    wantProvides := []string{"hello = 1.0-1", "hello(x86-64) = 1.0-1", "mail-transport-agent"}
+    if !reflect.DeepEqual(info.Provides, wantProvides) {
+        t.Errorf("provides = %q, want %q", info.Provides, wantProvides)
+    }
+    if want := []string{"sendmail < 8.0"}; !reflect.DeepEqual(info.Conflicts, want) {
+        t.Errorf("conflicts = %q, want %q", info.Conflicts, want)
+    }
+    assertCalls(t, runner)
+}
+
+func TestRPMRequiresFiltered(t *testing.T) {
+    path := buildTestRPM(t, t.TempDir(), "hello.rpm", testRPMTags)
+    runner := useFakeRunner(t, "rpm")
+    runner.outputs["rpm -qp --requires "+path] = []byte("/bin/sh\n" +
+        "config(hello) = 1.0-1\n" +
+        "libc.so.6()(64bit)\n" +
+        "rpmlib(CompressedFileNames) <= 3.0.4-1\n" +
+        "rpmlib(PayloadFilesHavePrefix) <= 4.0-1\n" +
+        "  \n")
+
+    pkg, err := NewRPM(path)
+    if err != nil {
+        t.Fatal(err)
+    }
+    requires := pkg.relations(context.Background(), nil, "--requires", rpmTagRequireName, rpmTagRequireFlags, rpmTagRequireVer)
+    if len(requires) != 5 {
+        t.Fatalf("relations = %q, want 5 entries without blank lines", requires)
+    }
+
+    if got, want := filterRPMRequires(requires), []string{"/bin/sh", "libc.so.6()(64bit)"}; !reflect.DeepEqual(got, want) {
+        t.Errorf("filterRPMRequires = %q, want %q", got, want)
+    }
+
+    ShowRPMInternalDeps = true
+    defer func() { ShowRPMInternalDeps = false }()
+    if got := filterRPMRequires(requires); !reflect.DeepEqual(got, requires) {
+        t.Errorf("filterRPMRequires with internal deps = %q, want %q", got, requires)
+    }
+}
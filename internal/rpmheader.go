@@ -0,0 +1,241 @@
+// internal/rpmheader.go
+package internal
+
+import (
+    "bytes"
+    "encoding/binary"
+    "fmt"
+    "io"
+    "os"
+)
+
+// Размер lead-структуры в начале .rpm файла
+const rpmLeadSize = 96
+
+// Магическое число заголовка RPM
+var magicRPMHeader = []byte{0x8E, 0xAD, 0xE8, 0x01}
+
+// Теги заголовка сигнатур
+const (
+    rpmSigTagSize   = 1000
+    rpmSigTagPGP    = 1002 // RSA подпись заголовка и данных
+    rpmSigTagMD5    = 1004
+    rpmSigTagGPG    = 1005 // DSA подпись заголовка и данных
+    rpmSigTagDSA    = 267  // DSA подпись заголовка
+    rpmSigTagRSA    = 268  // RSA подпись заголовка
+    rpmSigTagSHA1   = 269
+    rpmSigTagSHA256 = 273
+)
+
+// Теги основного заголовка
+const (
+    rpmTagName          = 1000
+    rpmTagVersion       = 1001
+    rpmTagRelease       = 1002
+    rpmTagSummary       = 1004
+    rpmTagDescription   = 1005
+    rpmTagBuildTime     = 1006
+    rpmTagSize          = 1009
+    rpmTagVendor        = 1011
+    rpmTagLicense       = 1014
+    rpmTagGroup         = 1016
+    rpmTagURL           = 1020
+    rpmTagArch          = 1022
+    rpmTagPreIn         = 1023
+    rpmTagPostIn        = 1024
+    rpmTagPreUn         = 1025
+    rpmTagPostUn        = 1026
+    rpmTagProvideName   = 1047
+    rpmTagRequireFlags  = 1048
+    rpmTagRequireName   = 1049
+    rpmTagRequireVer    = 1050
+    rpmTagConflictFlags = 1053
+    rpmTagConflictName  = 1054
+    rpmTagConflictVer   = 1055
+    rpmTagChangelogTime = 1080
+    rpmTagChangelogName = 1081
+    rpmTagChangelogText = 1082
+    rpmTagPreInProg     = 1085
+    rpmTagPostInProg    = 1086
+    rpmTagPreUnProg     = 1087
+    rpmTagPostUnProg    = 1088
+    rpmTagProvideFlags  = 1112
+    rpmTagProvideVer    = 1113
+)
+
+// Флаги сравнения версий в тегах *FLAGS
+const (
+    rpmSenseLess    = 0x02
+    rpmSenseGreater = 0x04
+    rpmSenseEqual   = 0x08
+)
+
+// Типы данных тегов
+const (
+    rpmTypeInt32       = 4
+    rpmTypeString      = 6
+    rpmTypeBin         = 7
+    rpmTypeStringArray = 8
+    rpmTypeI18NString  = 9
+)
+
+// rpmIndexEntry запись индекса заголовка RPM
+type rpmIndexEntry struct {
+    Tag    int32
+    Type   uint32
+    Offset int32
+    Count  uint32
+}
+
+// rpmHeader разобранный заголовок RPM
+type rpmHeader struct {
+    Raw     []byte // Заголовок целиком, начиная с магического числа
+    entries map[int32]rpmIndexEntry
+    store   []byte
+}
+
+// readRPMHeader читает заголовок RPM. Если pad установлен, пропускает
+// выравнивание до 8 байт, как после заголовка сигнатур
+func readRPMHeader(r io.Reader, pad bool) (*rpmHeader, error) {
+    intro := make([]byte, 16)
+    if _, err := io.ReadFull(r, intro); err != nil {
+        return nil, fmt.Errorf("failed to read rpm header: %w", err)
+    }
+    if !bytes.Equal(intro[:4], magicRPMHeader) {
+        return nil, ErrCorruptedPackage
+    }
+
+    count := binary.BigEndian.Uint32(intro[8:12])
+    size := binary.BigEndian.Uint32(intro[12:16])
+    // Ограничения из rpm: не более 0xffff записей и 256 МБ данных
+    if count > 0xffff || size > 256<<20 {
+        return nil, ErrCorruptedPackage
+    }
+
+    body := make([]byte, int(count)*16+int(size))
+    if _, err := io.ReadFull(r, body); err != nil {
+        return nil, fmt.Errorf("failed to read rpm header: %w", err)
+    }
+
+    header := &rpmHeader{
+        Raw:     append(intro, body...),
+        entries: make(map[int32]rpmIndexEntry, count),
+        store:   body[count*16:],
+    }
+    for i := 0; i < int(count); i++ {
+        e := body[i*16 : i*16+16]
+        entry := rpmIndexEntry{
+            Tag:    int32(binary.BigEndian.Uint32(e[0:4])),
+            Type:   binary.BigEndian.Uint32(e[4:8]),
+            Offset: int32(binary.BigEndian.Uint32(e[8:12])),
+            Count:  binary.BigEndian.Uint32(e[12:16]),
+        }
+        if entry.Offset < 0 || int(entry.Offset) > len(header.store) {
+            return nil, ErrCorruptedPackage
+        }
+        header.entries[entry.Tag] = entry
+    }
+
+    if pad {
+        if rem := len(header.Raw) % 8; rem != 0 {
+            if _, err := io.CopyN(io.Discard, r, int64(8-rem)); err != nil {
+                return nil, fmt.Errorf("failed to skip rpm header padding: %w", err)
+            }
+        }
+    }
+
+    return header, nil
+}
+
+// Binary возвращает значение бинарного тега
+func (h *rpmHeader) Binary(tag int32) ([]byte, bool) {
+    entry, ok := h.entries[tag]
+    if !ok || entry.Type != rpmTypeBin {
+        return nil, false
+    }
+    end := int(entry.Offset) + int(entry.Count)
+    if end > len(h.store) {
+        return nil, false
+    }
+    return h.store[entry.Offset:end], true
+}
+
+// String возвращает значение строкового тега
+func (h *rpmHeader) String(tag int32) (string, bool) {
+    entry, ok := h.entries[tag]
+    if !ok || (entry.Type != rpmTypeString && entry.Type != rpmTypeI18NString) {
+        return "", false
+    }
+    data := h.store[entry.Offset:]
+    if i := bytes.IndexByte(data, 0); i >= 0 {
+        data = data[:i]
+    }
+    return string(data), true
+}
+
+// Int32Array возвращает значения тега типа INT32
+func (h *rpmHeader) Int32Array(tag int32) ([]int32, bool) {
+    entry, ok := h.entries[tag]
+    if !ok || entry.Type != rpmTypeInt32 {
+        return nil, false
+    }
+    end := int(entry.Offset) + int(entry.Count)*4
+    if end > len(h.store) {
+        return nil, false
+    }
+
+    values := make([]int32, entry.Count)
+    for i := range values {
+        off := int(entry.Offset) + i*4
+        values[i] = int32(binary.BigEndian.Uint32(h.store[off : off+4]))
+    }
+    return values, true
+}
+
+// StringArray возвращает значения тега типа STRING_ARRAY
+func (h *rpmHeader) StringArray(tag int32) ([]string, bool) {
+    entry, ok := h.entries[tag]
+    if !ok || entry.Type != rpmTypeStringArray {
+        return nil, false
+    }
+
+    values := make([]string, 0, entry.Count)
+    data := h.store[entry.Offset:]
+    for i := 0; i < int(entry.Count); i++ {
+        end := bytes.IndexByte(data, 0)
+        if end < 0 {
+            return nil, false
+        }
+        values = append(values, string(data[:end]))
+        data = data[end+1:]
+    }
+    return values, true
+}
+
+// openRPM читает lead и заголовок сигнатур, оставляя r на начале
+// основного заголовка
+func openRPM(r io.Reader) (*rpmHeader, error) {
+    lead := make([]byte, rpmLeadSize)
+    if _, err := io.ReadFull(r, lead); err != nil {
+        return nil, fmt.Errorf("failed to read rpm lead: %w", err)
+    }
+    if !bytes.HasPrefix(lead, magicRPM) {
+        return nil, ErrInvalidFormat
+    }
+
+    return readRPMHeader(r, true)
+}
+
+// readRPMMainHeader читает основной заголовок .rpm файла
+func readRPMMainHeader(path string) (*rpmHeader, error) {
+    f, err := os.Open(path)
+    if err != nil {
+        return nil, fmt.Errorf("failed to open package: %w", err)
+    }
+    defer f.Close()
+
+    if _, err := openRPM(f); err != nil {
+        return nil, err
+    }
+    return readRPMHeader(f, false)
+}
@@ -0,0 +1,45 @@
+// internal/runner.go
+package internal
+
+import (
+    "context"
+    "os/exec"
+)
+
+// Runner выполняет внешние команды. Бэкенды вызывают менеджеры пакетов
+// при установке, удалении и чтении метаданных через CommandRunner, чтобы
+// их аргументы можно было проверить без установленных утилит
+type Runner interface {
+    // Run выполняет команду, вывод которой показывается пользователю,
+    // и возвращает stdout и stderr вместе
+    Run(ctx context.Context, name string, args ...string) ([]byte, error)
+
+    // Output выполняет команду, вывод которой разбирается, в C locale
+    // и возвращает только stdout
+    Output(ctx context.Context, name string, args ...string) ([]byte, error)
+
+    // LookPath ищет исполняемый файл name в PATH
+    LookPath(name string) (string, error)
+}
+
+// execRunner выполняет команды через os/exec
+type execRunner struct{}
+
+func (execRunner) Run(ctx context.Context, name string, args ...string) ([]byte, error) {
+    cmd := exec.CommandContext(ctx, name, args...)
+    cmd.Env = commandEnv()
+    return cmd.CombinedOutput()
+}
+
+func (execRunner) Output(ctx context.Context, name string, args ...string) ([]byte, error) {
+    cmd := exec.CommandContext(ctx, name, args...)
+    cmd.Env = parseEnv()
+    return cmd.Output()
+}
+
+func (execRunner) LookPath(name string) (string, error) {
+    return exec.LookPath(name)
+}
+
+// CommandRunner выполняет внешние команды бэкендов. Подменяется в тестах
+var CommandRunner Runner = execRunner{}
@@ -0,0 +1,251 @@
+package internal
+
+import (
+    "context"
+    "errors"
+    "os/exec"
+    "reflect"
+    "strings"
+    "sync"
+    "testing"
+)
+
+// fakeRunner записывает вызванные команды вместо их выполнения
+type fakeRunner struct {
+    mu       sync.Mutex
+    calls    [][]string
+    binaries map[string]bool   // Найденные LookPath бинарники
+    outputs  map[string][]byte // Вывод по строке команды
+    fail     map[string]bool   // Команды, завершающиеся ошибкой
+}
+
+func (f *fakeRunner) record(name string, args []string) ([]byte, error) {
+    f.mu.Lock()
+    defer f.mu.Unlock()
+    call := append([]string{name}, args...)
+    f.calls = append(f.calls, call)
+
+    line := strings.Join(call, " ")
+    if f.fail[line] {
+        return f.outputs[line], errors.New("exit status 1")
+    }
+    return f.outputs[line], nil
+}
+
+func (f *fakeRunner) Run(ctx context.Context, name string, args ...string) ([]byte, error) {
+    return f.record(name, args)
+}
+
+func (f *fakeRunner) Output(ctx context.Context, name string, args ...string) ([]byte, error) {
+    return f.record(name, args)
+}
+
+func (f *fakeRunner) LookPath(name string) (string, error) {
+    if f.binaries[name] {
+        return "/usr/bin/" + name, nil
+    }
+    return "", exec.ErrNotFound
+}
+
+// useFakeRunner подменяет CommandRunner на runner с бинарниками binaries
+// и выполняет тест от имени root
+func useFakeRunner(t *testing.T, binaries ...string) *fakeRunner {
+    t.Helper()
+    runner := &fakeRunner{
+        binaries: make(map[string]bool),
+        outputs:  make(map[string][]byte),
+        fail:     make(map[string]bool),
+    }
+    for _, binary := range binaries {
+        runner.binaries[binary] = true
+    }
+
+    oldRunner, oldEuid := CommandRunner, geteuid
+    CommandRunner = runner
+    geteuid = func() int { return 0 }
+    t.Cleanup(func() {
+        CommandRunner, geteuid = oldRunner, oldEuid
+    })
+    return runner
+}
+
+// assertCalls сравнивает вызванные команды с ожидаемыми
+func assertCalls(t *testing.T, runner *fakeRunner, want ...[]string) {
+    t.Helper()
+    if !reflect.DeepEqual(runner.calls, want) {
+        t.Errorf("commands:\n got  %q\n want %q", runner.calls, want)
+    }
+}
+
+func TestDebUsesCommandRunner(t *testing.T) {
+    deb := buildTestDeb(t, t.TempDir(), "hello.deb", testDebControl)
+    pkg, err := NewDeb(deb)
+    if err != nil {
+        t.Fatal(err)
+    }
+
+    runner := useFakeRunner(t, "dpkg")
+    if err := pkg.Install(context.Background(), InstallOptions{NoBackup: true}); err != nil {
+        t.Fatalf("Install: %v", err)
+    }
+    if err := pkg.Remove(context.Background(), RemoveOptions{NoBackup: true}); err != nil {
+        t.Fatalf("Remove: %v", err)
+    }
+    assertCalls(t, runner,
+        []string{"dpkg", "-i", deb},
+        []string{"dpkg", "--remove", "hello"},
+    )
+}
+
+func TestRequireBackendUsesCommandRunner(t *testing.T) {
+    useFakeRunner(t, "rpm")
+
+    if err := requireBackend(TypeRPM); err != nil {
+        t.Errorf("requireBackend(rpm) = %v, want nil", err)
+    }
+    if err := requireBackend(TypeDeb); !errors.Is(err, ErrBackendUnavailable) {
+        t.Errorf("requireBackend(deb) = %v, want ErrBackendUnavailable", err)
+    }
+}
+
+func TestDebCommandArgs(t *testing.T) {
+    deb := buildTestDeb(t, t.TempDir(), "hello.deb", testDebControl)
+
+    installTests := []struct {
+        name string
+        opts InstallOptions
+        want []string
+    }{
+        {"default", InstallOptions{}, []string{"dpkg", "-i", deb}},
+        {"root", InstallOptions{Root: "/mnt"}, []string{"dpkg", "-i", "--root=/mnt", deb}},
+        {"force", InstallOptions{Force: true, NoDeps: true}, []string{"dpkg", "-i", "--force-all", deb}},
+        {"no deps", InstallOptions{NoDeps: true}, []string{"dpkg", "-i", "--force-depends", deb}},
+        {"assume yes", InstallOptions{AssumeYes: true}, []string{"dpkg", "-i", "--force-confdef", "--force-confold", deb}},
+    }
+    for _, tt := range installTests {
+        t.Run("install "+tt.name, func(t *testing.T) {
+            runner := useFakeRunner(t, "dpkg")
+            pkg, err := NewDeb(deb)
+            if err != nil {
+                t.Fatal(err)
+            }
+            tt.opts.NoBackup = true
+            if err := pkg.Install(context.Background(), tt.opts); err != nil {
+                t.Fatalf("Install: %v", err)
+            }
+            assertCalls(t, runner, tt.want)
+        })
+    }
+
+    removeTests := []struct {
+        name string
+        opts RemoveOptions
+        want [][]string
+    }{
+        {"default", RemoveOptions{}, [][]string{{"dpkg", "--remove", "hello"}}},
+        {"purge", RemoveOptions{Purge: true}, [][]string{
+            {"dpkg", "--purge", "hello"},
+            {"apt-get", "clean"},
+        }},
+        {"root", RemoveOptions{Root: "/mnt", Purge: true}, [][]string{{"dpkg", "--purge", "--root=/mnt", "hello"}}},
+        {"no deps", RemoveOptions{NoDeps: true}, [][]string{{"dpkg", "--remove", "--force-depends", "hello"}}},
+        {"autoremove", RemoveOptions{Autoremove: true, AssumeYes: true}, [][]string{
+            {"dpkg", "--remove", "hello"},
+            {"apt-get", "autoremove", "-y"},
+        }},
+    }
+    for _, tt := range removeTests {
+        t.Run("remove "+tt.name, func(t *testing.T) {
+            runner := useFakeRunner(t, "dpkg", "apt-get")
+            pkg, err := NewDeb(deb)
+            if err != nil {
+                t.Fatal(err)
+            }
+            tt.opts.NoBackup = true
+            if err := pkg.Remove(context.Background(), tt.opts); err != nil {
+                t.Fatalf("Remove: %v", err)
+            }
+            assertCalls(t, runner, tt.want...)
+        })
+    }
+}
+
+func TestAssumeYesArgs(t *testing.T) {
+    dir := t.TempDir()
+    deb := buildTestDeb(t, dir, "hello.deb", testDebControl)
+    apk := buildTestAPK(t, dir, "")
+    eopkg := buildTestEopkg(t, dir, "nano.xml")
+    pacman := newTestPacman(t)
+
+    tests := []struct {
+        name    string
+        binary  string
+        open    func() (Package, error)
+        install [][]string
+        remove  [][]string
+    }{
+        {
+            name:    "deb",
+            binary:  "dpkg",
+            open:    func() (Package, error) { return NewDeb(deb) },
+            install: [][]string{{"dpkg", "-i", "--force-confdef", "--force-confold", deb}},
+            remove:  [][]string{{"dpkg", "--remove", "hello"}},
+        },
+        {
+            name:    "pacman",
+            binary:  "pacman",
+            open:    func() (Package, error) { return pacman, nil },
+            install: [][]string{{"pacman", "-U", "--noconfirm", pacman.Path}},
+            remove:  [][]string{{"pacman", "-R", "--noconfirm", "hello"}},
+        },
+        {
+            name:    "apk",
+            binary:  "apk",
+            open:    func() (Package, error) {
+                pkg, err := NewAPK(apk)
+                if err == nil {
+                    pkg.Name = "hello"
+                }
+                return pkg, err
+            },
+            install: [][]string{{"apk", "add", "--no-interactive", apk}},
+            remove:  [][]string{{"apk", "del", "--no-interactive", "hello"}},
+        },
+        {
+            name:    "eopkg",
+            binary:  "eopkg",
+            open:    func() (Package, error) {
+                pkg, err := NewEopkg(eopkg)
+                if err == nil {
+                    pkg.Name = "nano"
+                }
+                return pkg, err
+            },
+            install: [][]string{
+                {"eopkg", "install", "--yes-all", eopkg},
+                {"eopkg", "index", "--rebuild-db"},
+            },
+            remove: [][]string{{"eopkg", "remove", "--yes-all", "nano"}},
+        },
+    }
+
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            pkg, err := tt.open()
+            if err != nil {
+                t.Fatal(err)
+            }
+            runner := useFakeRunner(t, tt.binary)
+            if err := pkg.Install(context.Background(), InstallOptions{NoBackup: true, AssumeYes: true}); err != nil {
+                t.Fatalf("Install: %v", err)
+            }
+            assertCalls(t, runner, tt.install...)
+
+            runner = useFakeRunner(t, tt.binary)
+            if err := pkg.Remove(context.Background(), RemoveOptions{NoBackup: true, AssumeYes: true}); err != nil {
+                t.Fatalf("Remove: %v", err)
+            }
+            assertCalls(t, runner, tt.remove...)
+        })
+    }
+}
@@ -3,18 +3,31 @@ package internal
 
 import (
     "archive/tar"
+    "bufio"
+    "bytes"
+    "compress/bzip2"
     "compress/gzip"
+    "context"
+    "crypto"
+    "crypto/md5"
+    "crypto/sha1"
     "crypto/sha256"
+    "crypto/sha512"
     "encoding/hex"
     "fmt"
+    "hash"
     "io"
     "os"
-    "os/exec"
     "path/filepath"
+    "runtime"
+    "strconv"
     "strings"
+    "sync"
     "syscall"
     "time"
 
+    "github.com/klauspost/compress/zstd"
+    "github.com/pierrec/lz4/v4"
     "github.com/sirupsen/logrus"
     "github.com/ulikunitz/xz"
 )
@@ -26,7 +39,17 @@ func init() {
         FullTimestamp:   true,
         TimestampFormat: "2006-01-02 15:04:05",
     })
-    logger.SetOutput(os.Stdout)
+    logger.SetOutput(os.Stderr)
+}
+
+// SetLogLevel устанавливает уровень журнала пакета
+func SetLogLevel(level logrus.Level) {
+    logger.SetLevel(level)
+}
+
+// SetLogFormatter устанавливает формат журнала пакета
+func SetLogFormatter(formatter logrus.Formatter) {
+    logger.SetFormatter(formatter)
 }
 
 // FileInfo содержит информацию о файле
@@ -41,11 +64,19 @@ type FileInfo struct {
 
 // CheckRoot проверяет root права
 func CheckRoot() bool {
-    return os.Geteuid() == 0
+    return geteuid() == 0
 }
 
-// RequireRoot проверяет root права и возвращает ошибку если их нет
-func RequireRoot() error {
+// geteuid возвращает эффективный uid процесса. Подменяется в тестах
+var geteuid = os.Geteuid
+
+// RequireRoot проверяет root права и возвращает ошибку если их нет.
+// Для альтернативного корня, доступного пользователю на запись,
+// root права не требуются
+func RequireRoot(root string) error {
+    if isAltRoot(root) && isWritableDir(root) {
+        return nil
+    }
     if !CheckRoot() {
         return fmt.Errorf("root privileges required")
     }
@@ -60,6 +91,37 @@ func CreateDirectory(path string, mode os.FileMode) error {
     return nil
 }
 
+// isWritableDir проверяет, что path является директорией,
+// доступной текущему пользователю на запись
+func isWritableDir(path string) bool {
+    info, err := os.Stat(path)
+    if err != nil || !info.IsDir() {
+        return false
+    }
+    return syscall.Access(path, 0x2) == nil // W_OK
+}
+
+// CheckWritable проверяет, что в каталог path можно писать. Если его нет,
+// проверяется ближайший существующий родитель, в котором он будет создан
+func CheckWritable(path string) error {
+    dir := filepath.Clean(path)
+    for {
+        if _, err := os.Stat(dir); err == nil {
+            break
+        }
+        parent := filepath.Dir(dir)
+        if parent == dir {
+            break
+        }
+        dir = parent
+    }
+
+    if !isWritableDir(dir) {
+        return fmt.Errorf("%s is not writable", dir)
+    }
+    return nil
+}
+
 // RemoveDirectory удаляет директорию рекурсивно
 func RemoveDirectory(path string) error {
     if err := os.RemoveAll(path); err != nil {
@@ -68,6 +130,25 @@ func RemoveDirectory(path string) error {
     return nil
 }
 
+// WithTempDir создает временный каталог в TempDir, вызывает fn и
+// удаляет каталог, в том числе если fn вернула ошибку или паниковала
+func WithTempDir(fn func(dir string) error) error {
+    if err := CreateDirectory(TempDir, 0755); err != nil {
+        return err
+    }
+    dir, err := os.MkdirTemp(TempDir, "upkgt-")
+    if err != nil {
+        return fmt.Errorf("failed to create temporary directory: %w", err)
+    }
+    defer func() {
+        if err := os.RemoveAll(dir); err != nil {
+            logger.Warnf("Failed to remove temporary directory %s: %v", dir, err)
+        }
+    }()
+
+    return fn(dir)
+}
+
 // CopyFile копирует файл с сохранением прав
 func CopyFile(src, dst string) error {
     sourceFileStat, err := os.Stat(src)
@@ -112,6 +193,15 @@ func CopyFile(src, dst string) error {
     return nil
 }
 
+// fileSize возвращает размер файла или 0, если он недоступен
+func fileSize(path string) int64 {
+    fi, err := os.Stat(path)
+    if err != nil {
+        return 0
+    }
+    return fi.Size()
+}
+
 // CalculateFileHash вычисляет SHA256 хеш файла
 func CalculateFileHash(path string) (string, error) {
     file, err := os.Open(path)
@@ -120,29 +210,205 @@ func CalculateFileHash(path string) (string, error) {
     }
     defer file.Close()
 
-    hash := sha256.New()
-    if _, err := io.Copy(hash, file); err != nil {
+    return CalculateReaderHash(file)
+}
+
+// CalculateFileHashAlgo вычисляет хеш файла указанным алгоритмом
+func CalculateFileHashAlgo(path string, algo crypto.Hash) (string, error) {
+    file, err := os.Open(path)
+    if err != nil {
+        return "", fmt.Errorf("failed to open file: %w", err)
+    }
+    defer file.Close()
+
+    return CalculateReaderHashAlgo(file, algo)
+}
+
+// CalculateReaderHash вычисляет SHA256 хеш данных, прочитанных из r
+func CalculateReaderHash(r io.Reader) (string, error) {
+    return CalculateReaderHashAlgo(r, crypto.SHA256)
+}
+
+// CalculateReaderHashAlgo вычисляет хеш данных из r указанным алгоритмом
+func CalculateReaderHashAlgo(r io.Reader, algo crypto.Hash) (string, error) {
+    if !algo.Available() {
+        return "", fmt.Errorf("hash algorithm %v is not available", algo)
+    }
+
+    hash := algo.New()
+    if _, err := io.Copy(hash, r); err != nil {
         return "", fmt.Errorf("failed to calculate hash: %w", err)
     }
 
     return hex.EncodeToString(hash.Sum(nil)), nil
 }
 
-// ExtractTarGz распаковывает tar.gz архив
-func ExtractTarGz(src, dst string) error {
+// ExtractTarGz распаковывает tar.gz архив. Прогресс, если progress
+// задан, считается по прочитанной части сжатого архива
+func ExtractTarGz(src, dst string, progress ProgressFunc) error {
     file, err := os.Open(src)
     if err != nil {
         return fmt.Errorf("failed to open archive: %w", err)
     }
     defer file.Close()
 
-    gzr, err := gzip.NewReader(file)
+    tracker := newProgressTracker(fileSize(src), progress)
+    gzr, err := gzip.NewReader(tracker.wrap(file))
     if err != nil {
         return fmt.Errorf("failed to create gzip reader: %w", err)
     }
     defer gzr.Close()
 
-    tr := tar.NewReader(gzr)
+    if err := extractTar(tar.NewReader(gzr), dst, nil); err != nil {
+        return err
+    }
+    tracker.finish()
+    return nil
+}
+
+// ExtractTarXz распаковывает tar.xz архив. Прогресс, если progress
+// задан, считается по прочитанной части сжатого архива
+func ExtractTarXz(src, dst string, progress ProgressFunc) error {
+    file, err := os.Open(src)
+    if err != nil {
+        return fmt.Errorf("failed to open archive: %w", err)
+    }
+    defer file.Close()
+
+    tracker := newProgressTracker(fileSize(src), progress)
+    xzr, err := xz.NewReader(tracker.wrap(file))
+    if err != nil {
+        return fmt.Errorf("failed to create xz reader: %w", err)
+    }
+
+    if err := extractTar(tar.NewReader(xzr), dst, nil); err != nil {
+        return err
+    }
+    tracker.finish()
+    return nil
+}
+
+// safeJoin присоединяет имя записи архива к dst и проверяет,
+// что результат не выходит за пределы dst (защита от Zip Slip)
+func safeJoin(dst, name string) (string, error) {
+    cleaned := filepath.Clean("/" + name)
+    for _, part := range strings.Split(filepath.ToSlash(filepath.Clean(name)), "/") {
+        if part == ".." {
+            return "", fmt.Errorf("illegal path in archive: %s", name)
+        }
+    }
+
+    target := filepath.Join(dst, cleaned)
+    rel, err := filepath.Rel(dst, target)
+    if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+        return "", fmt.Errorf("illegal path in archive: %s", name)
+    }
+    return target, nil
+}
+
+// checkLinkTarget проверяет что ссылка из архива указывает внутрь dst и
+// возвращает путь, с которым ее нужно создать. Цель символической ссылки
+// вычисляется относительно ее каталога, абсолютная цель - относительно
+// dst и переписывается в относительную. Цель жесткой ссылки вычисляется
+// относительно корня архива и возвращается полным путем
+func checkLinkTarget(dst, target string, header *tar.Header) (string, error) {
+    var resolved string
+    switch {
+    case header.Typeflag == tar.TypeLink:
+        resolved = filepath.Join(dst, filepath.Clean("/"+header.Linkname))
+    case filepath.IsAbs(header.Linkname):
+        resolved = filepath.Join(dst, filepath.Clean(header.Linkname))
+    default:
+        resolved = filepath.Join(filepath.Dir(target), header.Linkname)
+    }
+
+    rel, err := filepath.Rel(dst, resolved)
+    if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+        return "", fmt.Errorf("illegal link in archive: %s -> %s", header.Name, header.Linkname)
+    }
+
+    if header.Typeflag == tar.TypeLink {
+        return resolved, nil
+    }
+    if !filepath.IsAbs(header.Linkname) {
+        return header.Linkname, nil
+    }
+    link, err := filepath.Rel(filepath.Dir(target), resolved)
+    if err != nil {
+        return "", fmt.Errorf("illegal link in archive: %s -> %s", header.Name, header.Linkname)
+    }
+    return link, nil
+}
+
+// checkNoSymlinks проверяет, что ни один каталог между dst и path не
+// является символической ссылкой, иначе запись архива могла бы попасть
+// за пределы dst. Несуществующая часть пути будет создана и не проверяется
+func checkNoSymlinks(dst, path string) error {
+    rel, err := filepath.Rel(dst, path)
+    if err != nil || rel == "." || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+        return nil
+    }
+
+    current := dst
+    for _, part := range strings.Split(rel, string(filepath.Separator)) {
+        current = filepath.Join(current, part)
+        fi, err := os.Lstat(current)
+        if os.IsNotExist(err) {
+            return nil
+        }
+        if err != nil {
+            return fmt.Errorf("failed to check %s: %w", current, err)
+        }
+        if fi.Mode()&os.ModeSymlink != 0 {
+            return fmt.Errorf("refusing to extract through symlink %s", current)
+        }
+    }
+    return nil
+}
+
+// replaceSymlink удаляет символическую ссылку на месте path, чтобы запись
+// архива не была сделана по ссылке
+func replaceSymlink(path string) error {
+    fi, err := os.Lstat(path)
+    if err != nil || fi.Mode()&os.ModeSymlink == 0 {
+        return nil
+    }
+    return removeExisting(path)
+}
+
+// prepareExtractDir проверяет каталог назначения и создает его
+func prepareExtractDir(dest string) (string, error) {
+    if err := ValidatePath(dest); err != nil {
+        return "", fmt.Errorf("invalid destination: %w", err)
+    }
+
+    absDest, err := filepath.Abs(dest)
+    if err != nil {
+        return "", fmt.Errorf("failed to get absolute path: %w", err)
+    }
+
+    if err := CreateDirectory(absDest, 0755); err != nil {
+        return "", err
+    }
+    return absDest, nil
+}
+
+// isMetadataEntry проверяет является ли запись служебным файлом
+// в корне архива (.PKGINFO, .MTREE, .SIGN.* и т.п.)
+func isMetadataEntry(name string) bool {
+    return !strings.Contains(strings.TrimSuffix(name, "/"), "/") && strings.HasPrefix(name, ".")
+}
+
+// extractTar распаковывает записи tar архива в dst, пропуская записи,
+// для которых skip возвращает true. Поддерживаются каталоги, обычные
+// файлы, символические и жесткие ссылки, FIFO и устройства (только root).
+// При запуске от root и PreserveOwnership выставляются числовые uid/gid
+// и полные права из заголовков, включая setuid
+func extractTar(tr *tar.Reader, dst string, skip func(name string) bool) error {
+    // Время модификации каталогов выставляется в конце,
+    // так как создание файлов внутри его меняет
+    var dirs []*tar.Header
+    preserve := PreserveOwnership && CheckRoot()
 
     for {
         header, err := tr.Next()
@@ -153,20 +419,44 @@ func ExtractTarGz(src, dst string) error {
             return fmt.Errorf("failed to read tar header: %w", err)
         }
 
-        target := filepath.Join(dst, header.Name)
-        
+        if skip != nil && skip(strings.TrimPrefix(header.Name, "./")) {
+            continue
+        }
+
+        target, err := safeJoin(dst, header.Name)
+        if err != nil {
+            return err
+        }
+
+        if err := checkNoSymlinks(dst, filepath.Dir(target)); err != nil {
+            return err
+        }
+        if header.Typeflag != tar.TypeDir {
+            if err := CreateDirectory(filepath.Dir(target), 0755); err != nil {
+                return err
+            }
+        }
+
         switch header.Typeflag {
         case tar.TypeDir:
+            if err := checkNoSymlinks(dst, target); err != nil {
+                return err
+            }
             if err := CreateDirectory(target, os.FileMode(header.Mode)); err != nil {
                 return err
             }
+            if preserve {
+                if err := setOwnership(target, header); err != nil {
+                    return err
+                }
+            }
+            dirs = append(dirs, header)
+            continue
         case tar.TypeReg:
-            dir := filepath.Dir(target)
-            if err := CreateDirectory(dir, 0755); err != nil {
+            if err := replaceSymlink(target); err != nil {
                 return err
             }
-
-            f, err := os.OpenFile(target, os.O_CREATE|os.O_RDWR, os.FileMode(header.Mode))
+            f, err := os.OpenFile(target, os.O_CREATE|os.O_RDWR|os.O_TRUNC|syscall.O_NOFOLLOW, os.FileMode(header.Mode))
             if err != nil {
                 return fmt.Errorf("failed to create file: %w", err)
             }
@@ -176,26 +466,266 @@ func ExtractTarGz(src, dst string) error {
                 return fmt.Errorf("failed to write file contents: %w", err)
             }
             f.Close()
+        case tar.TypeSymlink:
+            link, err := checkLinkTarget(dst, target, header)
+            if err != nil {
+                return err
+            }
+            if err := removeExisting(target); err != nil {
+                return err
+            }
+            if err := os.Symlink(link, target); err != nil {
+                return fmt.Errorf("failed to create symlink: %w", err)
+            }
+            if preserve {
+                if err := os.Lchown(target, header.Uid, header.Gid); err != nil {
+                    return fmt.Errorf("failed to set owner of %s: %w", target, err)
+                }
+            }
+            // os.Chtimes следует по ссылке, поэтому время не выставляем
+            continue
+        case tar.TypeLink:
+            source, err := checkLinkTarget(dst, target, header)
+            if err != nil {
+                return err
+            }
+            if err := checkNoSymlinks(dst, filepath.Dir(source)); err != nil {
+                return err
+            }
+            if err := removeExisting(target); err != nil {
+                return err
+            }
+            if err := os.Link(source, target); err != nil {
+                return fmt.Errorf("failed to create hardlink: %w", err)
+            }
+        case tar.TypeFifo:
+            if err := removeExisting(target); err != nil {
+                return err
+            }
+            if err := syscall.Mkfifo(target, uint32(header.Mode&07777)); err != nil {
+                return fmt.Errorf("failed to create fifo: %w", err)
+            }
+        case tar.TypeChar, tar.TypeBlock:
+            if !CheckRoot() {
+                logger.Warnf("Skipping device node %s: root privileges required", header.Name)
+                continue
+            }
+            mode := uint32(header.Mode & 07777)
+            if header.Typeflag == tar.TypeChar {
+                mode |= syscall.S_IFCHR
+            } else {
+                mode |= syscall.S_IFBLK
+            }
+            if err := removeExisting(target); err != nil {
+                return err
+            }
+            dev := int(((header.Devmajor & 0xfff) << 8) | (header.Devminor & 0xff) | ((header.Devminor &^ 0xff) << 12))
+            if err := syscall.Mknod(target, mode, dev); err != nil {
+                return fmt.Errorf("failed to create device node: %w", err)
+            }
+        default:
+            logger.Debugf("Skipping unsupported tar entry %s (type %c)", header.Name, header.Typeflag)
+            continue
+        }
+
+        // Жесткая ссылка разделяет inode с исходным файлом, его владелец
+        // и время уже выставлены
+        if header.Typeflag == tar.TypeLink {
+            continue
+        }
+        if preserve {
+            if err := setOwnership(target, header); err != nil {
+                return err
+            }
+        }
+        if err := os.Chtimes(target, header.AccessTime, header.ModTime); err != nil {
+            logger.Debugf("Failed to set modification time on %s: %v", target, err)
+        }
+    }
+
+    for _, header := range dirs {
+        target, _ := safeJoin(dst, header.Name)
+        if err := os.Chtimes(target, header.AccessTime, header.ModTime); err != nil {
+            logger.Debugf("Failed to set modification time on %s: %v", target, err)
         }
     }
 
     return nil
 }
 
-// ExtractTarXz распаковывает tar.xz архив
-func ExtractTarXz(src, dst string) error {
+// setOwnership выставляет владельца и права записи tar. chown сбрасывает
+// setuid и setgid, поэтому права выставляются после него
+func setOwnership(target string, header *tar.Header) error {
+    if err := os.Lchown(target, header.Uid, header.Gid); err != nil {
+        return fmt.Errorf("failed to set owner of %s: %w", target, err)
+    }
+    mode := header.FileInfo().Mode() & (os.ModePerm | os.ModeSetuid | os.ModeSetgid | os.ModeSticky)
+    if err := os.Chmod(target, mode); err != nil {
+        return fmt.Errorf("failed to set mode of %s: %w", target, err)
+    }
+    return nil
+}
+
+// removeExisting удаляет существующий файл перед созданием ссылки или узла
+func removeExisting(path string) error {
+    if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+        return fmt.Errorf("failed to replace %s: %w", path, err)
+    }
+    return nil
+}
+
+// writeTarFromDir записывает содержимое каталога root в tar архив.
+// Владельцем всех файлов указывается root. hook вызывается перед записью
+// каждого заголовка и может его изменить
+func writeTarFromDir(tw *tar.Writer, root string, hook func(header *tar.Header, path string) error) error {
+    return filepath.Walk(root, func(path string, fi os.FileInfo, err error) error {
+        if err != nil {
+            return err
+        }
+
+        relPath, err := filepath.Rel(root, path)
+        if err != nil {
+            return fmt.Errorf("failed to get relative path: %w", err)
+        }
+        if relPath == "." {
+            return nil
+        }
+
+        link := ""
+        if fi.Mode()&os.ModeSymlink != 0 {
+            if link, err = os.Readlink(path); err != nil {
+                return fmt.Errorf("failed to read symlink: %w", err)
+            }
+        }
+
+        header, err := tar.FileInfoHeader(fi, link)
+        if err != nil {
+            return fmt.Errorf("failed to create tar header: %w", err)
+        }
+
+        header.Name = filepath.ToSlash(relPath)
+        if fi.IsDir() {
+            header.Name += "/"
+        }
+        header.Uid, header.Gid = 0, 0
+        header.Uname, header.Gname = "root", "root"
+
+        if hook != nil {
+            if err := hook(header, path); err != nil {
+                return err
+            }
+        }
+
+        if err := tw.WriteHeader(header); err != nil {
+            return fmt.Errorf("failed to write tar header: %w", err)
+        }
+
+        if !fi.Mode().IsRegular() {
+            return nil
+        }
+
+        f, err := os.Open(path)
+        if err != nil {
+            return fmt.Errorf("failed to open file: %w", err)
+        }
+        defer f.Close()
+
+        if _, err := io.Copy(tw, f); err != nil {
+            return fmt.Errorf("failed to write file contents: %w", err)
+        }
+        return nil
+    })
+}
+
+// OpenCompressedTar открывает tar архив, определяя сжатие (gzip, xz, zstd
+// или без сжатия) по магическим байтам. Возвращает tar.Reader и функцию,
+// освобождающую ресурсы
+func OpenCompressedTar(path string) (*tar.Reader, func() error, error) {
+    file, err := os.Open(path)
+    if err != nil {
+        return nil, nil, fmt.Errorf("failed to open archive: %w", err)
+    }
+
+    r, closeReader, err := decompressStream(file)
+    if err != nil {
+        file.Close()
+        return nil, nil, err
+    }
+
+    closeFn := func() error {
+        closeReader()
+        return file.Close()
+    }
+    return tar.NewReader(r), closeFn, nil
+}
+
+// decompressStream определяет сжатие потока по магическим байтам
+// и возвращает распакованный поток. Поддерживаются gzip, xz, zstd,
+// bzip2, lz4 и tar без сжатия
+func decompressStream(r io.Reader) (io.Reader, func(), error) {
+    br := bufio.NewReader(r)
+    magic, _ := br.Peek(len(magicXz))
+
+    switch {
+    case bytes.HasPrefix(magic, magicGzip):
+        gzr, err := gzip.NewReader(br)
+        if err != nil {
+            return nil, nil, fmt.Errorf("failed to create gzip reader: %w", err)
+        }
+        return gzr, func() { gzr.Close() }, nil
+    case bytes.HasPrefix(magic, magicXz):
+        xzr, err := xz.NewReader(br)
+        if err != nil {
+            return nil, nil, fmt.Errorf("failed to create xz reader: %w", err)
+        }
+        return xzr, func() {}, nil
+    case bytes.HasPrefix(magic, magicZstd):
+        zr, err := zstd.NewReader(br)
+        if err != nil {
+            return nil, nil, fmt.Errorf("failed to create zstd reader: %w", err)
+        }
+        return zr, zr.Close, nil
+    case bytes.HasPrefix(magic, magicBzip2):
+        return bzip2.NewReader(br), func() {}, nil
+    case bytes.HasPrefix(magic, magicLz4):
+        return lz4.NewReader(br), func() {}, nil
+    }
+
+    header, _ := br.Peek(ustarOffset + len(magicUstar))
+    if len(header) == ustarOffset+len(magicUstar) && bytes.HasSuffix(header, magicUstar) {
+        return br, func() {}, nil
+    }
+    return nil, nil, fmt.Errorf("%w: unsupported compression (%s)", ErrInvalidFormat, describeMagic(magic))
+}
+
+// ExtractCompressedTar распаковывает tar архив, определяя сжатие по
+// содержимому (см. decompressStream). Прогресс, если progress задан,
+// считается по прочитанной части сжатого архива
+func ExtractCompressedTar(src, dst string, progress ProgressFunc) error {
     file, err := os.Open(src)
     if err != nil {
         return fmt.Errorf("failed to open archive: %w", err)
     }
     defer file.Close()
 
-    xzr, err := xz.NewReader(file)
+    tracker := newProgressTracker(fileSize(src), progress)
+    r, closeReader, err := decompressStream(tracker.wrap(file))
     if err != nil {
-        return fmt.Errorf("failed to create xz reader: %w", err)
+        return err
+    }
+    defer closeReader()
+
+    if err := extractTar(tar.NewReader(r), dst, nil); err != nil {
+        return err
     }
+    tracker.finish()
+    return nil
+}
 
-    tr := tar.NewReader(xzr)
+// listTarFiles возвращает содержимое tar архива, пропуская записи,
+// для которых skip возвращает true
+func listTarFiles(tr *tar.Reader, skip func(name string) bool) ([]FileInfo, error) {
+    var files []FileInfo
 
     for {
         header, err := tr.Next()
@@ -203,62 +733,290 @@ func ExtractTarXz(src, dst string) error {
             break
         }
         if err != nil {
-            return fmt.Errorf("failed to read tar header: %w", err)
+            return nil, fmt.Errorf("failed to read tar header: %w", err)
         }
 
-        target := filepath.Join(dst, header.Name)
+        name := strings.TrimPrefix(header.Name, "./")
+        if name == "" || (skip != nil && skip(name)) {
+            continue
+        }
 
-        switch header.Typeflag {
-        case tar.TypeDir:
-            if err := CreateDirectory(target, os.FileMode(header.Mode)); err != nil {
-                return err
+        files = append(files, FileInfo{
+            Path:    "/" + strings.TrimSuffix(name, "/"),
+            Size:    header.Size,
+            Mode:    header.FileInfo().Mode(),
+            ModTime: header.ModTime,
+            IsDir:   header.Typeflag == tar.TypeDir,
+        })
+    }
+
+    return files, nil
+}
+
+// parseModeString преобразует строку прав вида "drwxr-xr-x" в os.FileMode
+func parseModeString(s string) os.FileMode {
+    var mode os.FileMode
+    if len(s) != 10 {
+        return mode
+    }
+
+    switch s[0] {
+    case 'd':
+        mode |= os.ModeDir
+    case 'l':
+        mode |= os.ModeSymlink
+    case 'c':
+        mode |= os.ModeDevice | os.ModeCharDevice
+    case 'b':
+        mode |= os.ModeDevice
+    case 'p':
+        mode |= os.ModeNamedPipe
+    case 's':
+        mode |= os.ModeSocket
+    }
+
+    for i, c := range s[1:] {
+        bit := os.FileMode(1) << uint(8-i)
+        switch c {
+        case 'r', 'w', 'x':
+            mode |= bit
+        case 's':
+            mode |= bit
+            if i == 2 {
+                mode |= os.ModeSetuid
+            } else {
+                mode |= os.ModeSetgid
             }
-        case tar.TypeReg:
-            dir := filepath.Dir(target)
-            if err := CreateDirectory(dir, 0755); err != nil {
-                return err
+        case 'S':
+            if i == 2 {
+                mode |= os.ModeSetuid
+            } else {
+                mode |= os.ModeSetgid
             }
+        case 't':
+            mode |= bit | os.ModeSticky
+        case 'T':
+            mode |= os.ModeSticky
+        }
+    }
 
-            f, err := os.OpenFile(target, os.O_CREATE|os.O_RDWR, os.FileMode(header.Mode))
-            if err != nil {
-                return fmt.Errorf("failed to create file: %w", err)
-            }
+    return mode
+}
 
-            if _, err := io.Copy(f, tr); err != nil {
-                f.Close()
-                return fmt.Errorf("failed to write file contents: %w", err)
+// unixFileMode преобразует числовой режим st_mode в os.FileMode
+func unixFileMode(m uint32) os.FileMode {
+    mode := os.FileMode(m & 0777)
+
+    switch m & syscall.S_IFMT {
+    case syscall.S_IFDIR:
+        mode |= os.ModeDir
+    case syscall.S_IFLNK:
+        mode |= os.ModeSymlink
+    case syscall.S_IFCHR:
+        mode |= os.ModeDevice | os.ModeCharDevice
+    case syscall.S_IFBLK:
+        mode |= os.ModeDevice
+    case syscall.S_IFIFO:
+        mode |= os.ModeNamedPipe
+    case syscall.S_IFSOCK:
+        mode |= os.ModeSocket
+    }
+
+    if m&syscall.S_ISUID != 0 {
+        mode |= os.ModeSetuid
+    }
+    if m&syscall.S_ISGID != 0 {
+        mode |= os.ModeSetgid
+    }
+    if m&syscall.S_ISVTX != 0 {
+        mode |= os.ModeSticky
+    }
+
+    return mode
+}
+
+// hashAlgos поддерживаемые алгоритмы хеширования по имени
+var hashAlgos = map[string]crypto.Hash{
+    "md5":    crypto.MD5,
+    "sha1":   crypto.SHA1,
+    "sha256": crypto.SHA256,
+    "sha512": crypto.SHA512,
+}
+
+// ParseHashAlgo возвращает алгоритм хеширования по имени: md5, sha1,
+// sha256 или sha512
+func ParseHashAlgo(name string) (crypto.Hash, error) {
+    algo, ok := hashAlgos[strings.ToLower(strings.ReplaceAll(name, "-", ""))]
+    if !ok {
+        return 0, fmt.Errorf("unsupported hash algorithm %q (use md5, sha1, sha256 or sha512)", name)
+    }
+    return algo, nil
+}
+
+// newDigestHash подбирает алгоритм хеширования по длине hex-строки
+func newDigestHash(digest string) (hash.Hash, error) {
+    switch len(digest) {
+    case 32:
+        return md5.New(), nil
+    case 40:
+        return sha1.New(), nil
+    case 64:
+        return sha256.New(), nil
+    case 128:
+        return sha512.New(), nil
+    }
+    return nil, fmt.Errorf("unknown digest length %d", len(digest))
+}
+
+// verifyTarEntries читает все записи архива и сверяет содержимое
+// обычных файлов с ожидаемым хешем и размером. expected возвращает
+// пустой хеш, если проверять хеш не нужно, и размер -1, если не нужно
+// проверять размер
+func verifyTarEntries(tr *tar.Reader, expected func(name string, header *tar.Header) (string, int64)) error {
+    for {
+        header, err := tr.Next()
+        if err == io.EOF {
+            return nil
+        }
+        if err != nil {
+            return fmt.Errorf("%w: %v", ErrCorruptedPackage, err)
+        }
+
+        name := strings.Trim(strings.TrimPrefix(header.Name, "./"), "/")
+        digest, size := "", int64(-1)
+        if header.Typeflag == tar.TypeReg {
+            digest, size = expected(name, header)
+        }
+
+        var h hash.Hash
+        if digest != "" {
+            if h, err = newDigestHash(digest); err != nil {
+                return fmt.Errorf("%w: %s: %v", ErrCorruptedPackage, name, err)
             }
-            f.Close()
         }
-    }
 
-    return nil
+        // Читаем содержимое полностью, чтобы проверить распаковку
+        w := io.Discard
+        if h != nil {
+            w = h
+        }
+        n, err := io.Copy(w, tr)
+        if err != nil {
+            return fmt.Errorf("%w: %s: %v", ErrCorruptedPackage, name, err)
+        }
+
+        if size >= 0 && n != size {
+            return fmt.Errorf("%w: %s: size mismatch (expected %d, got %d)", ErrCorruptedPackage, name, size, n)
+        }
+        if h != nil && !strings.EqualFold(hex.EncodeToString(h.Sum(nil)), digest) {
+            return fmt.Errorf("%w: %s: checksum mismatch", ErrCorruptedPackage, name)
+        }
+    }
 }
 
-// CreateBackup создает резервную копию файла или директории
-func CreateBackup(path string) (string, error) {
-    backupDir := "/var/backups/upkgt"
+// CreateBackup создает резервную копию файла или директории.
+// Если path не существует, возвращает пустой путь без ошибки. Если
+// дерево больше BackupMaxSize, сохраняются только ключевые файлы базы
+// из backupEssentials, а для неизвестных баз копия пропускается.
+// progress, если задан, получает объем скопированных данных
+func CreateBackup(path string, progress ProgressFunc) (string, error) {
+    absPath, err := filepath.Abs(path)
+    if err != nil {
+        return "", fmt.Errorf("failed to get absolute path: %w", err)
+    }
+    path = absPath
+
+    if _, err := os.Lstat(path); os.IsNotExist(err) {
+        logger.Debugf("Nothing to back up: %s does not exist", path)
+        return "", nil
+    }
+
+    size, err := treeSize(path)
+    if err != nil {
+        return "", fmt.Errorf("failed to measure %s: %w", path, err)
+    }
+
+    roots := []string{path}
+    partial := false
+    if size > BackupMaxSize {
+        essentials, ok := backupEssentials[filepath.Base(path)]
+        if !ok {
+            logger.Warnf("Skipping backup of %s: %s exceeds limit of %s", path, FormatSize(size), FormatSize(BackupMaxSize))
+            return "", nil
+        }
+
+        roots = roots[:0]
+        for _, name := range essentials {
+            if _, err := os.Lstat(filepath.Join(path, name)); err == nil {
+                roots = append(roots, filepath.Join(path, name))
+            }
+        }
+        if len(roots) == 0 {
+            logger.Warnf("Skipping backup of %s: %s exceeds limit of %s", path, FormatSize(size), FormatSize(BackupMaxSize))
+            return "", nil
+        }
+        logger.Warnf("%s is %s, backing up only %s", path, FormatSize(size), strings.Join(essentials, ", "))
+        partial = true
+
+        size = 0
+        for _, root := range roots {
+            rootSize, err := treeSize(root)
+            if err != nil {
+                return "", fmt.Errorf("failed to measure %s: %w", root, err)
+            }
+            size += rootSize
+        }
+    }
+    tracker := newProgressTracker(size, progress)
+
+    // Каталог задается BackupDir (UPKGT_BACKUP_DIR, backup_dir в конфигурации)
+    backupDir := BackupDir
     if err := CreateDirectory(backupDir, 0755); err != nil {
         return "", err
     }
 
+    // Копии, созданные в одну секунду, получают числовой суффикс
     timestamp := time.Now().Format("20060102-150405")
-    backupName := fmt.Sprintf("%s-%s.tar.gz", filepath.Base(path), timestamp)
-    backupPath := filepath.Join(backupDir, backupName)
-
-    file, err := os.Create(backupPath)
+    backupPath := filepath.Join(backupDir, fmt.Sprintf("%s-%s.tar.gz", filepath.Base(path), timestamp))
+    file, err := os.OpenFile(backupPath, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+    for i := 1; os.IsExist(err); i++ {
+        backupPath = filepath.Join(backupDir, fmt.Sprintf("%s-%s-%d.tar.gz", filepath.Base(path), timestamp, i))
+        file, err = os.OpenFile(backupPath, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+    }
     if err != nil {
         return "", fmt.Errorf("failed to create backup file: %w", err)
     }
+    // Незавершенный архив удаляется, чтобы не попасть в ListBackups
+    complete := false
+    defer func() {
+        if !complete {
+            os.Remove(backupPath)
+        }
+    }()
     defer file.Close()
 
+    // tar и gzip закрываются явно в конце: при ошибке раньше архив все
+    // равно удаляется
     gzw := gzip.NewWriter(file)
-    defer gzw.Close()
+    // Исходный путь сохраняется в заголовке gzip для RestoreBackup
+    gzw.Comment = path
 
     tw := tar.NewWriter(gzw)
-    defer tw.Close()
 
-    err = filepath.Walk(path, func(file string, fi os.FileInfo, err error) error {
+    // Частичная копия помечается, чтобы RestoreBackup не удалял
+    // остальные файлы базы
+    if partial {
+        if err := tw.WriteHeader(&tar.Header{
+            Name:     partialBackupMarker,
+            Mode:     0644,
+            Typeflag: tar.TypeReg,
+            ModTime:  time.Now(),
+        }); err != nil {
+            return "", fmt.Errorf("failed to write tar header: %w", err)
+        }
+    }
+
+    walk := func(file string, fi os.FileInfo, err error) error {
         if err != nil {
             return err
         }
@@ -288,30 +1046,135 @@ func CreateBackup(path string) (string, error) {
         }
         defer f.Close()
 
-        if _, err := io.Copy(tw, f); err != nil {
+        if _, err := io.Copy(tw, tracker.wrap(f)); err != nil {
             return fmt.Errorf("failed to write file contents: %w", err)
         }
 
         return nil
-    })
+    }
 
-    if err != nil {
-        return "", fmt.Errorf("failed to create backup: %w", err)
+    for _, root := range roots {
+        if err := filepath.Walk(root, walk); err != nil {
+            return "", fmt.Errorf("failed to create backup: %w", err)
+        }
     }
 
+    // Концевые блоки tar и gzip записываются при закрытии, поэтому копия
+    // считается готовой только если все закрытия прошли без ошибок
+    if err := tw.Close(); err != nil {
+        return "", fmt.Errorf("failed to finish backup archive: %w", err)
+    }
+    if err := gzw.Close(); err != nil {
+        return "", fmt.Errorf("failed to finish backup compression: %w", err)
+    }
+    if err := file.Close(); err != nil {
+        return "", fmt.Errorf("failed to write backup file: %w", err)
+    }
+
+    complete = true
+    tracker.finish()
     return backupPath, nil
 }
 
+// treeSize возвращает суммарный размер обычных файлов в дереве
+func treeSize(path string) (int64, error) {
+    var size int64
+    err := filepath.Walk(path, func(_ string, fi os.FileInfo, err error) error {
+        if err != nil {
+            return err
+        }
+        if fi.Mode().IsRegular() {
+            size += fi.Size()
+        }
+        return nil
+    })
+    return size, err
+}
+
+// commandEnv возвращает окружение для внешних команд, вывод которых
+// показывается пользователю. C locale выставляется, если не задан
+// PreserveLocale
+func commandEnv() []string {
+    if PreserveLocale {
+        return os.Environ()
+    }
+    return parseEnv()
+}
+
+// parseEnv возвращает окружение для команд, вывод которых разбирается:
+// метки полей в нем не должны зависеть от языка пользователя
+func parseEnv() []string {
+    return append(os.Environ(), "LANG=C", "LC_ALL=C")
+}
+
+// RunConcurrent вызывает fn для индексов 0..count-1, выполняя не более
+// jobs вызовов одновременно (jobs < 1 - по числу процессоров). Ошибка
+// вызова i возвращается в элементе i; после отмены ctx оставшиеся
+// индексы не обрабатываются и получают ctx.Err()
+func RunConcurrent(ctx context.Context, count, jobs int, fn func(i int) error) []error {
+    if jobs < 1 {
+        jobs = runtime.NumCPU()
+    }
+    if jobs > count {
+        jobs = count
+    }
+
+    errs := make([]error, count)
+    indexes := make(chan int)
+    var wg sync.WaitGroup
+    for w := 0; w < jobs; w++ {
+        wg.Add(1)
+        go func() {
+            defer wg.Done()
+            for i := range indexes {
+                errs[i] = fn(i)
+            }
+        }()
+    }
+
+    for i := 0; i < count; i++ {
+        select {
+        case indexes <- i:
+            continue
+        case <-ctx.Done():
+        }
+        for ; i < count; i++ {
+            errs[i] = ctx.Err()
+        }
+    }
+    close(indexes)
+    wg.Wait()
+    return errs
+}
+
 // ExecuteCommand выполняет команду и возвращает вывод
 func ExecuteCommand(name string, args ...string) (string, error) {
-    cmd := exec.Command(name, args...)
-    output, err := cmd.CombinedOutput()
+    output, err := CommandRunner.Run(context.Background(), name, args...)
     if err != nil {
         return "", fmt.Errorf("command failed: %s: %w", string(output), err)
     }
     return string(output), nil
 }
 
+// printDryRun выводит резервную копию и команду, которые были бы
+// выполнены, не запуская их
+func printDryRun(name string, cmdArgs []string, backupSource string, noBackup bool) {
+    if noBackup {
+        fmt.Println("Backup:  skipped")
+    } else {
+        fmt.Printf("Backup:  %s -> %s\n", backupSource, BackupDir)
+    }
+
+    args := make([]string, 0, len(cmdArgs)+1)
+    for _, arg := range append([]string{name}, cmdArgs...) {
+        if arg == "" || strings.ContainsAny(arg, " \t\n\"'\\$*?") {
+            arg = strconv.Quote(arg)
+        }
+        args = append(args, arg)
+    }
+    fmt.Printf("Command: %s\n", strings.Join(args, " "))
+}
+
 // IsSymlink проверяет является ли путь символической ссылкой
 func IsSymlink(path string) bool {
     fi, err := os.Lstat(path)
@@ -0,0 +1,119 @@
+// internal/validate.go
+package internal
+
+import (
+    "errors"
+    "fmt"
+    "io"
+    "os"
+    "strings"
+)
+
+// Validate проверяет структуру .deb: члены ar debian-binary, control.tar*
+// и data.tar* в этом порядке. Содержимое архивов не распаковывается
+func (d *Deb) Validate() error {
+    f, err := os.Open(d.Path)
+    if err != nil {
+        return fmt.Errorf("failed to open package: %w", err)
+    }
+    defer f.Close()
+
+    ar, err := newArReader(f)
+    if err != nil {
+        if errors.Is(err, ErrInvalidFormat) {
+            return err
+        }
+        return fmt.Errorf("%w: %v", ErrCorruptedPackage, err)
+    }
+
+    for i, prefix := range []string{"debian-binary", "control.tar", "data.tar"} {
+        header, err := ar.Next()
+        if err == io.EOF {
+            return fmt.Errorf("%w: missing %s member", ErrInvalidFormat, prefix)
+        }
+        if err != nil {
+            return fmt.Errorf("%w: %v", ErrCorruptedPackage, err)
+        }
+        if !strings.HasPrefix(header.Name, prefix) {
+            return fmt.Errorf("%w: member %d is %s, expected %s", ErrInvalidFormat, i+1, header.Name, prefix)
+        }
+
+        if i == 0 {
+            version := make([]byte, 2)
+            if _, err := io.ReadFull(ar, version); err != nil || string(version) != "2." {
+                return fmt.Errorf("%w: unsupported debian-binary version", ErrInvalidFormat)
+            }
+        }
+    }
+    return nil
+}
+
+// Validate проверяет lead и заголовки сигнатур и метаданных .rpm
+func (r *RPM) Validate() error {
+    if _, err := readRPMMainHeader(r.Path); err != nil {
+        if errors.Is(err, ErrInvalidFormat) {
+            return err
+        }
+        return fmt.Errorf("%w: %v", ErrCorruptedPackage, err)
+    }
+    return nil
+}
+
+// Validate проверяет, что архив .eopkg распаковывается и содержит
+// metadata.xml и install.tar.xz
+func (e *Eopkg) Validate() error {
+    return validateTarMembers(e.Path, "metadata.xml", "install.tar.xz")
+}
+
+// Validate проверяет, что архив пакета распаковывается и содержит .PKGINFO
+func (p *Pacman) Validate() error {
+    return validateTarMembers(p.Path, ".PKGINFO")
+}
+
+// Validate проверяет, что gzip-сегменты .apk читаются и содержат .PKGINFO
+func (a *APK) Validate() error {
+    control, err := readAPKControl(a.Path)
+    if err != nil {
+        return fmt.Errorf("%w: %v", ErrCorruptedPackage, err)
+    }
+    if control == nil {
+        return fmt.Errorf("%w: missing .PKGINFO", ErrInvalidFormat)
+    }
+    return nil
+}
+
+// validateTarMembers читает заголовки сжатого tar архива, пока не найдет
+// все записи required
+func validateTarMembers(path string, required ...string) error {
+    tr, closeFn, err := OpenCompressedTar(path)
+    if err != nil {
+        if errors.Is(err, ErrInvalidFormat) {
+            return err
+        }
+        return fmt.Errorf("%w: %v", ErrCorruptedPackage, err)
+    }
+    defer closeFn()
+
+    missing := make(map[string]bool, len(required))
+    for _, name := range required {
+        missing[name] = true
+    }
+
+    for len(missing) > 0 {
+        header, err := tr.Next()
+        if err == io.EOF {
+            break
+        }
+        if err != nil {
+            return fmt.Errorf("%w: %v", ErrCorruptedPackage, err)
+        }
+        delete(missing, strings.TrimPrefix(header.Name, "./"))
+    }
+
+    for _, name := range required {
+        if missing[name] {
+            return fmt.Errorf("%w: missing %s", ErrInvalidFormat, name)
+        }
+    }
+    return nil
+}
@@ -0,0 +1,630 @@
+// internal/version.go
+package internal
+
+import (
+    "strconv"
+    "strings"
+)
+
+// debVersion разобранная версия Debian пакета
+type debVersion struct {
+    Epoch    int
+    Upstream string
+    Revision string
+}
+
+// parseDebVersion разбирает строку вида [epoch:]upstream[-revision]
+func parseDebVersion(v string) debVersion {
+    var result debVersion
+    v = strings.TrimSpace(v)
+
+    if i := strings.Index(v, ":"); i >= 0 {
+        if epoch, err := strconv.Atoi(v[:i]); err == nil {
+            result.Epoch = epoch
+            v = v[i+1:]
+        }
+    }
+
+    if i := strings.LastIndex(v, "-"); i >= 0 {
+        result.Revision = v[i+1:]
+        v = v[:i]
+    }
+
+    result.Upstream = v
+    return result
+}
+
+// compareDebVersion сравнивает версии по алгоритму dpkg
+func compareDebVersion(v1, v2 string) int {
+    a := parseDebVersion(v1)
+    b := parseDebVersion(v2)
+
+    if a.Epoch != b.Epoch {
+        if a.Epoch < b.Epoch {
+            return -1
+        }
+        return 1
+    }
+
+    if r := compareDebSegment(a.Upstream, b.Upstream); r != 0 {
+        return r
+    }
+    return compareDebSegment(a.Revision, b.Revision)
+}
+
+// debCharOrder возвращает вес символа для сравнения нецифровых частей.
+// "~" меньше всего, включая конец строки; буквы меньше остальных символов.
+func debCharOrder(s string, i int) int {
+    if i >= len(s) {
+        return 0
+    }
+    c := s[i]
+    switch {
+    case isDigit(c):
+        return 0
+    case isAlpha(c):
+        return int(c)
+    case c == '~':
+        return -1
+    default:
+        return int(c) + 256
+    }
+}
+
+// compareDebSegment сравнивает upstream или revision часть версии,
+// чередуя нецифровые и цифровые участки
+func compareDebSegment(a, b string) int {
+    i, j := 0, 0
+
+    for i < len(a) || j < len(b) {
+        // Нецифровой участок
+        for (i < len(a) && !isDigit(a[i])) || (j < len(b) && !isDigit(b[j])) {
+            ac := debCharOrder(a, i)
+            bc := debCharOrder(b, j)
+            if ac != bc {
+                return sign(ac - bc)
+            }
+            i++
+            j++
+        }
+
+        // Цифровой участок, ведущие нули не учитываются
+        for i < len(a) && a[i] == '0' {
+            i++
+        }
+        for j < len(b) && b[j] == '0' {
+            j++
+        }
+
+        firstDiff := 0
+        for i < len(a) && isDigit(a[i]) && j < len(b) && isDigit(b[j]) {
+            if firstDiff == 0 {
+                firstDiff = int(a[i]) - int(b[j])
+            }
+            i++
+            j++
+        }
+
+        if i < len(a) && isDigit(a[i]) {
+            return 1
+        }
+        if j < len(b) && isDigit(b[j]) {
+            return -1
+        }
+        if firstDiff != 0 {
+            return sign(firstDiff)
+        }
+    }
+
+    return 0
+}
+
+// isDigit проверяет является ли символ цифрой
+func isDigit(c byte) bool {
+    return c >= '0' && c <= '9'
+}
+
+// isAlpha проверяет является ли символ латинской буквой
+func isAlpha(c byte) bool {
+    return (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
+
+// sign приводит результат сравнения к -1, 0 или 1
+func sign(n int) int {
+    switch {
+    case n < 0:
+        return -1
+    case n > 0:
+        return 1
+    }
+    return 0
+}
+
+// rpmVersion разобранная версия RPM пакета (epoch:version-release)
+type rpmVersion struct {
+    Epoch   int
+    Version string
+    Release string
+}
+
+// parseRPMVersion разбирает строку EVR; epoch и release необязательны
+func parseRPMVersion(v string) rpmVersion {
+    var result rpmVersion
+    v = strings.TrimSpace(v)
+
+    if i := strings.Index(v, ":"); i >= 0 {
+        if epoch, err := strconv.Atoi(v[:i]); err == nil {
+            result.Epoch = epoch
+            v = v[i+1:]
+        }
+    }
+
+    if i := strings.LastIndex(v, "-"); i >= 0 {
+        result.Release = v[i+1:]
+        v = v[:i]
+    }
+
+    result.Version = v
+    return result
+}
+
+// compareRPMVersion сравнивает версии по правилам rpm (EVR)
+func compareRPMVersion(v1, v2 string) int {
+    a := parseRPMVersion(v1)
+    b := parseRPMVersion(v2)
+
+    if a.Epoch != b.Epoch {
+        if a.Epoch < b.Epoch {
+            return -1
+        }
+        return 1
+    }
+
+    if r := rpmvercmp(a.Version, b.Version); r != 0 {
+        return r
+    }
+
+    // RPM.GetInfo может вернуть версию без release, в этом случае
+    // release не участвует в сравнении
+    if a.Release == "" || b.Release == "" {
+        return 0
+    }
+    return rpmvercmp(a.Release, b.Release)
+}
+
+// rpmvercmp сравнивает сегменты версии по алгоритму rpmvercmp:
+// цифровые сегменты старше буквенных, длинный цифровой сегмент старше
+// короткого, "~" сортируется раньше всего, "^" раньше конца строки
+func rpmvercmp(a, b string) int {
+    if a == b {
+        return 0
+    }
+
+    i, j := 0, 0
+    for i < len(a) || j < len(b) {
+        // Пропускаем разделители
+        for i < len(a) && !isAlnum(a[i]) && a[i] != '~' && a[i] != '^' {
+            i++
+        }
+        for j < len(b) && !isAlnum(b[j]) && b[j] != '~' && b[j] != '^' {
+            j++
+        }
+
+        // Тильда сортируется раньше всего
+        if (i < len(a) && a[i] == '~') || (j < len(b) && b[j] == '~') {
+            if i >= len(a) || a[i] != '~' {
+                return 1
+            }
+            if j >= len(b) || b[j] != '~' {
+                return -1
+            }
+            i++
+            j++
+            continue
+        }
+
+        // Каретка сортируется раньше всего, кроме конца строки
+        if (i < len(a) && a[i] == '^') || (j < len(b) && b[j] == '^') {
+            if i >= len(a) {
+                return -1
+            }
+            if j >= len(b) {
+                return 1
+            }
+            if a[i] != '^' {
+                return 1
+            }
+            if b[j] != '^' {
+                return -1
+            }
+            i++
+            j++
+            continue
+        }
+
+        if i >= len(a) || j >= len(b) {
+            break
+        }
+
+        // Выделяем сегмент одного типа
+        numeric := isDigit(a[i])
+        si, sj := i, j
+        if numeric {
+            for i < len(a) && isDigit(a[i]) {
+                i++
+            }
+            for j < len(b) && isDigit(b[j]) {
+                j++
+            }
+        } else {
+            for i < len(a) && isAlpha(a[i]) {
+                i++
+            }
+            for j < len(b) && isAlpha(b[j]) {
+                j++
+            }
+        }
+
+        segA, segB := a[si:i], b[sj:j]
+
+        // Сегменты разных типов: цифровой старше буквенного
+        if segB == "" {
+            if numeric {
+                return 1
+            }
+            return -1
+        }
+
+        if numeric {
+            segA = strings.TrimLeft(segA, "0")
+            segB = strings.TrimLeft(segB, "0")
+            if len(segA) != len(segB) {
+                if len(segA) > len(segB) {
+                    return 1
+                }
+                return -1
+            }
+        }
+
+        if r := strings.Compare(segA, segB); r != 0 {
+            return r
+        }
+    }
+
+    // Побеждает версия, у которой остались символы
+    switch {
+    case i >= len(a) && j >= len(b):
+        return 0
+    case i < len(a):
+        return 1
+    default:
+        return -1
+    }
+}
+
+// isAlnum проверяет является ли символ буквой или цифрой
+func isAlnum(c byte) bool {
+    return isDigit(c) || isAlpha(c)
+}
+
+// pacmanVersion разобранная версия пакета Arch Linux (epoch:pkgver-pkgrel)
+type pacmanVersion struct {
+    Epoch   string
+    Version string
+    Release string
+}
+
+// parsePacmanVersion разбирает строку по правилам libalpm parseEVR
+func parsePacmanVersion(v string) pacmanVersion {
+    result := pacmanVersion{Epoch: "0"}
+    v = strings.TrimSpace(v)
+
+    i := 0
+    for i < len(v) && isDigit(v[i]) {
+        i++
+    }
+    if i < len(v) && v[i] == ':' {
+        if i > 0 {
+            result.Epoch = v[:i]
+        }
+        v = v[i+1:]
+    }
+
+    if i := strings.LastIndex(v, "-"); i >= 0 {
+        result.Release = v[i+1:]
+        v = v[:i]
+    }
+
+    result.Version = v
+    return result
+}
+
+// comparePacmanVersion сравнивает версии по правилам pacman vercmp
+func comparePacmanVersion(v1, v2 string) int {
+    if v1 == v2 {
+        return 0
+    }
+
+    a := parsePacmanVersion(v1)
+    b := parsePacmanVersion(v2)
+
+    if r := alpmVercmp(a.Epoch, b.Epoch); r != 0 {
+        return r
+    }
+    if r := alpmVercmp(a.Version, b.Version); r != 0 {
+        return r
+    }
+
+    // pkgrel сравнивается только если указан у обеих версий
+    if a.Release == "" || b.Release == "" {
+        return 0
+    }
+    return alpmVercmp(a.Release, b.Release)
+}
+
+// alpmVercmp реализация rpmvercmp из libalpm. В отличие от rpm, различная
+// длина разделителей влияет на результат, а оставшийся буквенный хвост
+// ("1.0a" против "1.0") считается более старой версией
+func alpmVercmp(a, b string) int {
+    if a == b {
+        return 0
+    }
+
+    i, j := 0, 0
+    pi, pj := 0, 0
+    for i < len(a) && j < len(b) {
+        for i < len(a) && !isAlnum(a[i]) {
+            i++
+        }
+        for j < len(b) && !isAlnum(b[j]) {
+            j++
+        }
+
+        if i >= len(a) || j >= len(b) {
+            break
+        }
+
+        // Разделители разной длины
+        if i-pi != j-pj {
+            if i-pi < j-pj {
+                return -1
+            }
+            return 1
+        }
+
+        pi, pj = i, j
+        numeric := isDigit(a[pi])
+        if numeric {
+            for pi < len(a) && isDigit(a[pi]) {
+                pi++
+            }
+            for pj < len(b) && isDigit(b[pj]) {
+                pj++
+            }
+        } else {
+            for pi < len(a) && isAlpha(a[pi]) {
+                pi++
+            }
+            for pj < len(b) && isAlpha(b[pj]) {
+                pj++
+            }
+        }
+
+        segA, segB := a[i:pi], b[j:pj]
+
+        // Сегменты разных типов: цифровой старше буквенного
+        if segB == "" {
+            if numeric {
+                return 1
+            }
+            return -1
+        }
+
+        if numeric {
+            segA = strings.TrimLeft(segA, "0")
+            segB = strings.TrimLeft(segB, "0")
+            if len(segA) != len(segB) {
+                if len(segA) > len(segB) {
+                    return 1
+                }
+                return -1
+            }
+        }
+
+        if r := strings.Compare(segA, segB); r != 0 {
+            return r
+        }
+
+        i, j = pi, pj
+    }
+
+    if i >= len(a) && j >= len(b) {
+        return 0
+    }
+
+    // Буквенный хвост никогда не побеждает пустую строку
+    if (i >= len(a) && !isAlpha(b[j])) || (i < len(a) && isAlpha(a[i])) {
+        return -1
+    }
+    return 1
+}
+
+// apkSuffixOrder порядок суффиксов версий apk-tools; пустой суффикс
+// находится между пре-релизными и пост-релизными
+var apkSuffixOrder = map[string]int{
+    "alpha": 0,
+    "beta":  1,
+    "pre":   2,
+    "rc":    3,
+    "":      4,
+    "cvs":   5,
+    "svn":   6,
+    "git":   7,
+    "hg":    8,
+    "p":     9,
+}
+
+// apkSuffix суффикс версии вида _rc1
+type apkSuffix struct {
+    Name   string
+    Number int
+}
+
+// apkVersion разобранная версия Alpine пакета
+type apkVersion struct {
+    Numbers  []string
+    Letter   byte
+    Suffixes []apkSuffix
+    Revision int
+}
+
+// parseAPKVersion разбирает строку вида 1.2.3a_rc1_p2-r4
+func parseAPKVersion(v string) apkVersion {
+    var result apkVersion
+    v = strings.TrimSpace(v)
+
+    if i := strings.LastIndex(v, "-r"); i >= 0 {
+        if rev, err := strconv.Atoi(v[i+2:]); err == nil {
+            result.Revision = rev
+            v = v[:i]
+        }
+    }
+
+    parts := strings.Split(v, "_")
+    base := parts[0]
+    if n := len(base); n > 0 && isAlpha(base[n-1]) {
+        result.Letter = base[n-1]
+        base = base[:n-1]
+    }
+    result.Numbers = strings.Split(base, ".")
+
+    for _, part := range parts[1:] {
+        i := 0
+        for i < len(part) && isAlpha(part[i]) {
+            i++
+        }
+        suffix := apkSuffix{Name: part[:i]}
+        suffix.Number, _ = strconv.Atoi(part[i:])
+        result.Suffixes = append(result.Suffixes, suffix)
+    }
+
+    return result
+}
+
+// compareAPKNumber сравнивает числовые компоненты версии apk. Компоненты
+// после первого с ведущим нулем сравниваются как дробная часть
+func compareAPKNumber(a, b string, first bool) int {
+    if !first && (strings.HasPrefix(a, "0") || strings.HasPrefix(b, "0")) {
+        return strings.Compare(a, b)
+    }
+
+    a = strings.TrimLeft(a, "0")
+    b = strings.TrimLeft(b, "0")
+    if len(a) != len(b) {
+        if len(a) > len(b) {
+            return 1
+        }
+        return -1
+    }
+    return strings.Compare(a, b)
+}
+
+// compareAPKVersion сравнивает версии по правилам apk-tools
+func compareAPKVersion(v1, v2 string) int {
+    if v1 == v2 {
+        return 0
+    }
+
+    a := parseAPKVersion(v1)
+    b := parseAPKVersion(v2)
+
+    for i := 0; i < len(a.Numbers) && i < len(b.Numbers); i++ {
+        if r := compareAPKNumber(a.Numbers[i], b.Numbers[i], i == 0); r != 0 {
+            return r
+        }
+    }
+    if len(a.Numbers) != len(b.Numbers) {
+        if len(a.Numbers) > len(b.Numbers) {
+            return 1
+        }
+        return -1
+    }
+
+    if a.Letter != b.Letter {
+        if a.Letter > b.Letter {
+            return 1
+        }
+        return -1
+    }
+
+    for i := 0; i < len(a.Suffixes) || i < len(b.Suffixes); i++ {
+        var sa, sb apkSuffix
+        if i < len(a.Suffixes) {
+            sa = a.Suffixes[i]
+        }
+        if i < len(b.Suffixes) {
+            sb = b.Suffixes[i]
+        }
+        if r := sign(apkSuffixOrder[sa.Name] - apkSuffixOrder[sb.Name]); r != 0 {
+            return r
+        }
+        if r := sign(sa.Number - sb.Number); r != 0 {
+            return r
+        }
+    }
+
+    return sign(a.Revision - b.Revision)
+}
+
+// VersionComparator сравнивает версии пакетов одного формата
+type VersionComparator interface {
+    // Compare возвращает -1, 0 или 1
+    Compare(a, b string) int
+}
+
+// DebVersion сравнение версий по правилам dpkg
+type DebVersion struct{}
+
+// Compare сравнивает версии Debian пакетов
+func (DebVersion) Compare(a, b string) int {
+    return compareDebVersion(a, b)
+}
+
+// RPMVersion сравнение версий по правилам rpm
+type RPMVersion struct{}
+
+// Compare сравнивает версии RPM пакетов
+func (RPMVersion) Compare(a, b string) int {
+    return compareRPMVersion(a, b)
+}
+
+// PacmanVersion сравнение версий по правилам pacman vercmp
+type PacmanVersion struct{}
+
+// Compare сравнивает версии пакетов Arch Linux
+func (PacmanVersion) Compare(a, b string) int {
+    return comparePacmanVersion(a, b)
+}
+
+// APKVersion сравнение версий по правилам apk-tools
+type APKVersion struct{}
+
+// Compare сравнивает версии Alpine пакетов
+func (APKVersion) Compare(a, b string) int {
+    return compareAPKVersion(a, b)
+}
+
+// ComparatorFor возвращает компаратор версий для типа пакета.
+// Для eopkg и неизвестных типов используются правила dpkg
+func ComparatorFor(pt PackageType) VersionComparator {
+    switch pt {
+    case TypeRPM:
+        return RPMVersion{}
+    case TypePacman:
+        return PacmanVersion{}
+    case TypeAPK:
+        return APKVersion{}
+    default:
+        return DebVersion{}
+    }
+}
@@ -0,0 +1,139 @@
+package internal
+
+import "testing"
+
+// versionTest ожидаемый результат сравнения a и b
+type versionTest struct {
+    a, b string
+    want int
+}
+
+// checkComparator проверяет comparator на tests в обе стороны
+func checkComparator(t *testing.T, comparator VersionComparator, tests []versionTest) {
+    t.Helper()
+    for _, tt := range tests {
+        if got := comparator.Compare(tt.a, tt.b); got != tt.want {
+            t.Errorf("Compare(%q, %q) = %d, want %d", tt.a, tt.b, got, tt.want)
+        }
+        if got := comparator.Compare(tt.b, tt.a); got != -tt.want {
+            t.Errorf("Compare(%q, %q) = %d, want %d", tt.b, tt.a, got, -tt.want)
+        }
+    }
+}
+
+func TestDebVersionCompare(t *testing.T) {
+    checkComparator(t, DebVersion{}, []versionTest{
+        {"1.0", "1.0", 0},
+        {"1.10", "1.9", 1},
+        {"1.0-1", "1.0-2", -1},
+        {"1.0", "1.0-0", 0},
+        // Эпоха важнее версии
+        {"1:1.0", "2.0", 1},
+        {"0:1.0", "1.0", 0},
+        {"2:0.1", "1:9.9", 1},
+        // "~" раньше всего, даже конца строки
+        {"1.0~rc1", "1.0", -1},
+        {"1.0~rc1", "1.0~rc2", -1},
+        {"1.0~~", "1.0~", -1},
+        {"1.0~", "1.0", -1},
+        // Буквы раньше прочих символов, цифры сравниваются численно
+        {"1.0a", "1.0", 1},
+        {"1.0a", "1.0+", -1},
+        {"1.2a3", "1.2a10", -1},
+        {"2.30-1ubuntu1", "2.30-1", 1},
+        {"1.0-1+b1", "1.0-1", 1},
+    })
+}
+
+func TestCompareVersionsUsesDpkgRules(t *testing.T) {
+    if got := CompareVersions("1.10", "1.9"); got != 1 {
+        t.Errorf("CompareVersions(1.10, 1.9) = %d, want 1", got)
+    }
+}
+
+func TestRPMVersionCompare(t *testing.T) {
+    // Пары взяты из тестов rpmvercmp в rpm
+    checkComparator(t, RPMVersion{}, []versionTest{
+        {"1.0", "1.0", 0},
+        {"1.0", "2.0", -1},
+        {"2.0.1", "2.0", 1},
+        {"5.5p1", "5.5p2", -1},
+        {"5.5p10", "5.5p1", 1},
+        {"10xyz", "10.1xyz", -1},
+        {"xyz10", "xyz10.1", -1},
+        {"1.0", "1.0a", -1},
+        {"1b.fc17", "1.fc17", -1},
+        {"2.0", "2_0", 0},
+        {"1.0~rc1", "1.0", -1},
+        {"1.0~rc1", "1.0~rc2", -1},
+        {"1.0^", "1.0", 1},
+        {"1.0^git1", "1.01", -1},
+        {"1.0-1", "1.0-2", -1},
+        {"1.0-1.el9", "1.0-1.el8", 1},
+        // Отсутствующая эпоха равна нулю
+        {"0:1.0-1", "1.0-1", 0},
+        {"1:1.0-1", "2.0-1", 1},
+        {"1:1.0", "0:9.9", 1},
+        // Release без пары не сравнивается
+        {"1.0", "1.0-5", 0},
+    })
+}
+
+func TestPacmanVersionCompare(t *testing.T) {
+    // Ожидаемые значения совпадают с выводом vercmp(8)
+    checkComparator(t, PacmanVersion{}, []versionTest{
+        {"1.0", "1.0", 0},
+        {"1.0", "1.0.1", -1},
+        {"1.0-1", "1.0-2", -1},
+        {"1.0a", "1.0", -1},
+        {"1.0alpha", "1.0beta", -1},
+        {"1.0.a", "1.0", 1},
+        {"1.0.1", "1.0.b", 1},
+        {"1.0..0", "1.0.0", 1},
+        {"1.0", "1.0-1", 0},
+        // git-снимки после тега
+        {"1.0.r15.g1234-1", "1.0-1", 1},
+        {"1.0.r15.g1234-1", "1.0.r9.gabcd-1", 1},
+        {"1.0.1", "1.0.r15.g1234", 1},
+        // Повышение эпохи перекрывает любую версию
+        {"1:1.0-1", "2.0-1", 1},
+        {"2:0.1-1", "1:9.9-1", 1},
+        {"0:1.0-1", "1.0-1", 0},
+    })
+}
+
+func TestAPKVersionCompare(t *testing.T) {
+    // Порядок суффиксов apk-tools: _alpha < _beta < _pre < _rc < без
+    // суффикса < _cvs < _svn < _git < _hg < _p
+    checkComparator(t, APKVersion{}, []versionTest{
+        {"1.0", "1.0", 0},
+        {"1.0", "1.0.1", -1},
+        {"1.10", "1.9", 1},
+        {"2.0", "10.0", -1},
+        {"1.0_alpha1", "1.0_beta1", -1},
+        {"1.0_beta2", "1.0_pre1", -1},
+        {"1.0_pre3", "1.0_rc1", -1},
+        {"1.0_rc1", "1.0", -1},
+        {"1.0_rc1", "1.0_rc2", -1},
+        {"1.0_rc10", "1.0_rc9", 1},
+        {"1.0", "1.0_cvs20230101", -1},
+        {"1.0_cvs1", "1.0_svn1", -1},
+        {"1.0_svn1", "1.0_git20240101", -1},
+        {"1.0_git1", "1.0_hg1", -1},
+        {"1.0_hg1", "1.0_p1", -1},
+        {"1.0_p1", "1.0_p2", -1},
+        {"1.0_p1", "1.0.1", -1},
+        // Буква после номера старше версии без нее
+        {"1.0a", "1.0", 1},
+        {"1.0a", "1.0b", -1},
+        {"1.0b_rc1", "1.0a", 1},
+        // Компоненты с ведущим нулем сравниваются как дробная часть
+        {"1.01", "1.1", -1},
+        {"1.001", "1.01", -1},
+        // Ревизия пакета -rN
+        {"1.0-r0", "1.0-r1", -1},
+        {"1.0-r10", "1.0-r9", 1},
+        {"1.0", "1.0-r0", 0},
+        {"1.0_rc1-r5", "1.0-r0", -1},
+    })
+}
@@ -2,19 +2,152 @@
 package main
 
 import (
+    "context"
+    "encoding/json"
+    "errors"
     "fmt"
-    "log"
     "os"
+    "os/exec"
+    "os/signal"
     "path/filepath"
     "runtime"
+    "sort"
+    "strconv"
     "strings"
+    "syscall"
+    "text/tabwriter"
+    "text/template"
     "time"
 
+    "github.com/NurOS-Linux/upkgt/internal"
     "github.com/spf13/cobra"
+    "github.com/spf13/viper"
     "github.com/fatih/color"
     "github.com/sirupsen/logrus"
 )
 
+// Process exit codes, so scripts can branch on the kind of failure.
+// exitCode maps errors to them.
+const (
+    exitFailure      = 1   // Any other failure
+    exitLocked       = 2   // Another upkgt process holds the lock
+    exitNotFound     = 3   // Package, file or backup not found
+    exitPermission   = 4   // Root privileges or write access required
+    exitInvalid      = 5   // Malformed, corrupted or unsupported package
+    exitDependency   = 6   // Unresolved dependencies or conflicts
+    exitIncompatible = 7   // Wrong architecture or no usable backend
+    exitUsage        = 8   // Invalid arguments, flags or configuration
+    exitProtected    = 9   // Refused to remove an essential package
+    exitCancelled    = 130 // Interrupted by Ctrl-C or SIGTERM
+)
+
+// errorExitCodes maps the command error codes (the outermost PackageError)
+// to exit codes. Every code a command emits is listed; retired codes
+// (2-4, 6, 29 and 48) are not reused. A wrapped internal error with a
+// category in internalExitCodes wins over the command code.
+var errorExitCodes = map[int]int{
+    1:  exitPermission,   // Root privileges required
+    5:  exitFailure,      // Installation failed
+    7:  exitNotFound,     // Package not found or unknown format
+    8:  exitFailure,      // Removal failed
+    9:  exitUsage,        // Invalid package path
+    10: exitNotFound,     // Package file not found
+    11: exitInvalid,      // Unsupported package format
+    12: exitInvalid,      // Could not read package info
+    13: exitUsage,        // Invalid package type
+    14: exitIncompatible, // No supported package manager
+    15: exitFailure,      // Could not list installed packages
+    16: exitNotFound,     // No installed packages match
+    17: exitFailure,      // Could not list package files
+    18: exitInvalid,      // Package verification failed
+    19: exitFailure,      // Extraction failed
+    20: exitFailure,      // Conversion failed
+    21: exitFailure,      // Some packages of a batch failed to install
+    22: exitDependency,   // Could not resolve install order
+    23: exitDependency,   // Conflicts with installed packages
+    24: exitFailure,      // Could not build dependency tree
+    25: exitFailure,      // Could not read history
+    26: exitFailure,      // Could not list backups
+    27: exitNotFound,     // Backup not found
+    28: exitFailure,      // Rollback failed
+    30: exitFailure,      // Could not prune backups
+    31: exitUsage,        // Invalid format template
+    32: exitFailure,      // Could not read changelog
+    33: exitUsage,        // Invalid log level
+    34: exitLocked,       // Could not acquire lock
+    35: exitFailure,      // Could not compare packages
+    36: exitIncompatible, // Architecture mismatch
+    37: exitUsage,        // Invalid hash algorithm
+    38: exitUsage,        // Invalid configuration file
+    39: exitFailure,      // Could not clean a directory
+    40: exitInvalid,      // Some packages failed validation
+    41: exitIncompatible, // No package backend available
+    42: exitUsage,        // Invalid metadata change
+    43: exitFailure,      // Repack failed
+    44: exitDependency,   // Required by installed packages
+    45: exitFailure,      // Could not query reverse dependencies
+    46: exitProtected,    // Essential package
+    47: exitUsage,        // Conflicting or missing destination
+    49: exitUsage,        // Both package path and --dir
+    50: exitNotFound,     // Could not scan directory
+    51: exitFailure,      // Download failed
+    52: exitCancelled,    // Directory scan cancelled
+    53: exitFailure,      // is-installed: package not installed
+    54: exitUsage,        // Unsupported completion shell
+}
+
+// errNotInstalled is returned by is-installed when the package is not
+// installed. It is an answer rather than a failure, so it is not logged.
+var errNotInstalled = &internal.PackageError{Code: 53, Message: "Package is not installed"}
+
+// internalExitCodes maps internal error categories to exit codes
+var internalExitCodes = map[int]int{
+    internal.ErrNotFound:           exitNotFound,
+    internal.ErrPermissionDenied:   exitPermission,
+    internal.ErrInvalidPackage:     exitInvalid,
+    internal.ErrDependencyMissing:  exitDependency,
+    internal.ErrConflict:           exitDependency,
+    internal.ErrSystemIncompatible: exitIncompatible,
+}
+
+// exitCode returns the process exit code for err. Commands wrap causes in
+// a PackageError with their own code; a wrapped internal error category,
+// being the more specific cause, wins over it.
+func exitCode(err error) int {
+    if errors.Is(err, internal.ErrLocked) {
+        return exitLocked
+    }
+    if errors.Is(err, context.Canceled) {
+        return exitCancelled
+    }
+
+    var command *internal.PackageError
+    for e := err; e != nil; e = errors.Unwrap(e) {
+        pkgErr, ok := e.(*internal.PackageError)
+        if !ok {
+            continue
+        }
+        if command == nil {
+            command = pkgErr
+            continue
+        }
+        if code, ok := internalExitCodes[pkgErr.Code]; ok {
+            return code
+        }
+    }
+
+    if command != nil {
+        if code, ok := errorExitCodes[command.Code]; ok {
+            return code
+        }
+    }
+
+    if errors.Is(err, os.ErrPermission) {
+        return exitPermission
+    }
+    return exitFailure
+}
+
 const (
     ProgramName    = "upkgt"
     ProgramVersion = "1.0.0" 
@@ -22,276 +155,2287 @@ const (
     BuildDate      = "2025-02-01 13:40:28"
 )
 
-var (
-    logger = logrus.New()
-    verbose bool
-    force bool
-    purge bool
-)
+var (
+    logger = logrus.New()
+    verbose bool
+    quiet bool
+    logLevel string
+    logJSON bool
+    preserveLocale bool
+    noCache bool
+    force bool
+    iKnowWhatImDoing bool
+    noDeps bool
+    dryRun bool
+    noBackup bool
+    installRoot string
+    keepGoing bool
+    purge bool
+    noAutoremove bool
+    backendType string
+    jsonOutput bool
+    namesOnly bool
+    depth int
+    historyLimit int
+    changelogLimit int
+    changelogSince string
+    restoreDest string
+    cleanBackups bool
+    cleanAll bool
+    cleanOlderThan time.Duration
+    backupKeep int
+    backupMaxAge time.Duration
+    convertTarget string
+    outputDir string
+    extractDir string
+    noPreserveOwner bool
+    repackOut string
+    repackVersion string
+    repackDepends []string
+    repackFields []string
+    timeout time.Duration
+    infoFormat string
+    infoResolve bool
+    infoDir string
+    jobs int
+    sizeTop int
+    noLock bool
+    minVersion string
+    ignoreArch bool
+    allowDowngrade bool
+    reinstall bool
+    refresh bool
+    interactive bool
+    offline bool
+    allowUntrusted bool
+    checksum string
+    hashAlgo string
+    downloadDir string
+    resume bool
+)
+
+func init() {
+    logger.SetFormatter(&logrus.TextFormatter{
+        FullTimestamp:   true,
+        TimestampFormat: "2006-01-02 15:04:05",
+    })
+    logger.SetOutput(os.Stderr)
+}
+
+// detectInstalledPackageType returns the backend whose database has the
+// package installed, or internal.TypeUnknown
+func detectInstalledPackageType(ctx context.Context, name string) internal.PackageType {
+    return internal.DetectInstalledPackageType(ctx, name)
+}
+
+// resolvePackageType detects the package type by extension, falling
+// back to the file's magic bytes
+func resolvePackageType(path string) internal.PackageType {
+    return internal.DetectPackageType(path)
+}
+
+func handleInstall(ctx context.Context, path string, opts internal.InstallOptions) error {
+    if err := requireInstallRoot(opts); err != nil {
+        return err
+    }
+
+    absPath, err := filepath.Abs(path)
+    if err != nil {
+        return &internal.PackageError{
+            Code:     9,
+            Message:  "Invalid package path",
+            Type:     internal.TypeUnknown,
+            Original: err,
+        }
+    }
+
+    if _, err := os.Stat(absPath); os.IsNotExist(err) {
+        return &internal.PackageError{
+            Code:     10,
+            Message:  "Package file not found",
+            Type:     internal.TypeUnknown,
+            Original: err,
+        }
+    }
+
+    pkgType := resolvePackageType(absPath)
+    if pkgType == internal.TypeUnknown {
+        return &internal.PackageError{
+            Code:    11,
+            Message: "Unsupported package format",
+            Type:    internal.TypeUnknown,
+        }
+    }
+
+    pkg, err := internal.CreatePackageFromPath(absPath)
+    if err != nil {
+        return &internal.PackageError{
+            Code:     11,
+            Message:  "Unsupported package format",
+            Type:     pkgType,
+            Original: err,
+        }
+    }
+
+    return installPackage(ctx, absPath, pkg, opts)
+}
+
+// requireInstallRoot returns an error unless the user may install into
+// the root of opts. Dry runs need no privileges.
+func requireInstallRoot(opts internal.InstallOptions) error {
+    if err := internal.RequireRoot(opts.InstallRoot()); err != nil && !opts.DryRun {
+        return &internal.PackageError{
+            Code:     1,
+            Message:  "Root privileges required for installation",
+            Type:     internal.TypeUnknown,
+            Original: err,
+        }
+    }
+    return nil
+}
+
+// installPackage runs the pre-install checks and installs pkg, opened
+// from absPath by the caller
+func installPackage(ctx context.Context, absPath string, pkg internal.Package, opts internal.InstallOptions) error {
+    pkgType := pkg.GetType()
+
+    logger.WithFields(logrus.Fields{
+        "path": absPath,
+        "type": pkgType,
+        "force": opts.Force,
+        "root": opts.InstallRoot(),
+    }).Info("Installing package")
+
+    // Metadata is read once for all checks below; packages whose metadata
+    // can't be read are left to the backend
+    info, err := pkg.GetInfo(ctx)
+    if err != nil {
+        logger.Warnf("Could not read package info: %v", err)
+        info = nil
+    }
+
+    // Refuse packages built for another architecture unless forced
+    if !opts.Force && !opts.IgnoreArch {
+        if err := checkPackageArch(info); err != nil {
+            return &internal.PackageError{
+                Code:     36,
+                Message:  "Package architecture does not match this system (use --ignore-arch to override)",
+                Type:     pkgType,
+                Original: err,
+            }
+        }
+    }
+
+    // Refuse to install over conflicting packages unless forced
+    if !opts.Force && !opts.IsAltRoot() {
+        conflicts, err := findConflicts(ctx, pkg)
+        if err != nil {
+            logger.Warnf("Could not check conflicts: %v", err)
+        } else if len(conflicts) > 0 {
+            return &internal.PackageError{
+                Code:    23,
+                Message: fmt.Sprintf("Package conflicts with installed packages: %s (use --force to override)", strings.Join(conflicts, ", ")),
+                Type:    pkgType,
+            }
+        }
+    }
+
+    err = pkg.Install(ctx, opts)
+
+    if !opts.DryRun {
+        name, version := packageNameVersion(absPath, info)
+        recordHistory(opts.Root, "install", name, version, pkgType, err)
+    }
+
+    if err != nil {
+        return &internal.PackageError{
+            Code:     5,
+            Message:  "Installation failed",
+            Type:     pkgType,
+            Original: err,
+        }
+    }
+
+    return nil
+}
+
+// handleUpgrade installs the package at path only when it is newer than the
+// installed version. Downgrades and reinstalls of the same version are
+// reported as up to date unless allowed through opts.
+func handleUpgrade(ctx context.Context, path string, opts internal.InstallOptions) error {
+    if _, err := os.Stat(path); os.IsNotExist(err) {
+        return &internal.PackageError{
+            Code:     10,
+            Message:  "Package file not found",
+            Type:     internal.TypeUnknown,
+            Original: err,
+        }
+    }
+
+    pkg, err := internal.CreatePackageFromPath(path)
+    if err != nil {
+        return &internal.PackageError{
+            Code:     11,
+            Message:  "Unsupported package format",
+            Type:     resolvePackageType(path),
+            Original: err,
+        }
+    }
+    pkgType := pkg.GetType()
+
+    info, err := pkg.GetInfo(ctx)
+    if err != nil {
+        return &internal.PackageError{
+            Code:     12,
+            Message:  "Could not read package info",
+            Type:     pkgType,
+            Original: err,
+        }
+    }
+
+    installed, found, err := internal.InstalledVersion(pkgType, info.Name)
+    if err != nil {
+        return &internal.PackageError{
+            Code:     15,
+            Message:  "Could not list installed packages",
+            Type:     pkgType,
+            Original: err,
+        }
+    }
+
+    if found {
+        cmp := pkg.Comparator().Compare(info.Version, installed)
+        switch {
+        case cmp == 0 && !opts.Reinstall:
+            fmt.Printf("%s %s is already up to date\n", info.Name, installed)
+            return nil
+        case cmp < 0 && !opts.Downgrade:
+            fmt.Printf("%s is already up to date: installed %s is newer than %s\n", info.Name, installed, info.Version)
+            return nil
+        }
+        logger.WithFields(logrus.Fields{
+            "package":   info.Name,
+            "installed": installed,
+            "version":   info.Version,
+        }).Info("Upgrading package")
+    }
+
+    if err := requireInstallRoot(opts); err != nil {
+        return err
+    }
+    absPath, err := filepath.Abs(path)
+    if err != nil {
+        return &internal.PackageError{
+            Code:     9,
+            Message:  "Invalid package path",
+            Type:     pkgType,
+            Original: err,
+        }
+    }
+
+    opts.Upgrade = true
+    return installPackage(ctx, absPath, pkg, opts)
+}
+
+// checkPackageArch checks the architecture of a package against the host.
+// A nil info means the metadata couldn't be read and passes.
+func checkPackageArch(info *internal.PackageInfo) error {
+    if info == nil {
+        return nil
+    }
+    return internal.CheckArchitecture(info)
+}
+
+// findConflicts returns installed packages that conflict with pkg
+func findConflicts(ctx context.Context, pkg internal.Package) ([]string, error) {
+    installed, err := internal.ListInstalled(pkg.GetType())
+    if err != nil {
+        return nil, err
+    }
+
+    return internal.CheckConflicts(ctx, pkg, installed)
+}
+
+// packageNameVersion returns the name and version from info, falling back
+// to the file name at path when the metadata couldn't be read
+func packageNameVersion(path string, info *internal.PackageInfo) (string, string) {
+    if info != nil {
+        return info.Name, info.Version
+    }
+    return filepath.Base(path), ""
+}
+
+// recordHistory appends an install/remove entry to the transaction log
+func recordHistory(root, action, name, version string, pkgType internal.PackageType, err error) {
+    tx := internal.Transaction{
+        Action:  action,
+        Package: name,
+        Version: version,
+        Backend: pkgType.String(),
+        Result:  internal.ResultSuccess,
+    }
+    if err != nil {
+        tx.Result = internal.ResultFailed
+        tx.Error = err.Error()
+    }
+
+    if err := internal.RecordTransaction(root, tx); err != nil {
+        logger.Warnf("Could not record history: %v", err)
+    }
+}
+
+// installResult is the outcome of one package in a batch install
+type installResult struct {
+    Path   string
+    Status string
+    Err    error
+}
+
+func handleBatchInstall(ctx context.Context, paths []string, opts internal.InstallOptions, keepGoing bool, jobs int) error {
+    if len(paths) == 1 {
+        return handleInstall(ctx, paths[0], opts)
+    }
+
+    installed := "installed"
+    if opts.DryRun {
+        installed = "planned"
+    }
+
+    paths, err := orderInstallPaths(ctx, paths, jobs)
+    if err != nil {
+        return &internal.PackageError{
+            Code:     22,
+            Message:  "Could not resolve install order",
+            Type:     internal.TypeUnknown,
+            Original: err,
+        }
+    }
+
+    results := make([]installResult, 0, len(paths))
+    failed := 0
+    for i, path := range paths {
+        err := handleInstall(ctx, path, opts)
+        if err == nil {
+            results = append(results, installResult{Path: path, Status: installed})
+            continue
+        }
+
+        failed++
+        logger.Errorf("Failed to install %s: %v", path, err)
+        results = append(results, installResult{Path: path, Status: "failed", Err: err})
+
+        // A cancelled or timed out batch stops even with --keep-going
+        if !keepGoing || ctx.Err() != nil {
+            for _, rest := range paths[i+1:] {
+                results = append(results, installResult{Path: rest, Status: "skipped"})
+            }
+            break
+        }
+    }
+
+    printInstallSummary(results)
+
+    if failed > 0 {
+        return &internal.PackageError{
+            Code:    21,
+            Message: fmt.Sprintf("%d of %d packages failed to install", failed, len(paths)),
+            Type:    internal.TypeUnknown,
+        }
+    }
+    return nil
+}
+
+// orderInstallPaths sorts package paths so that dependencies within the
+// set are installed first. If any package cannot be opened the argument
+// order is kept and the failure surfaces in handleInstall.
+func orderInstallPaths(ctx context.Context, paths []string, jobs int) ([]string, error) {
+    pkgs, err := preflightPackages(ctx, paths, jobs)
+    if err != nil {
+        return nil, err
+    }
+    if pkgs == nil {
+        return paths, nil
+    }
+    pkgPaths := make(map[internal.Package]string)
+    for i, pkg := range pkgs {
+        pkgPaths[pkg] = paths[i]
+    }
+
+    // The packages cache their info, so this doesn't read them again
+    ordered, err := internal.ResolveInstallOrder(ctx, pkgs)
+    if err != nil {
+        return nil, err
+    }
+
+    result := make([]string, len(ordered))
+    for i, pkg := range ordered {
+        result[i] = pkgPaths[pkg]
+    }
+    return result, nil
+}
+
+// preflightPackages opens, validates and reads the metadata of the packages
+// at paths with up to jobs of them in parallel before the serial install
+// step. It returns nil packages when a path is not a package the ordering
+// can handle.
+func preflightPackages(ctx context.Context, paths []string, jobs int) ([]internal.Package, error) {
+    start := time.Now()
+    pkgs := make([]internal.Package, len(paths))
+    unsupported := make([]bool, len(paths))
+    errs := internal.RunConcurrent(ctx, len(paths), jobs, func(i int) error {
+        pkg, err := internal.CreatePackageFromPath(paths[i])
+        if err != nil {
+            logger.WithField("path", paths[i]).Debugf("Not ordering package: %v", err)
+            unsupported[i] = true
+            return nil
+        }
+        if err := pkg.Validate(); err != nil {
+            return fmt.Errorf("invalid package %s: %w", paths[i], err)
+        }
+        if _, err := pkg.GetInfo(ctx); err != nil {
+            return fmt.Errorf("failed to read package info for %s: %w", paths[i], err)
+        }
+        pkgs[i] = pkg
+        return nil
+    })
+    logger.Debugf("Read %d packages in %s", len(paths), time.Since(start).Round(time.Millisecond))
+
+    for _, skip := range unsupported {
+        if skip {
+            return nil, nil
+        }
+    }
+    if err := errors.Join(errs...); err != nil {
+        return nil, err
+    }
+    return pkgs, nil
+}
+
+// printInstallSummary prints a table of batch install outcomes
+func printInstallSummary(results []installResult) {
+    w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+    fmt.Fprintln(w, "PACKAGE\tSTATUS\tERROR")
+    for _, result := range results {
+        errText := ""
+        if result.Err != nil {
+            errText = result.Err.Error()
+        }
+        fmt.Fprintf(w, "%s\t%s\t%s\n", result.Path, result.Status, errText)
+    }
+    w.Flush()
+}
+
+// handleRemove removes an installed package. typeName selects the backend,
+// otherwise the one with the package installed is used; allowEssential
+// together with --force permits removing an essential package
+func handleRemove(ctx context.Context, packageName, typeName string, allowEssential bool, opts internal.RemoveOptions) error {
+    if err := internal.RequireRoot(opts.InstallRoot()); err != nil && !opts.DryRun {
+        return &internal.PackageError{
+            Code:     1,
+            Message:  "Root privileges required for removal",
+            Type:     internal.TypeUnknown,
+            Original: err,
+        }
+    }
+
+    logger.WithFields(logrus.Fields{
+        "package": packageName,
+        "purge":   opts.Purge,
+        "root":    opts.InstallRoot(),
+    }).Info("Removing package")
+
+    // Detect installed package type
+    var pkgType internal.PackageType
+    if typeName != "" {
+        var err error
+        if pkgType, err = hostPackageType(typeName); err != nil {
+            return err
+        }
+        if !internal.IsPackageInstalled(ctx, pkgType, packageName) {
+            pkgType = internal.TypeUnknown
+        }
+    } else {
+        pkgType = detectInstalledPackageType(ctx, packageName)
+    }
+    if pkgType == internal.TypeUnknown {
+        return &internal.PackageError{
+            Code:    7,
+            Message: "Package not found or unknown format",
+            Type:    internal.TypeUnknown,
+        }
+    }
+
+    if internal.IsEssential(packageName, pkgType) {
+        if !opts.Force || !allowEssential {
+            return &internal.PackageError{
+                Code:    46,
+                Message: fmt.Sprintf("%s is an essential package, use --force --i-know-what-im-doing to remove it", packageName),
+                Type:    pkgType,
+            }
+        }
+        logger.Warn(color.New(color.FgRed, color.Bold).Sprintf("Removing essential package %s, the system may become unusable", packageName))
+    }
+
+    if !opts.Force && !opts.NoDeps {
+        if err := checkReverseDependencies(ctx, pkgType, packageName, opts); err != nil {
+            return err
+        }
+    }
+
+    pkg, err := internal.NewInstalledPackage(pkgType, packageName)
+    if err == nil {
+        err = pkg.Remove(ctx, opts)
+    }
+
+    if !opts.DryRun {
+        recordHistory(opts.Root, "remove", packageName, "", pkgType, err)
+    }
+
+    if err != nil {
+        return &internal.PackageError{
+            Code:     8,
+            Message:  "Removal failed",
+            Type:     pkgType,
+            Original: err,
+        }
+    }
+
+    return nil
+}
+
+// checkReverseDependencies refuses to remove a package that installed
+// packages depend on. The native tools only see the host database, so
+// alternate roots are not checked
+func checkReverseDependencies(ctx context.Context, pkgType internal.PackageType, name string, opts internal.RemoveOptions) error {
+    if opts.IsAltRoot() {
+        logger.Debugf("Skipping reverse dependency check for root %s", opts.InstallRoot())
+        return nil
+    }
+
+    rdeps, err := internal.ReverseDependencies(ctx, pkgType, name)
+    if err != nil {
+        logger.Warnf("Could not check reverse dependencies: %v", err)
+        return nil
+    }
+    if len(rdeps) == 0 {
+        return nil
+    }
+
+    fmt.Printf("%s is required by:\n", name)
+    for _, dep := range rdeps {
+        fmt.Printf("  - %s\n", dep)
+    }
+    return &internal.PackageError{
+        Code:     44,
+        Message:  "Package is required by installed packages, use --force to remove anyway",
+        Type:     pkgType,
+        Original: fmt.Errorf("%d installed packages depend on %s", len(rdeps), name),
+    }
+}
+
+func handleWhy(ctx context.Context, name, typeName string, asJSON bool) error {
+    var pkgType internal.PackageType
+    if typeName != "" {
+        var err error
+        if pkgType, err = hostPackageType(typeName); err != nil {
+            return err
+        }
+    } else {
+        pkgType = detectInstalledPackageType(ctx, name)
+    }
+    if pkgType == internal.TypeUnknown {
+        return &internal.PackageError{
+            Code:    7,
+            Message: "Package not found or unknown format",
+            Type:    internal.TypeUnknown,
+        }
+    }
+
+    rdeps, err := internal.ReverseDependencies(ctx, pkgType, name)
+    if err != nil {
+        return &internal.PackageError{
+            Code:     45,
+            Message:  "Could not query reverse dependencies",
+            Type:     pkgType,
+            Original: err,
+        }
+    }
+
+    if asJSON {
+        if rdeps == nil {
+            rdeps = []string{}
+        }
+        encoder := json.NewEncoder(os.Stdout)
+        encoder.SetIndent("", "  ")
+        return encoder.Encode(struct {
+            Name       string   `json:"name"`
+            Type       string   `json:"type"`
+            RequiredBy []string `json:"required_by"`
+        }{name, pkgType.String(), rdeps})
+    }
+
+    if len(rdeps) == 0 {
+        fmt.Printf("No installed package depends on %s\n", name)
+        return nil
+    }
+    fmt.Printf("%s is required by:\n", name)
+    for _, dep := range rdeps {
+        fmt.Printf("  - %s\n", dep)
+    }
+    return nil
+}
+
+func handleInfo(ctx context.Context, path string, asJSON bool, format string, resolve bool) error {
+    absPath, err := filepath.Abs(path)
+    if err != nil {
+        return &internal.PackageError{
+            Code:     9,
+            Message:  "Invalid package path",
+            Type:     internal.TypeUnknown,
+            Original: err,
+        }
+    }
+
+    if _, err := os.Stat(absPath); os.IsNotExist(err) {
+        return &internal.PackageError{
+            Code:     10,
+            Message:  "Package file not found",
+            Type:     internal.TypeUnknown,
+            Original: err,
+        }
+    }
+
+    pkgType := resolvePackageType(absPath)
+    if pkgType == internal.TypeUnknown {
+        return &internal.PackageError{
+            Code:    11,
+            Message: "Unsupported package format",
+            Type:    internal.TypeUnknown,
+        }
+    }
+
+    pkg, err := internal.OpenPackage(absPath)
+    if err != nil {
+        message := "Invalid package"
+        if errors.Is(err, internal.ErrNotSupported) {
+            message = "Unsupported package format"
+        }
+        return &internal.PackageError{
+            Code:     11,
+            Message:  message,
+            Type:     pkgType,
+            Original: err,
+        }
+    }
+
+    info, err := pkg.GetInfo(ctx)
+    if err != nil {
+        return &internal.PackageError{
+            Code:     12,
+            Message:  "Could not read package info",
+            Type:     pkgType,
+            Original: err,
+        }
+    }
+
+    output := infoOutput{PackageInfo: info, Type: pkgType.String()}
+    if resolve {
+        output.DependencyTree = resolveInfoDeps(ctx, pkg)
+    }
+    if asJSON {
+        encoder := json.NewEncoder(os.Stdout)
+        encoder.SetIndent("", "  ")
+        return encoder.Encode(output)
+    }
+
+    if format != "" {
+        text, err := formatInfo(format, output)
+        if err != nil {
+            return &internal.PackageError{
+                Code:     31,
+                Message:  "Invalid format template",
+                Type:     pkgType,
+                Original: err,
+            }
+        }
+        fmt.Println(text)
+        return nil
+    }
+
+    printPackageInfo(info, pkgType)
+    if output.DependencyTree != nil {
+        fmt.Printf("\nDependency Tree:\n")
+        fmt.Println(formatDepNode(output.DependencyTree))
+        printDepTree(output.DependencyTree.Children, "")
+    }
+    return nil
+}
+
+// resolveInfoDeps resolves the transitive dependency tree with the native
+// tools, falling back to direct dependencies when they are unavailable
+func resolveInfoDeps(ctx context.Context, pkg internal.Package) *internal.DepNode {
+    tree, err := internal.ResolveDependencyTree(ctx, pkg, 0)
+    if err == nil {
+        return tree
+    }
+
+    logger.Warnf("Could not resolve dependencies, showing direct dependencies only: %v", err)
+    tree, err = internal.GetDependencyTree(ctx, pkg, 1)
+    if err != nil {
+        logger.Warnf("Could not build dependency tree: %v", err)
+        return nil
+    }
+    return tree
+}
+
+// infoOutput is the package information printed by info --json and
+// available to info --format templates
+type infoOutput struct {
+    *internal.PackageInfo
+    Type           string            `json:"type"`
+    DependencyTree *internal.DepNode `json:"dependency_tree,omitempty"`
+}
+
+// formatInfo renders output with a text/template. The template is fully
+// executed before anything is printed so a bad field name yields only an
+// error.
+func formatInfo(format string, output infoOutput) (string, error) {
+    tmpl, err := template.New("format").Option("missingkey=error").Parse(format)
+    if err != nil {
+        return "", err
+    }
+
+    var buf strings.Builder
+    if err := tmpl.Execute(&buf, output); err != nil {
+        return "", err
+    }
+    return strings.TrimSuffix(buf.String(), "\n"), nil
+}
+
+// infoDirEntry is the info --dir result for one file. Files whose
+// metadata can't be read carry Error instead of the package fields.
+type infoDirEntry struct {
+    Path string `json:"path"`
+    *internal.PackageInfo
+    Type  string `json:"type"`
+    Error string `json:"error,omitempty"`
+}
+
+// handleInfoDir reads the metadata of every package under dir with up to
+// jobs concurrent GetInfo calls and prints them as a JSON array. Errors on
+// single files are reported in their entries and don't stop the scan.
+func handleInfoDir(ctx context.Context, dir string, jobs int) error {
+    var paths []string
+    err := filepath.WalkDir(dir, func(path string, entry os.DirEntry, err error) error {
+        if err != nil {
+            return err
+        }
+        if entry.Type().IsRegular() {
+            paths = append(paths, path)
+        }
+        return nil
+    })
+    if err != nil {
+        return &internal.PackageError{
+            Code:     50,
+            Message:  "Could not scan directory",
+            Type:     internal.TypeUnknown,
+            Original: err,
+        }
+    }
+
+    entries := make([]*infoDirEntry, len(paths))
+    internal.RunConcurrent(ctx, len(paths), jobs, func(i int) error {
+        entries[i] = readInfoEntry(ctx, paths[i])
+        return nil
+    })
+
+    if err := ctx.Err(); err != nil {
+        return &internal.PackageError{
+            Code:     52,
+            Message:  "Directory scan cancelled",
+            Type:     internal.TypeUnknown,
+            Original: err,
+        }
+    }
+
+    // Files that are not packages are left out of the result
+    result := make([]*infoDirEntry, 0, len(entries))
+    failed := 0
+    for _, entry := range entries {
+        if entry == nil {
+            continue
+        }
+        if entry.Error != "" {
+            failed++
+        }
+        result = append(result, entry)
+    }
+    if failed > 0 {
+        logger.Warnf("Could not read %d of %d packages", failed, len(result))
+    }
+
+    encoder := json.NewEncoder(os.Stdout)
+    encoder.SetIndent("", "  ")
+    return encoder.Encode(result)
+}
+
+// readInfoEntry reads the metadata of the package at path for info --dir.
+// It returns nil for files that are not packages.
+func readInfoEntry(ctx context.Context, path string) *infoDirEntry {
+    pkgType := resolvePackageType(path)
+    if pkgType == internal.TypeUnknown {
+        return nil
+    }
+
+    entry := &infoDirEntry{Path: path, Type: pkgType.String()}
+    pkg, err := internal.OpenPackage(path)
+    if err != nil {
+        entry.Error = err.Error()
+        return entry
+    }
+    if entry.PackageInfo, err = pkg.GetInfo(ctx); err != nil {
+        entry.Error = err.Error()
+    }
+    return entry
+}
+
+// printPackageInfo prints package information in human-readable form
+func printPackageInfo(info *internal.PackageInfo, pkgType internal.PackageType) {
+    fmt.Println(color.GreenString("Package Information:"))
+    fmt.Printf("Name: %s\n", info.Name)
+    fmt.Printf("Version: %s\n", info.Version)
+    fmt.Printf("Architecture: %s\n", info.Architecture)
+    fmt.Printf("Size: %s\n", internal.FormatSize(info.Size))
+    fmt.Printf("Installed Size: %s\n", internal.FormatSize(info.InstalledSize))
+    fmt.Printf("Type: %s\n", pkgType)
+
+    if info.Description != "" {
+        fmt.Printf("\nDescription: %s\n", info.Description)
+    }
+
+    if len(info.Dependencies) > 0 {
+        fmt.Printf("\nDependencies:\n")
+        for _, dep := range info.Dependencies {
+            fmt.Printf("  - %s\n", dep)
+        }
+    }
+}
+
+func handleFiles(path string) error {
+    absPath, err := filepath.Abs(path)
+    if err != nil {
+        return &internal.PackageError{
+            Code:     9,
+            Message:  "Invalid package path",
+            Type:     internal.TypeUnknown,
+            Original: err,
+        }
+    }
+
+    pkg, err := internal.CreatePackageFromPath(absPath)
+    if err != nil {
+        return &internal.PackageError{
+            Code:     11,
+            Message:  "Unsupported package format",
+            Type:     resolvePackageType(absPath),
+            Original: err,
+        }
+    }
+
+    files, err := pkg.ListFiles()
+    if err != nil {
+        return &internal.PackageError{
+            Code:     17,
+            Message:  "Could not list package files",
+            Type:     pkg.GetType(),
+            Original: err,
+        }
+    }
+
+    sort.Slice(files, func(i, j int) bool {
+        return files[i].Path < files[j].Path
+    })
+
+    w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+    for _, file := range files {
+        size := "-"
+        if !file.IsDir {
+            size = internal.FormatSize(file.Size)
+        }
+        fmt.Fprintf(w, "%s\t%s\t%s\n", file.Mode, size, file.Path)
+    }
+    return w.Flush()
+}
+
+// sizeReport is the package footprint printed by the size command.
+// InstalledFromFiles is set when the format has no installed-size field
+// and InstalledSize is the sum of the archive's file sizes.
+type sizeReport struct {
+    DownloadSize       int64       `json:"download_size"`
+    InstalledSize      int64       `json:"installed_size"`
+    InstalledFromFiles bool        `json:"installed_from_files"`
+    FileCount          int         `json:"file_count"`
+    Largest            []sizeEntry `json:"largest"`
+}
+
+type sizeEntry struct {
+    Path string `json:"path"`
+    Size int64  `json:"size"`
+}
+
+func handleSize(ctx context.Context, path string, top int, asJSON bool) error {
+    absPath, err := filepath.Abs(path)
+    if err != nil {
+        return &internal.PackageError{
+            Code:     9,
+            Message:  "Invalid package path",
+            Type:     internal.TypeUnknown,
+            Original: err,
+        }
+    }
+
+    pkg, err := internal.CreatePackageFromPath(absPath)
+    if err != nil {
+        return &internal.PackageError{
+            Code:     11,
+            Message:  "Unsupported package format",
+            Type:     resolvePackageType(absPath),
+            Original: err,
+        }
+    }
+
+    info, err := pkg.GetInfo(ctx)
+    if err != nil {
+        return &internal.PackageError{
+            Code:     12,
+            Message:  "Could not read package info",
+            Type:     pkg.GetType(),
+            Original: err,
+        }
+    }
+
+    files, err := pkg.ListFiles()
+    if err != nil {
+        return &internal.PackageError{
+            Code:     17,
+            Message:  "Could not list package files",
+            Type:     pkg.GetType(),
+            Original: err,
+        }
+    }
+
+    report := sizeReport{
+        DownloadSize:  info.Size,
+        InstalledSize: info.InstalledSize,
+    }
+    if fi, err := os.Stat(absPath); err == nil {
+        report.DownloadSize = fi.Size()
+    }
+
+    var regular []internal.FileInfo
+    var total int64
+    for _, file := range files {
+        if file.IsDir {
+            continue
+        }
+        regular = append(regular, file)
+        total += file.Size
+    }
+    report.FileCount = len(regular)
+    if report.InstalledSize == 0 {
+        report.InstalledSize = total
+        report.InstalledFromFiles = true
+    }
+
+    sort.SliceStable(regular, func(i, j int) bool {
+        return regular[i].Size > regular[j].Size
+    })
+    if top >= 0 && len(regular) > top {
+        regular = regular[:top]
+    }
+    report.Largest = []sizeEntry{}
+    for _, file := range regular {
+        report.Largest = append(report.Largest, sizeEntry{file.Path, file.Size})
+    }
+
+    if asJSON {
+        encoder := json.NewEncoder(os.Stdout)
+        encoder.SetIndent("", "  ")
+        return encoder.Encode(report)
+    }
+
+    installedNote := ""
+    if report.InstalledFromFiles {
+        installedNote = " (sum of file sizes)"
+    }
+    fmt.Printf("Download size:  %d (%s)\n", report.DownloadSize, internal.FormatSize(report.DownloadSize))
+    fmt.Printf("Installed size: %d (%s)%s\n", report.InstalledSize, internal.FormatSize(report.InstalledSize), installedNote)
+    fmt.Printf("Files:          %d\n", report.FileCount)
+
+    if len(report.Largest) > 0 {
+        fmt.Printf("\nLargest files:\n")
+        w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', tabwriter.AlignRight)
+        for _, file := range report.Largest {
+            fmt.Fprintf(w, "%s\t%d\t  %s\n", internal.FormatSize(file.Size), file.Size, file.Path)
+        }
+        return w.Flush()
+    }
+    return nil
+}
+
+// handleValidate runs the cheap structural check on every path and reports
+// each result, failing if any package is malformed.
+func handleValidate(paths []string) error {
+    failed := 0
+    for _, path := range paths {
+        pkg, err := internal.CreatePackageFromPath(path)
+        if err == nil {
+            err = pkg.Validate()
+        }
+        if err != nil {
+            fmt.Printf("%s: %s: %v\n", path, color.RedString("INVALID"), err)
+            failed++
+            continue
+        }
+        fmt.Printf("%s: %s\n", path, color.GreenString("OK"))
+    }
+
+    if failed > 0 {
+        return &internal.PackageError{
+            Code:    40,
+            Message: fmt.Sprintf("%d of %d packages failed validation", failed, len(paths)),
+            Type:    internal.TypeUnknown,
+        }
+    }
+    return nil
+}
+
+func handleVerify(path, checksum, hashAlgo string) error {
+    absPath, err := filepath.Abs(path)
+    if err != nil {
+        return &internal.PackageError{
+            Code:     9,
+            Message:  "Invalid package path",
+            Type:     internal.TypeUnknown,
+            Original: err,
+        }
+    }
+
+    pkg, err := internal.CreatePackageFromPath(absPath)
+    if err != nil {
+        return &internal.PackageError{
+            Code:     11,
+            Message:  "Unsupported package format",
+            Type:     resolvePackageType(absPath),
+            Original: err,
+        }
+    }
+
+    logger.WithField("path", absPath).Debug("Verifying package")
+
+    // Report every mismatching file when the format records per-file hashes
+    if files, ok := pkg.(interface {
+        VerifyFiles() ([]string, error)
+    }); ok {
+        mismatched, err := files.VerifyFiles()
+        if err != nil {
+            return &internal.PackageError{
+                Code:     18,
+                Message:  "Package verification failed",
+                Type:     pkg.GetType(),
+                Original: err,
+            }
+        }
+        if len(mismatched) > 0 {
+            for _, path := range mismatched {
+                fmt.Printf("%s: %s\n", path, color.RedString("MISMATCH"))
+            }
+            return &internal.PackageError{
+                Code:     18,
+                Message:  "Package verification failed",
+                Type:     pkg.GetType(),
+                Original: fmt.Errorf("%d files do not match package metadata", len(mismatched)),
+            }
+        }
+    }
+
+    if err := pkg.Verify(); err != nil {
+        return &internal.PackageError{
+            Code:     18,
+            Message:  "Package verification failed",
+            Type:     pkg.GetType(),
+            Original: err,
+        }
+    }
+
+    // Compare the file checksum when one is given
+    algo, err := internal.ParseHashAlgo(hashAlgo)
+    if err != nil {
+        return &internal.PackageError{
+            Code:     37,
+            Message:  "Invalid hash algorithm",
+            Type:     pkg.GetType(),
+            Original: err,
+        }
+    }
+    if checksum != "" {
+        sum, err := internal.CalculateFileHashAlgo(absPath, algo)
+        if err != nil {
+            return &internal.PackageError{
+                Code:     18,
+                Message:  "Package verification failed",
+                Type:     pkg.GetType(),
+                Original: err,
+            }
+        }
+        if !strings.EqualFold(sum, checksum) {
+            return &internal.PackageError{
+                Code:     18,
+                Message:  "Package verification failed",
+                Type:     pkg.GetType(),
+                Original: fmt.Errorf("%w: expected %s, got %s", internal.ErrChecksumMismatch, checksum, sum),
+            }
+        }
+    }
+
+    fmt.Printf("%s: %s\n", pkg, color.GreenString("OK"))
+    return nil
+}
+
+// handleDownload downloads the package at url into dir and prints its path
+func handleDownload(ctx context.Context, url, dir, checksum, hashAlgo string, resume bool) error {
+    algo, err := internal.ParseHashAlgo(hashAlgo)
+    if err != nil {
+        return &internal.PackageError{
+            Code:     37,
+            Message:  "Invalid hash algorithm",
+            Type:     internal.TypeUnknown,
+            Original: err,
+        }
+    }
+
+    path, err := internal.DownloadPackage(ctx, url, internal.DownloadOptions{
+        Dir:          dir,
+        ExpectedHash: checksum,
+        Algo:         algo,
+        Resume:       resume,
+        Progress:     newDownloadPrinter("Downloading"),
+    })
+    if err != nil {
+        return &internal.PackageError{
+            Code:     51,
+            Message:  "Download failed",
+            Type:     internal.TypeUnknown,
+            Original: err,
+        }
+    }
+
+    fmt.Println(path)
+    return nil
+}
+
+func handleChangelog(path string, limit int, since string, asJSON bool) error {
+    absPath, err := filepath.Abs(path)
+    if err != nil {
+        return &internal.PackageError{
+            Code:     9,
+            Message:  "Invalid package path",
+            Type:     internal.TypeUnknown,
+            Original: err,
+        }
+    }
+
+    pkg, err := internal.CreatePackageFromPath(absPath)
+    if err != nil {
+        return &internal.PackageError{
+            Code:     11,
+            Message:  "Unsupported package format",
+            Type:     resolvePackageType(absPath),
+            Original: err,
+        }
+    }
+
+    source, ok := pkg.(interface {
+        GetChangelog() ([]internal.ChangelogEntry, error)
+    })
+    if !ok {
+        return &internal.PackageError{
+            Code:     11,
+            Message:  "Changelog is not supported for this package format",
+            Type:     pkg.GetType(),
+            Original: internal.ErrNotSupported,
+        }
+    }
+
+    entries, err := source.GetChangelog()
+    if err != nil {
+        return &internal.PackageError{
+            Code:     32,
+            Message:  "Could not read changelog",
+            Type:     pkg.GetType(),
+            Original: err,
+        }
+    }
+    if since != "" {
+        entries = internal.ChangelogSince(entries, since, pkg.Comparator())
+    }
+    if limit > 0 && len(entries) > limit {
+        entries = entries[:limit]
+    }
+
+    if asJSON {
+        encoder := json.NewEncoder(os.Stdout)
+        encoder.SetIndent("", "  ")
+        return encoder.Encode(entries)
+    }
+
+    if len(entries) == 0 && since != "" {
+        fmt.Printf("No changelog entries newer than %s\n", since)
+        return nil
+    }
+    if len(entries) == 0 {
+        fmt.Println("No changelog entries")
+        return nil
+    }
+
+    for i, entry := range entries {
+        if i > 0 {
+            fmt.Println()
+        }
+        fmt.Printf("%s  %s  %s\n", color.GreenString(entry.Date.Format("2006-01-02")), entry.Version, entry.Author)
+        for _, line := range strings.Split(entry.Text, "\n") {
+            fmt.Printf("    %s\n", line)
+        }
+    }
+    return nil
+}
+
+func handleDiff(ctx context.Context, oldPath, newPath string, asJSON bool) error {
+    var pkgs []internal.Package
+    for _, path := range []string{oldPath, newPath} {
+        absPath, err := filepath.Abs(path)
+        if err != nil {
+            return &internal.PackageError{
+                Code:     9,
+                Message:  "Invalid package path",
+                Type:     internal.TypeUnknown,
+                Original: err,
+            }
+        }
+
+        pkg, err := internal.CreatePackageFromPath(absPath)
+        if err != nil {
+            return &internal.PackageError{
+                Code:     11,
+                Message:  "Unsupported package format",
+                Type:     resolvePackageType(absPath),
+                Original: err,
+            }
+        }
+        pkgs = append(pkgs, pkg)
+    }
+
+    diff, err := internal.DiffPackages(ctx, pkgs[0], pkgs[1])
+    if err != nil {
+        return &internal.PackageError{
+            Code:     35,
+            Message:  "Could not compare packages",
+            Type:     pkgs[0].GetType(),
+            Original: err,
+        }
+    }
+
+    if asJSON {
+        encoder := json.NewEncoder(os.Stdout)
+        encoder.SetIndent("", "  ")
+        return encoder.Encode(diff)
+    }
+
+    printPackageDiff(diff)
+    return nil
+}
+
+// printPackageDiff prints a package diff, added lines in green and
+// removed lines in red
+func printPackageDiff(diff *internal.PackageDiff) {
+    if diff.IsEmpty() {
+        fmt.Println("Packages are identical")
+        return
+    }
+
+    if diff.OldName != diff.NewName {
+        fmt.Printf("Name: %s -> %s\n", diff.OldName, diff.NewName)
+    } else {
+        fmt.Printf("Name: %s\n", diff.NewName)
+    }
+
+    switch diff.VersionOrder {
+    case 0:
+        fmt.Printf("Version: %s (unchanged)\n", diff.NewVersion)
+    case 1:
+        fmt.Printf("Version: %s -> %s\n", diff.OldVersion, color.GreenString(diff.NewVersion))
+    default:
+        fmt.Printf("Version: %s -> %s (downgrade)\n", diff.OldVersion, color.RedString(diff.NewVersion))
+    }
+
+    if len(diff.AddedDeps) > 0 || len(diff.RemovedDeps) > 0 {
+        fmt.Println("\nDependencies:")
+        for _, dep := range diff.AddedDeps {
+            fmt.Println(color.GreenString("  + %s", dep))
+        }
+        for _, dep := range diff.RemovedDeps {
+            fmt.Println(color.RedString("  - %s", dep))
+        }
+    }
+
+    if len(diff.AddedFiles) > 0 || len(diff.RemovedFiles) > 0 || len(diff.ModifiedFiles) > 0 {
+        fmt.Println("\nFiles:")
+        for _, path := range diff.AddedFiles {
+            fmt.Println(color.GreenString("  + %s", path))
+        }
+        for _, path := range diff.RemovedFiles {
+            fmt.Println(color.RedString("  - %s", path))
+        }
+        for _, change := range diff.ModifiedFiles {
+            fmt.Println(color.YellowString("  ~ %s (%s -> %s)", change.Path,
+                internal.FormatSize(change.OldSize), internal.FormatSize(change.NewSize)))
+        }
+    }
+}
+
+func handleExtract(path, dest string) error {
+    absPath, err := filepath.Abs(path)
+    if err != nil {
+        return &internal.PackageError{
+            Code:     9,
+            Message:  "Invalid package path",
+            Type:     internal.TypeUnknown,
+            Original: err,
+        }
+    }
+
+    pkg, err := internal.CreatePackageFromPath(absPath)
+    if err != nil {
+        return &internal.PackageError{
+            Code:     11,
+            Message:  "Unsupported package format",
+            Type:     resolvePackageType(absPath),
+            Original: err,
+        }
+    }
+
+    logger.WithFields(logrus.Fields{
+        "path": absPath,
+        "dest": dest,
+    }).Info("Extracting package")
+
+    if err := pkg.Extract(dest); err != nil {
+        return &internal.PackageError{
+            Code:     19,
+            Message:  "Extraction failed",
+            Type:     pkg.GetType(),
+            Original: err,
+        }
+    }
+
+    logger.Info("Package extracted successfully")
+    return nil
+}
+
+func handleConvert(ctx context.Context, path, targetName, outDir string) error {
+    target, err := internal.ParsePackageType(targetName)
+    if err != nil {
+        return &internal.PackageError{
+            Code:     13,
+            Message:  "Invalid package type",
+            Type:     internal.TypeUnknown,
+            Original: err,
+        }
+    }
+
+    absPath, err := filepath.Abs(path)
+    if err != nil {
+        return &internal.PackageError{
+            Code:     9,
+            Message:  "Invalid package path",
+            Type:     internal.TypeUnknown,
+            Original: err,
+        }
+    }
+
+    pkg, err := internal.CreatePackageFromPath(absPath)
+    if err != nil {
+        return &internal.PackageError{
+            Code:     11,
+            Message:  "Unsupported package format",
+            Type:     resolvePackageType(absPath),
+            Original: err,
+        }
+    }
+
+    logger.WithFields(logrus.Fields{
+        "path": absPath,
+        "from": pkg.GetType(),
+        "to":   target,
+    }).Info("Converting package")
+
+    outPath, err := internal.ConvertTo(ctx, pkg, target, outDir)
+    if err != nil {
+        return &internal.PackageError{
+            Code:     20,
+            Message:  "Conversion failed",
+            Type:     pkg.GetType(),
+            Original: err,
+        }
+    }
+
+    fmt.Println(outPath)
+    return nil
+}
+
+// repackChanges builds the EditMetadata changes from the repack flags.
+// Fields are given as KEY=VALUE in the package's own metadata syntax
+func repackChanges(version string, depends, fields []string) (map[string]string, error) {
+    changes := make(map[string]string)
+    for _, field := range fields {
+        key, value, ok := strings.Cut(field, "=")
+        if !ok || strings.TrimSpace(key) == "" {
+            return nil, fmt.Errorf("invalid field %q, expected KEY=VALUE", field)
+        }
+        changes[strings.TrimSpace(key)] = value
+    }
+    if version != "" {
+        changes[internal.MetaVersion] = version
+    }
+    if len(depends) > 0 {
+        changes[internal.MetaAddDepend] = strings.Join(depends, ",")
+    }
+    if len(changes) == 0 {
+        return nil, fmt.Errorf("nothing to change, use --set-version, --add-depend or --set")
+    }
+    return changes, nil
+}
+
+func handleRepack(path, out string, changes map[string]string) error {
+    absPath, err := filepath.Abs(path)
+    if err != nil {
+        return &internal.PackageError{
+            Code:     9,
+            Message:  "Invalid package path",
+            Type:     internal.TypeUnknown,
+            Original: err,
+        }
+    }
+
+    pkg, err := internal.CreatePackageFromPath(absPath)
+    if err != nil {
+        return &internal.PackageError{
+            Code:     11,
+            Message:  "Unsupported package format",
+            Type:     resolvePackageType(absPath),
+            Original: err,
+        }
+    }
+
+    repacker, ok := pkg.(interface {
+        EditMetadata(changes map[string]string) error
+        Repack(out string) error
+    })
+    if !ok {
+        return &internal.PackageError{
+            Code:     11,
+            Message:  "Repacking is not supported for this package format",
+            Type:     pkg.GetType(),
+            Original: internal.ErrNotSupported,
+        }
+    }
+
+    logger.WithFields(logrus.Fields{
+        "path": absPath,
+        "out":  out,
+    }).Info("Repacking package")
+
+    if err := repacker.EditMetadata(changes); err != nil {
+        return &internal.PackageError{
+            Code:     42,
+            Message:  "Invalid metadata change",
+            Type:     pkg.GetType(),
+            Original: err,
+        }
+    }
+    if err := repacker.Repack(out); err != nil {
+        return &internal.PackageError{
+            Code:     43,
+            Message:  "Repack failed",
+            Type:     pkg.GetType(),
+            Original: err,
+        }
+    }
+
+    fmt.Println(out)
+    return nil
+}
+
+func handleDeps(ctx context.Context, path string, depth int, asJSON bool) error {
+    absPath, err := filepath.Abs(path)
+    if err != nil {
+        return &internal.PackageError{
+            Code:     9,
+            Message:  "Invalid package path",
+            Type:     internal.TypeUnknown,
+            Original: err,
+        }
+    }
+
+    pkg, err := internal.CreatePackageFromPath(absPath)
+    if err != nil {
+        return &internal.PackageError{
+            Code:     11,
+            Message:  "Unsupported package format",
+            Type:     resolvePackageType(absPath),
+            Original: err,
+        }
+    }
+
+    tree, err := internal.GetDependencyTree(ctx, pkg, depth)
+    if err != nil {
+        return &internal.PackageError{
+            Code:     24,
+            Message:  "Could not build dependency tree",
+            Type:     pkg.GetType(),
+            Original: err,
+        }
+    }
+
+    if asJSON {
+        encoder := json.NewEncoder(os.Stdout)
+        encoder.SetIndent("", "  ")
+        return encoder.Encode(tree)
+    }
+
+    fmt.Println(formatDepNode(tree))
+    printDepTree(tree.Children, "")
+    return nil
+}
+
+// printDepTree prints dependency nodes as an indented tree
+func printDepTree(nodes []*internal.DepNode, prefix string) {
+    for i, node := range nodes {
+        branch, indent := "├── ", "│   "
+        if i == len(nodes)-1 {
+            branch, indent = "└── ", "    "
+        }
+        fmt.Printf("%s%s%s\n", prefix, branch, formatDepNode(node))
+        printDepTree(node.Children, prefix+indent)
+    }
+}
+
+func formatDepNode(node *internal.DepNode) string {
+    if node.Version == "" {
+        return node.Name
+    }
+    return fmt.Sprintf("%s %s", node.Name, color.New(color.Faint).Sprint(node.Version))
+}
+
+func handleHistory(root string, limit int, asJSON bool) error {
+    entries, err := internal.ReadHistory(root, limit)
+    if err != nil {
+        return &internal.PackageError{
+            Code:     25,
+            Message:  "Could not read history",
+            Type:     internal.TypeUnknown,
+            Original: err,
+        }
+    }
+
+    if asJSON {
+        if entries == nil {
+            entries = []internal.Transaction{}
+        }
+        encoder := json.NewEncoder(os.Stdout)
+        encoder.SetIndent("", "  ")
+        return encoder.Encode(entries)
+    }
+
+    w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+    fmt.Fprintln(w, "TIME\tACTION\tPACKAGE\tVERSION\tBACKEND\tRESULT")
+    for _, tx := range entries {
+        result := color.GreenString(tx.Result)
+        if tx.Result != internal.ResultSuccess {
+            result = color.RedString(tx.Result)
+        }
+        fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n",
+            tx.Time.Local().Format("2006-01-02 15:04:05"),
+            tx.Action, tx.Package, tx.Version, tx.Backend, result)
+    }
+    return w.Flush()
+}
+
+func handleRollback(args []string, dest string) error {
+    backups, err := internal.ListBackups()
+    if err != nil {
+        return &internal.PackageError{
+            Code:     26,
+            Message:  "Could not list backups",
+            Type:     internal.TypeUnknown,
+            Original: err,
+        }
+    }
+
+    if len(args) == 0 {
+        if len(backups) == 0 {
+            fmt.Println("No backups found in", internal.BackupDir)
+            return nil
+        }
+
+        w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+        fmt.Fprintln(w, "#\tCREATED\tSOURCE\tSIZE\tFILE")
+        for i, backup := range backups {
+            source := backup.Source
+            if source == "" {
+                source = backup.Name
+            }
+            fmt.Fprintf(w, "%d\t%s\t%s\t%s\t%s\n", i+1,
+                backup.Time.Format("2006-01-02 15:04:05"), source,
+                internal.FormatSize(backup.Size), filepath.Base(backup.Path))
+        }
+        return w.Flush()
+    }
+
+    // The backup is chosen by its number in the listing or by file name
+    var backupPath string
+    if n, err := strconv.Atoi(args[0]); err == nil && n >= 1 && n <= len(backups) {
+        backupPath = backups[n-1].Path
+    } else {
+        for _, backup := range backups {
+            if args[0] == backup.Path || args[0] == filepath.Base(backup.Path) {
+                backupPath = backup.Path
+                break
+            }
+        }
+    }
+    if backupPath == "" {
+        return &internal.PackageError{
+            Code:    27,
+            Message: fmt.Sprintf("Backup %q not found", args[0]),
+            Type:    internal.TypeUnknown,
+        }
+    }
+
+    if err := internal.RequireRoot(internal.DefaultInstallRoot); err != nil {
+        return &internal.PackageError{
+            Code:     1,
+            Message:  "Root privileges required for rollback",
+            Type:     internal.TypeUnknown,
+            Original: err,
+        }
+    }
+
+    if err := internal.RestoreBackup(backupPath, dest, newProgressPrinter("Restoring")); err != nil {
+        return &internal.PackageError{
+            Code:     28,
+            Message:  "Rollback failed",
+            Type:     internal.TypeUnknown,
+            Original: err,
+        }
+    }
+    return nil
+}
+
+// handleClean removes stale files from the cache and temp directories,
+// everything in them with all, and prunes backups when asked.
+func handleClean(backups, all bool, keep int, maxAge, olderThan time.Duration) error {
+    if all {
+        olderThan = 0
+    }
+
+    for _, dir := range []string{internal.CacheDir, internal.TempDir} {
+        reclaimed, err := internal.CleanDirectory(dir, olderThan)
+        if err != nil {
+            return &internal.PackageError{
+                Code:     39,
+                Message:  "Could not clean " + dir,
+                Type:     internal.TypeUnknown,
+                Original: err,
+            }
+        }
+        fmt.Printf("Reclaimed %s from %s\n", internal.FormatSize(reclaimed), dir)
+    }
+
+    if !backups {
+        return nil
+    }
+
+    if err := internal.RequireRoot(internal.DefaultInstallRoot); err != nil {
+        return &internal.PackageError{
+            Code:     1,
+            Message:  "Root privileges required for cleaning",
+            Type:     internal.TypeUnknown,
+            Original: err,
+        }
+    }
+
+    if err := internal.PruneBackups(keep, maxAge); err != nil {
+        return &internal.PackageError{
+            Code:     30,
+            Message:  "Could not prune backups",
+            Type:     internal.TypeUnknown,
+            Original: err,
+        }
+    }
+    return nil
+}
+
+// configureLogging applies --verbose, --quiet, --log-level and --log-json
+// to both the CLI and the internal package loggers
+func configureLogging() error {
+    level := logrus.InfoLevel
+    switch {
+    case logLevel != "":
+        parsed, err := logrus.ParseLevel(logLevel)
+        if err != nil {
+            return &internal.PackageError{
+                Code:     33,
+                Message:  "Invalid log level",
+                Type:     internal.TypeUnknown,
+                Original: err,
+            }
+        }
+        level = parsed
+    case verbose:
+        level = logrus.DebugLevel
+    case quiet:
+        level = logrus.ErrorLevel
+    }
+    logger.SetLevel(level)
+    internal.SetLogLevel(level)
+
+    if logJSON {
+        logger.SetFormatter(&logrus.JSONFormatter{})
+        internal.SetLogFormatter(&logrus.JSONFormatter{})
+    }
+    return nil
+}
+
+// configFiles lists config files in increasing priority; "~" is the
+// user's home directory.
+var configFiles = []string{
+    "/etc/upkgt/config.toml",
+    "~/.config/upkgt/config.toml",
+}
+
+// loadConfig applies defaults from the config files and UPKGT_* environment
+// variables. Precedence is flag > env > file > built-in default: a value is
+// only used for flags not given on the command line.
+func loadConfig(cmd *cobra.Command) error {
+    v := viper.New()
+    v.SetConfigType("toml")
+    v.SetEnvPrefix("UPKGT")
+    v.AutomaticEnv()
+
+    for _, path := range configFiles {
+        if strings.HasPrefix(path, "~/") {
+            home, err := os.UserHomeDir()
+            if err != nil {
+                continue
+            }
+            path = filepath.Join(home, path[2:])
+        }
+        if _, err := os.Stat(path); err != nil {
+            continue
+        }
+
+        v.SetConfigFile(path)
+        if err := v.MergeInConfig(); err != nil {
+            return &internal.PackageError{
+                Code:     38,
+                Message:  "Invalid configuration file",
+                Type:     internal.TypeUnknown,
+                Original: err,
+            }
+        }
+        logger.WithField("path", path).Debug("Loaded configuration")
+    }
+
+    if v.IsSet("backup_dir") {
+        internal.BackupDir = v.GetString("backup_dir")
+    }
+    if v.IsSet("keep_backups") {
+        internal.BackupKeep = v.GetInt("keep_backups")
+    }
+    if v.IsSet("prefer_native_parsers") {
+        internal.PreferNativeParsers = v.GetBool("prefer_native_parsers")
+    }
+    if v.IsSet("preserve_locale") {
+        internal.PreserveLocale = v.GetBool("preserve_locale")
+    }
+    if v.IsSet("rpm_internal_deps") {
+        internal.ShowRPMInternalDeps = v.GetBool("rpm_internal_deps")
+    }
+
+    // Flags set explicitly keep their values
+    flags := cmd.Flags()
+    changed := func(name string) bool {
+        f := flags.Lookup(name)
+        return f != nil && f.Changed
+    }
+    if changed("preserve-locale") {
+        internal.PreserveLocale = preserveLocale
+    }
+    if noCache {
+        internal.UseInfoCache = false
+    }
+    setFlag := func(name, key string) error {
+        f := flags.Lookup(name)
+        if f == nil || f.Changed || !v.IsSet(key) {
+            return nil
+        }
+        if err := f.Value.Set(v.GetString(key)); err != nil {
+            return &internal.PackageError{
+                Code:     38,
+                Message:  "Invalid configuration file",
+                Type:     internal.TypeUnknown,
+                Original: fmt.Errorf("%s: %w", key, err),
+            }
+        }
+        return nil
+    }
+
+    if err := setFlag("root", "default_root"); err != nil {
+        return err
+    }
+    if err := setFlag("keep", "keep_backups"); err != nil {
+        return err
+    }
+    // --verbose and --quiet also choose the log level
+    if !changed("verbose") && !changed("quiet") {
+        if err := setFlag("log-level", "log_level"); err != nil {
+            return err
+        }
+    }
+    return nil
+}
 
-type PackageType int
+// lockDatabase takes the upkgt lock for root and returns a function that
+// releases it. Dry runs, --no-lock and unprivileged runs (which fail the
+// root check later) skip locking.
+func lockDatabase(root string, dryRun bool) (func(), error) {
+    if noLock || dryRun || internal.RequireRoot(root) != nil {
+        return func() {}, nil
+    }
 
-const (
-    TypeUnknown PackageType = iota
-    TypeDeb
-    TypeRPM 
-    TypeEopkg
-    TypePacman
-    TypeAPK
-)
+    lock, err := internal.AcquireLock(root)
+    if err != nil {
+        return nil, &internal.PackageError{
+            Code:     34,
+            Message:  "Could not acquire lock (use --no-lock to override)",
+            Type:     internal.TypeUnknown,
+            Original: err,
+        }
+    }
 
-func (pt PackageType) String() string {
-    return [...]string{"unknown", "deb", "rpm", "eopkg", "pacman", "apk"}[pt]
+    return func() {
+        if err := lock.Release(); err != nil {
+            logger.Warnf("Could not release lock: %v", err)
+        }
+    }, nil
 }
 
-type PackageError struct {
-    Code    int
-    Message string 
-    Type    PackageType
-    Err     error
-}
+// newProgressPrinter returns a ProgressFunc that prints a percentage to
+// stderr, or nil when stderr is not a terminal or logs are quiet or JSON
+func newProgressPrinter(label string) internal.ProgressFunc {
+    if quiet || logJSON {
+        return nil
+    }
+    if fi, err := os.Stderr.Stat(); err != nil || fi.Mode()&os.ModeCharDevice == 0 {
+        return nil
+    }
 
-func (e *PackageError) Error() string {
-    if e.Err != nil {
-        return fmt.Sprintf("[%s] %s: %v", e.Type, e.Message, e.Err)
+    last := -1
+    return func(done, total int64) {
+        if total <= 0 {
+            return
+        }
+        percent := int(done * 100 / total)
+        if percent == last {
+            return
+        }
+        last = percent
+        fmt.Fprintf(os.Stderr, "\r%s: %3d%%", label, percent)
+        if done >= total {
+            fmt.Fprintln(os.Stderr)
+            last = -1
+        }
     }
-    return fmt.Sprintf("[%s] %s", e.Type, e.Message)
 }
 
-func init() {
-    logger.SetFormatter(&logrus.TextFormatter{
-        FullTimestamp:   true,
-        TimestampFormat: "2006-01-02 15:04:05",
-    })
-    logger.SetOutput(os.Stdout)
-}
+// newDownloadPrinter returns a ProgressFunc that prints downloaded and total
+// bytes with an estimate of the time left. Like newProgressPrinter it is
+// nil when stderr is not a terminal. The rate counts only bytes received
+// since the first call, so a resumed download doesn't skew it.
+func newDownloadPrinter(label string) internal.ProgressFunc {
+    if quiet || logJSON {
+        return nil
+    }
+    if fi, err := os.Stderr.Stat(); err != nil || fi.Mode()&os.ModeCharDevice == 0 {
+        return nil
+    }
+
+    var start time.Time
+    var startDone int64
+    var last time.Time
+    return func(done, total int64) {
+        if total <= 0 {
+            return
+        }
+        now := time.Now()
+        if start.IsZero() {
+            start, startDone = now, done
+        }
+        if done < total && now.Sub(last) < 200*time.Millisecond {
+            return
+        }
+        last = now
 
-func detectPackageType(path string) PackageType {
-    ext := strings.ToLower(filepath.Ext(path))
-    switch ext {
-    case ".deb":
-        return TypeDeb
-    case ".rpm":
-        return TypeRPM
-    case ".eopkg":
-        return TypeEopkg
-    case ".apk":
-        return TypeAPK
+        eta := "--:--"
+        if elapsed := now.Sub(start).Seconds(); elapsed > 0 && done > startDone {
+            rate := float64(done-startDone) / elapsed
+            left := time.Duration(float64(total-done) / rate * float64(time.Second))
+            eta = fmt.Sprintf("%02d:%02d", int(left.Minutes()), int(left.Seconds())%60)
+        }
+        fmt.Fprintf(os.Stderr, "\r%s: %s / %s %3d%% ETA %s   ", label,
+            internal.FormatSize(done), internal.FormatSize(total), int(done*100/total), eta)
+        if done >= total {
+            fmt.Fprintln(os.Stderr)
+        }
     }
-    
-    // Check for pacman packages (.pkg.tar.*)
-    if strings.HasPrefix(filepath.Base(path), "pkg.tar.") {
-        return TypePacman
+}
+
+// commandContext returns the command's context, bounded by --timeout when set
+func commandContext(cmd *cobra.Command) (context.Context, context.CancelFunc) {
+    if timeout > 0 {
+        return context.WithTimeout(cmd.Context(), timeout)
     }
-    
-    return TypeUnknown
+    return context.WithCancel(cmd.Context())
 }
 
-func isRoot() bool {
-    return os.Geteuid() == 0 
+// formatRequirements lists the tools each package format needs to read
+// packages, list their files and install or remove them. An empty tool
+// means upkgt handles it natively.
+var formatRequirements = []struct {
+    Type    internal.PackageType
+    Read    string
+    Files   string
+    Install string
+}{
+    {internal.TypeDeb, "", "dpkg-deb", "dpkg"},
+    {internal.TypeRPM, "rpm", "rpm", "rpm"},
+    {internal.TypePacman, "", "", "pacman"},
+    {internal.TypeAPK, "", "", "apk"},
+    {internal.TypeEopkg, "", "", "eopkg"},
 }
 
-func handleInstall(path string, force bool) error {
-    if !isRoot() {
-        return &PackageError{
-            Code:    1,
-            Message: "Root privileges required for installation",
-            Type:    TypeUnknown,
+// handleDoctor reports the environment upkgt runs in: privileges, state
+// directories, backends and what each package format needs. It fails when
+// no backend is available to install or remove packages.
+func handleDoctor() error {
+    fmt.Println("System:")
+    fmt.Printf("  upkgt    %s\n", ProgramVersion)
+    fmt.Printf("  Go       %s\n", runtime.Version())
+    fmt.Printf("  OS/Arch  %s/%s\n", runtime.GOOS, runtime.GOARCH)
+    if internal.CheckRoot() {
+        fmt.Printf("  Root     %s\n", color.GreenString("yes"))
+    } else {
+        fmt.Printf("  Root     %s (install and remove need root)\n", color.YellowString("no"))
+    }
+
+    fmt.Println("\nState directories:")
+    for _, dir := range []string{internal.BackupDir, internal.DBDir, internal.CacheDir, internal.TempDir} {
+        if err := internal.CheckWritable(dir); err != nil {
+            fmt.Printf("  %-20s %s (%v)\n", dir, color.RedString("not writable"), err)
+            continue
         }
+        fmt.Printf("  %-20s %s\n", dir, color.GreenString("writable"))
     }
 
-    absPath, err := filepath.Abs(path)
-    if err != nil {
-        return &PackageError{
-            Code:    2,
-            Message: "Invalid package path",
-            Type:    TypeUnknown,
-            Err:     err,
+    available := make(map[internal.PackageType]bool)
+    for _, pt := range internal.DetectAvailableManagers() {
+        available[pt] = true
+    }
+
+    fmt.Println("\nBackends:")
+    for _, pt := range []internal.PackageType{internal.TypeDeb, internal.TypeRPM, internal.TypePacman, internal.TypeAPK, internal.TypeEopkg} {
+        status := color.RedString("not found")
+        if available[pt] {
+            status = color.GreenString("available")
         }
+        fmt.Printf("  %-8s %-8s %s\n", pt, internal.BackendBinary(pt), status)
     }
 
-    if _, err := os.Stat(absPath); os.IsNotExist(err) {
-        return &PackageError{
-            Code:    3,
-            Message: "Package file not found",
-            Type:    TypeUnknown,
-            Err:     err,
+    // "native" or the tool with whether it is installed. Not colored, as
+    // escape codes would break the tabwriter alignment
+    requirement := func(tool string) string {
+        if tool == "" {
+            return "native"
         }
+        if _, err := exec.LookPath(tool); err != nil {
+            return tool + " (missing)"
+        }
+        return tool + " (found)"
     }
 
-    pkgType := detectPackageType(absPath)
-    if pkgType == TypeUnknown {
-        return &PackageError{
-            Code:    4,
-            Message: "Unsupported package format",
-            Type:    TypeUnknown,
+    fmt.Println("\nFormats:")
+    w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+    fmt.Fprintln(w, "  FORMAT\tREAD\tFILES\tINSTALL/REMOVE")
+    for _, format := range formatRequirements {
+        fmt.Fprintf(w, "  %s\t%s\t%s\t%s\n", format.Type, requirement(format.Read), requirement(format.Files), requirement(format.Install))
+    }
+    w.Flush()
+
+    if len(available) == 0 {
+        return &internal.PackageError{
+            Code:    41,
+            Message: "No package backend available on this host",
+            Type:    internal.TypeUnknown,
         }
     }
+    return nil
+}
 
-    logger.WithFields(logrus.Fields{
-        "path": absPath,
-        "type": pkgType,
-        "force": force,
-    }).Info("Installing package")
+// hostPackageType returns the backend from the --type flag or the
+// host's package manager
+func hostPackageType(typeName string) (internal.PackageType, error) {
+    if typeName != "" {
+        pkgType, err := internal.ParsePackageType(typeName)
+        if err != nil {
+            return internal.TypeUnknown, &internal.PackageError{
+                Code:     13,
+                Message:  "Invalid package type",
+                Type:     internal.TypeUnknown,
+                Original: err,
+            }
+        }
+        return pkgType, nil
+    }
 
-    // Create backup
-    backupDir := "/var/backups/upkgt"
-    if err := os.MkdirAll(backupDir, 0755); err != nil {
-        logger.Warn("Could not create backup directory")
+    pkgType := internal.DetectHostPackageType()
+    if pkgType == internal.TypeUnknown {
+        return internal.TypeUnknown, &internal.PackageError{
+            Code:    14,
+            Message: "No supported package manager found on this system",
+            Type:    internal.TypeUnknown,
+        }
     }
+    return pkgType, nil
+}
 
-    // Install package based on type
-    switch pkgType {
-    case TypeDeb:
-        err = installDeb(absPath, force)
-    case TypeRPM:
-        err = installRPM(absPath, force)
-    case TypeEopkg:
-        err = installEopkg(absPath, force)
-    case TypePacman:
-        err = installPacman(absPath, force)
-    case TypeAPK:
-        err = installAPK(absPath, force)
+func handleList(typeName string, asJSON bool) error {
+    pkgType, err := hostPackageType(typeName)
+    if err != nil {
+        return err
     }
 
+    logger.WithField("type", pkgType).Debug("Listing installed packages")
+
+    packages, err := internal.ListInstalled(pkgType)
     if err != nil {
-        return &PackageError{
-            Code:    5,
-            Message: "Installation failed",
-            Type:    pkgType,
-            Err:     err,
+        return &internal.PackageError{
+            Code:     15,
+            Message:  "Could not list installed packages",
+            Type:     pkgType,
+            Original: err,
         }
     }
 
-    logger.Info("Package installed successfully")
-    return nil
+    if asJSON {
+        encoder := json.NewEncoder(os.Stdout)
+        encoder.SetIndent("", "  ")
+        return encoder.Encode(packages)
+    }
+
+    w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+    fmt.Fprintln(w, "NAME\tVERSION\tARCH")
+    for _, pkg := range packages {
+        fmt.Fprintf(w, "%s\t%s\t%s\n", pkg.Name, pkg.Version, pkg.Architecture)
+    }
+    return w.Flush()
 }
 
-func handleRemove(packageName string, purge bool) error {
-    if !isRoot() {
-        return &PackageError{
-            Code:    6,
-            Message: "Root privileges required for removal",
-            Type:    TypeUnknown,
+func handleIsInstalled(name, typeName, minVersion string) (bool, error) {
+    pkgType, err := hostPackageType(typeName)
+    if err != nil {
+        return false, err
+    }
+
+    // Prefer the backend's own check, it knows about half-removed packages
+    if manager, err := internal.NewPackageManager(pkgType); err == nil {
+        if !manager.IsInstalled(name) {
+            if verbose {
+                fmt.Printf("%s is not installed\n", name)
+            }
+            return false, nil
+        }
+        if minVersion == "" {
+            if verbose {
+                fmt.Printf("%s is installed\n", name)
+            }
+            return true, nil
         }
     }
 
-    logger.WithFields(logrus.Fields{
-        "package": packageName,
-        "purge":   purge,
-    }).Info("Removing package")
+    version, found, err := internal.InstalledVersion(pkgType, name)
+    if err != nil {
+        return false, &internal.PackageError{
+            Code:     15,
+            Message:  "Could not list installed packages",
+            Type:     pkgType,
+            Original: err,
+        }
+    }
+    if !found {
+        if verbose {
+            fmt.Printf("%s is not installed\n", name)
+        }
+        return false, nil
+    }
 
-    // Detect installed package type
-    pkgType := detectInstalledPackageType(packageName)
-    if pkgType == TypeUnknown {
-        return &PackageError{
-            Code:    7,
-            Message: "Package not found or unknown format",
-            Type:    TypeUnknown,
+    if minVersion != "" && internal.CompareVersionsFor(pkgType, version, minVersion) < 0 {
+        if verbose {
+            fmt.Printf("%s %s is installed, older than %s\n", name, version, minVersion)
         }
+        return false, nil
     }
 
-    // Remove package based on type
-    var err error
-    switch pkgType {
-    case TypeDeb:
-        err = removeDeb(packageName, purge)
-    case TypeRPM:
-        err = removeRPM(packageName, purge)
-    case TypeEopkg:
-        err = removeEopkg(packageName, purge)
-    case TypePacman:
-        err = removePacman(packageName, purge)
-    case TypeAPK:
-        err = removeAPK(packageName, purge)
+    if verbose {
+        fmt.Printf("%s %s is installed\n", name, version)
     }
+    return true, nil
+}
 
+func handleSearch(pattern, typeName string, namesOnly bool) error {
+    pkgType, err := hostPackageType(typeName)
     if err != nil {
-        return &PackageError{
-            Code:    8,
-            Message: "Removal failed",
-            Type:    pkgType,
-            Err:     err,
-        }
+        return err
     }
 
-    logger.Info("Package removed successfully")
-    return nil
-}
+    logger.WithFields(logrus.Fields{
+        "pattern":    pattern,
+        "type":       pkgType,
+        "names-only": namesOnly,
+    }).Debug("Searching installed packages")
 
-func handleInfo(path string) error {
-    absPath, err := filepath.Abs(path)
+    packages, err := internal.ListInstalled(pkgType)
     if err != nil {
-        return &PackageError{
-            Code:    9,
-            Message: "Invalid package path",
-            Type:    TypeUnknown,
-            Err:     err,
+        return &internal.PackageError{
+            Code:     15,
+            Message:  "Could not list installed packages",
+            Type:     pkgType,
+            Original: err,
         }
     }
 
-    if _, err := os.Stat(absPath); os.IsNotExist(err) {
-        return &PackageError{
-            Code:    10,
-            Message: "Package file not found",
-            Type:    TypeUnknown,
-            Err:     err,
+    needle := strings.ToLower(pattern)
+    found := 0
+    for i := range packages {
+        pkg := &packages[i]
+        if !strings.Contains(strings.ToLower(pkg.Name), needle) &&
+            (namesOnly || !strings.Contains(strings.ToLower(pkg.Description), needle)) {
+            continue
+        }
+
+        if found > 0 {
+            fmt.Println()
         }
+        printPackageInfo(pkg, pkgType)
+        found++
     }
 
-    pkgType := detectPackageType(absPath)
-    if pkgType == TypeUnknown {
-        return &PackageError{
-            Code:    11,
-            Message: "Unsupported package format",
-            Type:    TypeUnknown,
+    if found == 0 {
+        return &internal.PackageError{
+            Code:    16,
+            Message: fmt.Sprintf("No installed packages match %q", pattern),
+            Type:    pkgType,
         }
     }
 
-    // Get package info based on type
-    var info *PackageInfo
-    switch pkgType {
-    case TypeDeb:
-        info, err = getDebInfo(absPath)
-    case TypeRPM:
-        info, err = getRPMInfo(absPath)
-    case TypeEopkg:
-        info, err = getEopkgInfo(absPath)
-    case TypePacman:
-        info, err = getPacmanInfo(absPath)
-    case TypeAPK:
-        info, err = getAPKInfo(absPath)
+    return nil
+}
+
+// reinstallHelp describes how each backend reinstalls the same version
+const reinstallHelp = "Reinstall the same version (rpm --replacepkgs, eopkg --reinstall, apk fix --reinstall " +
+    "from its repositories; dpkg -i and pacman -U always reinstall)"
+
+// packageFileExts are the file extensions shell completion offers for
+// package paths; pacman packages end in .pkg.tar.zst or .pkg.tar.xz
+var packageFileExts = []string{"deb", "rpm", "apk", "eopkg", "zst", "xz"}
+
+// completePackageFiles completes package file paths
+func completePackageFiles(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+    return packageFileExts, cobra.ShellCompDirectiveFilterFileExt
+}
+
+// completeInstalledPackages completes the name of an installed package from
+// the backend selected with --type or detected on the host. The list is read
+// once per completion request. Without a usable backend it offers nothing
+// instead of failing the completion.
+func completeInstalledPackages(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+    if len(args) > 0 {
+        return nil, cobra.ShellCompDirectiveNoFileComp
     }
 
+    names, err := installedPackageNames(backendType)
     if err != nil {
-        return &PackageError{
-            Code:    12,
-            Message: "Could not read package info",
-            Type:    pkgType,
-            Err:     err,
+        cobra.CompDebugln(fmt.Sprintf("Could not list installed packages: %v", err), true)
+        return nil, cobra.ShellCompDirectiveNoFileComp
+    }
+
+    var matches []string
+    for _, name := range names {
+        if strings.HasPrefix(name, toComplete) {
+            matches = append(matches, name)
         }
     }
+    return matches, cobra.ShellCompDirectiveNoFileComp
+}
 
-    // Print package information
-    fmt.Println(color.GreenString("Package Information:"))
-    fmt.Printf("Name: %s\n", info.Name)
-    fmt.Printf("Version: %s\n", info.Version)
-    fmt.Printf("Architecture: %s\n", info.Architecture)
-    fmt.Printf("Size: %d bytes\n", info.Size)
-    fmt.Printf("Type: %s\n", pkgType)
+// installedPackageNames returns the names of the packages installed with
+// the backend typeName, or the host backend if typeName is empty
+func installedPackageNames(typeName string) ([]string, error) {
+    pkgType, err := hostPackageType(typeName)
+    if err != nil {
+        return nil, err
+    }
+    packages, err := internal.ListInstalled(pkgType)
+    if err != nil {
+        return nil, err
+    }
 
-    if info.Description != "" {
-        fmt.Printf("\nDescription: %s\n", info.Description)
+    names := make([]string, len(packages))
+    for i, pkg := range packages {
+        names[i] = pkg.Name
     }
+    return names, nil
+}
 
-    if len(info.Dependencies) > 0 {
-        fmt.Printf("\nDependencies:\n")
-        for _, dep := range info.Dependencies {
-            fmt.Printf("  - %s\n", dep)
+// handleCompletion writes the completion script for shell to stdout
+func handleCompletion(root *cobra.Command, shell string) error {
+    switch shell {
+    case "bash":
+        return root.GenBashCompletionV2(os.Stdout, true)
+    case "zsh":
+        return root.GenZshCompletion(os.Stdout)
+    case "fish":
+        return root.GenFishCompletion(os.Stdout, true)
+    case "powershell":
+        return root.GenPowerShellCompletionWithDesc(os.Stdout)
+    default:
+        return &internal.PackageError{
+            Code:    54,
+            Message: fmt.Sprintf("Unsupported shell %q (use bash, zsh, fish or powershell)", shell),
+            Type:    internal.TypeUnknown,
         }
     }
-
-    return nil
 }
 
 func main() {
@@ -306,27 +2450,151 @@ Version: %s
 Author:  %s
 Build:   %s
 Go:      %s
-OS/Arch: %s/%s`,
+OS/Arch: %s/%s
+
+Defaults are read from /etc/upkgt/config.toml and ~/.config/upkgt/config.toml
+(keys: backup_dir, default_root, keep_backups, log_level,
+prefer_native_parsers, preserve_locale, rpm_internal_deps) and from
+UPKGT_<KEY> environment variables.
+Precedence: flag > environment > config file > built-in default.
+UPKGT_DB_DIR, UPKGT_CACHE_DIR and UPKGT_TEMP_DIR relocate the remaining
+state directories.
+
+Exit status:
+  0  success
+  1  other failure (is-installed: package not installed)
+  2  another upkgt process holds the lock
+  3  package, file or backup not found
+  4  root privileges or write access required
+  5  malformed, corrupted or unsupported package
+  6  unresolved dependencies or conflicts
+  7  wrong architecture or no usable backend
+  8  invalid arguments, flags or configuration
+  9  refused to remove an essential package
+130  interrupted by Ctrl-C or SIGTERM`,
             ProgramVersion, ProgramAuthor, BuildDate,
             runtime.Version(), runtime.GOOS, runtime.GOARCH,
         ),
-        PersistentPreRun: func(cmd *cobra.Command, args []string) {
-            if verbose {
-                logger.SetLevel(logrus.DebugLevel)
+        PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+            if err := loadConfig(cmd); err != nil {
+                return err
             }
+            return configureLogging()
         },
     }
 
     // Install command
     installCmd := &cobra.Command{
-        Use:   "install [path]",
-        Short: "Install a package",
+        Use:   "install [path...]",
+        Short: "Install one or more packages",
+        Args:  cobra.MinimumNArgs(1),
+        RunE: func(cmd *cobra.Command, args []string) error {
+            unlock, err := lockDatabase(installRoot, dryRun)
+            if err != nil {
+                return err
+            }
+            defer unlock()
+
+            ctx, cancel := commandContext(cmd)
+            defer cancel()
+            return handleBatchInstall(ctx, args, internal.InstallOptions{
+                Root:       installRoot,
+                Force:      force,
+                NoDeps:     noDeps,
+                DryRun:     dryRun,
+                NoBackup:   noBackup,
+                IgnoreArch: ignoreArch,
+                Reinstall:  reinstall,
+                Refresh:    refresh,
+                AssumeYes:  !interactive,
+                Offline:    offline,
+                Progress:   newProgressPrinter("Backing up"),
+
+                AllowUntrusted: allowUntrusted,
+            }, keepGoing, jobs)
+        },
+    }
+    installCmd.Flags().BoolVar(&keepGoing, "keep-going", false, "Continue installing after a failure")
+    installCmd.Flags().BoolVarP(&force, "force", "f", false, "Force installation over conflicts and architecture checks (use --no-deps to skip dependencies)")
+    installCmd.Flags().BoolVar(&noDeps, "no-deps", false, "Skip dependency checks only, unlike --force (dpkg --force-depends, rpm/pacman --nodeps, eopkg --ignore-dependency)")
+    installCmd.Flags().BoolVar(&noDeps, "nodeps", false, "Skip dependency checks")
+    installCmd.Flags().MarkDeprecated("nodeps", "use --no-deps instead")
+    installCmd.Flags().BoolVar(&dryRun, "dry-run", false, "Show what would be done without making changes")
+    installCmd.Flags().BoolVar(&noBackup, "no-backup", false, "Skip package database backup")
+    installCmd.Flags().StringVar(&installRoot, "root", internal.DefaultInstallRoot, "Install into an alternate root directory")
+    installCmd.Flags().DurationVar(&timeout, "timeout", 0, "Abort the backend after this long (0 for no limit)")
+    installCmd.Flags().BoolVar(&ignoreArch, "ignore-arch", false, "Install packages built for another architecture")
+    installCmd.Flags().BoolVar(&noLock, "no-lock", false, "Do not take the upkgt lock")
+    installCmd.Flags().BoolVar(&interactive, "interactive", false, "Let the package manager ask for confirmation instead of assuming yes")
+    installCmd.Flags().BoolVar(&offline, "offline", false, "Install without network access (apk --no-network; no apt-get for deb)")
+    installCmd.Flags().BoolVar(&allowUntrusted, "allow-untrusted", false, "Install unsigned packages or ones signed with unknown keys (apk)")
+    installCmd.Flags().BoolVar(&reinstall, "reinstall", false, reinstallHelp)
+    installCmd.Flags().BoolVar(&refresh, "refresh", false, "Run apt-get update after installing a deb")
+    installCmd.Flags().IntVarP(&jobs, "jobs", "j", 0, "Packages to read and validate concurrently before installing (0 for one per CPU)")
+
+    // Upgrade command
+    upgradeCmd := &cobra.Command{
+        Use:   "upgrade [path]",
+        Short: "Install a package only if it is newer than the installed version",
+        Args:  cobra.ExactArgs(1),
+        RunE: func(cmd *cobra.Command, args []string) error {
+            unlock, err := lockDatabase(installRoot, dryRun)
+            if err != nil {
+                return err
+            }
+            defer unlock()
+
+            ctx, cancel := commandContext(cmd)
+            defer cancel()
+            return handleUpgrade(ctx, args[0], internal.InstallOptions{
+                Root:       installRoot,
+                Force:      force,
+                NoDeps:     noDeps,
+                DryRun:     dryRun,
+                NoBackup:   noBackup,
+                IgnoreArch: ignoreArch,
+                Downgrade:  allowDowngrade,
+                Reinstall:  reinstall,
+                Refresh:    refresh,
+                AssumeYes:  !interactive,
+                Offline:    offline,
+                Progress:   newProgressPrinter("Backing up"),
+
+                AllowUntrusted: allowUntrusted,
+            })
+        },
+    }
+    upgradeCmd.Flags().BoolVar(&allowDowngrade, "downgrade", false, "Also install when the package is older than the installed version")
+    upgradeCmd.Flags().BoolVar(&reinstall, "reinstall", false, reinstallHelp)
+    upgradeCmd.Flags().BoolVar(&refresh, "refresh", false, "Run apt-get update after installing a deb")
+    upgradeCmd.Flags().BoolVarP(&force, "force", "f", false, "Force installation over conflicts and architecture checks")
+    upgradeCmd.Flags().BoolVar(&noDeps, "no-deps", false, "Skip dependency checks")
+    upgradeCmd.Flags().BoolVar(&dryRun, "dry-run", false, "Show what would be done without making changes")
+    upgradeCmd.Flags().BoolVar(&noBackup, "no-backup", false, "Skip package database backup")
+    upgradeCmd.Flags().StringVar(&installRoot, "root", internal.DefaultInstallRoot, "Install into an alternate root directory")
+    upgradeCmd.Flags().DurationVar(&timeout, "timeout", 0, "Abort the backend after this long (0 for no limit)")
+    upgradeCmd.Flags().BoolVar(&ignoreArch, "ignore-arch", false, "Install packages built for another architecture")
+    upgradeCmd.Flags().BoolVar(&noLock, "no-lock", false, "Do not take the upkgt lock")
+    upgradeCmd.Flags().BoolVar(&interactive, "interactive", false, "Let the package manager ask for confirmation instead of assuming yes")
+    upgradeCmd.Flags().BoolVar(&offline, "offline", false, "Install without network access (apk --no-network; no apt-get for deb)")
+    upgradeCmd.Flags().BoolVar(&allowUntrusted, "allow-untrusted", false, "Install unsigned packages or ones signed with unknown keys (apk)")
+
+    // Download command
+    downloadCmd := &cobra.Command{
+        Use:   "download [url]",
+        Short: "Download a package into the cache",
         Args:  cobra.ExactArgs(1),
         RunE: func(cmd *cobra.Command, args []string) error {
-            return handleInstall(args[0], force)
+            ctx, cancel := commandContext(cmd)
+            defer cancel()
+            return handleDownload(ctx, args[0], downloadDir, checksum, hashAlgo, resume)
         },
     }
-    installCmd.Flags().BoolVarP(&force, "force", "f", false, "Force installation")
+    downloadCmd.Flags().StringVarP(&downloadDir, "output-dir", "o", internal.CacheDir, "Directory to download into")
+    downloadCmd.Flags().StringVar(&checksum, "checksum", "", "Expected checksum; a mismatching file is downloaded again once")
+    downloadCmd.Flags().StringVar(&hashAlgo, "hash-algo", "sha256", "Checksum algorithm: md5, sha1, sha256, sha512")
+    downloadCmd.Flags().BoolVar(&resume, "resume", false, "Keep partial downloads and resume them with HTTP Range requests")
+    downloadCmd.Flags().DurationVar(&timeout, "timeout", 0, "Abort the download after this long (0 for no limit)")
 
     // Remove command
     removeCmd := &cobra.Command{
@@ -334,27 +2602,383 @@ OS/Arch: %s/%s`,
         Short: "Remove a package",
         Args:  cobra.ExactArgs(1),
         RunE: func(cmd *cobra.Command, args []string) error {
-            return handleRemove(args[0], purge)
+            unlock, err := lockDatabase(installRoot, dryRun)
+            if err != nil {
+                return err
+            }
+            defer unlock()
+
+            ctx, cancel := commandContext(cmd)
+            defer cancel()
+            return handleRemove(ctx, args[0], backendType, iKnowWhatImDoing, internal.RemoveOptions{
+                Root:       installRoot,
+                Purge:      purge,
+                Force:      force,
+                NoDeps:     noDeps,
+                DryRun:     dryRun,
+                NoBackup:   noBackup,
+                Autoremove: !noAutoremove,
+                AssumeYes:  !interactive,
+                Progress:   newProgressPrinter("Backing up"),
+            })
         },
     }
     removeCmd.Flags().BoolVarP(&purge, "purge", "p", false, "Purge configuration files")
+    removeCmd.Flags().StringVarP(&backendType, "type", "t", "", "Package backend (deb, rpm, eopkg, pacman, apk)")
+    removeCmd.Flags().BoolVarP(&force, "force", "f", false, "Force removal, even if installed packages depend on it")
+    removeCmd.Flags().BoolVar(&iKnowWhatImDoing, "i-know-what-im-doing", false, "Together with --force, allow removing essential packages")
+    removeCmd.Flags().BoolVar(&noDeps, "no-deps", false, "Skip dependency checks only, unlike --force (dpkg --force-depends, rpm/pacman --nodeps, eopkg --ignore-dependency)")
+    removeCmd.Flags().BoolVar(&noDeps, "nodeps", false, "Skip dependency checks")
+    removeCmd.Flags().MarkDeprecated("nodeps", "use --no-deps instead")
+    removeCmd.Flags().BoolVar(&dryRun, "dry-run", false, "Show what would be done without making changes")
+    removeCmd.Flags().BoolVar(&noBackup, "no-backup", false, "Skip package database backup")
+    removeCmd.Flags().BoolVar(&noAutoremove, "no-autoremove", false, "Keep dependencies that are no longer needed (deb: skip apt-get autoremove)")
+    removeCmd.Flags().StringVar(&installRoot, "root", internal.DefaultInstallRoot, "Remove from an alternate root directory")
+    removeCmd.Flags().DurationVar(&timeout, "timeout", 0, "Abort the backend after this long (0 for no limit)")
+    removeCmd.Flags().BoolVar(&noLock, "no-lock", false, "Do not take the upkgt lock")
+    removeCmd.Flags().BoolVar(&interactive, "interactive", false, "Let the package manager ask for confirmation instead of assuming yes")
 
     // Info command
     infoCmd := &cobra.Command{
         Use:   "info [path]",
         Short: "Display package information",
+        Args:  cobra.RangeArgs(0, 1),
+        RunE: func(cmd *cobra.Command, args []string) error {
+            if (infoDir == "") == (len(args) == 0) {
+                return &internal.PackageError{
+                    Code:    49,
+                    Message: "Specify either a package path or --dir",
+                    Type:    internal.TypeUnknown,
+                }
+            }
+            if infoDir != "" {
+                return handleInfoDir(cmd.Context(), infoDir, jobs)
+            }
+            return handleInfo(cmd.Context(), args[0], jsonOutput, infoFormat, infoResolve)
+        },
+    }
+    infoCmd.Flags().BoolVar(&jsonOutput, "json", false, "Output in JSON format")
+    infoCmd.Flags().StringVar(&infoFormat, "format", "", "Format output with a Go template, e.g. '{{.Name}} {{.Version}}'")
+    infoCmd.Flags().BoolVar(&infoResolve, "resolve", false, "Resolve the transitive dependency tree with apt-cache, dnf or pactree")
+    infoCmd.Flags().StringVar(&infoDir, "dir", "", "Read every package under a directory and print a JSON array")
+    infoCmd.Flags().IntVarP(&jobs, "jobs", "j", 0, "Packages to read concurrently with --dir (0 for one per CPU)")
+    infoCmd.MarkFlagsMutuallyExclusive("json", "format")
+    infoCmd.MarkFlagsMutuallyExclusive("dir", "format")
+    infoCmd.MarkFlagsMutuallyExclusive("dir", "resolve")
+
+    // List command
+    listCmd := &cobra.Command{
+        Use:   "list",
+        Short: "List installed packages",
+        Args:  cobra.NoArgs,
+        RunE: func(cmd *cobra.Command, args []string) error {
+            return handleList(backendType, jsonOutput)
+        },
+    }
+    listCmd.Flags().StringVarP(&backendType, "type", "t", "", "Package backend (deb, rpm, eopkg, pacman, apk)")
+    listCmd.Flags().BoolVar(&jsonOutput, "json", false, "Output in JSON format")
+
+    // Search command
+    searchCmd := &cobra.Command{
+        Use:   "search [pattern]",
+        Short: "Search installed packages by name or description",
+        Args:  cobra.ExactArgs(1),
+        RunE: func(cmd *cobra.Command, args []string) error {
+            return handleSearch(args[0], backendType, namesOnly)
+        },
+    }
+    searchCmd.Flags().StringVarP(&backendType, "type", "t", "", "Package backend (deb, rpm, eopkg, pacman, apk)")
+    searchCmd.Flags().BoolVar(&namesOnly, "names-only", false, "Match package names only")
+
+    // Is-installed command
+    isInstalledCmd := &cobra.Command{
+        Use:   "is-installed [name]",
+        Short: "Exit 0 if a package is installed, 1 otherwise",
+        Args:  cobra.ExactArgs(1),
+        RunE: func(cmd *cobra.Command, args []string) error {
+            installed, err := handleIsInstalled(args[0], backendType, minVersion)
+            if err != nil {
+                return err
+            }
+            if !installed {
+                cmd.SilenceErrors = true
+                cmd.SilenceUsage = true
+                return errNotInstalled
+            }
+            return nil
+        },
+    }
+    isInstalledCmd.Flags().StringVarP(&backendType, "type", "t", "", "Package backend (deb, rpm, eopkg, pacman, apk)")
+    isInstalledCmd.Flags().StringVar(&minVersion, "min-version", "", "Require at least this version")
+
+    // Why command
+    whyCmd := &cobra.Command{
+        Use:   "why [name]",
+        Short: "Show which installed packages depend on a package",
+        Args:  cobra.ExactArgs(1),
+        RunE: func(cmd *cobra.Command, args []string) error {
+            ctx, cancel := commandContext(cmd)
+            defer cancel()
+            return handleWhy(ctx, args[0], backendType, jsonOutput)
+        },
+    }
+    whyCmd.Flags().StringVarP(&backendType, "type", "t", "", "Package backend (deb, rpm, pacman, apk)")
+    whyCmd.Flags().BoolVar(&jsonOutput, "json", false, "Output in JSON format")
+
+    // Files command
+    filesCmd := &cobra.Command{
+        Use:   "files [path]",
+        Short: "List files contained in a package",
+        Args:  cobra.ExactArgs(1),
+        RunE: func(cmd *cobra.Command, args []string) error {
+            return handleFiles(args[0])
+        },
+    }
+
+    // Size command
+    sizeCmd := &cobra.Command{
+        Use:   "size [path]",
+        Short: "Summarize the download and installed size of a package",
+        Args:  cobra.ExactArgs(1),
+        RunE: func(cmd *cobra.Command, args []string) error {
+            return handleSize(cmd.Context(), args[0], sizeTop, jsonOutput)
+        },
+    }
+    sizeCmd.Flags().IntVar(&sizeTop, "top", 10, "Number of largest files to list")
+    sizeCmd.Flags().BoolVar(&jsonOutput, "json", false, "Output in JSON format")
+
+    // Deps command
+    depsCmd := &cobra.Command{
+        Use:   "deps [path]",
+        Short: "Print the dependency tree of a package",
+        Args:  cobra.ExactArgs(1),
+        RunE: func(cmd *cobra.Command, args []string) error {
+            return handleDeps(cmd.Context(), args[0], depth, jsonOutput)
+        },
+    }
+    depsCmd.Flags().IntVar(&depth, "depth", 3, "Maximum tree depth (0 for unlimited)")
+    depsCmd.Flags().BoolVar(&jsonOutput, "json", false, "Output in JSON format")
+
+    // Verify command
+    verifyCmd := &cobra.Command{
+        Use:   "verify [path]",
+        Short: "Check package integrity and checksums",
+        Args:  cobra.ExactArgs(1),
+        RunE: func(cmd *cobra.Command, args []string) error {
+            return handleVerify(args[0], checksum, hashAlgo)
+        },
+    }
+    verifyCmd.Flags().StringVar(&checksum, "checksum", "", "Expected checksum of the package file")
+    verifyCmd.Flags().StringVar(&hashAlgo, "hash-algo", "sha256", "Checksum algorithm: md5, sha1, sha256, sha512")
+
+    // Validate command
+    validateCmd := &cobra.Command{
+        Use:   "validate [path...]",
+        Short: "Check package structure without verifying signatures or checksums",
+        Args:  cobra.MinimumNArgs(1),
+        RunE: func(cmd *cobra.Command, args []string) error {
+            return handleValidate(args)
+        },
+    }
+
+    // Changelog command
+    changelogCmd := &cobra.Command{
+        Use:   "changelog [path]",
+        Short: "Show the package changelog (rpm, deb)",
+        Args:  cobra.ExactArgs(1),
+        RunE: func(cmd *cobra.Command, args []string) error {
+            return handleChangelog(args[0], changelogLimit, changelogSince, jsonOutput)
+        },
+    }
+    changelogCmd.Flags().IntVar(&changelogLimit, "limit", 0, "Number of entries to show (0 for all)")
+    changelogCmd.Flags().StringVar(&changelogSince, "since", "", "Only show entries for versions newer than this one")
+    changelogCmd.Flags().BoolVar(&jsonOutput, "json", false, "Output in JSON format")
+
+    // Diff command
+    diffCmd := &cobra.Command{
+        Use:   "diff [old] [new]",
+        Short: "Compare two package files of the same type",
+        Args:  cobra.ExactArgs(2),
+        RunE: func(cmd *cobra.Command, args []string) error {
+            return handleDiff(cmd.Context(), args[0], args[1], jsonOutput)
+        },
+    }
+    diffCmd.Flags().BoolVar(&jsonOutput, "json", false, "Output in JSON format")
+
+    // Extract command
+    extractCmd := &cobra.Command{
+        Use:   "extract [path] [dir]",
+        Short: "Unpack package payload into a directory",
+        Long: `Unpack the package payload into a directory, given as the second
+argument or with --output-dir. When run as root, file owners (numeric
+uid/gid) and modes including setuid bits are kept from the package.`,
+        Args: cobra.RangeArgs(1, 2),
+        RunE: func(cmd *cobra.Command, args []string) error {
+            dest := extractDir
+            if len(args) == 2 {
+                if dest != "" && dest != args[1] {
+                    return &internal.PackageError{
+                        Code:    47,
+                        Message: "Destination given both as argument and --output-dir",
+                        Type:    internal.TypeUnknown,
+                    }
+                }
+                dest = args[1]
+            }
+            if dest == "" {
+                return &internal.PackageError{
+                    Code:    47,
+                    Message: "No destination directory, pass it as argument or with --output-dir",
+                    Type:    internal.TypeUnknown,
+                }
+            }
+            internal.PreserveOwnership = !noPreserveOwner
+            return handleExtract(args[0], dest)
+        },
+    }
+    extractCmd.Flags().StringVarP(&extractDir, "output-dir", "o", "", "Directory to extract into")
+    extractCmd.Flags().BoolVar(&noPreserveOwner, "no-preserve-owner", false, "Do not restore file owners from the package when running as root")
+
+    // History command
+    historyCmd := &cobra.Command{
+        Use:   "history",
+        Short: "Show the log of install and remove operations",
+        Args:  cobra.NoArgs,
+        RunE: func(cmd *cobra.Command, args []string) error {
+            return handleHistory(installRoot, historyLimit, jsonOutput)
+        },
+    }
+    historyCmd.Flags().IntVar(&historyLimit, "limit", 20, "Number of entries to show (0 for all)")
+    historyCmd.Flags().BoolVar(&jsonOutput, "json", false, "Output in JSON format")
+    historyCmd.Flags().StringVar(&installRoot, "root", internal.DefaultInstallRoot, "Read history of an alternate root directory")
+
+    // Rollback command
+    rollbackCmd := &cobra.Command{
+        Use:   "rollback [backup]",
+        Short: "List package database backups or restore one",
+        Args:  cobra.MaximumNArgs(1),
+        RunE: func(cmd *cobra.Command, args []string) error {
+            return handleRollback(args, restoreDest)
+        },
+    }
+    rollbackCmd.Flags().StringVar(&restoreDest, "to", "", "Restore into this path instead of the backup's source")
+
+    // Clean command
+    cleanCmd := &cobra.Command{
+        Use:   "clean",
+        Short: "Remove stale cache and temp files, and old backups",
+        Args:  cobra.NoArgs,
+        RunE: func(cmd *cobra.Command, args []string) error {
+            return handleClean(cleanBackups, cleanAll, backupKeep, backupMaxAge, cleanOlderThan)
+        },
+    }
+    cleanCmd.Flags().BoolVar(&cleanAll, "all", false, "Remove everything from the cache and temp directories")
+    cleanCmd.Flags().DurationVar(&cleanOlderThan, "older-than", internal.CacheMaxAge, "Remove cache and temp files not modified for this long")
+    cleanCmd.Flags().BoolVar(&cleanBackups, "backups", false, "Also prune package database backups")
+    cleanCmd.Flags().IntVar(&backupKeep, "keep", internal.BackupKeep, "Backups to keep per source (0 for no limit)")
+    cleanCmd.Flags().DurationVar(&backupMaxAge, "max-age", internal.BackupMaxAge, "Remove backups older than this (0 to disable)")
+
+    // Doctor command
+    doctorCmd := &cobra.Command{
+        Use:   "doctor",
+        Short: "Diagnose the environment and available package backends",
+        Args:  cobra.NoArgs,
+        RunE: func(cmd *cobra.Command, args []string) error {
+            return handleDoctor()
+        },
+    }
+
+    // Convert command
+    convertCmd := &cobra.Command{
+        Use:   "convert [path]",
+        Short: "Convert a package to another format",
         Args:  cobra.ExactArgs(1),
         RunE: func(cmd *cobra.Command, args []string) error {
-            return handleInfo(args[0])
+            return handleConvert(cmd.Context(), args[0], convertTarget, outputDir)
+        },
+    }
+    convertCmd.Flags().StringVar(&convertTarget, "to", "", "Target package format (apk)")
+    convertCmd.Flags().StringVarP(&outputDir, "out-dir", "o", ".", "Directory for the converted package")
+    convertCmd.MarkFlagRequired("to")
+
+    // Repack command
+    repackCmd := &cobra.Command{
+        Use:   "repack [path]",
+        Short: "Rebuild a package with modified metadata",
+        Long: `Rebuild a deb, pacman or apk package with edited metadata without
+rebuilding its contents. Dependencies and --set fields use the package's
+own syntax (e.g. "libfoo (>= 1.2)" for deb, "libfoo>=1.2" for pacman);
+an empty --set value removes the field. Signatures are dropped.`,
+        Args: cobra.ExactArgs(1),
+        RunE: func(cmd *cobra.Command, args []string) error {
+            changes, err := repackChanges(repackVersion, repackDepends, repackFields)
+            if err != nil {
+                return &internal.PackageError{
+                    Code:     42,
+                    Message:  "Invalid metadata change",
+                    Type:     internal.TypeUnknown,
+                    Original: err,
+                }
+            }
+            return handleRepack(args[0], repackOut, changes)
         },
     }
+    repackCmd.Flags().StringVarP(&repackOut, "out", "o", "", "Path of the repacked package")
+    repackCmd.Flags().StringVar(&repackVersion, "set-version", "", "New package version")
+    repackCmd.Flags().StringArrayVar(&repackDepends, "add-depend", nil, "Dependency to add (repeatable)")
+    repackCmd.Flags().StringArrayVar(&repackFields, "set", nil, "Set a metadata field as KEY=VALUE (repeatable)")
+    repackCmd.MarkFlagRequired("out")
 
     rootCmd.PersistentFlags().BoolVarP(&verbose, "verbose", "v", false, "Enable verbose output")
-    rootCmd.AddCommand(installCmd, removeCmd, infoCmd)
+    rootCmd.PersistentFlags().BoolVarP(&quiet, "quiet", "q", false, "Only log errors")
+    rootCmd.PersistentFlags().StringVar(&logLevel, "log-level", "", "Log level (trace, debug, info, warn, error); overrides --verbose and --quiet")
+    rootCmd.PersistentFlags().BoolVar(&logJSON, "log-json", false, "Write logs as JSON")
+    rootCmd.PersistentFlags().BoolVar(&preserveLocale, "preserve-locale", false, "Run package managers in the user's locale instead of forcing LANG=C")
+    rootCmd.PersistentFlags().BoolVar(&noCache, "no-cache", false, "Read package metadata without the cache in "+internal.CacheDir)
+
+    // Completion command, replacing cobra's default one
+    completionCmd := &cobra.Command{
+        Use:   "completion [bash|zsh|fish|powershell]",
+        Short: "Generate a shell completion script",
+        Long: `Generate a shell completion script and print it to stdout.
+
+  bash:        source <(upkgt completion bash)
+  zsh:         upkgt completion zsh > "${fpath[1]}/_upkgt"
+  fish:        upkgt completion fish > ~/.config/fish/completions/upkgt.fish
+  powershell:  upkgt completion powershell | Out-String | Invoke-Expression`,
+        ValidArgs:             []string{"bash", "zsh", "fish", "powershell"},
+        Args:                  cobra.MatchAll(cobra.ExactArgs(1), cobra.OnlyValidArgs),
+        DisableFlagsInUseLine: true,
+        RunE: func(cmd *cobra.Command, args []string) error {
+            return handleCompletion(cmd.Root(), args[0])
+        },
+    }
+    rootCmd.CompletionOptions.DisableDefaultCmd = true
 
-    if err := rootCmd.Execute(); err != nil {
-        logger.Errorf("Error: %v", err)
-        os.Exit(1)
+    for _, cmd := range []*cobra.Command{installCmd, upgradeCmd, infoCmd, filesCmd, sizeCmd, depsCmd, validateCmd, verifyCmd, changelogCmd, diffCmd, convertCmd, repackCmd} {
+        cmd.ValidArgsFunction = completePackageFiles
+    }
+    for _, cmd := range []*cobra.Command{removeCmd, isInstalledCmd, whyCmd} {
+        cmd.ValidArgsFunction = completeInstalledPackages
+    }
+    extractCmd.ValidArgsFunction = func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+        if len(args) == 1 {
+            return nil, cobra.ShellCompDirectiveFilterDirs
+        }
+        return completePackageFiles(cmd, args, toComplete)
+    }
+
+    rootCmd.AddCommand(installCmd, upgradeCmd, downloadCmd, removeCmd, infoCmd, listCmd, searchCmd, isInstalledCmd, whyCmd, filesCmd, sizeCmd, depsCmd, validateCmd, verifyCmd, changelogCmd, diffCmd, extractCmd, convertCmd, repackCmd, historyCmd, rollbackCmd, cleanCmd, doctorCmd, completionCmd)
+
+    // Cancel running backends on Ctrl-C or SIGTERM so deferred cleanup runs
+    ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+    err := rootCmd.ExecuteContext(ctx)
+    stop()
+    if err != nil {
+        if err != errNotInstalled {
+            logger.Errorf("Error: %v", err)
+        }
+        os.Exit(exitCode(err))
     }
 
     if verbose {
@@ -0,0 +1,269 @@
+package main
+
+import (
+    "bytes"
+    "context"
+    "encoding/json"
+    "errors"
+    "fmt"
+    "os"
+    "os/exec"
+    "path/filepath"
+    "reflect"
+    "strings"
+    "testing"
+
+    "github.com/NurOS-Linux/upkgt/internal"
+    "github.com/spf13/cobra"
+)
+
+func TestMain(m *testing.M) {
+    // runUpkgt re-executes the test binary with UPKGT_TEST_ARGS set to run
+    // the real CLI in a separate process
+    if args := os.Getenv("UPKGT_TEST_ARGS"); args != "" {
+        os.Args = append([]string{ProgramName}, strings.Split(args, "\n")...)
+        main()
+        os.Exit(0)
+    }
+    os.Exit(m.Run())
+}
+
+// runUpkgt runs the CLI with args and returns what it wrote to stdout
+// and stderr
+func runUpkgt(t *testing.T, args ...string) (string, string, error) {
+    t.Helper()
+    cmd := exec.Command(os.Args[0])
+    cmd.Env = append(os.Environ(), "UPKGT_TEST_ARGS="+strings.Join(args, "\n"))
+    var stdout, stderr bytes.Buffer
+    cmd.Stdout, cmd.Stderr = &stdout, &stderr
+    err := cmd.Run()
+    return stdout.String(), stderr.String(), err
+}
+
+// buildTestDeb builds hello_1.0-1_all.deb in a temporary directory
+func buildTestDeb(t *testing.T) string {
+    t.Helper()
+    dir := t.TempDir()
+    root := filepath.Join(dir, "root")
+    controlDir := filepath.Join(dir, "DEBIAN")
+    for _, d := range []string{filepath.Join(root, "usr", "bin"), controlDir} {
+        if err := os.MkdirAll(d, 0755); err != nil {
+            t.Fatal(err)
+        }
+    }
+    if err := os.WriteFile(filepath.Join(root, "usr", "bin", "hello"), []byte("#!/bin/sh\n"), 0755); err != nil {
+        t.Fatal(err)
+    }
+    control := "Package: hello\nVersion: 1.0-1\nArchitecture: all\nMaintainer: Test <test@example.com>\nDescription: test package\n"
+    if err := os.WriteFile(filepath.Join(controlDir, "control"), []byte(control), 0644); err != nil {
+        t.Fatal(err)
+    }
+
+    path := filepath.Join(dir, "hello.deb")
+    if err := internal.BuildDeb(root, controlDir, path); err != nil {
+        t.Fatalf("BuildDeb: %v", err)
+    }
+    return path
+}
+
+func TestInfoSeparatesOutputStreams(t *testing.T) {
+    deb := buildTestDeb(t)
+    dir := filepath.Dir(deb)
+    // Unreadable package: info --dir reports it in its entry and logs a warning
+    if err := os.WriteFile(filepath.Join(dir, "broken.deb"), []byte("!<arch>\ngarbage"), 0644); err != nil {
+        t.Fatal(err)
+    }
+
+    stdout, stderr, err := runUpkgt(t, "info", "--no-cache", "--dir", dir)
+    if err != nil {
+        t.Fatalf("upkgt info --dir: %v\n%s", err, stderr)
+    }
+
+    var entries []struct {
+        Name  string
+        Error string `json:"error"`
+    }
+    if err := json.Unmarshal([]byte(stdout), &entries); err != nil {
+        t.Fatalf("stdout is not JSON: %v\n%s", err, stdout)
+    }
+    if len(entries) != 2 {
+        t.Fatalf("got %d entries, want 2:\n%s", len(entries), stdout)
+    }
+    if !strings.Contains(stderr, "level=warning") || !strings.Contains(stderr, "Could not read 1 of 2 packages") {
+        t.Errorf("stderr has no warning:\n%s", stderr)
+    }
+
+    // Errors go to the log only
+    stdout, stderr, err = runUpkgt(t, "info", "--no-cache", filepath.Join(dir, "missing.deb"))
+    if err == nil {
+        t.Fatal("upkgt info of a missing file succeeded")
+    }
+    if stdout != "" {
+        t.Errorf("stdout = %q, want empty", stdout)
+    }
+    if !strings.Contains(stderr, "level=error") {
+        t.Errorf("stderr has no error log:\n%s", stderr)
+    }
+}
+
+// recordingRunner records the commands it is asked to run and finds only
+// the listed binaries
+type recordingRunner struct {
+    binaries map[string]bool
+    calls    [][]string
+}
+
+func (r *recordingRunner) Run(ctx context.Context, name string, args ...string) ([]byte, error) {
+    r.calls = append(r.calls, append([]string{name}, args...))
+    return nil, nil
+}
+
+func (r *recordingRunner) Output(ctx context.Context, name string, args ...string) ([]byte, error) {
+    return r.Run(ctx, name, args...)
+}
+
+func (r *recordingRunner) LookPath(name string) (string, error) {
+    if !r.binaries[name] {
+        return "", exec.ErrNotFound
+    }
+    return "/usr/bin/" + name, nil
+}
+
+func TestHandleInstallIntoAltRoot(t *testing.T) {
+    deb := buildTestDeb(t)
+    root := t.TempDir()
+    runner := &recordingRunner{binaries: map[string]bool{"dpkg": true}}
+    oldRunner := internal.CommandRunner
+    internal.CommandRunner = runner
+    t.Cleanup(func() { internal.CommandRunner = oldRunner })
+
+    // A writable alternative root needs no root privileges
+    if err := handleInstall(context.Background(), deb, internal.InstallOptions{Root: root, NoBackup: true}); err != nil {
+        t.Fatalf("handleInstall: %v", err)
+    }
+
+    want := [][]string{{"dpkg", "-i", "--root=" + root, deb}}
+    if !reflect.DeepEqual(runner.calls, want) {
+        t.Errorf("commands:\n got  %q\n want %q", runner.calls, want)
+    }
+
+    history, err := internal.ReadHistory(root, 0)
+    if err != nil {
+        t.Fatal(err)
+    }
+    if len(history) != 1 || history[0].Package != "hello" || history[0].Result != internal.ResultSuccess {
+        t.Errorf("history = %+v, want one successful install of hello", history)
+    }
+}
+
+func TestExitCode(t *testing.T) {
+    tests := []struct {
+        name string
+        err  error
+        want int
+    }{
+        {"plain error", errors.New("boom"), exitFailure},
+        {"lock held", fmt.Errorf("wrapped: %w", internal.ErrLocked), exitLocked},
+        {"unsupported format", &internal.PackageError{Code: 11}, exitInvalid},
+        {"essential package", &internal.PackageError{Code: 46}, exitProtected},
+        {"install failed", &internal.PackageError{Code: 5}, exitFailure},
+        {
+            "internal category wins",
+            &internal.PackageError{Code: 5, Original: internal.ErrNotSupported},
+            exitIncompatible,
+        },
+        {
+            "cancelled",
+            &internal.PackageError{Code: 5, Original: fmt.Errorf("installation cancelled: %w", context.Canceled)},
+            exitCancelled,
+        },
+        {"scan cancelled", &internal.PackageError{Code: 52}, exitCancelled},
+        {"not installed", errNotInstalled, exitFailure},
+    }
+
+    for _, tt := range tests {
+        if got := exitCode(tt.err); got != tt.want {
+            t.Errorf("%s: exitCode = %d, want %d", tt.name, got, tt.want)
+        }
+    }
+}
+
+// completionRunner answers every query with output; without output it
+// behaves as if no package manager were installed
+type completionRunner struct {
+    output []byte
+}
+
+func (r completionRunner) Run(ctx context.Context, name string, args ...string) ([]byte, error) {
+    return r.Output(ctx, name, args...)
+}
+
+func (r completionRunner) Output(ctx context.Context, name string, args ...string) ([]byte, error) {
+    if r.output == nil {
+        return nil, exec.ErrNotFound
+    }
+    return r.output, nil
+}
+
+func (r completionRunner) LookPath(name string) (string, error) {
+    if r.output == nil {
+        return "", exec.ErrNotFound
+    }
+    return "/usr/bin/" + name, nil
+}
+
+// useCompletionRunner installs runner and restores the previous runner and
+// --type after the test
+func useCompletionRunner(t *testing.T, runner completionRunner) {
+    oldRunner, oldType := internal.CommandRunner, backendType
+    internal.CommandRunner = runner
+    t.Cleanup(func() {
+        internal.CommandRunner, backendType = oldRunner, oldType
+    })
+}
+
+func TestCompleteInstalledPackages(t *testing.T) {
+    useCompletionRunner(t, completionRunner{output: []byte(
+        "ii \thello\t2.10-3\tamd64\t\t\t\t\t\t\n" +
+            "ii \thelp2man\t1.49\tamd64\t\t\t\t\t\t\n" +
+            "rc \theroes\t0.21-8\tamd64\t\t\t\t\t\t\n" +
+            "ii \tvim\t9.0\tamd64\t\t\t\t\t\t\n")})
+    backendType = "deb"
+
+    names, directive := completeInstalledPackages(&cobra.Command{}, nil, "he")
+    if !reflect.DeepEqual(names, []string{"hello", "help2man"}) || directive != cobra.ShellCompDirectiveNoFileComp {
+        t.Errorf("completion = %q, %v; want hello, help2man", names, directive)
+    }
+}
+
+func TestCompleteInstalledPackagesRPM(t *testing.T) {
+    useCompletionRunner(t, completionRunner{output: []byte(
+        "hello\t2.10-3\tx86_64\tgreeting program\n" +
+            "help2man\t1.49-1\tnoarch\tman page generator\n" +
+            "vim\t9.0-1\tx86_64\teditor\n")})
+    backendType = "rpm"
+
+    names, directive := completeInstalledPackages(&cobra.Command{}, nil, "he")
+    if !reflect.DeepEqual(names, []string{"hello", "help2man"}) || directive != cobra.ShellCompDirectiveNoFileComp {
+        t.Errorf("completion = %q, %v; want hello, help2man", names, directive)
+    }
+}
+
+func TestCompleteInstalledPackagesWithoutBackend(t *testing.T) {
+    useCompletionRunner(t, completionRunner{})
+
+    for _, typeName := range []string{"", "deb", "rpm"} {
+        backendType = typeName
+        names, directive := completeInstalledPackages(&cobra.Command{}, nil, "he")
+        if names != nil || directive != cobra.ShellCompDirectiveNoFileComp {
+            t.Errorf("--type %q: completion = %q, %v; want no suggestions", typeName, names, directive)
+        }
+    }
+}
+
+func TestHandleCompletionRejectsUnknownShell(t *testing.T) {
+    err := handleCompletion(&cobra.Command{Use: "upkgt"}, "tcsh")
+    if exitCode(err) != exitUsage {
+        t.Errorf("handleCompletion(tcsh) = %v, want a usage error", err)
+    }
+}
@@ -0,0 +1,115 @@
+// Package upkgt is the stable Go API of UPKGT.
+//
+// It covers opening package files of every supported format, reading
+// their metadata and comparing versions with the rules of each format.
+// Everything exported here follows semantic versioning: it is only
+// changed in a backwards-compatible way within a major version.
+//
+// The implementation lives in the module's internal package, which also
+// holds the CLI plumbing (backups, config, caches, command runners). That
+// package is not importable and may change at any time; if something you
+// need is only available there, open an issue instead of copying it.
+package upkgt
+
+import (
+    "github.com/NurOS-Linux/upkgt/internal"
+)
+
+// PackageType identifies a package format
+type PackageType = internal.PackageType
+
+// Supported package formats
+const (
+    TypeUnknown = internal.TypeUnknown
+    TypeDeb     = internal.TypeDeb
+    TypeRPM     = internal.TypeRPM
+    TypeEopkg   = internal.TypeEopkg
+    TypePacman  = internal.TypePacman
+    TypeAPK     = internal.TypeAPK
+)
+
+// Package is a package file (or an installed package) of any format
+type Package = internal.Package
+
+// PackageInfo holds package metadata as returned by Package.GetInfo
+type PackageInfo = internal.PackageInfo
+
+// FileInfo describes a single file listed by Package.ListFiles
+type FileInfo = internal.FileInfo
+
+// InstallOptions are the parameters of Package.Install
+type InstallOptions = internal.InstallOptions
+
+// RemoveOptions are the parameters of Package.Remove
+type RemoveOptions = internal.RemoveOptions
+
+// ProgressFunc receives the number of processed bytes and the total
+type ProgressFunc = internal.ProgressFunc
+
+// PackageError is the error type returned by package operations
+type PackageError = internal.PackageError
+
+// Errors returned when a package file cannot be used
+var (
+    ErrEmptyPackage     = internal.ErrEmptyPackage
+    ErrInvalidFormat    = internal.ErrInvalidFormat
+    ErrCorruptedPackage = internal.ErrCorruptedPackage
+    ErrNotSupported     = internal.ErrNotSupported
+    ErrUnsigned         = internal.ErrUnsigned
+    ErrReadOnly         = internal.ErrReadOnly
+)
+
+// VersionComparator compares versions of a single package format
+type VersionComparator = internal.VersionComparator
+
+// Version comparators of the supported formats
+type (
+    DebVersion    = internal.DebVersion
+    RPMVersion    = internal.RPMVersion
+    PacmanVersion = internal.PacmanVersion
+    APKVersion    = internal.APKVersion
+)
+
+// CreatePackageFromPath opens the package file at path, choosing the
+// format by its extension or, failing that, by its contents. Files of an
+// unknown format return ErrNotSupported
+func CreatePackageFromPath(path string) (Package, error) {
+    return internal.CreatePackageFromPath(path)
+}
+
+// OpenPackage opens the package file at path for inspection only. The
+// file is validated first, and Install and Remove of the returned package
+// always fail with ErrReadOnly. It never requires root and runs no
+// external commands; signatures are checked by Verify and VerifySignature
+func OpenPackage(path string) (Package, error) {
+    return internal.OpenPackage(path)
+}
+
+// ParsePackageType converts a format name such as "deb" or "rpm"
+// to a PackageType
+func ParsePackageType(name string) (PackageType, error) {
+    return internal.ParsePackageType(name)
+}
+
+// ComparatorFor returns the version comparator of a package format.
+// eopkg and unknown formats use the dpkg rules
+func ComparatorFor(pt PackageType) VersionComparator {
+    return internal.ComparatorFor(pt)
+}
+
+// CompareVersions compares two versions with the dpkg rules and
+// returns -1, 0 or 1
+func CompareVersions(v1, v2 string) int {
+    return internal.CompareVersions(v1, v2)
+}
+
+// CompareVersionsFor compares two versions with the rules of the given
+// package format and returns -1, 0 or 1
+func CompareVersionsFor(pt PackageType, v1, v2 string) int {
+    return internal.CompareVersionsFor(pt, v1, v2)
+}
+
+// FormatSize formats a size in bytes in binary units, e.g. "1.5 MiB"
+func FormatSize(size int64) string {
+    return internal.FormatSize(size)
+}